@@ -28,13 +28,32 @@ type Args interface {
 
 	// Next reads the next value from the argument list into dst, which must be
 	// a pointer.
+	//
+	// When dst points to a map, a struct, or a slice other than []byte, Next
+	// decodes the next value if it is an array, otherwise it consumes all the
+	// remaining values of the list, treating them as field/value pairs for maps
+	// and structs.
 	Next(dst interface{}) bool
 }
 
 // List creates an argument list from a sequence of values.
+//
+// Structs and maps are flattened into a sequence of field/value pairs, which
+// is the form expected by commands like HSET. Struct fields are named after
+// their `redis` tag, and the "omitempty" tag option skips fields that have an
+// empty value:
+//
+//	type User struct {
+//		Name  string `redis:"name"`
+//		Email string `redis:"email,omitempty"`
+//	}
+//
+//	client.Exec(ctx, "HSET", "user:42", User{Name: "Luke"})
 func List(args ...interface{}) Args {
-	list := make([]interface{}, len(args))
-	copy(list, args)
+	list := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		list = appendFields(list, arg)
+	}
 	return &argsList{
 		dec: objconv.StreamDecoder{
 			Parser: objconv.NewValueParser(list),
@@ -65,6 +84,9 @@ func String(args Args) (s string, err error) {
 
 // ParseArgs reads a list of arguments into a sequence of destination pointers
 // and closes it, returning any error that occurred while parsing the values.
+//
+// Destinations may be pointers to maps, structs or slices, see Args.Next for
+// details on how aggregate values are decoded.
 func ParseArgs(args Args, dsts ...interface{}) error {
 	if args == nil && len(dsts) != 0 {
 		return ErrNilArgs
@@ -117,6 +139,14 @@ func (m *multiArgs) Next(dst interface{}) bool {
 		return false
 	}
 
+	if isAggregate(dst) {
+		ok, err := decodeArgs(m, dst)
+		if err != nil && m.err == nil {
+			m.err = err
+		}
+		return ok && err == nil
+	}
+
 	for !m.args[m.argn].Next(dst) {
 		if err := m.args[m.argn].Close(); err != nil {
 			m.err = err
@@ -286,6 +316,14 @@ func (args *argsList) Next(val interface{}) bool {
 		return false
 	}
 
+	if isAggregate(val) {
+		ok, err := decodeArgs(args, val)
+		if err != nil && args.err == nil {
+			args.err = err
+		}
+		return ok && err == nil
+	}
+
 	if args.dec.Len() != 0 {
 		if t, _ := args.dec.Parser.ParseType(); t == objconv.Error {
 			args.dec.Decode(&args.err)
@@ -314,6 +352,11 @@ func (args *byteArgs) Next(dst interface{}) (ok bool) {
 	if len(args.args) == 0 || args.err != nil {
 		return false
 	}
+
+	if isAggregate(dst) {
+		ok, args.err = decodeArgs(args, dst)
+		return ok && args.err == nil
+	}
 	a := args.args[0]
 	args.args = args.args[1:]
 	args.err = args.next(reflect.ValueOf(dst), a)
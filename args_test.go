@@ -1,10 +1,15 @@
 package redis_test
 
 import (
+	"context"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/golib/assert"
 
 	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
 )
 
 func TestList(t *testing.T) {
@@ -36,6 +41,18 @@ func testArgs(t *testing.T, makeArgs makeArgsFunc) {
 			scenario: "read a list of values",
 			function: testArgsReadValues,
 		},
+		{
+			scenario: "read field/value pairs into a map",
+			function: testArgsReadMap,
+		},
+		{
+			scenario: "read field/value pairs into a struct",
+			function: testArgsReadStruct,
+		},
+		{
+			scenario: "read all remaining values into a slice",
+			function: testArgsReadSlice,
+		},
 	}
 
 	for _, test := range tests {
@@ -84,3 +101,238 @@ func testArgsReadValues(t *testing.T, makeArgs makeArgsFunc) {
 		t.Logf("found:    %#v", values)
 	}
 }
+
+type testUser struct {
+	Name   string `redis:"name"`
+	Age    int    `redis:"age"`
+	Admin  bool   `redis:"admin,omitempty"`
+	Secret string `redis:"-"`
+}
+
+type testStreamEntry struct {
+	_      struct{} `redis:",array"`
+	ID     string
+	Fields map[string]string
+}
+
+func testArgsReadMap(t *testing.T, makeArgs makeArgsFunc) {
+	it := assert.New(t)
+
+	var m map[string]int
+
+	err := redis.ParseArgs(makeArgs("a", "1", "b", "2"), &m)
+	if it.Nil(err) {
+		it.Equal(map[string]int{"a": 1, "b": 2}, m)
+	}
+}
+
+func testArgsReadStruct(t *testing.T, makeArgs makeArgsFunc) {
+	it := assert.New(t)
+
+	var u testUser
+
+	err := redis.ParseArgs(makeArgs("name", "Luke", "age", "42", "admin", "1", "unknown", "x"), &u)
+	if it.Nil(err) {
+		it.Equal(testUser{Name: "Luke", Age: 42, Admin: true}, u)
+	}
+}
+
+func testArgsReadSlice(t *testing.T, makeArgs makeArgsFunc) {
+	it := assert.New(t)
+
+	var (
+		first string
+		rest  []int
+	)
+
+	err := redis.ParseArgs(makeArgs("head", "1", "2", "3"), &first, &rest)
+	if it.Nil(err) {
+		it.Equal("head", first)
+		it.Equal([]int{1, 2, 3}, rest)
+	}
+}
+
+func TestArgsNested(t *testing.T) {
+	it := assert.New(t)
+
+	entries := []interface{}{
+		[]interface{}{"1-0", []interface{}{"a", "1"}},
+		[]interface{}{"2-0", []interface{}{"b", "2", "c", "3"}},
+	}
+
+	var list []testStreamEntry
+
+	if err := redis.ParseArgs(redis.List(entries...), &list); it.Nil(err) {
+		it.Equal([]testStreamEntry{
+			{ID: "1-0", Fields: map[string]string{"a": "1"}},
+			{ID: "2-0", Fields: map[string]string{"b": "2", "c": "3"}},
+		}, list)
+	}
+
+	var slices [][]string
+
+	if err := redis.ParseArgs(redis.List([]interface{}{"a", "b"}, []interface{}{"c"}), &slices); it.Nil(err) {
+		it.Equal([][]string{{"a", "b"}, {"c"}}, slices)
+	}
+
+	var entry testStreamEntry
+
+	args := redis.List(entries...)
+	if it.True(args.Next(&entry)) {
+		it.Equal("1-0", entry.ID)
+		it.Equal(1, args.Len())
+	}
+	it.Nil(args.Close())
+}
+
+func TestArgsTrailingSlice(t *testing.T) {
+	type entry struct {
+		_    struct{} `redis:",array"`
+		Name string
+		Tags []string
+	}
+
+	tests := []struct {
+		scenario string
+		values   []interface{}
+		entry    entry
+	}{
+		{
+			scenario: "the remaining values are collected",
+			values:   []interface{}{"a", "x", "y"},
+			entry:    entry{Name: "a", Tags: []string{"x", "y"}},
+		},
+		{
+			scenario: "a single remaining value is collected",
+			values:   []interface{}{"a", "x"},
+			entry:    entry{Name: "a", Tags: []string{"x"}},
+		},
+		{
+			scenario: "a nested list is decoded into the slice",
+			values:   []interface{}{"a", []interface{}{"x", "y"}},
+			entry:    entry{Name: "a", Tags: []string{"x", "y"}},
+		},
+		{
+			scenario: "the slice is left empty without remaining values",
+			values:   []interface{}{"a"},
+			entry:    entry{Name: "a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			it := assert.New(t)
+
+			var e entry
+			if err := redis.ParseArgs(redis.List(test.values), &e); it.Nil(err) {
+				it.Equal(test.entry, e)
+			}
+		})
+	}
+}
+
+func TestArgsNestedNil(t *testing.T) {
+	it := assert.New(t)
+
+	type entry struct {
+		_     struct{} `redis:",array"`
+		ID    string
+		Value *string
+		Count *int
+	}
+
+	one := 1
+	list := []entry{{ID: "stale", Count: &one}}
+
+	if err := redis.ParseArgs(redis.List([]interface{}{"1-0", nil, "2"}, []interface{}{"2-0", "a", nil}), &list); it.Nil(err) {
+		if it.Equal(2, len(list)) {
+			it.Nil(list[0].Value)
+			it.Equal(2, *list[0].Count)
+			it.Equal("a", *list[1].Value)
+			it.Nil(list[1].Count)
+		}
+	}
+
+	var m map[string]*string
+
+	if err := redis.ParseArgs(redis.List("a", nil), &m); it.Nil(err) {
+		value, ok := m["a"]
+		it.True(ok)
+		it.Nil(value)
+	}
+}
+
+func TestArgsNestedMismatch(t *testing.T) {
+	it := assert.New(t)
+
+	var m map[string]string
+
+	it.NotNil(redis.ParseArgs(redis.List("a", "1", "b"), &m))
+}
+
+func TestListFlattensStructs(t *testing.T) {
+	it := assert.New(t)
+
+	args := redis.List("user:42", testUser{Name: "Luke", Age: 42, Secret: "x"})
+	it.Equal(5, args.Len())
+
+	var values []string
+	if it.Nil(redis.ParseArgs(args, &values)) {
+		it.Equal([]string{"user:42", "name", "Luke", "age", "42"}, values)
+	}
+
+	args = redis.List(map[string]int{"b": 2, "a": 1})
+	if it.Nil(redis.ParseArgs(args, &values)) {
+		it.Equal([]string{"a", "1", "b", "2"}, values)
+	}
+}
+
+func TestArgsDecodeReplies(t *testing.T) {
+	it := assert.New(t)
+
+	srv, addr := redistest.FakeServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		switch req.Cmds[0].Cmd {
+		case "HSET":
+			var (
+				key  string
+				user testUser
+			)
+			if err := req.Cmds[0].ParseArgs(&key, &user); err != nil {
+				res.Write(err)
+				return
+			}
+			res.Write(2)
+
+		case "HGETALL":
+			res.Write([]interface{}{"name", "Luke", "age", "42"})
+
+		case "XRANGE":
+			res.Write([]interface{}{
+				[]interface{}{"1-0", []interface{}{"a", "1"}},
+				[]interface{}{"2-0", []interface{}{"b", "2"}},
+			})
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr, Timeout: time.Second}
+	ctx := context.Background()
+
+	it.Nil(client.Exec(ctx, "HSET", "user:42", testUser{Name: "Luke", Age: 42}))
+
+	var user testUser
+	if it.Nil(redis.ParseArgs(client.Query(ctx, "HGETALL", "user:42"), &user)) {
+		it.Equal(testUser{Name: "Luke", Age: 42}, user)
+	}
+
+	var entries []testStreamEntry
+	if it.Nil(redis.ParseArgs(client.Query(ctx, "XRANGE", "stream", "-", "+"), &entries)) {
+		it.Equal([]testStreamEntry{
+			{ID: "1-0", Fields: map[string]string{"a": "1"}},
+			{ID: "2-0", Fields: map[string]string{"b": "2"}},
+		}, entries)
+	}
+}
@@ -0,0 +1,203 @@
+package redis
+
+import (
+	"context"
+	"sync"
+)
+
+// A KeyNotifier coordinates the handlers of blocking commands waiting for keys
+// to become ready, for example a BLPOP handler waiting for a list to receive
+// elements.
+//
+// Values are handed over to the waiters in the order they started waiting,
+// like the redis server serves blocked clients. A typical handler registers a
+// waiter before checking its data store, so no value can be missed in between:
+//
+//	w := notifier.Watch(keys...)
+//	defer w.Stop()
+//
+//	if key, v, ok := store.Pop(keys...); ok {
+//		res.Write([]interface{}{key, v})
+//		return
+//	}
+//
+//	key, v, err := w.Wait(req.Context)
+//	...
+//
+// while handlers of commands adding data first try to hand the values over to
+// waiters, and only store the values that no waiter took:
+//
+//	for _, v := range values {
+//		if !notifier.Notify(key, v) {
+//			store.Push(key, v)
+//		}
+//	}
+//
+// The zero value of KeyNotifier is ready to use, KeyNotifiers are safe for
+// concurrent use by multiple goroutines.
+type KeyNotifier struct {
+	// Undelivered is called with the values that were handed over to waiters
+	// which stopped before receiving them, when no other waiter could take
+	// them. Handlers typically put the values back in their data store.
+	Undelivered func(key string, value interface{})
+
+	mutex   sync.Mutex
+	waiters map[string][]*KeyWaiter
+}
+
+// A KeyWaiter represents a handler waiting for keys to become ready, it is
+// created by calling KeyNotifier.Watch.
+type KeyWaiter struct {
+	notifier *KeyNotifier
+	keys     []string
+	ready    chan keyValue
+	held     bool // a value was handed over since the last call to Wait
+	stopped  bool
+}
+
+type keyValue struct {
+	key   string
+	value interface{}
+}
+
+// Watch registers a waiter for the given keys. The waiter keeps its position
+// in the queues of the keys until its Stop method is called.
+func (n *KeyNotifier) Watch(keys ...string) *KeyWaiter {
+	w := &KeyWaiter{
+		notifier: n,
+		keys:     keys,
+		ready:    make(chan keyValue, 1),
+	}
+
+	n.mutex.Lock()
+
+	if n.waiters == nil {
+		n.waiters = make(map[string][]*KeyWaiter)
+	}
+
+	for _, key := range keys {
+		n.waiters[key] = append(n.waiters[key], w)
+	}
+
+	n.mutex.Unlock()
+	return w
+}
+
+// Notify hands value over to the oldest waiter of key which doesn't hold a
+// value already. The method returns false if there were no waiters to take the
+// value, in which case the caller keeps ownership of the value.
+func (n *KeyNotifier) Notify(key string, value interface{}) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.notify(key, value)
+}
+
+// NotifyAll hands value over to all the waiters of key which don't hold a
+// value already, returning how many did. It is useful when waiters don't
+// consume the data, like XREAD readers.
+func (n *KeyNotifier) NotifyAll(key string, value interface{}) int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	count := 0
+
+	for n.notify(key, value) {
+		count++
+	}
+
+	return count
+}
+
+// Len returns the number of waiters of key.
+func (n *KeyNotifier) Len(key string) int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return len(n.waiters[key])
+}
+
+func (n *KeyNotifier) notify(key string, value interface{}) bool {
+	for _, w := range n.waiters[key] {
+		if !w.held {
+			w.held = true
+			w.ready <- keyValue{key: key, value: value}
+			return true
+		}
+	}
+	return false
+}
+
+// Wait blocks until a value is handed over to the waiter, returning the key
+// and the value, or until ctx is canceled, returning the context error.
+//
+// Wait may be called again after receiving a value, the waiter keeps its
+// position in the queues of its keys.
+func (w *KeyWaiter) Wait(ctx context.Context) (key string, value interface{}, err error) {
+	n := w.notifier
+	n.mutex.Lock()
+
+	// The waiter can take a new value once the previous one was received.
+	if w.held && len(w.ready) == 0 {
+		w.held = false
+	}
+
+	n.mutex.Unlock()
+
+	select {
+	case kv := <-w.ready:
+		return kv.key, kv.value, nil
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
+}
+
+// Stop removes the waiter from the queues of its keys. A value which was handed
+// over to the waiter but not received is passed on to the next waiter of the
+// key, or to the notifier's Undelivered function.
+func (w *KeyWaiter) Stop() {
+	n := w.notifier
+	n.mutex.Lock()
+
+	if w.stopped {
+		n.mutex.Unlock()
+		return
+	}
+	w.stopped = true
+
+	for _, key := range w.keys {
+		waiters := n.waiters[key]
+
+		for i, x := range waiters {
+			if x == w {
+				copy(waiters[i:], waiters[i+1:])
+				waiters[len(waiters)-1] = nil
+				waiters = waiters[:len(waiters)-1]
+				break
+			}
+		}
+
+		if len(waiters) == 0 {
+			delete(n.waiters, key)
+		} else {
+			n.waiters[key] = waiters
+		}
+	}
+
+	var (
+		kv          keyValue
+		undelivered bool
+	)
+
+	select {
+	case kv = <-w.ready:
+		undelivered = !n.notify(kv.key, kv.value)
+	default:
+	}
+
+	n.mutex.Unlock()
+
+	if undelivered && n.Undelivered != nil {
+		n.Undelivered(kv.key, kv.value)
+	}
+}
@@ -0,0 +1,396 @@
+package redis_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	"github.com/dolab/redis-go"
+)
+
+func TestKeyNotifier(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context)
+	}{
+		{
+			scenario: "waiters are notified in the order they started waiting",
+			function: testKeyNotifierFIFO,
+		},
+		{
+			scenario: "notifying a key without waiters returns false",
+			function: testKeyNotifierNoWaiters,
+		},
+		{
+			scenario: "a waiter watching multiple keys is notified once",
+			function: testKeyNotifierMultipleKeys,
+		},
+		{
+			scenario: "stopping a notified waiter passes the notification on",
+			function: testKeyNotifierStopPassesNotification,
+		},
+		{
+			scenario: "values that no waiter received are reported as undelivered",
+			function: testKeyNotifierUndelivered,
+		},
+		{
+			scenario: "waiting returns the context error when it is canceled",
+			function: testKeyNotifierCancel,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			testFunc(t, ctx)
+		})
+	}
+}
+
+func testKeyNotifierFIFO(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	n := &redis.KeyNotifier{}
+	w1 := n.Watch("a")
+	w2 := n.Watch("a")
+	defer w1.Stop()
+	defer w2.Stop()
+
+	it.True(n.Notify("a", 1))
+
+	key, value, err := w1.Wait(ctx)
+	it.Nil(err)
+	it.Equal("a", key)
+	it.Equal(1, value)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	_, _, err = w2.Wait(timeout)
+	it.Equal(context.DeadlineExceeded, err)
+
+	// w1 doesn't take values until it waits again
+	it.Equal(1, n.NotifyAll("a", nil))
+}
+
+func testKeyNotifierNoWaiters(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	n := &redis.KeyNotifier{}
+	it.False(n.Notify("a", 1))
+
+	w := n.Watch("a")
+	w.Stop()
+
+	it.False(n.Notify("a", 1))
+	it.Equal(0, n.Len("a"))
+}
+
+func testKeyNotifierMultipleKeys(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	n := &redis.KeyNotifier{}
+	w1 := n.Watch("a", "b")
+	w2 := n.Watch("b")
+	defer w1.Stop()
+	defer w2.Stop()
+
+	it.True(n.Notify("a", 1))
+	it.True(n.Notify("b", 2)) // w1 holds a value already, w2 gets it
+
+	key, value, err := w1.Wait(ctx)
+	it.Nil(err)
+	it.Equal("a", key)
+	it.Equal(1, value)
+
+	key, value, err = w2.Wait(ctx)
+	it.Nil(err)
+	it.Equal("b", key)
+	it.Equal(2, value)
+}
+
+func testKeyNotifierStopPassesNotification(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	n := &redis.KeyNotifier{}
+	w1 := n.Watch("a")
+	w2 := n.Watch("a")
+	defer w2.Stop()
+
+	it.True(n.Notify("a", 1))
+	w1.Stop()
+
+	key, value, err := w2.Wait(ctx)
+	it.Nil(err)
+	it.Equal("a", key)
+	it.Equal(1, value)
+	it.Equal(1, n.Len("a"))
+}
+
+func testKeyNotifierUndelivered(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	var undelivered []interface{}
+
+	n := &redis.KeyNotifier{
+		Undelivered: func(key string, value interface{}) {
+			undelivered = append(undelivered, key, value)
+		},
+	}
+
+	w := n.Watch("a")
+	it.True(n.Notify("a", 1))
+	w.Stop()
+
+	it.Equal([]interface{}{"a", 1}, undelivered)
+}
+
+func testKeyNotifierCancel(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	n := &redis.KeyNotifier{}
+	w := n.Watch("a")
+	defer w.Stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	_, _, err := w.Wait(ctx)
+	it.Equal(context.Canceled, err)
+}
+
+// blockingListHandler serves BLPOP and RPUSH on in-memory lists.
+type blockingListHandler struct {
+	mutex    sync.Mutex
+	lists    map[string][]string
+	notifier redis.KeyNotifier
+	blocked  chan struct{}
+	canceled chan error
+}
+
+func (h *blockingListHandler) ServeRedis(res redis.ResponseWriter, req *redis.Request) {
+	var args []string
+	req.Cmds[0].ParseArgs(&args)
+
+	switch req.Cmds[0].Cmd {
+	case "RPUSH":
+		h.mutex.Lock()
+		for _, v := range args[1:] {
+			if !h.notifier.Notify(args[0], v) {
+				h.lists[args[0]] = append(h.lists[args[0]], v)
+			}
+		}
+		h.mutex.Unlock()
+		res.Write(len(args) - 1)
+
+	case "BLPOP":
+		keys := args[:len(args)-1]
+
+		w := h.notifier.Watch(keys...)
+		defer w.Stop()
+
+		h.mutex.Lock()
+		for _, key := range keys {
+			if list := h.lists[key]; len(list) != 0 {
+				h.lists[key] = list[1:]
+				h.mutex.Unlock()
+				res.Write([]string{key, list[0]})
+				return
+			}
+		}
+		h.mutex.Unlock()
+
+		if h.blocked != nil {
+			h.blocked <- struct{}{}
+		}
+
+		key, value, err := w.Wait(req.Context)
+		if err != nil {
+			if h.canceled != nil {
+				h.canceled <- err
+			}
+			res.Write(nil)
+			return
+		}
+		res.Write([]interface{}{key, value})
+
+	case "LONGPOLL":
+		deadline, _ := req.Context.Deadline()
+		res.Write(deadline.Format(time.RFC3339Nano))
+
+	case "BRPOP":
+		if _, ok := req.Context.Deadline(); ok {
+			res.Write(1)
+		} else {
+			res.Write(0)
+		}
+	}
+}
+
+func newBlockingServer(handler redis.Handler) (*redis.Server, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	srv := &redis.Server{
+		Handler:     handler,
+		ReadTimeout: 50 * time.Millisecond,
+		CommandTimeouts: map[string]time.Duration{
+			"LONGPOLL": time.Hour,
+		},
+	}
+
+	go srv.Serve(l)
+	return srv, l.Addr().String()
+}
+
+func TestServerBlockingCommands(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context)
+	}{
+		{
+			scenario: "blocked clients are served in the order they blocked",
+			function: testServerBlockingFIFO,
+		},
+		{
+			scenario: "blocked handlers are canceled when the client disconnects",
+			function: testServerBlockingClientDisconnect,
+		},
+		{
+			scenario: "blocking commands are not bound to the read timeout",
+			function: testServerBlockingNoDeadline,
+		},
+		{
+			scenario: "command timeouts override the read timeout",
+			function: testServerBlockingCommandTimeout,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			testFunc(t, ctx)
+		})
+	}
+}
+
+func testServerBlockingFIFO(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	handler := &blockingListHandler{
+		lists:   map[string][]string{},
+		blocked: make(chan struct{}),
+	}
+
+	srv, addr := newBlockingServer(handler)
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr}
+
+	results := make([]chan []string, 3)
+
+	for i := range results {
+		results[i] = make(chan []string, 1)
+
+		go func(res chan<- []string) {
+			var values []string
+			redis.ParseArgs(client.Query(ctx, "BLPOP", "list", 0), &values)
+			res <- values
+		}(results[i])
+
+		// waits for the client to be blocked before starting the next one
+		<-handler.blocked
+	}
+
+	it.Nil(client.Exec(ctx, "RPUSH", "list", "a", "b", "c"))
+
+	it.Equal([]string{"list", "a"}, <-results[0])
+	it.Equal([]string{"list", "b"}, <-results[1])
+	it.Equal([]string{"list", "c"}, <-results[2])
+}
+
+func testServerBlockingClientDisconnect(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	handler := &blockingListHandler{
+		lists:    map[string][]string{},
+		blocked:  make(chan struct{}, 1),
+		canceled: make(chan error, 1),
+	}
+
+	srv, addr := newBlockingServer(handler)
+	defer srv.Close()
+
+	conn, err := redis.DialContext(ctx, "tcp", addr)
+	if !it.Nil(err) {
+		return
+	}
+
+	it.Nil(conn.WriteCommands(redis.Command{Cmd: "BLPOP", Args: redis.List("list", 0)}))
+
+	select {
+	case <-handler.blocked:
+	case <-ctx.Done():
+		t.Fatal("the handler never blocked")
+	}
+
+	conn.Close()
+
+	select {
+	case err := <-handler.canceled:
+		it.Equal(context.Canceled, err)
+	case <-ctx.Done():
+		t.Fatal("the handler was not canceled")
+	}
+
+	it.Equal(0, handler.notifier.Len("list"))
+}
+
+func testServerBlockingNoDeadline(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr := newBlockingServer(&blockingListHandler{})
+	defer srv.Close()
+
+	client := &redis.Client{Addr: addr, Transport: &redis.Transport{}}
+
+	hasDeadline, err := redis.Int(client.Query(ctx, "BRPOP", "list", 0))
+	it.Nil(err)
+	it.Equal(0, hasDeadline)
+}
+
+func testServerBlockingCommandTimeout(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr := newBlockingServer(&blockingListHandler{})
+	defer srv.Close()
+
+	client := &redis.Client{Addr: addr, Transport: &redis.Transport{}}
+
+	s, err := redis.String(client.Query(ctx, "LONGPOLL"))
+	if it.Nil(err) {
+		deadline, err := time.Parse(time.RFC3339Nano, s)
+		if it.Nil(err) {
+			it.True(time.Until(deadline) > time.Minute)
+		}
+	}
+}
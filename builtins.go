@@ -0,0 +1,876 @@
+package redis
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverVersion is the version of redis that servers report to clients.
+const serverVersion = "6.2.0"
+
+// builtinCommands is the list of commands answered by servers instead of their
+// handlers, in addition to AUTH when the authentication is enabled,
+// optionalBuiltinCommands the ones answered only if EnableBuiltins is set, and
+// pubsubCommands the ones answered only if the server has a PubSub broker.
+var (
+	builtinCommands         = []string{"PING"}
+	optionalBuiltinCommands = []string{"CLIENT", "COMMAND", "CONFIG", "HELLO", "INFO", "LATENCY", "MONITOR", "SLOWLOG"}
+	pubsubCommands          = []string{"PSUBSCRIBE", "PUBLISH", "PUBSUB", "PUNSUBSCRIBE", "SUBSCRIBE", "UNSUBSCRIBE"}
+)
+
+// builtin returns the function answering the built-in command name, or nil if
+// name is not a built-in command of the server.
+func (s *Server) builtin(name string) func(*Conn, Command) interface{} {
+	switch strings.ToUpper(name) {
+	case "PING":
+		return s.ping
+	}
+
+	if s.PubSub != nil {
+		switch strings.ToUpper(name) {
+		case "PUBLISH":
+			return s.publish
+		case "PUBSUB":
+			return s.pubsubCommand
+		case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+			// Connections switch to Pub/Sub mode on requests made of a single
+			// subscription, see serveSubscriber.
+			return func(c *Conn, cmd Command) interface{} {
+				cmd.ParseArgs()
+				return errorf("ERR %s isn't allowed in transactions", strings.ToLower(cmd.Cmd))
+			}
+		}
+	}
+
+	if !s.EnableBuiltins {
+		return nil
+	}
+
+	switch strings.ToUpper(name) {
+	case "CLIENT":
+		return s.client
+	case "COMMAND":
+		return s.command
+	case "CONFIG":
+		return s.configCommand
+	case "HELLO":
+		return s.hello
+	case "INFO":
+		return s.info
+	case "LATENCY":
+		return s.latencyCommand
+	case "MONITOR":
+		return s.monitor
+	case "SLOWLOG":
+		return s.slowlogCommand
+	}
+	return nil
+}
+
+func (s *Server) ping(c *Conn, cmd Command) interface{} {
+	msg := "PONG"
+	cmd.ParseArgs(&msg)
+	return msg
+}
+
+// hello answers HELLO [protover [AUTH user password] [SETNAME name]]. With the
+// version 3 of the protocol the client receives the invalidation messages of
+// CLIENT TRACKING as push messages, the replies are still encoded with the
+// types of RESP2, which RESP3 clients can read.
+func (s *Server) hello(c *Conn, cmd Command) interface{} {
+	var args []string
+
+	if err := cmd.ParseArgs(&args); err != nil {
+		return err
+	}
+
+	proto := 2
+	if c.resp3 {
+		proto = 3
+	}
+
+	if len(args) != 0 {
+		var err error
+
+		if proto, err = strconv.Atoi(args[0]); err != nil {
+			return errorf("ERR Protocol version is not an integer or out of range")
+		}
+
+		if proto != 2 && proto != 3 {
+			return errorf("NOPROTO unsupported protocol version")
+		}
+
+		args = args[1:]
+	}
+
+	var name *string
+
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				return errorf("ERR Syntax error in HELLO option 'auth'")
+			}
+
+			if s.Authenticate == nil {
+				return errorf("ERR AUTH called without any password configured for the default user.")
+			}
+
+			if err := s.login(c, args[i+1], args[i+2]); err != nil {
+				return err
+			}
+
+			i += 2
+
+		case "SETNAME":
+			if i+1 >= len(args) {
+				return errorf("ERR Syntax error in HELLO option 'setname'")
+			}
+
+			i++
+			name = &args[i]
+
+		default:
+			return errorf("ERR Syntax error in HELLO option '%s'", args[i])
+		}
+	}
+
+	if s.Authenticate != nil && len(c.user) == 0 {
+		return errorf("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+
+	if name != nil {
+		if err := c.setName(*name); err != nil {
+			return err
+		}
+	}
+
+	c.resp3 = proto == 3
+
+	return []interface{}{
+		"server", "redis",
+		"version", serverVersion,
+		"proto", int64(proto),
+		"id", int64(c.clientID()),
+		"mode", "standalone",
+		"role", "master",
+		"modules", []interface{}{},
+	}
+}
+
+// InfoField is a field of a section of the reply to INFO, the value is
+// formatted with fmt.Sprint.
+type InfoField struct {
+	Name  string
+	Value interface{}
+}
+
+// An InfoFunc returns the fields of a section of the reply to INFO, in order.
+type InfoFunc func() []InfoField
+
+type infoSection struct {
+	name string
+	fn   InfoFunc
+}
+
+// HandleInfo registers fn to contribute the fields of section to the reply of
+// INFO. Sections are reported in the order of their registration, after the
+// server, clients and stats sections, and before the keyspace section. The
+// built-in sections (server, clients, stats, commandstats and keyspace) are
+// replaced by the functions registered with their names, the keyspace section
+// is empty unless a function is registered for it.
+func (s *Server) HandleInfo(section string, fn InfoFunc) {
+	section = strings.ToLower(section)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, info := range s.infos {
+		if info.name == section {
+			s.infos[i].fn = fn
+			return
+		}
+	}
+
+	s.infos = append(s.infos, infoSection{name: section, fn: fn})
+}
+
+// info answers INFO [section ...].
+func (s *Server) info(c *Conn, cmd Command) interface{} {
+	var args []string
+
+	if err := cmd.ParseArgs(&args); err != nil {
+		return err
+	}
+
+	var (
+		all      bool
+		defaults = len(args) == 0
+		selected = map[string]bool{}
+	)
+
+	for _, arg := range args {
+		switch arg = strings.ToLower(arg); arg {
+		case "all", "everything":
+			all = true
+		case "default":
+			defaults = true
+		default:
+			selected[arg] = true
+		}
+	}
+
+	sections := s.infoSections()
+
+	var buf bytes.Buffer
+
+	for _, section := range sections {
+		if all || selected[section.name] || (defaults && section.name != "commandstats") {
+			if buf.Len() != 0 {
+				buf.WriteString("\r\n")
+			}
+
+			buf.WriteString("# ")
+			buf.WriteString(strings.ToUpper(section.name[:1]) + section.name[1:])
+			buf.WriteString("\r\n")
+
+			for _, f := range section.fn() {
+				fmt.Fprintf(&buf, "%s:%v\r\n", f.Name, f.Value)
+			}
+		}
+	}
+
+	return buf.String()
+}
+
+// infoSections returns the sections of the reply to INFO in order.
+func (s *Server) infoSections() []infoSection {
+	sections := []infoSection{
+		{name: "server", fn: s.infoServer},
+		{name: "clients", fn: s.infoClients},
+		{name: "stats", fn: s.infoStats},
+	}
+
+	s.mutex.Lock()
+	registered := append([]infoSection(nil), s.infos...)
+	s.mutex.Unlock()
+
+	keyspace := infoSection{name: "keyspace", fn: func() []InfoField { return nil }}
+	commandstats := infoSection{name: "commandstats", fn: s.infoCommandStats}
+
+	for _, r := range registered {
+		switch r.name {
+		case "server":
+			sections[0] = r
+		case "clients":
+			sections[1] = r
+		case "stats":
+			sections[2] = r
+		case "commandstats":
+			commandstats = r
+		case "keyspace":
+			keyspace = r
+		default:
+			sections = append(sections, r)
+		}
+	}
+
+	return append(sections, commandstats, keyspace)
+}
+
+func (s *Server) infoServer() []InfoField {
+	s.mutex.Lock()
+	startedAt, runID := s.startedAt, s.runID
+	s.mutex.Unlock()
+
+	uptime := time.Since(startedAt)
+
+	return []InfoField{
+		{"redis_version", serverVersion},
+		{"redis_mode", "standalone"},
+		{"os", runtime.GOOS + " " + runtime.GOARCH},
+		{"arch_bits", strconv.IntSize},
+		{"go_version", runtime.Version()},
+		{"process_id", os.Getpid()},
+		{"run_id", runID},
+		{"uptime_in_seconds", int64(uptime / time.Second)},
+		{"uptime_in_days", int64(uptime / (24 * time.Hour))},
+	}
+}
+
+func (s *Server) infoClients() []InfoField {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return []InfoField{
+		{"connected_clients", len(s.connections)},
+		{"maxclients", s.MaxConns},
+	}
+}
+
+func (s *Server) infoStats() []InfoField {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return []InfoField{
+		{"total_connections_received", s.stats.connections},
+		{"total_commands_processed", s.stats.commands},
+		{"rejected_connections", s.stats.rejected},
+	}
+}
+
+func (s *Server) infoCommandStats() []InfoField {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	names := make([]string, 0, len(s.stats.cmds))
+	for name := range s.stats.cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]InfoField, len(names))
+
+	for i, name := range names {
+		st := s.stats.cmds[name]
+		fields[i] = InfoField{
+			Name:  "cmdstat_" + name,
+			Value: fmt.Sprintf("calls=%d,usec=%d,usec_per_call=%.2f", st.calls, st.usec, float64(st.usec)/float64(st.calls)),
+		}
+	}
+
+	return fields
+}
+
+// serverStats are the statistics reported by INFO, they are protected by the
+// mutex of the server.
+type serverStats struct {
+	connections int64
+	rejected    int64
+	commands    int64
+	cmds        map[string]*commandStats
+}
+
+type commandStats struct {
+	calls int64
+	usec  int64
+}
+
+// recordCommands records that the commands of a request were served in d.
+func (s *Server) recordCommands(names []string, d time.Duration) {
+	if len(names) == 0 {
+		return
+	}
+
+	usec := int64(d/time.Microsecond) / int64(len(names))
+
+	s.mutex.Lock()
+
+	if s.stats.cmds == nil {
+		s.stats.cmds = make(map[string]*commandStats)
+	}
+
+	for _, name := range names {
+		name = strings.ToLower(name)
+		st := s.stats.cmds[name]
+
+		if st == nil {
+			st = &commandStats{}
+			s.stats.cmds[name] = st
+		}
+
+		st.calls++
+		st.usec += usec
+	}
+
+	s.stats.commands += int64(len(names))
+	s.mutex.Unlock()
+}
+
+func (s *Server) recordConnection(rejected bool) {
+	s.mutex.Lock()
+	s.stats.connections++
+
+	if rejected {
+		s.stats.rejected++
+	}
+
+	s.mutex.Unlock()
+}
+
+// command answers COMMAND [COUNT | LIST | INFO name ... | DOCS [name ...] |
+// GETKEYS command arg ...]. The commands are the ones of the handler if it
+// implements ServerHandler, or all the commands of the spec otherwise.
+func (s *Server) command(c *Conn, cmd Command) interface{} {
+	var args []string
+
+	if err := cmd.ParseArgs(&args); err != nil {
+		return err
+	}
+
+	names := s.commandNames()
+
+	if len(args) == 0 {
+		list := make([]interface{}, len(names))
+
+		for i, name := range names {
+			list[i] = commandReply(name)
+		}
+
+		return list
+	}
+
+	sub, args := strings.ToUpper(args[0]), args[1:]
+
+	switch {
+	case sub == "COUNT" && len(args) == 0:
+		return int64(len(names))
+
+	case sub == "LIST" && len(args) == 0:
+		list := make([]interface{}, len(names))
+
+		for i, name := range names {
+			list[i] = strings.ToLower(name)
+		}
+
+		return list
+
+	case sub == "INFO":
+		list := make([]interface{}, len(args))
+
+		for i, name := range args {
+			if s.hasCommand(name) {
+				list[i] = commandReply(strings.ToUpper(name))
+			}
+		}
+
+		return list
+
+	case sub == "DOCS":
+		if len(args) == 0 {
+			args = names
+		}
+
+		list := make([]interface{}, 0, 2*len(args))
+
+		for _, name := range args {
+			if info := LookupCommand(name); info != nil && s.hasCommand(name) {
+				list = append(list, strings.ToLower(info.Name), []interface{}{
+					"summary", info.Summary,
+					"group", info.Group,
+				})
+			}
+		}
+
+		return list
+
+	case sub == "GETKEYS" && len(args) != 0:
+		info := LookupCommand(args[0])
+		if info == nil {
+			return errorf("ERR Invalid command specified")
+		}
+
+		if (info.Arity > 0 && len(args) != info.Arity) || len(args) < -info.Arity {
+			return errorf("ERR Invalid number of arguments specified for command")
+		}
+
+		indexes := info.KeyIndexes(len(args) - 1)
+		if len(indexes) == 0 {
+			return errorf("ERR The command has no key arguments")
+		}
+
+		keys := make([]interface{}, len(indexes))
+
+		for i, j := range indexes {
+			keys[i] = args[j+1]
+		}
+
+		return keys
+	}
+
+	return errorf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try COMMAND HELP.", strings.ToLower(sub))
+}
+
+// commandNames returns the sorted names of the commands of the server, in upper
+// case.
+func (s *Server) commandNames() []string {
+	set := map[string]bool{}
+
+	if h, ok := s.Handler.(ServerHandler); ok {
+		for name := range h.LookupHandlers() {
+			set[strings.ToUpper(name)] = true
+		}
+	} else {
+		for name := range commandTable {
+			set[name] = true
+		}
+	}
+
+	for _, name := range builtinCommands {
+		set[name] = true
+	}
+
+	for _, name := range optionalBuiltinCommands {
+		set[name] = true
+	}
+
+	if s.PubSub != nil {
+		for _, name := range pubsubCommands {
+			set[name] = true
+		}
+	}
+
+	if s.Authenticate != nil {
+		set["AUTH"] = true
+	}
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (s *Server) hasCommand(name string) bool {
+	name = strings.ToUpper(name)
+
+	for _, n := range s.commandNames() {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// commandReply returns the description of the command name in the format of
+// the reply to COMMAND.
+func commandReply(name string) []interface{} {
+	info := LookupCommand(name)
+	if info == nil {
+		info = &CommandInfo{Name: name, Arity: -1}
+	}
+
+	flags := make([]interface{}, len(info.Flags))
+	for i, f := range info.Flags {
+		flags[i] = f
+	}
+
+	categories := info.Categories()
+	acl := make([]interface{}, len(categories))
+	for i, c := range categories {
+		acl[i] = "@" + c
+	}
+
+	return []interface{}{
+		strings.ToLower(info.Name),
+		int64(info.Arity),
+		flags,
+		int64(info.FirstKey),
+		int64(info.LastKey),
+		int64(info.KeyStep),
+		acl,
+	}
+}
+
+// configParam is a parameter of the server exposed by CONFIG GET and CONFIG
+// SET. The functions are called with the mutex of the server held.
+type configParam struct {
+	name string
+	get  func(*Server) string
+	set  func(*Server, string) bool
+}
+
+// configParams are the parameters of CONFIG, the names of parameters which
+// exist in redis follow their semantics, the others take Go durations.
+var configParams = []configParam{
+	unitParam("timeout", time.Second, func(s *Server) *time.Duration { return &s.IdleTimeout }),
+	durationParam("read-timeout", func(s *Server) *time.Duration { return &s.ReadTimeout }),
+	durationParam("write-timeout", func(s *Server) *time.Duration { return &s.WriteTimeout }),
+	intParam("maxclients", 0, parseConfigInt, func(s *Server) *int { return &s.MaxConns }),
+	intParam("maxclients-per-ip", 0, parseConfigInt, func(s *Server) *int { return &s.MaxConnsPerIP }),
+	intParam("client-query-buffer-limit", DefaultMaxRequestSize, parseConfigMemory, func(s *Server) *int { return &s.MaxRequestSize }),
+	intParam("proto-max-bulk-len", DefaultMaxBulkLen, parseConfigMemory, func(s *Server) *int { return &s.MaxBulkLen }),
+	intParam("proto-max-multibulk-len", DefaultMaxMultiBulkLen, parseConfigInt, func(s *Server) *int { return &s.MaxMultiBulkLen }),
+	intParam("max-queued-commands", 0, parseConfigInt, func(s *Server) *int { return &s.MaxQueuedCommands }),
+	{
+		// Negative values disable the slow log, zero records all requests.
+		name: "slowlog-log-slower-than",
+		get: func(s *Server) string {
+			if s.SlowLogThreshold <= 0 {
+				return "-1"
+			}
+			return strconv.FormatInt(int64(s.SlowLogThreshold/time.Microsecond), 10)
+		},
+		set: func(s *Server, v string) bool {
+			n, err := strconv.ParseInt(v, 10, 64)
+			switch {
+			case err != nil:
+				return false
+			case n < 0:
+				s.SlowLogThreshold = 0
+			case n == 0:
+				s.SlowLogThreshold = time.Nanosecond
+			default:
+				s.SlowLogThreshold = time.Duration(n) * time.Microsecond
+			}
+			return true
+		},
+	},
+	intParam("slowlog-max-len", DefaultSlowLogMaxLen, parseConfigInt, func(s *Server) *int { return &s.SlowLogMaxLen }),
+	unitParam("latency-monitor-threshold", time.Millisecond, func(s *Server) *time.Duration { return &s.LatencyThreshold }),
+	{
+		name: "notify-keyspace-events",
+		get: func(s *Server) string {
+			return s.NotifyKeyspaceEvents.String()
+		},
+		set: func(s *Server, v string) bool {
+			flags, err := ParseNotifyFlags(v)
+			if err == nil {
+				s.NotifyKeyspaceEvents = flags
+			}
+			return err == nil
+		},
+	},
+}
+
+// intParam returns a parameter bound to an integer field of servers, which is
+// reported as def when it is zero.
+func intParam(name string, def int, parse func(string) (int, bool), field func(*Server) *int) configParam {
+	return configParam{
+		name: name,
+		get: func(s *Server) string {
+			n := *field(s)
+			if n == 0 {
+				n = def
+			}
+			return strconv.Itoa(n)
+		},
+		set: func(s *Server, v string) bool {
+			n, ok := parse(v)
+			if ok {
+				*field(s) = n
+			}
+			return ok
+		},
+	}
+}
+
+// unitParam returns a parameter bound to a duration field of servers, in a
+// number of units.
+func unitParam(name string, unit time.Duration, field func(*Server) *time.Duration) configParam {
+	return configParam{
+		name: name,
+		get: func(s *Server) string {
+			return strconv.FormatInt(int64(*field(s)/unit), 10)
+		},
+		set: func(s *Server, v string) bool {
+			n, ok := parseConfigInt(v)
+			if ok {
+				*field(s) = time.Duration(n) * unit
+			}
+			return ok
+		},
+	}
+}
+
+// durationParam returns a parameter bound to a duration field of servers, in
+// the format of time.ParseDuration.
+func durationParam(name string, field func(*Server) *time.Duration) configParam {
+	return configParam{
+		name: name,
+		get: func(s *Server) string {
+			return field(s).String()
+		},
+		set: func(s *Server, v string) bool {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return false
+			}
+			*field(s) = d
+			return true
+		},
+	}
+}
+
+// configCommand answers CONFIG GET pattern ..., CONFIG SET name value ... and
+// CONFIG RESETSTAT. Changes made with CONFIG SET apply to the next requests of
+// connections, and to the connections accepted afterwards.
+func (s *Server) configCommand(c *Conn, cmd Command) interface{} {
+	var args []string
+
+	if err := cmd.ParseArgs(&args); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errorf("ERR wrong number of arguments for 'config' command")
+	}
+
+	sub, args := strings.ToUpper(args[0]), args[1:]
+
+	switch {
+	case sub == "GET" && len(args) != 0:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		list := []interface{}{}
+
+		for _, p := range configParams {
+			for _, pattern := range args {
+				if ok, _ := path.Match(strings.ToLower(pattern), p.name); ok {
+					list = append(list, p.name, p.get(s))
+					break
+				}
+			}
+		}
+
+		return list
+
+	case sub == "SET" && len(args) != 0 && len(args)%2 == 0:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		// The parameters are all set, or none of them.
+		saved := s.configFields()
+
+		for i := 0; i < len(args); i += 2 {
+			p := lookupConfigParam(args[i])
+			if p == nil {
+				s.setConfigFields(saved)
+				return errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", args[i])
+			}
+
+			if !p.set(s, args[i+1]) {
+				s.setConfigFields(saved)
+				return errorf("ERR Invalid argument '%s' for CONFIG SET '%s'", args[i+1], p.name)
+			}
+		}
+
+		s.config.Store(s.makeConfig())
+		return "OK"
+
+	case sub == "RESETSTAT" && len(args) == 0:
+		s.mutex.Lock()
+		s.stats = serverStats{}
+		s.mutex.Unlock()
+		return "OK"
+
+	case sub == "REWRITE" && len(args) == 0:
+		return errorf("ERR The server is running without a config file")
+	}
+
+	return errorf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try CONFIG HELP.", strings.ToLower(sub))
+}
+
+// serverConfigFields are the fields of servers which can be changed by CONFIG
+// SET.
+type serverConfigFields struct {
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxConns          int
+	maxConnsPerIP     int
+	maxRequestSize    int
+	maxBulkLen        int
+	maxMultiBulkLen   int
+	maxQueuedCommands int
+	slowLogThreshold  time.Duration
+	slowLogMaxLen     int
+	latencyThreshold  time.Duration
+	notifyFlags       NotifyFlags
+}
+
+func (s *Server) configFields() serverConfigFields {
+	return serverConfigFields{
+		readTimeout:       s.ReadTimeout,
+		writeTimeout:      s.WriteTimeout,
+		idleTimeout:       s.IdleTimeout,
+		maxConns:          s.MaxConns,
+		maxConnsPerIP:     s.MaxConnsPerIP,
+		maxRequestSize:    s.MaxRequestSize,
+		maxBulkLen:        s.MaxBulkLen,
+		maxMultiBulkLen:   s.MaxMultiBulkLen,
+		maxQueuedCommands: s.MaxQueuedCommands,
+		slowLogThreshold:  s.SlowLogThreshold,
+		slowLogMaxLen:     s.SlowLogMaxLen,
+		latencyThreshold:  s.LatencyThreshold,
+		notifyFlags:       s.NotifyKeyspaceEvents,
+	}
+}
+
+func (s *Server) setConfigFields(f serverConfigFields) {
+	s.ReadTimeout = f.readTimeout
+	s.WriteTimeout = f.writeTimeout
+	s.IdleTimeout = f.idleTimeout
+	s.MaxConns = f.maxConns
+	s.MaxConnsPerIP = f.maxConnsPerIP
+	s.MaxRequestSize = f.maxRequestSize
+	s.MaxBulkLen = f.maxBulkLen
+	s.MaxMultiBulkLen = f.maxMultiBulkLen
+	s.MaxQueuedCommands = f.maxQueuedCommands
+	s.SlowLogThreshold = f.slowLogThreshold
+	s.SlowLogMaxLen = f.slowLogMaxLen
+	s.LatencyThreshold = f.latencyThreshold
+	s.NotifyKeyspaceEvents = f.notifyFlags
+}
+
+func lookupConfigParam(name string) *configParam {
+	name = strings.ToLower(name)
+
+	for i := range configParams {
+		if configParams[i].name == name {
+			return &configParams[i]
+		}
+	}
+
+	return nil
+}
+
+func parseConfigInt(v string) (int, bool) {
+	n, err := strconv.Atoi(v)
+	return n, err == nil && n >= 0
+}
+
+// parseConfigMemory parses a size in bytes, optionally followed by a unit like
+// in the configuration of redis ("1gb", "512mb", "64k").
+func parseConfigMemory(v string) (int, bool) {
+	units := []struct {
+		suffix string
+		size   int
+	}{
+		{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+		{"g", 1000 * 1000 * 1000}, {"m", 1000 * 1000}, {"k", 1000},
+		{"b", 1},
+	}
+
+	v = strings.ToLower(v)
+	size := 1
+
+	for _, u := range units {
+		if strings.HasSuffix(v, u.suffix) {
+			v, size = strings.TrimSuffix(v, u.suffix), u.size
+			break
+		}
+	}
+
+	n, ok := parseConfigInt(v)
+	return n * size, ok
+}
+
+func newRunID() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
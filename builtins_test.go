@@ -0,0 +1,283 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+)
+
+func TestServerBuiltins(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, *redis.Server, *clientConn)
+	}{
+		{
+			scenario: "INFO reports the built-in sections and the registered ones",
+			function: testServerBuiltinsInfo,
+		},
+		{
+			scenario: "INFO commandstats reports the commands served",
+			function: testServerBuiltinsInfoCommandStats,
+		},
+		{
+			scenario: "COMMAND describes the commands of the handler",
+			function: testServerBuiltinsCommand,
+		},
+		{
+			scenario: "CONFIG GET and CONFIG SET are bound to the fields of the server",
+			function: testServerBuiltinsConfig,
+		},
+		{
+			scenario: "CONFIG SET changes the limits of the next requests",
+			function: testServerBuiltinsConfigLimits,
+		},
+		{
+			scenario: "HELLO describes the server and switches protocols",
+			function: testServerBuiltinsHello,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			srv := &redis.Server{
+				Handler: handlerMap{
+					"GET": echoHandler,
+					"SET": echoHandler,
+				},
+				MaxConns:       100,
+				EnableBuiltins: true,
+			}
+			addr := startServer(t, srv)
+			defer srv.Close()
+
+			conn := dialClientConn(t, addr)
+			defer conn.Close()
+
+			testFunc(t, ctx, srv, conn)
+		})
+	}
+}
+
+func TestServerBuiltinsDisabled(t *testing.T) {
+	it := assert.New(t)
+
+	srv := &redis.Server{Handler: echoHandler}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	// the commands are passed to the handler, except PING
+	for _, cmd := range []string{"CLIENT", "CONFIG", "MONITOR"} {
+		var name string
+		it.Nil(conn.query(&name, cmd, "LIST"))
+		it.Equal(cmd, name)
+	}
+
+	var pong string
+	it.Nil(conn.query(&pong, "PING"))
+	it.Equal("PONG", pong)
+}
+
+// handlerMap is a redis.ServerHandler routing commands to handlers by name.
+type handlerMap map[string]redis.Handler
+
+func (m handlerMap) LookupHandlers() map[string]redis.Handler { return m }
+
+func (m handlerMap) ServeRedis(w redis.ResponseWriter, r *redis.Request) {
+	m[r.Cmds[0].Cmd].ServeRedis(w, r)
+}
+
+// parseInfo parses the reply of INFO into a map of sections to fields.
+func parseInfo(info string) map[string]map[string]string {
+	sections := map[string]map[string]string{}
+
+	var fields map[string]string
+
+	for _, line := range strings.Split(info, "\r\n") {
+		switch {
+		case strings.HasPrefix(line, "# "):
+			fields = map[string]string{}
+			sections[strings.ToLower(line[2:])] = fields
+		case fields != nil:
+			if i := strings.IndexByte(line, ':'); i >= 0 {
+				fields[line[:i]] = line[i+1:]
+			}
+		}
+	}
+
+	return sections
+}
+
+func testServerBuiltinsInfo(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	srv.HandleInfo("keyspace", func() []redis.InfoField {
+		return []redis.InfoField{{Name: "db0", Value: "keys=1,expires=0,avg_ttl=0"}}
+	})
+	srv.HandleInfo("replication", func() []redis.InfoField {
+		return []redis.InfoField{{Name: "role", Value: "master"}}
+	})
+
+	var info string
+	it.Nil(conn.query(&info, "INFO"))
+
+	sections := parseInfo(info)
+	it.Equal("6.2.0", sections["server"]["redis_version"])
+	it.Equal("1", sections["clients"]["connected_clients"])
+	it.Equal("100", sections["clients"]["maxclients"])
+	it.Equal("1", sections["stats"]["total_connections_received"])
+	it.Equal("master", sections["replication"]["role"])
+	it.Equal("keys=1,expires=0,avg_ttl=0", sections["keyspace"]["db0"])
+
+	_, ok := sections["commandstats"]
+	it.False(ok, "commandstats is not a default section")
+
+	it.Nil(conn.query(&info, "INFO", "replication"))
+
+	sections = parseInfo(info)
+	it.Equal(1, len(sections))
+	it.Equal("master", sections["replication"]["role"])
+}
+
+func testServerBuiltinsInfoCommandStats(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	var name, info string
+
+	for i := 0; i != 3; i++ {
+		it.Nil(conn.query(&name, "GET", "key"))
+	}
+
+	it.Nil(conn.query(&info, "INFO", "commandstats"))
+
+	stats := parseInfo(info)["commandstats"]
+	it.True(strings.HasPrefix(stats["cmdstat_get"], "calls=3,usec="), stats["cmdstat_get"])
+
+	it.Nil(conn.query(&info, "CONFIG", "RESETSTAT"))
+	it.Nil(conn.query(&info, "INFO", "commandstats"))
+
+	_, ok := parseInfo(info)["commandstats"]["cmdstat_get"]
+	it.False(ok)
+}
+
+func testServerBuiltinsCommand(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	var count int
+	it.Nil(conn.query(&count, "COMMAND", "COUNT"))
+	it.Equal(11, count) // GET, SET and the built-in commands
+
+	var names []string
+	it.Nil(conn.query(&names, "COMMAND", "LIST"))
+	it.Equal([]string{"client", "command", "config", "get", "hello", "info", "latency", "monitor", "ping", "set", "slowlog"}, names)
+
+	var get, unknown []interface{}
+	it.Nil(conn.WriteCommands(redis.Command{Cmd: "COMMAND", Args: redis.List("INFO", "get", "unknown")}))
+	it.Nil(redis.ParseArgs(conn.ReadArgs(), &get, &unknown))
+
+	if it.Equal(7, len(get)) {
+		it.Equal("get", fmt.Sprint(get[0]))
+		it.Equal("2", fmt.Sprint(get[1]))
+		it.Equal("1", fmt.Sprint(get[3]))
+	}
+	it.Nil(unknown)
+
+	var name string
+	var docs map[string]string
+	it.Nil(conn.WriteCommands(redis.Command{Cmd: "COMMAND", Args: redis.List("DOCS", "set")}))
+	it.Nil(redis.ParseArgs(conn.ReadArgs(), &name, &docs))
+	it.Equal("set", name)
+	it.Equal("string", docs["group"])
+
+	var keys []string
+	it.Nil(conn.query(&keys, "COMMAND", "GETKEYS", "MSET", "a", "1", "b", "2"))
+	it.Equal([]string{"a", "b"}, keys)
+}
+
+func testServerBuiltinsConfig(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	var config map[string]string
+	it.Nil(conn.query(&config, "CONFIG", "GET", "maxclients", "proto-max-*"))
+	it.Equal(map[string]string{
+		"maxclients":              "100",
+		"proto-max-bulk-len":      "536870912",
+		"proto-max-multibulk-len": "1048576",
+	}, config)
+
+	var status string
+	it.Nil(conn.query(&status, "CONFIG", "SET", "timeout", "30", "proto-max-bulk-len", "1mb"))
+	it.Equal("OK", status)
+
+	it.Nil(conn.query(&config, "CONFIG", "GET", "timeout", "proto-max-bulk-len"))
+	it.Equal("30", config["timeout"])
+	it.Equal("1048576", config["proto-max-bulk-len"])
+
+	err := conn.query(&status, "CONFIG", "SET", "maxclients", "10", "unknown", "1")
+	if it.NotNil(err) {
+		it.Equal("ERR Unknown option or number of arguments for CONFIG SET - 'unknown'", err.Error())
+	}
+
+	err = conn.query(&status, "CONFIG", "SET", "maxclients", "many")
+	if it.NotNil(err) {
+		it.Equal("ERR Invalid argument 'many' for CONFIG SET 'maxclients'", err.Error())
+	}
+
+	// failed changes are not applied
+	it.Nil(conn.query(&config, "CONFIG", "GET", "maxclients"))
+	it.Equal("100", config["maxclients"])
+}
+
+func testServerBuiltinsConfigLimits(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	var status, name string
+	it.Nil(conn.query(&status, "CONFIG", "SET", "proto-max-multibulk-len", "2"))
+	it.Nil(conn.query(&name, "GET", "key"))
+
+	err := conn.query(&name, "SET", "key", "value")
+	if it.NotNil(err) {
+		it.Equal("ERR Protocol error: invalid multibulk length", err.Error())
+	}
+}
+
+func testServerBuiltinsHello(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	var hello map[string]interface{}
+	it.Nil(conn.query(&hello, "HELLO", "2", "SETNAME", "worker"))
+	it.Equal("redis", fmt.Sprint(hello["server"]))
+	it.Equal("2", fmt.Sprint(hello["proto"]))
+
+	var name string
+	it.Nil(conn.query(&name, "CLIENT", "GETNAME"))
+	it.Equal("worker", name)
+
+	it.Nil(conn.query(&hello, "HELLO", "3"))
+	it.Equal("3", fmt.Sprint(hello["proto"]))
+
+	it.Nil(conn.query(&hello, "HELLO"))
+	it.Equal("3", fmt.Sprint(hello["proto"]))
+
+	it.Nil(conn.query(&hello, "HELLO", "2"))
+	it.Equal("2", fmt.Sprint(hello["proto"]))
+
+	err := conn.query(&hello, "HELLO", "4")
+	if it.NotNil(err) {
+		it.Equal("NOPROTO unsupported protocol version", err.Error())
+	}
+}
@@ -0,0 +1,613 @@
+package redis
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dolab/objconv"
+)
+
+// DefaultCacheSize is the default number of replies kept in the local cache of
+// CachingClients.
+const DefaultCacheSize = 4096
+
+// invalidateChannel is the channel that redis publishes the invalidation
+// messages of client-side caching to.
+const invalidateChannel = "__redis__:invalidate"
+
+// CacheStats reports the activity of the local cache of a CachingClient.
+type CacheStats struct {
+	// Entries is the number of replies in the cache.
+	Entries int
+
+	// Hits and Misses count the reads answered from the cache or sent to the
+	// server, Invalidations the keys invalidated by the server or by writes
+	// of the client, and Flushes the times the whole cache was dropped.
+	Hits          int64
+	Misses        int64
+	Invalidations int64
+	Flushes       int64
+}
+
+// A CachingClient is a client keeping the replies of read commands in a local
+// cache, which is invalidated by the client-side caching of redis 6.
+//
+// The connections of the client enable CLIENT TRACKING and redirect the
+// invalidation messages to a separate connection subscribed to
+// __redis__:invalidate, the way it is done with RESP2. The whole cache is
+// flushed when any of these connections is lost, since the server stops
+// tracking the keys read on them.
+//
+// Only the replies of deterministic commands flagged "readonly" which have keys
+// are cached, like GET, HGETALL or LRANGE, and the keys of the other commands
+// flagged "write" are invalidated when their replies are read. The commands of
+// transactions are never cached, and the keys they write are invalidated when
+// the server notifies the client.
+//
+// CachingClients are safe for concurrent use by multiple goroutines.
+type CachingClient struct {
+	// Addr is the address of the redis server, "localhost:6379" if empty.
+	Addr string
+
+	// Transport configures the connections of the client, the client uses its
+	// own transport made from its configuration. If nil, the default values
+	// of transports are used.
+	Transport *Transport
+
+	// Timeout is the time limit of the requests of the client, see Client.
+	Timeout time.Duration
+
+	// Size is the maximum number of replies kept in the cache, the least
+	// recently used are evicted first. DefaultCacheSize is used if zero.
+	Size int
+
+	// Broadcast enables the broadcasting mode of CLIENT TRACKING, where the
+	// server sends the invalidation of all the keys matching Prefixes, or of
+	// all keys if there are none, instead of tracking the keys read by the
+	// client. Only the replies of commands on keys matching Prefixes are
+	// cached in this mode.
+	Broadcast bool
+	Prefixes  []string
+
+	once      sync.Once
+	client    Client
+	transport *Transport
+
+	// The connection receiving the invalidation messages, and its client ID
+	// which the other connections redirect to.
+	submutex sync.Mutex
+	sub      *SubConn
+	subID    int64
+
+	mutex   sync.Mutex
+	lru     list.List
+	entries map[string]*list.Element
+	keys    map[string]map[string]struct{}
+	fetches map[string]map[*cacheFetch]struct{}
+	epoch   uint64
+	stats   CacheStats
+}
+
+// cacheEntry is a reply in the cache, stored as the list of values read from
+// the server.
+type cacheEntry struct {
+	key    string
+	keys   []string
+	values []interface{}
+}
+
+// cacheFetch is a read in progress, its reply isn't cached if one of its keys
+// is invalidated before it completes.
+type cacheFetch struct {
+	keys  []string
+	epoch uint64
+	stale bool
+}
+
+// Query issues a request with cmd and args, like Client.Query. The reply is
+// served from the cache if it has one, and cached otherwise.
+func (c *CachingClient) Query(ctx context.Context, cmd string, args ...interface{}) Args {
+	c.once.Do(c.init)
+
+	keys, cacheable := c.cacheable(cmd, args)
+	if !cacheable {
+		r := c.client.Query(ctx, cmd, args...)
+
+		if keys = writtenKeys(cmd, args); len(keys) != 0 {
+			r = &invalidatingArgs{Args: r, cache: c, keys: keys}
+		}
+
+		return r
+	}
+
+	key := cacheKey(cmd, args)
+
+	if values, ok := c.get(key); ok {
+		return replayArgs(values)
+	}
+
+	f := c.beginFetch(keys)
+
+	values, err := readValues(c.client.Query(ctx, cmd, args...))
+	if err != nil {
+		c.endFetch(f, "", nil)
+		return newArgsError(err)
+	}
+
+	c.endFetch(f, key, values)
+	return replayArgs(values)
+}
+
+// Exec issues a request with cmd and args, like Client.Exec.
+func (c *CachingClient) Exec(ctx context.Context, cmd string, args ...interface{}) error {
+	return ParseArgs(c.Query(ctx, cmd, args...), nil)
+}
+
+// MultiQuery issues a transaction, like Client.MultiQuery. The replies of
+// transactions are not cached.
+func (c *CachingClient) MultiQuery(ctx context.Context, cmds ...Command) TxArgs {
+	c.once.Do(c.init)
+	return c.client.MultiQuery(ctx, cmds...)
+}
+
+// MultiExec issues a transaction, like Client.MultiExec.
+func (c *CachingClient) MultiExec(ctx context.Context, cmds ...Command) error {
+	return c.MultiQuery(ctx, cmds...).Close()
+}
+
+// Stats returns the statistics of the cache.
+func (c *CachingClient) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// Close closes the connections of the client and flushes its cache. The
+// client can be used again after it was closed, it reconnects on the next
+// request.
+func (c *CachingClient) Close() error {
+	c.once.Do(c.init)
+
+	c.submutex.Lock()
+	sub := c.sub
+	c.sub = nil
+	c.submutex.Unlock()
+
+	c.transport.FlushConnections(c.addr())
+
+	var err error
+	if sub != nil {
+		err = sub.Close()
+	}
+
+	c.flush()
+	return err
+}
+
+func (c *CachingClient) init() {
+	t := c.Transport
+	if t == nil {
+		t = &Transport{}
+	}
+
+	c.transport = &Transport{
+		DialContext:         c.dial,
+		MaxIdleConns:        t.MaxIdleConns,
+		MaxIdleConnsPerHost: t.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     t.MaxConnsPerHost,
+		MinIdleConns:        t.MinIdleConns,
+		MaxConnLifetime:     t.MaxConnLifetime,
+		IdleTimeout:         t.IdleTimeout,
+		PingInterval:        t.PingInterval,
+		PingTimeout:         t.PingTimeout,
+	}
+
+	c.client = Client{
+		Addr:      c.addr(),
+		Transport: c.transport,
+		Timeout:   c.Timeout,
+	}
+
+	c.entries = map[string]*list.Element{}
+	c.keys = map[string]map[string]struct{}{}
+	c.fetches = map[string]map[*cacheFetch]struct{}{}
+}
+
+func (c *CachingClient) addr() string {
+	if len(c.Addr) == 0 {
+		return "localhost:6379"
+	}
+	return c.Addr
+}
+
+func (c *CachingClient) dialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	if t := c.Transport; t != nil {
+		return t.dialContext(ctx, network, address)
+	}
+	return DefaultDialer.DialContext(ctx, network, address)
+}
+
+// dial opens a connection to the server which redirects its invalidation
+// messages to the subscriber of the client.
+func (c *CachingClient) dial(ctx context.Context, network string, address string) (net.Conn, error) {
+	id, err := c.redirect(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.dialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{"CLIENT", "TRACKING", "on", "REDIRECT", id}
+
+	if c.Broadcast {
+		args = append(args, "BCAST")
+
+		for _, prefix := range c.Prefixes {
+			args = append(args, "PREFIX", prefix)
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := NewSubConn(conn).do(args...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return &trackingConn{Conn: conn, cache: c}, nil
+}
+
+// redirect returns the client ID of the connection receiving the invalidation
+// messages, it is opened if needed.
+func (c *CachingClient) redirect(ctx context.Context, network string, address string) (int64, error) {
+	c.submutex.Lock()
+	defer c.submutex.Unlock()
+
+	if c.sub != nil {
+		return c.subID, nil
+	}
+
+	conn, err := c.dialContext(ctx, network, address)
+	if err != nil {
+		return 0, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	sub := NewSubConn(conn)
+
+	reply, err := sub.do("CLIENT", "ID")
+	if err == nil {
+		// The subscription must be active before the keys are tracked, the
+		// server drops the invalidation messages of clients which didn't
+		// subscribe.
+		_, err = sub.do("SUBSCRIBE", invalidateChannel)
+	}
+
+	id, ok := reply.(int64)
+	if err == nil && !ok {
+		err = errorf("ERR unexpected reply to CLIENT ID: %v", reply)
+	}
+
+	if err != nil {
+		conn.Close()
+		return 0, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	c.sub, c.subID = sub, id
+
+	go c.readInvalidations(sub)
+	return id, nil
+}
+
+// readInvalidations applies the invalidation messages received by sub until
+// the connection is closed.
+func (c *CachingClient) readInvalidations(sub *SubConn) {
+	for {
+		keys, err := sub.ReadInvalidation()
+		if err != nil {
+			break
+		}
+
+		// A nil list of keys means that the server was flushed.
+		if keys == nil {
+			c.flush()
+		} else {
+			c.invalidate(keys)
+		}
+	}
+
+	c.submutex.Lock()
+	current := c.sub == sub
+	if current {
+		c.sub = nil
+	}
+	c.submutex.Unlock()
+
+	// The connections redirecting to the subscriber don't receive the
+	// invalidation messages anymore, they are replaced along with the cache.
+	// This was already done if the client was closed.
+	if current {
+		c.transport.FlushConnections(c.addr())
+		c.flush()
+	}
+}
+
+// cacheable returns the keys of the command cmd, and whether its reply can be
+// cached.
+func (c *CachingClient) cacheable(cmd string, args []interface{}) ([]string, bool) {
+	info := LookupCommand(cmd)
+	if info == nil || !info.HasFlag("readonly") || info.HasFlag("random") || info.HasFlag("blocking") {
+		return nil, false
+	}
+
+	keys := commandKeys(info, args)
+	if len(keys) == 0 {
+		return nil, false
+	}
+
+	if c.Broadcast && len(c.Prefixes) != 0 {
+		for _, key := range keys {
+			if !hasAnyPrefix(key, c.Prefixes) {
+				return nil, false
+			}
+		}
+	}
+
+	return keys, true
+}
+
+func (c *CachingClient) get(key string) ([]interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		gometrics.IncClientCache("miss")
+		return nil, false
+	}
+
+	c.stats.Hits++
+	gometrics.IncClientCache("hit")
+
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).values, true
+}
+
+func (c *CachingClient) beginFetch(keys []string) *cacheFetch {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	f := &cacheFetch{keys: keys, epoch: c.epoch}
+
+	for _, key := range keys {
+		fetches := c.fetches[key]
+		if fetches == nil {
+			fetches = map[*cacheFetch]struct{}{}
+			c.fetches[key] = fetches
+		}
+		fetches[f] = struct{}{}
+	}
+
+	return f
+}
+
+// endFetch completes f, the values are cached under key unless one of the keys
+// of f was invalidated in the meantime.
+func (c *CachingClient) endFetch(f *cacheFetch, key string, values []interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, k := range f.keys {
+		if fetches := c.fetches[k]; fetches != nil {
+			if delete(fetches, f); len(fetches) == 0 {
+				delete(c.fetches, k)
+			}
+		}
+	}
+
+	if f.stale || f.epoch != c.epoch || len(key) == 0 {
+		return
+	}
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).values = values
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, keys: f.keys, values: values})
+
+	for _, k := range f.keys {
+		entries := c.keys[k]
+		if entries == nil {
+			entries = map[string]struct{}{}
+			c.keys[k] = entries
+		}
+		entries[key] = struct{}{}
+	}
+
+	size := c.Size
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	for c.lru.Len() > size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops the entry e from the cache, the mutex must be held.
+func (c *CachingClient) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, entry.key)
+
+	for _, k := range entry.keys {
+		if entries := c.keys[k]; entries != nil {
+			if delete(entries, entry.key); len(entries) == 0 {
+				delete(c.keys, k)
+			}
+		}
+	}
+}
+
+// invalidate drops the replies of commands on keys from the cache.
+func (c *CachingClient) invalidate(keys []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, key := range keys {
+		for entry := range c.keys[key] {
+			c.remove(c.entries[entry])
+		}
+
+		for f := range c.fetches[key] {
+			f.stale = true
+		}
+
+		c.stats.Invalidations++
+		gometrics.IncClientCache("invalidation")
+	}
+}
+
+// flush drops all the replies from the cache, and the replies of the reads in
+// progress.
+func (c *CachingClient) flush() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+	c.keys = map[string]map[string]struct{}{}
+	c.epoch++
+
+	c.stats.Flushes++
+	gometrics.IncClientCache("flush")
+}
+
+// trackingConn is a connection with CLIENT TRACKING enabled, closing it flushes
+// the cache since the server forgets the keys read on it.
+type trackingConn struct {
+	net.Conn
+	cache *CachingClient
+	once  sync.Once
+}
+
+func (conn *trackingConn) Close() error {
+	conn.once.Do(conn.cache.flush)
+	return conn.Conn.Close()
+}
+
+// invalidatingArgs invalidates the keys written by a command when its reply is
+// read.
+type invalidatingArgs struct {
+	Args
+	cache *CachingClient
+	keys  []string
+}
+
+func (args *invalidatingArgs) Close() error {
+	err := args.Args.Close()
+	args.cache.invalidate(args.keys)
+	return err
+}
+
+// writtenKeys returns the keys of cmd if it is a write command.
+func writtenKeys(cmd string, args []interface{}) []string {
+	info := LookupCommand(cmd)
+	if info == nil || !info.HasFlag("write") {
+		return nil
+	}
+	return commandKeys(info, args)
+}
+
+func commandKeys(info *CommandInfo, args []interface{}) []string {
+	indexes := info.KeyIndexes(len(args))
+	keys := make([]string, 0, len(indexes))
+
+	for _, i := range indexes {
+		keys = append(keys, cacheArg(args[i]))
+	}
+
+	return keys
+}
+
+// cacheKey returns the key of the reply of cmd in the cache.
+func cacheKey(cmd string, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(cmd))
+
+	for _, arg := range args {
+		s := cacheArg(arg)
+		b.WriteByte(' ')
+		b.WriteString(strconv.Itoa(len(s)))
+		b.WriteByte(':')
+		b.WriteString(s)
+	}
+
+	return b.String()
+}
+
+func cacheArg(arg interface{}) string {
+	switch a := arg.(type) {
+	case string:
+		return a
+	case []byte:
+		return string(a)
+	}
+
+	return fmt.Sprint(arg)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readValues reads the values of the reply args and closes it.
+func readValues(args Args) ([]interface{}, error) {
+	var values []interface{}
+
+	for {
+		var v interface{}
+		if !args.Next(&v) {
+			break
+		}
+		values = append(values, v)
+	}
+
+	return values, args.Close()
+}
+
+// replayArgs returns an argument list reading values, like the reply they
+// were read from.
+func replayArgs(values []interface{}) Args {
+	return &argsList{
+		dec: objconv.StreamDecoder{
+			Parser: objconv.NewValueParser(values),
+		},
+	}
+}
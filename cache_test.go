@@ -0,0 +1,400 @@
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+)
+
+func TestCachingClient(t *testing.T) {
+	tests := []struct {
+		scenario string
+		client   *redis.CachingClient
+		function func(*testing.T, context.Context, *trackingServer, *redis.CachingClient)
+	}{
+		{
+			scenario: "reads are served from the cache until the server invalidates them",
+			client:   &redis.CachingClient{},
+			function: testCachingClientInvalidate,
+		},
+		{
+			scenario: "the writes of the client invalidate its cache",
+			client:   &redis.CachingClient{},
+			function: testCachingClientWrite,
+		},
+		{
+			scenario: "the cache is flushed when the connections are lost",
+			client:   &redis.CachingClient{},
+			function: testCachingClientReconnect,
+		},
+		{
+			scenario: "the least recently used replies are evicted",
+			client:   &redis.CachingClient{Size: 2},
+			function: testCachingClientEvict,
+		},
+		{
+			scenario: "in broadcast mode only the keys matching the prefixes are cached",
+			client:   &redis.CachingClient{Broadcast: true, Prefixes: []string{"user:"}},
+			function: testCachingClientBroadcast,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc, client := test.function, test.client
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			srv := startTrackingServer(t)
+			defer srv.Close()
+
+			client.Addr = srv.Addr()
+			client.Transport = &redis.Transport{}
+			defer client.Close()
+
+			testFunc(t, ctx, srv, client)
+		})
+	}
+}
+
+func testCachingClientInvalidate(t *testing.T, ctx context.Context, srv *trackingServer, client *redis.CachingClient) {
+	it := assert.New(t)
+
+	it.Nil(srv.set("key", "A"))
+
+	for i := 0; i != 3; i++ {
+		value, err := redis.String(client.Query(ctx, "GET", "key"))
+		it.Nil(err)
+		it.Equal("A", value)
+	}
+	it.Equal(1, srv.reads())
+
+	var missing interface{}
+	it.Nil(redis.ParseArgs(client.Query(ctx, "GET", "missing"), &missing))
+	it.Nil(redis.ParseArgs(client.Query(ctx, "GET", "missing"), &missing))
+	it.Nil(missing)
+
+	it.Nil(srv.set("key", "B"))
+	waitCacheStats(t, client, func(stats redis.CacheStats) bool { return stats.Invalidations == 1 })
+
+	value, err := redis.String(client.Query(ctx, "GET", "key"))
+	it.Nil(err)
+	it.Equal("B", value)
+	it.Equal(3, srv.reads())
+
+	stats := client.Stats()
+	it.Equal(2, stats.Entries)
+	it.Equal(int64(3), stats.Hits)
+	it.Equal(int64(3), stats.Misses)
+}
+
+func testCachingClientWrite(t *testing.T, ctx context.Context, srv *trackingServer, client *redis.CachingClient) {
+	it := assert.New(t)
+
+	it.Nil(client.Exec(ctx, "SET", "key", "A"))
+
+	value, err := redis.String(client.Query(ctx, "GET", "key"))
+	it.Nil(err)
+	it.Equal("A", value)
+
+	// The reply of GET is dropped without waiting for the server.
+	it.Nil(client.Exec(ctx, "SET", "key", "B"))
+
+	value, err = redis.String(client.Query(ctx, "GET", "key"))
+	it.Nil(err)
+	it.Equal("B", value)
+	it.Equal(2, srv.reads())
+}
+
+func testCachingClientReconnect(t *testing.T, ctx context.Context, srv *trackingServer, client *redis.CachingClient) {
+	it := assert.New(t)
+
+	it.Nil(srv.set("key", "A"))
+
+	value, err := redis.String(client.Query(ctx, "GET", "key"))
+	it.Nil(err)
+	it.Equal("A", value)
+
+	srv.closeConns()
+	waitCacheStats(t, client, func(stats redis.CacheStats) bool { return stats.Entries == 0 && stats.Flushes != 0 })
+
+	// The client reconnects and tracks the keys on the new connections.
+	for i := 0; i != 2; i++ {
+		value, err = redis.String(client.Query(ctx, "GET", "key"))
+		if err != nil {
+			// The request may have been made on a connection which was
+			// closed by the server.
+			value, err = redis.String(client.Query(ctx, "GET", "key"))
+		}
+		it.Nil(err)
+		it.Equal("A", value)
+	}
+
+	it.Nil(srv.set("key", "B"))
+	waitCacheStats(t, client, func(stats redis.CacheStats) bool { return stats.Entries == 0 })
+}
+
+func testCachingClientEvict(t *testing.T, ctx context.Context, srv *trackingServer, client *redis.CachingClient) {
+	it := assert.New(t)
+
+	for _, key := range []string{"a", "b", "c", "c", "b", "a"} {
+		it.Nil(redis.ParseArgs(client.Query(ctx, "GET", key), nil))
+	}
+
+	stats := client.Stats()
+	it.Equal(2, stats.Entries)
+	it.Equal(int64(2), stats.Hits)
+	it.Equal(4, srv.reads())
+}
+
+func testCachingClientBroadcast(t *testing.T, ctx context.Context, srv *trackingServer, client *redis.CachingClient) {
+	it := assert.New(t)
+
+	for _, key := range []string{"user:1", "user:1", "session:1", "session:1"} {
+		it.Nil(redis.ParseArgs(client.Query(ctx, "GET", key), nil))
+	}
+
+	it.Equal(3, srv.reads())
+	it.Equal("on REDIRECT 1 BCAST PREFIX user:", srv.tracking())
+
+	it.Nil(srv.set("user:1", "A"))
+	waitCacheStats(t, client, func(stats redis.CacheStats) bool { return stats.Entries == 0 })
+}
+
+func waitCacheStats(t *testing.T, client *redis.CachingClient, cond func(redis.CacheStats) bool) {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond(client.Stats()) {
+			return
+		}
+	}
+	t.Fatalf("unexpected cache stats: %+v", client.Stats())
+}
+
+// trackingServer is a fake redis server implementing the subset of commands
+// used by client-side caching in RESP2, with invalidation messages redirected
+// to subscribers of __redis__:invalidate.
+type trackingServer struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	values   map[string]string
+	conns    map[net.Conn]*trackingClient
+	lastID   int64
+	nreads   int
+	lastArgs string
+}
+
+type trackingClient struct {
+	id         int64
+	subscribed bool
+	redirect   int64
+	bcast      bool
+	prefixes   []string
+	keys       map[string]bool
+}
+
+func startTrackingServer(t *testing.T) *trackingServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &trackingServer{
+		listener: l,
+		values:   map[string]string{},
+		conns:    map[net.Conn]*trackingClient{},
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+
+	return srv
+}
+
+func (srv *trackingServer) Addr() string { return srv.listener.Addr().String() }
+
+func (srv *trackingServer) Close() error {
+	srv.closeConns()
+	return srv.listener.Close()
+}
+
+func (srv *trackingServer) closeConns() {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	for conn := range srv.conns {
+		conn.Close()
+		delete(srv.conns, conn)
+	}
+}
+
+func (srv *trackingServer) reads() int {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.nreads
+}
+
+func (srv *trackingServer) tracking() string {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.lastArgs
+}
+
+// set writes key and sends the invalidation messages, like SET would.
+func (srv *trackingServer) set(key string, value string) error {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	srv.values[key] = value
+
+	for _, c := range srv.conns {
+		tracked := c.keys[key]
+		delete(c.keys, key)
+
+		if c.bcast {
+			for _, prefix := range c.prefixes {
+				tracked = tracked || strings.HasPrefix(key, prefix)
+			}
+		}
+
+		if !tracked {
+			continue
+		}
+
+		for conn, sub := range srv.conns {
+			if sub.id == c.redirect && sub.subscribed {
+				fmt.Fprintf(conn, "*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$%d\r\n%s\r\n", len(key), key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (srv *trackingServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	srv.mutex.Lock()
+	srv.lastID++
+	client := &trackingClient{id: srv.lastID, keys: map[string]bool{}}
+	srv.conns[conn] = client
+	srv.mutex.Unlock()
+
+	r := bufio.NewReader(conn)
+
+	for {
+		args, err := readTrackingCommand(r)
+		if err != nil {
+			return
+		}
+
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "PING":
+			fmt.Fprint(conn, "+PONG\r\n")
+
+		case cmd == "CLIENT" && strings.ToUpper(args[1]) == "ID":
+			fmt.Fprintf(conn, ":%d\r\n", client.id)
+
+		case cmd == "CLIENT" && strings.ToUpper(args[1]) == "TRACKING":
+			srv.mutex.Lock()
+			srv.lastArgs = strings.Join(args[2:], " ")
+
+			for i := 3; i < len(args); i++ {
+				switch strings.ToUpper(args[i]) {
+				case "REDIRECT":
+					i++
+					client.redirect, _ = strconv.ParseInt(args[i], 10, 64)
+				case "BCAST":
+					client.bcast = true
+				case "PREFIX":
+					i++
+					client.prefixes = append(client.prefixes, args[i])
+				}
+			}
+
+			srv.mutex.Unlock()
+			fmt.Fprint(conn, "+OK\r\n")
+
+		case cmd == "SUBSCRIBE":
+			srv.mutex.Lock()
+			client.subscribed = true
+			fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+			srv.mutex.Unlock()
+
+		case cmd == "GET":
+			srv.mutex.Lock()
+			srv.nreads++
+			if !client.bcast {
+				client.keys[args[1]] = true
+			}
+			value, ok := srv.values[args[1]]
+			srv.mutex.Unlock()
+
+			if ok {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+			} else {
+				fmt.Fprint(conn, "$-1\r\n")
+			}
+
+		case cmd == "SET":
+			srv.set(args[1], args[2])
+			fmt.Fprint(conn, "+OK\r\n")
+
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func readTrackingCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		args[i] = string(b[:size])
+	}
+
+	return args, nil
+}
@@ -46,13 +46,17 @@ type Client struct {
 //
 // Generally Exec or Query will be used instead of Do.
 func (c *Client) Do(req *Request) (*Response, error) {
+	return c.do(req, c.Timeout)
+}
+
+func (c *Client) do(req *Request, timeout time.Duration) (*Response, error) {
 	transport := c.Transport
 
 	if transport == nil {
 		transport = DefaultTransport
 	}
 
-	if c.Timeout != 0 {
+	if timeout != 0 {
 		var ctx = req.Context
 		var cancel context.CancelFunc
 
@@ -60,7 +64,7 @@ func (c *Client) Do(req *Request) (*Response, error) {
 			ctx = context.Background()
 		}
 
-		req.Context, cancel = context.WithTimeout(ctx, c.Timeout)
+		req.Context, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
 
@@ -99,16 +103,38 @@ func (c *Client) MultiExec(ctx context.Context, cmds ...Command) error {
 // The context passed as first argument allows the operation to be canceled
 // asynchronously.
 func (c *Client) Query(ctx context.Context, cmd string, args ...interface{}) Args {
+	return c.query(ctx, c.Timeout, cmd, args...)
+}
+
+// queryBlocking is like Query for commands which may block on the server for
+// the given duration, the client timeout is extended by this duration so long
+// blocking reads aren't interrupted. A block of zero means the command blocks
+// until data is available, in which case only the context bounds the request.
+func (c *Client) queryBlocking(ctx context.Context, block time.Duration, cmd string, args ...interface{}) Args {
+	timeout := c.Timeout
+
+	if timeout != 0 {
+		if block == 0 {
+			timeout = 0
+		} else {
+			timeout += block
+		}
+	}
+
+	return c.query(ctx, timeout, cmd, args...)
+}
+
+func (c *Client) query(ctx context.Context, timeout time.Duration, cmd string, args ...interface{}) Args {
 	addr := c.Addr
 	if len(addr) == 0 {
 		addr = "localhost:6379"
 	}
 
-	r, err := c.Do(&Request{
+	r, err := c.do(&Request{
 		Addr:    addr,
 		Cmds:    []Command{{Cmd: cmd, Args: List(args...)}},
 		Context: ctx,
-	})
+	}, timeout)
 	if err != nil {
 		return newArgsError(err)
 	}
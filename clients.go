@@ -0,0 +1,592 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConnInfo describes a client connection of a server, as reported by the
+// CLIENT LIST command.
+type ConnInfo struct {
+	// ID is the unique identifier of the connection within its server.
+	ID uint64
+
+	// Name is the name set by the client with CLIENT SETNAME.
+	Name string
+
+	// User is the user that the client authenticated as, it is empty if the
+	// client didn't authenticate.
+	User string
+
+	// Addr and LocalAddr are the remote and local addresses of the
+	// connection.
+	Addr      string
+	LocalAddr string
+
+	// CreatedAt is the time at which the connection was accepted, and
+	// LastInteraction the time at which the server last received a request or
+	// sent a response on the connection.
+	CreatedAt       time.Time
+	LastInteraction time.Time
+
+	// LastCmd is the name of the last command received on the connection, in
+	// lower case.
+	LastCmd string
+
+	// ReadBuffer is the number of bytes buffered from the connection when its
+	// last request started, ReadBufferFree is the free space left in the
+	// buffer, and WriteBuffer the number of bytes of responses which were
+	// not yet sent when its last request ended.
+	ReadBuffer     int
+	ReadBufferFree int
+	WriteBuffer    int
+
+	// NoEvict is true if the client set CLIENT NO-EVICT on.
+	NoEvict bool
+
+	// Monitor is true if the client sent MONITOR.
+	Monitor bool
+
+	// Subscriptions and PatternSubscriptions are the number of channels and
+	// patterns that the client is subscribed to.
+	Subscriptions        int
+	PatternSubscriptions int
+}
+
+// String returns the representation of the connection in the format of CLIENT
+// LIST.
+func (info ConnInfo) String() string {
+	return info.format(time.Now())
+}
+
+func (info ConnInfo) format(now time.Time) string {
+	flags := "N"
+	switch {
+	case info.Monitor:
+		flags = "O"
+	case info.Subscriptions != 0 || info.PatternSubscriptions != 0:
+		flags = "P"
+	case info.NoEvict:
+		flags = "e"
+	}
+
+	user := info.User
+	if len(user) == 0 {
+		user = "default"
+	}
+
+	return fmt.Sprintf(
+		"id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s sub=%d psub=%d qbuf=%d qbuf-free=%d obl=%d cmd=%s user=%s",
+		info.ID,
+		info.Addr,
+		info.LocalAddr,
+		info.Name,
+		int64(now.Sub(info.CreatedAt)/time.Second),
+		int64(now.Sub(info.LastInteraction)/time.Second),
+		flags,
+		info.Subscriptions,
+		info.PatternSubscriptions,
+		info.ReadBuffer,
+		info.ReadBufferFree,
+		info.WriteBuffer,
+		info.LastCmd,
+		user,
+	)
+}
+
+// clientState is the state of the client of a server connection. It is written
+// by the goroutine serving the connection, and read by others with CLIENT LIST
+// or Server.Connections.
+type clientState struct {
+	mutex     sync.Mutex
+	id        uint64
+	name      string
+	user      string
+	createdAt time.Time
+	lastAt    time.Time
+	lastCmd   string
+	qbuf      int
+	qbufFree  int
+	obl       int
+	noEvict   bool
+	killed    bool
+	monitor   bool
+	subs      int
+	psubs     int
+}
+
+// beginRequest records the start of a request made of cmds on c.
+func (c *Conn) beginRequest(cmds []string, now time.Time) {
+	qbuf := c.rbuffer.Buffered()
+	qbufFree := c.rbuffer.Size() - qbuf
+
+	c.client.mutex.Lock()
+	c.client.lastAt = now
+	c.client.qbuf = qbuf
+	c.client.qbufFree = qbufFree
+
+	if len(cmds) != 0 {
+		c.client.lastCmd = strings.ToLower(cmds[len(cmds)-1])
+	}
+
+	c.client.mutex.Unlock()
+}
+
+// endRequest records the end of a request on c.
+func (c *Conn) endRequest(now time.Time) {
+	// The buffers of hijacked connections are owned by the handler which took
+	// them over, only the time of the request is recorded.
+	if state, _ := c.getState(); state == http.StateHijacked {
+		c.client.mutex.Lock()
+		c.client.lastAt = now
+		c.client.mutex.Unlock()
+		return
+	}
+
+	obl := c.wbuffer.Buffered()
+
+	c.client.mutex.Lock()
+	c.client.lastAt = now
+	c.client.obl = obl
+	c.client.mutex.Unlock()
+}
+
+func (c *Conn) setUser(user string) {
+	c.client.mutex.Lock()
+	c.user = user
+	c.client.user = user
+	c.client.mutex.Unlock()
+}
+
+// setName sets the name of the connection, or returns the error to answer the
+// client with if the name is invalid.
+func (c *Conn) setName(name string) error {
+	for _, r := range name {
+		if r <= ' ' || r > '~' {
+			return errorf("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+	}
+
+	c.client.mutex.Lock()
+	c.client.name = name
+	c.client.mutex.Unlock()
+	return nil
+}
+
+// kill marks the connection to be closed by the goroutine serving it after it
+// answered the current request.
+func (c *Conn) kill() {
+	c.client.mutex.Lock()
+	c.client.killed = true
+	c.client.mutex.Unlock()
+}
+
+func (c *Conn) killed() bool {
+	c.client.mutex.Lock()
+	defer c.client.mutex.Unlock()
+	return c.client.killed
+}
+
+func (c *Conn) info() ConnInfo {
+	c.client.mutex.Lock()
+	defer c.client.mutex.Unlock()
+
+	return ConnInfo{
+		ID:                   c.client.id,
+		Name:                 c.client.name,
+		User:                 c.client.user,
+		Addr:                 c.RemoteAddr().String(),
+		LocalAddr:            c.LocalAddr().String(),
+		CreatedAt:            c.client.createdAt,
+		LastInteraction:      c.client.lastAt,
+		LastCmd:              c.client.lastCmd,
+		ReadBuffer:           c.client.qbuf,
+		ReadBufferFree:       c.client.qbufFree,
+		WriteBuffer:          c.client.obl,
+		NoEvict:              c.client.noEvict,
+		Monitor:              c.client.monitor,
+		Subscriptions:        c.client.subs,
+		PatternSubscriptions: c.client.psubs,
+	}
+}
+
+// Connections returns the description of the client connections of the server,
+// ordered by ID. Hijacked connections are not included.
+func (s *Server) Connections() []ConnInfo {
+	conns := s.clientConns()
+	infos := make([]ConnInfo, len(conns))
+
+	for i, c := range conns {
+		infos[i] = c.info()
+	}
+
+	return infos
+}
+
+// clientConns returns the connections of the server ordered by ID.
+func (s *Server) clientConns() []*Conn {
+	s.mutex.Lock()
+	conns := make([]*Conn, 0, len(s.connections))
+
+	for c := range s.connections {
+		conns = append(conns, c)
+	}
+
+	s.mutex.Unlock()
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].clientID() < conns[j].clientID()
+	})
+
+	return conns
+}
+
+func (c *Conn) clientID() uint64 {
+	c.client.mutex.Lock()
+	defer c.client.mutex.Unlock()
+	return c.client.id
+}
+
+// clientPause is the state of the server set by CLIENT PAUSE.
+type clientPause struct {
+	until  time.Time
+	writes bool
+	done   chan struct{}
+}
+
+// applies returns true if the commands of cmds must wait for the pause to end.
+func (p *clientPause) applies(cmds []Command) bool {
+	if !p.writes {
+		return true
+	}
+
+	for _, cmd := range cmds {
+		if info := LookupCommand(cmd.Cmd); info != nil && info.HasFlag("write") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// waitPause blocks until the server is not paused for cmds, or ctx is canceled.
+func (s *Server) waitPause(ctx context.Context, cmds []Command) {
+	for {
+		s.mutex.Lock()
+		p := s.pause
+		s.mutex.Unlock()
+
+		if p == nil || !p.applies(cmds) {
+			return
+		}
+
+		wait := time.Until(p.until)
+		if wait <= 0 {
+			return
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+		case <-p.done:
+		case <-ctx.Done():
+		}
+
+		timer.Stop()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) setPause(p *clientPause) {
+	s.mutex.Lock()
+
+	if s.pause != nil {
+		close(s.pause.done)
+	}
+
+	s.pause = p
+	s.mutex.Unlock()
+}
+
+// client answers the CLIENT command cmd received on the connection c.
+func (s *Server) client(c *Conn, cmd Command) interface{} {
+	var args []string
+
+	if err := cmd.ParseArgs(&args); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errorf("ERR wrong number of arguments for 'client' command")
+	}
+
+	sub, args := strings.ToUpper(args[0]), args[1:]
+
+	switch {
+	case sub == "ID" && len(args) == 0:
+		return int64(c.clientID())
+
+	case sub == "INFO" && len(args) == 0:
+		return c.info().String() + "\n"
+
+	case sub == "LIST":
+		return s.clientList(args)
+
+	case sub == "KILL" && len(args) != 0:
+		return s.clientKill(c, args)
+
+	case sub == "SETNAME" && len(args) == 1:
+		if err := c.setName(args[0]); err != nil {
+			return err
+		}
+		return "OK"
+
+	case sub == "GETNAME" && len(args) == 0:
+		if name := c.info().Name; len(name) != 0 {
+			return name
+		}
+		return nil
+
+	case sub == "PAUSE" && (len(args) == 1 || len(args) == 2):
+		ms, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil || ms < 0 {
+			return errorf("ERR timeout is not an integer or out of range")
+		}
+
+		if ms > math.MaxInt64/int64(time.Millisecond) {
+			return errorf("ERR timeout is out of range")
+		}
+
+		p := &clientPause{
+			until: time.Now().Add(time.Duration(ms) * time.Millisecond),
+			done:  make(chan struct{}),
+		}
+
+		if len(args) == 2 {
+			switch strings.ToUpper(args[1]) {
+			case "WRITE":
+				p.writes = true
+			case "ALL":
+			default:
+				return errorf("ERR syntax error")
+			}
+		}
+
+		s.setPause(p)
+		return "OK"
+
+	case sub == "UNPAUSE" && len(args) == 0:
+		s.setPause(nil)
+		return "OK"
+
+	case sub == "NO-EVICT" && len(args) == 1:
+		var on bool
+
+		switch strings.ToUpper(args[0]) {
+		case "ON":
+			on = true
+		case "OFF":
+		default:
+			return errorf("ERR syntax error")
+		}
+
+		c.client.mutex.Lock()
+		c.client.noEvict = on
+		c.client.mutex.Unlock()
+		return "OK"
+
+	case sub == "TRACKING":
+		return s.clientTracking(c, args)
+
+	case sub == "CACHING" && len(args) == 1:
+		return s.clientCaching(c, args[0])
+
+	case sub == "GETREDIR" && len(args) == 0:
+		return s.clientGetRedir(c)
+	}
+
+	return errorf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try CLIENT HELP.", strings.ToLower(sub))
+}
+
+// clientList answers CLIENT LIST [TYPE type] [ID id ...].
+func (s *Server) clientList(args []string) interface{} {
+	var (
+		ids    map[uint64]bool
+		none   bool
+		pubsub *bool
+	)
+
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "TYPE":
+			if i++; i == len(args) {
+				return errorf("ERR syntax error")
+			}
+
+			// The clients of the server are normal clients, or subscribers
+			// in Pub/Sub mode.
+			switch t := strings.ToLower(args[i]); t {
+			case "normal", "pubsub":
+				isPubSub := t == "pubsub"
+				pubsub = &isPubSub
+			case "master", "replica":
+				none = true
+			default:
+				return errorf("ERR Unknown client type '%s'", args[i])
+			}
+
+		case "ID":
+			if i+1 == len(args) {
+				return errorf("ERR syntax error")
+			}
+
+			ids = make(map[uint64]bool)
+
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseUint(args[i], 10, 64)
+				if err != nil || id == 0 {
+					return errorf("ERR Invalid client ID")
+				}
+				ids[id] = true
+			}
+
+		default:
+			return errorf("ERR syntax error")
+		}
+	}
+
+	var (
+		buf bytes.Buffer
+		now = time.Now()
+	)
+
+	if none {
+		return ""
+	}
+
+	for _, c := range s.clientConns() {
+		info := c.info()
+
+		if ids != nil && !ids[info.ID] {
+			continue
+		}
+
+		if pubsub != nil && *pubsub != (info.Subscriptions != 0 || info.PatternSubscriptions != 0) {
+			continue
+		}
+
+		buf.WriteString(info.format(now))
+		buf.WriteByte('\n')
+	}
+
+	return buf.String()
+}
+
+// clientKill answers CLIENT KILL addr, or CLIENT KILL with filters.
+func (s *Server) clientKill(self *Conn, args []string) interface{} {
+	// The old form takes the address of the client, and fails if there is no
+	// such client.
+	if len(args) == 1 {
+		for _, c := range s.clientConns() {
+			if c.RemoteAddr().String() == args[0] {
+				s.killConn(self, c)
+				return "OK"
+			}
+		}
+		return errorf("ERR No such client")
+	}
+
+	if len(args)%2 != 0 {
+		return errorf("ERR syntax error")
+	}
+
+	var (
+		filters []func(ConnInfo) bool
+		skipMe  = true
+	)
+
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+
+		switch strings.ToUpper(args[i]) {
+		case "ID":
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || id == 0 {
+				return errorf("ERR client-id should be greater than 0")
+			}
+			filters = append(filters, func(info ConnInfo) bool { return info.ID == id })
+
+		case "ADDR":
+			filters = append(filters, func(info ConnInfo) bool { return info.Addr == value })
+
+		case "LADDR":
+			filters = append(filters, func(info ConnInfo) bool { return info.LocalAddr == value })
+
+		case "USER":
+			filters = append(filters, func(info ConnInfo) bool { return info.User == value })
+
+		case "TYPE":
+			if !strings.EqualFold(value, "normal") {
+				filters = append(filters, func(ConnInfo) bool { return false })
+			}
+
+		case "SKIPME":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return errorf("ERR syntax error")
+			}
+
+		default:
+			return errorf("ERR syntax error")
+		}
+	}
+
+	killed := int64(0)
+
+	for _, c := range s.clientConns() {
+		if c == self && skipMe {
+			continue
+		}
+
+		info, match := c.info(), true
+
+		for _, f := range filters {
+			if match = f(info); !match {
+				break
+			}
+		}
+
+		if match {
+			s.killConn(self, c)
+			killed++
+		}
+	}
+
+	return killed
+}
+
+// killConn closes the connection c, or marks it to be closed after its reply
+// if c is the connection of the client which killed it.
+func (s *Server) killConn(self *Conn, c *Conn) {
+	if c == self {
+		c.kill()
+	} else {
+		c.Close()
+	}
+}
@@ -0,0 +1,275 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+)
+
+func TestServerClients(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, *redis.Server, string)
+	}{
+		{
+			scenario: "CLIENT LIST and CLIENT INFO describe the connections",
+			function: testServerClientsList,
+		},
+		{
+			scenario: "CLIENT SETNAME sets the name returned by CLIENT GETNAME",
+			function: testServerClientsName,
+		},
+		{
+			scenario: "CLIENT KILL closes the connections matching its filters",
+			function: testServerClientsKill,
+		},
+		{
+			scenario: "CLIENT PAUSE delays commands until CLIENT UNPAUSE",
+			function: testServerClientsPause,
+		},
+		{
+			scenario: "Server.Connections describes the connections",
+			function: testServerClientsConnections,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			srv := &redis.Server{
+				Authenticate: func(user string, password string) error {
+					if password != user+"-password" {
+						return errors.New("invalid password")
+					}
+					return nil
+				},
+				EnableBuiltins: true,
+			}
+			addr := startServer(t, srv)
+			defer srv.Close()
+
+			testFunc(t, ctx, srv, addr)
+		})
+	}
+}
+
+// dialAuthConn opens a connection to addr authenticated as user.
+func dialAuthConn(t *testing.T, addr string, user string) *clientConn {
+	conn := dialClientConn(t, addr)
+
+	var status string
+	if err := conn.query(&status, "AUTH", user, user+"-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+// parseClientList parses the reply of CLIENT LIST into a list of fields.
+func parseClientList(list string) []map[string]string {
+	var clients []map[string]string
+
+	for _, line := range strings.Split(strings.TrimSuffix(list, "\n"), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := map[string]string{}
+
+		for _, f := range strings.Split(line, " ") {
+			if i := strings.IndexByte(f, '='); i >= 0 {
+				fields[f[:i]] = f[i+1:]
+			}
+		}
+
+		clients = append(clients, fields)
+	}
+
+	return clients
+}
+
+func testServerClientsList(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	alice, bob := dialAuthConn(t, addr, "alice"), dialAuthConn(t, addr, "bob")
+	defer alice.Close()
+	defer bob.Close()
+
+	var name string
+	it.Nil(bob.query(&name, "GET", "key"))
+
+	var list string
+	it.Nil(alice.query(&list, "CLIENT", "LIST"))
+
+	clients := parseClientList(list)
+	if !it.Equal(2, len(clients)) {
+		return
+	}
+
+	it.Equal("alice", clients[0]["user"])
+	it.Equal("client", clients[0]["cmd"])
+	it.Equal("bob", clients[1]["user"])
+	it.Equal("get", clients[1]["cmd"])
+	it.Equal("N", clients[1]["flags"])
+	it.Equal(bob.LocalAddr().String(), clients[1]["addr"])
+
+	for _, field := range []string{"id", "age", "idle", "qbuf", "qbuf-free", "obl"} {
+		_, err := strconv.Atoi(clients[1][field])
+		it.Nil(err, field)
+	}
+
+	var id int64
+	it.Nil(bob.query(&id, "CLIENT", "ID"))
+	it.Equal(clients[1]["id"], strconv.FormatInt(id, 10))
+
+	it.Nil(alice.query(&list, "CLIENT", "LIST", "ID", strconv.FormatInt(id, 10)))
+	it.Equal(1, len(parseClientList(list)))
+
+	var info string
+	it.Nil(bob.query(&info, "CLIENT", "INFO"))
+
+	if fields := parseClientList(info); it.Equal(1, len(fields)) {
+		it.Equal(clients[1]["id"], fields[0]["id"])
+	}
+
+	it.Nil(bob.query(&info, "CLIENT", "NO-EVICT", "on"))
+	it.Nil(bob.query(&info, "CLIENT", "INFO"))
+	it.Contains(info, " flags=e ")
+}
+
+func testServerClientsName(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	conn := dialAuthConn(t, addr, "alice")
+	defer conn.Close()
+
+	var name []byte
+	it.Nil(conn.query(&name, "CLIENT", "GETNAME"))
+	it.Nil(name)
+
+	var status string
+	it.Nil(conn.query(&status, "CLIENT", "SETNAME", "worker-1"))
+	it.Equal("OK", status)
+
+	it.Nil(conn.query(&name, "CLIENT", "GETNAME"))
+	it.Equal("worker-1", string(name))
+
+	it.NotNil(conn.query(&status, "CLIENT", "SETNAME", "worker 1"))
+}
+
+func testServerClientsKill(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	admin := dialAuthConn(t, addr, "admin")
+	defer admin.Close()
+
+	alice1, alice2, bob := dialAuthConn(t, addr, "alice"), dialAuthConn(t, addr, "alice"), dialAuthConn(t, addr, "bob")
+	defer alice1.Close()
+	defer alice2.Close()
+	defer bob.Close()
+
+	var n int
+	it.Nil(admin.query(&n, "CLIENT", "KILL", "USER", "alice"))
+	it.Equal(2, n)
+
+	var status string
+	it.Nil(admin.query(&status, "CLIENT", "KILL", bob.LocalAddr().String()))
+	it.Equal("OK", status)
+
+	for _, conn := range []*clientConn{alice1, alice2, bob} {
+		var name string
+		it.NotNil(conn.query(&name, "GET", "key"), "the connection should have been closed")
+	}
+
+	err := admin.query(&status, "CLIENT", "KILL", bob.LocalAddr().String())
+	if it.NotNil(err) {
+		it.Equal("ERR No such client", err.Error())
+	}
+
+	// the connection which killed itself receives the response first
+	it.Nil(admin.query(&n, "CLIENT", "KILL", "USER", "admin", "SKIPME", "no"))
+	it.Equal(1, n)
+
+	var name string
+	it.NotNil(admin.query(&name, "GET", "key"))
+}
+
+func testServerClientsPause(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	admin, conn := dialAuthConn(t, addr, "admin"), dialAuthConn(t, addr, "alice")
+	defer admin.Close()
+	defer conn.Close()
+
+	var status, name string
+
+	err := admin.query(&status, "CLIENT", "PAUSE", "9300000000000")
+	if it.NotNil(err) {
+		it.Equal("ERR timeout is out of range", err.Error())
+	}
+
+	it.Nil(admin.query(&status, "CLIENT", "PAUSE", "10000", "WRITE"))
+
+	// reads are not paused in WRITE mode
+	it.Nil(conn.query(&name, "GET", "key"))
+
+	done := make(chan error, 1)
+	go func() { done <- conn.query(&name, "SET", "key", "value") }()
+
+	select {
+	case err := <-done:
+		t.Error("the write was not paused:", err)
+		return
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	it.Nil(admin.query(&status, "CLIENT", "UNPAUSE"))
+
+	select {
+	case err := <-done:
+		it.Nil(err)
+		it.Equal("SET", name)
+	case <-ctx.Done():
+		t.Error("the write was not resumed")
+	}
+}
+
+func testServerClientsConnections(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	conn := dialAuthConn(t, addr, "alice")
+	defer conn.Close()
+
+	var status string
+	it.Nil(conn.query(&status, "CLIENT", "SETNAME", "worker"))
+
+	conns := srv.Connections()
+	if !it.Equal(1, len(conns)) {
+		return
+	}
+
+	info := conns[0]
+	it.Equal("worker", info.Name)
+	it.Equal("alice", info.User)
+	it.Equal("client", info.LastCmd)
+	it.Equal(conn.LocalAddr().String(), info.Addr)
+	it.False(info.CreatedAt.IsZero())
+	it.True(strings.HasPrefix(info.String(), "id="+strconv.FormatUint(info.ID, 10)+" addr="+info.Addr))
+
+	// closed connections are removed
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	it.Equal(0, len(srv.Connections()))
+}
@@ -4,17 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/dolab/objconv/yaml"
 	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/consul"
 	"github.com/segmentio/conf"
-	consul "github.com/segmentio/consul-go"
 	"github.com/segmentio/events"
 	eventslog "github.com/segmentio/events/log"
 	"github.com/segmentio/stats"
@@ -23,22 +26,31 @@ import (
 )
 
 type proxyConfig struct {
-	Bind      string `conf:"bind"      help:"Address on which the proxy is listening for incoming connections, in ip:port format." validate:"nonzero"`
-	Upstream  string `conf:"upstream"  help:"URL or comma-separated list of upstream servers."                                     validate:"nonzero"`
-	Dogstatsd string `conf:"dogstatsd" help:"Address of the dogstatsd agent to send metrics to, in ip:port format."                validate:"nonzero"`
-	Debug     bool   `conf:"debug"     help:"Enable debug mode."`
+	Bind          string            `conf:"bind"           help:"Address on which the proxy is listening for incoming connections, in ip:port format." validate:"nonzero"`
+	Upstream      string            `conf:"upstream"       help:"URL or comma-separated list of upstream servers."                                     validate:"nonzero"`
+	MigrateFrom   string            `conf:"migrate-from"   help:"URL or comma-separated list of the upstream servers to migrate keys from."`
+	CopyOnRead    bool              `conf:"copy-on-read"   help:"Migrate the keys read by clients instead of reading them from their old server."`
+	Allow         []string          `conf:"allow"          help:"Commands and @categories that clients are allowed to send, all commands if empty."`
+	Deny          []string          `conf:"deny"           help:"Commands and @categories that clients are not allowed to send, none if empty (@dangerous denies the administrative commands)."`
+	RenameCommand map[string]string `conf:"rename-command" help:"Map of commands to the names that clients must use instead, an empty name disables a command."`
+	MaxClients    int               `conf:"maxclients"     help:"Maximum number of client connections, unlimited if zero."`
+	Builtins      bool              `conf:"builtins"       help:"Answer CLIENT, CONFIG, INFO, MONITOR, SLOWLOG and LATENCY in the proxy, bypassing the allow and deny lists."`
+	Dogstatsd     string            `conf:"dogstatsd"      help:"Address of the dogstatsd agent to send metrics to, in ip:port format."                validate:"nonzero"`
+	Debug         bool              `conf:"debug"          help:"Enable debug mode."`
 }
 
 func proxy(args []string) (err error) {
 	config := proxyConfig{
-		Bind:      ":6479",
-		Dogstatsd: "127.0.0.1:8125",
+		Bind:       ":6479",
+		MaxClients: 10000,
+		Dogstatsd:  "127.0.0.1:8125",
 	}
 
 	conf.LoadWith(&config, conf.Loader{
 		Name: "red proxy",
 		Args: args,
 		Sources: []conf.Source{
+			conf.NewFileSource("config-file", nil, ioutil.ReadFile, yaml.Unmarshal),
 			conf.NewEnvSource("RED", os.Environ()...),
 		},
 	})
@@ -95,32 +107,70 @@ func makeProxyServer(eng *stats.Engine, config proxyConfig) *redis.Server {
 	up := eng.WithTags(stats.Tag{"side", "upstream"})
 	down := eng.WithTags(stats.Tag{"side", "downstream"})
 	return &redis.Server{
-		Handler:      redisstats.NewHandlerWith(down, makeReverseProxy(up, logger, config)),
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  90 * time.Second,
-		ErrorLog:     logger,
+		Handler:        redisstats.NewHandlerWith(down, makeCommandPolicy(config, makeReverseProxy(up, logger, config))),
+		ReadTimeout:    30 * time.Second,
+		WriteTimeout:   30 * time.Second,
+		IdleTimeout:    90 * time.Second,
+		MaxConns:       config.MaxClients,
+		EnableBuiltins: config.Builtins,
+		ErrorLog:       logger,
 	}
 }
 
 func makeReverseProxy(eng *stats.Engine, logger *log.Logger, config proxyConfig) redis.Handler {
-	return &redis.ReverseProxy{
-		Transport: makeTransport(eng, config),
-		Registry:  makeRegistry(config.Upstream),
+	transport := makeTransport(config)
+
+	proxy := &redis.ReverseProxy{
+		Transport: redisstats.NewTransportWith(eng, transport),
+		Registry:  makeRegistry(config.Upstream, transport, logger),
 		ErrorLog:  logger,
 	}
+
+	if len(config.MigrateFrom) != 0 {
+		proxy.Migration = &redis.Migration{
+			From:       makeRegistry(config.MigrateFrom, transport, logger),
+			CopyOnRead: config.CopyOnRead,
+			ErrorLog:   logger,
+		}
+
+		events.Log("migrating keys from '%{redis_old_upstream}s' to '%{redis_new_upstream}s'", config.MigrateFrom, config.Upstream)
+	}
+
+	return proxy
 }
 
-func makeTransport(eng *stats.Engine, config proxyConfig) redis.RoundTripper {
-	return redisstats.NewTransportWith(eng, &redis.Transport{
+func makeCommandPolicy(config proxyConfig, handler redis.Handler) redis.Handler {
+	if len(config.Allow) == 0 && len(config.Deny) == 0 && len(config.RenameCommand) == 0 {
+		return handler
+	}
+
+	return &redis.CommandPolicy{
+		Handler: handler,
+		Allow:   config.Allow,
+		Deny:    config.Deny,
+		Rename:  config.RenameCommand,
+	}
+}
+
+func makeTransport(config proxyConfig) *redis.Transport {
+	return &redis.Transport{
 		PingTimeout:  10 * time.Second,
 		PingInterval: 15 * time.Second,
-	})
+	}
 }
 
-func makeRegistry(upstream string) (registry redis.ServerRegistry) {
+func makeRegistry(upstream string, transport *redis.Transport, logger *log.Logger) (registry redis.ServerRegistry) {
 	if strings.Index(upstream, "://") < 0 {
-		registry = makeStaticRegistry(upstream)
+		registry = makeHealthCheckedRegistry(makeStaticRegistry(upstream), transport)
+	} else if strings.HasPrefix(upstream, "sentinel://") {
+		// The list of sentinels isn't a valid URL host, it is parsed by hand.
+		registry = makeSentinelRegistry(strings.TrimPrefix(upstream, "sentinel://"), transport)
+	} else if strings.HasPrefix(upstream, "file://") {
+		registry = makeHealthCheckedRegistry(makeFileRegistry(strings.TrimPrefix(upstream, "file://"), logger), transport)
+	} else if strings.HasPrefix(upstream, "dns://") {
+		// SRV names start with underscores which aren't valid URL hosts, the
+		// name is parsed by hand.
+		registry = makeHealthCheckedRegistry(makeDNSRegistry(strings.TrimPrefix(upstream, "dns://"), logger), transport)
 	} else {
 		u, err := url.Parse(upstream)
 		if err != nil {
@@ -139,6 +189,24 @@ func makeRegistry(upstream string) (registry redis.ServerRegistry) {
 	return
 }
 
+// makeHealthCheckedRegistry wraps the registries which don't check the health
+// of the servers themselves, unlike sentinel and consul.
+func makeHealthCheckedRegistry(registry redis.ServerRegistry, transport *redis.Transport) *redis.HealthCheckedRegistry {
+	return &redis.HealthCheckedRegistry{
+		Registry:  registry,
+		Transport: transport,
+		OnHealthChange: func(endpoint redis.ServerEndpoint, healthy bool) {
+			if healthy {
+				stats.Incr("health_check.recovery.count")
+				events.Log("upstream redis server '%{redis_server_addr}s' is healthy", endpoint.Addr)
+			} else {
+				stats.Incr("health_check.failure.count")
+				events.Log("upstream redis server '%{redis_server_addr}s' is unhealthy", endpoint.Addr)
+			}
+		},
+	}
+}
+
 func makeStaticRegistry(upstream string) redis.ServerList {
 	addrs := strings.Split(upstream, ",")
 	servers := make(redis.ServerList, len(addrs))
@@ -162,76 +230,99 @@ func makeStaticRegistry(upstream string) redis.ServerList {
 	return servers
 }
 
-func makeConsulRegistry(u *url.URL) *consulRegistry {
-	v := u.Query()
-
-	r := &consulRegistry{
-		service: strings.TrimPrefix(u.Path, "/"),
-		cluster: v.Get("cluster"),
-		client: &consul.Client{
-			Address:    u.Host,
-			UserAgent:  fmt.Sprintf("RED (github.com/dolab/redis-go, version %s)", version),
-			Datacenter: v.Get("dc"),
-		},
-		resolver: &consul.Resolver{
-			OnlyPassing: true,
-			Cache: &consul.ResolverCache{
-				CacheTimeout: 10 * time.Second,
-			},
-			Blacklist: &consul.ResolverBlacklist{},
-		},
+func makeSentinelRegistry(upstream string, transport *redis.Transport) *redis.SentinelRegistry {
+	i := strings.IndexByte(upstream, '/')
+	if i < 0 || i == len(upstream)-1 {
+		panic("missing master name in sentinel upstream: sentinel://" + upstream)
 	}
 
-	if len(r.cluster) != 0 {
-		r.resolver.ServiceTags = []string{"redis-cluster:" + r.cluster}
+	r := &redis.SentinelRegistry{
+		Sentinels:  strings.Split(upstream[:i], ","),
+		MasterName: upstream[i+1:],
+		Transport:  transport,
+		OnFailover: func(from redis.ServerEndpoint, to redis.ServerEndpoint) {
+			stats.Incr("sentinel_failover.count")
+			events.Log("failover of '%{redis_master_name}s' from '%{redis_old_addr}s' to '%{redis_new_addr}s'", to.Name, from.Addr, to.Addr)
+		},
 	}
 
-	r.resolver.Client = r.client
-
-	events.Log("using '%{redis_service_name}s' services of the '%{redis_cluster_name}s' from the consul registry at '%{consul_addr}s'",
-		r.cluster,
-		r.service,
-		r.client.Address,
-	)
+	events.Log("using the '%{redis_master_name}s' master of the sentinels at '%{sentinel_addrs}v'", r.MasterName, r.Sentinels)
 
 	var _ redis.ServerBlacklist = r
 	return r
 }
 
-type consulRegistry struct {
-	service  string
-	cluster  string
-	client   *consul.Client
-	resolver *consul.Resolver
+func makeFileRegistry(path string, logger *log.Logger) *redis.FileRegistry {
+	r := &redis.FileRegistry{
+		Path:     path,
+		ErrorLog: logger,
+	}
+
+	events.Log("using the list of upstream redis servers from '%{file_path}s'", path)
+	return r
 }
 
-func (r *consulRegistry) LookupServers(ctx context.Context) ([]redis.ServerEndpoint, error) {
-	endpoints, err := r.resolver.LookupService(ctx, r.service)
-	if err != nil {
-		return nil, err
+func makeDNSRegistry(upstream string, logger *log.Logger) *redis.DNSRegistry {
+	r := &redis.DNSRegistry{
+		Name:     upstream,
+		ErrorLog: logger,
 	}
 
-	servers := make([]redis.ServerEndpoint, len(endpoints))
-
-	for i, e := range endpoints {
-		servers[i] = redis.ServerEndpoint{
-			Name: e.ID,
-			Addr: e.Addr.String(),
+	if host, port, err := net.SplitHostPort(upstream); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			panic("invalid port in dns upstream: dns://" + upstream)
 		}
+		r.Name, r.Port = host, p
+	}
+
+	// Service names like _redis._tcp.redis.svc.cluster.local have SRV records
+	// which carry the ports of the servers.
+	r.SRV = strings.HasPrefix(r.Name, "_")
+
+	if r.SRV {
+		events.Log("using the SRV records of '%{dns_name}s' as the list of upstream redis servers", r.Name)
+	} else {
+		events.Log("using the A and AAAA records of '%{dns_name}s' as the list of upstream redis servers", r.Name)
 	}
 
-	return servers, nil
+	return r
 }
 
-func (r *consulRegistry) BlacklistServer(server redis.ServerEndpoint) {
-	stats.Incr("blacklist_server.count")
-	r.resolver.Blacklist.Blacklist(stringAddr(server.Addr), time.Now().Add(10*time.Second))
+func makeConsulRegistry(u *url.URL) *consulRegistry {
+	v := u.Query()
+
+	r := &consulRegistry{&consul.Registry{
+		Address:    u.Host,
+		Service:    strings.TrimPrefix(u.Path, "/"),
+		Datacenter: v.Get("dc"),
+		UserAgent:  fmt.Sprintf("RED (github.com/dolab/redis-go, version %s)", version),
+	}}
+
+	cluster := v.Get("cluster")
+	if len(cluster) != 0 {
+		r.Tags = []string{"redis-cluster:" + cluster}
+	}
+
+	events.Log("using '%{redis_service_name}s' services of the '%{redis_cluster_name}s' from the consul registry at '%{consul_addr}s'",
+		r.Service,
+		cluster,
+		r.Address,
+	)
+
+	var _ redis.ServerBlacklist = r
+	return r
 }
 
-type stringAddr string
+// consulRegistry counts the servers blacklisted by the proxy.
+type consulRegistry struct {
+	*consul.Registry
+}
 
-func (a stringAddr) Network() string { return "" }
-func (a stringAddr) String() string  { return string(a) }
+func (r *consulRegistry) BlacklistServer(server redis.ServerEndpoint) {
+	stats.Incr("blacklist_server.count")
+	r.Registry.BlacklistServer(server)
+}
 
 func convertPanicToError(v interface{}) error {
 	switch x := v.(type) {
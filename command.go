@@ -8,6 +8,21 @@ import (
 
 	"github.com/dolab/objconv"
 	"github.com/dolab/objconv/objutil"
+	"github.com/dolab/objconv/resp"
+)
+
+var (
+	// errInvalidBulkLength is the error returned when reading a bulk string
+	// longer than the limit of a command reader.
+	errInvalidBulkLength = resp.NewError("ERR Protocol error: invalid bulk length")
+
+	// errInvalidMultiBulkLength is the error returned when reading a command
+	// with more arguments than the limit of a command reader.
+	errInvalidMultiBulkLength = resp.NewError("ERR Protocol error: invalid multibulk length")
+
+	// errRequestTooLarge is the error returned when reading a request larger
+	// than the limit of a command reader.
+	errRequestTooLarge = resp.NewError("ERR Protocol error: request is too large")
 )
 
 // A Command represent a Redis command used withing a Request.
@@ -91,6 +106,10 @@ func (cmd *Command) pipeCommand() (pipe Command, err error) {
 				err = ErrNotPipeline
 			}
 		}
+
+	default:
+		// arguments loaded in memory are detached from the connection
+		err = ErrNotPipeline
 	}
 
 	return
@@ -167,6 +186,7 @@ func (r *CommandReader) Close() error {
 		if !r.done || err != nil {
 			r.conn.Close()
 		}
+		r.conn.request.reset(0)
 		r.conn.rmutex.Unlock()
 		r.conn = nil
 	}
@@ -212,6 +232,20 @@ func (r *CommandReader) Read(cmd *Command) bool {
 	return true
 }
 
+// limitErr returns the error of r if it failed because the request exceeded
+// the limits of the connection.
+func (r *CommandReader) limitErr() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch r.err {
+	case errInvalidBulkLength, errInvalidMultiBulkLength, errRequestTooLarge:
+		return r.err
+	}
+
+	return nil
+}
+
 func (r *CommandReader) resetReader() {
 	r.done = false
 }
@@ -227,6 +261,11 @@ func newCmdArgsReader(r *CommandReader, cmd *Command) *cmdArgsReader {
 
 	args := &cmdArgsReader{r: r, cmd: cmd}
 	args.b = args.a[:0]
+
+	if r.conn != nil && r.conn.argv.command(cmd.Cmd) {
+		args.argv = &r.conn.argv
+	}
+
 	return args
 }
 
@@ -237,14 +276,24 @@ type cmdArgsReader struct {
 	r    *CommandReader
 	b    []byte
 	a    [128]byte
+
+	// set if the arguments are recorded for the slow log
+	argv *slowLogArgs
 }
 
 func (args *cmdArgsReader) Close() error {
 	args.once.Do(func() {
 		var err error
 
-		for args.r.dec.Decode(nil) == nil {
-			// discard all remaining values
+		if args.argv != nil {
+			// the arguments that the handler didn't read are recorded too
+			for args.b = args.b[:0]; args.r.dec.Decode(&args.b) == nil; args.b = args.b[:0] {
+				args.argv.add(args.b)
+			}
+		} else {
+			for args.r.dec.Decode(nil) == nil {
+				// discard all remaining values
+			}
 		}
 
 		err = args.r.dec.Err()
@@ -276,6 +325,14 @@ func (args *cmdArgsReader) Next(val interface{}) bool {
 		return false
 	}
 
+	if isAggregate(val) {
+		ok, err := decodeArgs(args, val)
+		if err != nil {
+			args.err = err
+		}
+		return ok && err == nil
+	}
+
 	if args.r.dec.Len() != 0 {
 		t, _ := args.r.dec.Parser.ParseType()
 		if t == objconv.Error {
@@ -302,6 +359,10 @@ func (args *cmdArgsReader) Next(val interface{}) bool {
 		}
 	}
 
+	if args.argv != nil {
+		args.argv.add(args.b)
+	}
+
 	return true
 }
 
@@ -0,0 +1,301 @@
+package redis
+
+//go:generate go run ./internal/gencommands -input commands.json -output commands_gen.go
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Z represents a member of a sorted set and its score.
+type Z struct {
+	Score  float64
+	Member interface{}
+}
+
+// CommandInfo describes a redis command, the values are generated from the
+// command spec in commands.json and follow the format of the COMMAND reply.
+type CommandInfo struct {
+	// Name of the command, in upper case.
+	Name string
+
+	// Group and Summary document what the command does.
+	Group   string
+	Summary string
+
+	// Arity is the number of arguments of the command, including the command
+	// name itself. A negative arity means the command accepts at least -Arity
+	// arguments.
+	Arity int
+
+	// Flags is the list of flags of the command, for example "readonly",
+	// "write", "fast" or "blocking".
+	Flags []string
+
+	// FirstKey, LastKey and KeyStep describe the positions of keys in the
+	// arguments of the command, where position 0 is the command name. A
+	// negative LastKey is relative to the end of the argument list.
+	FirstKey int
+	LastKey  int
+	KeyStep  int
+}
+
+// LookupCommand returns the description of the command with the given name,
+// or nil if the command is unknown. The lookup is case insensitive.
+func LookupCommand(name string) *CommandInfo {
+	if cmd := commandTable[name]; cmd != nil {
+		return cmd
+	}
+	return commandTable[strings.ToUpper(name)]
+}
+
+// HasFlag returns true if flag is one of the flags of the command.
+func (cmd *CommandInfo) HasFlag(flag string) bool {
+	for _, f := range cmd.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// IsReadOnly returns true if the command does not modify the keyspace.
+func (cmd *CommandInfo) IsReadOnly() bool {
+	return cmd.HasFlag("readonly")
+}
+
+// IsWrite returns true if the command may modify the keyspace.
+func (cmd *CommandInfo) IsWrite() bool {
+	return cmd.HasFlag("write")
+}
+
+// Categories returns the categories of the command, named after the ACL
+// categories of redis (without the "@" prefix), for example "keyspace",
+// "string", "read", "write", "fast", "slow", "admin" or "dangerous".
+func (cmd *CommandInfo) Categories() []string {
+	categories := make([]string, 0, 6)
+
+	switch cmd.Group {
+	case "generic":
+		categories = append(categories, "keyspace")
+	case "sorted-set":
+		categories = append(categories, "sortedset")
+	case "transactions":
+		categories = append(categories, "transaction")
+	default:
+		categories = append(categories, cmd.Group)
+	}
+
+	if cmd.IsReadOnly() {
+		categories = append(categories, "read")
+	}
+
+	if cmd.IsWrite() {
+		categories = append(categories, "write")
+	}
+
+	if cmd.HasFlag("fast") {
+		categories = append(categories, "fast")
+	} else {
+		categories = append(categories, "slow")
+	}
+
+	if cmd.HasFlag("blocking") {
+		categories = append(categories, "blocking")
+	}
+
+	if cmd.HasFlag("pubsub") && cmd.Group != "pubsub" {
+		categories = append(categories, "pubsub")
+	}
+
+	if cmd.HasFlag("admin") {
+		categories = append(categories, "admin", "dangerous")
+	} else if dangerousCommands[cmd.Name] {
+		categories = append(categories, "dangerous")
+	}
+
+	return categories
+}
+
+// dangerousCommands is the set of commands which are not administrative but
+// belong to the "dangerous" category.
+var dangerousCommands = map[string]bool{
+	"FLUSHALL": true,
+	"FLUSHDB":  true,
+	"KEYS":     true,
+	"MIGRATE":  true,
+	"RESTORE":  true,
+	"SORT":     true,
+	"SWAPDB":   true,
+}
+
+// KeyIndexes returns the indexes of the keys within the n arguments of a
+// command, not counting the command name.
+func (cmd *CommandInfo) KeyIndexes(n int) []int {
+	if cmd.FirstKey <= 0 || cmd.KeyStep <= 0 {
+		return nil
+	}
+
+	last := cmd.LastKey
+	if last < 0 {
+		last += n + 1
+	}
+	if last > n {
+		last = n
+	}
+	if last < cmd.FirstKey {
+		return nil
+	}
+
+	indexes := make([]int, 0, (last-cmd.FirstKey)/cmd.KeyStep+1)
+
+	for i := cmd.FirstKey; i <= last; i += cmd.KeyStep {
+		indexes = append(indexes, i-1)
+	}
+
+	return indexes
+}
+
+func replyStatus(args Args) error {
+	return ParseArgs(args, nil)
+}
+
+func replyValue(args Args) (v interface{}, err error) {
+	if err = ParseArgs(args, &v); err == nil && v == nil {
+		err = ErrNil
+	}
+	return
+}
+
+func replyString(args Args) (string, error) {
+	v, err := replyValue(args)
+	if err != nil {
+		return "", err
+	}
+	switch x := v.(type) {
+	case []byte:
+		return string(x), nil
+	case string:
+		return x, nil
+	default:
+		return fmt.Sprint(x), nil
+	}
+}
+
+func replyBytes(args Args) ([]byte, error) {
+	v, err := replyValue(args)
+	if err != nil {
+		return nil, err
+	}
+	switch x := v.(type) {
+	case []byte:
+		return x, nil
+	case string:
+		return []byte(x), nil
+	default:
+		return []byte(fmt.Sprint(x)), nil
+	}
+}
+
+func replyInt64(args Args) (i int64, err error) {
+	err = ParseArgs(args, &i)
+	return
+}
+
+// replyRank is like replyInt64 for the replies of ZRANK and ZREVRANK, which
+// are nil when the member doesn't exist. ErrNil is returned in that case, so
+// it can't be mistaken for the rank 0.
+func replyRank(args Args) (int64, error) {
+	v, err := replyValue(args)
+	if err != nil {
+		return 0, err
+	}
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case []byte:
+		return strconv.ParseInt(string(x), 10, 64)
+	default:
+		return 0, fmt.Errorf("redis: unexpected rank of type %T", v)
+	}
+}
+
+func replyBool(args Args) (bool, error) {
+	i, err := replyInt64(args)
+	return i != 0, err
+}
+
+func replyFloat64(args Args) (float64, error) {
+	s, err := replyString(args)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func replyStrings(args Args) (list []string, err error) {
+	err = ParseArgs(args, &list)
+	return
+}
+
+func replyValues(args Args) ([]interface{}, error) {
+	var list []interface{}
+
+	if err := ParseArgs(args, &list); err != nil {
+		return nil, err
+	}
+
+	for i, v := range list {
+		if b, ok := v.([]byte); ok {
+			list[i] = string(b)
+		}
+	}
+
+	return list, nil
+}
+
+func replyStringMap(args Args) (m map[string]string, err error) {
+	err = ParseArgs(args, &m)
+	return
+}
+
+func replyZ(args Args) ([]Z, error) {
+	var list []string
+
+	if err := ParseArgs(args, &list); err != nil {
+		return nil, err
+	}
+
+	if len(list)%2 != 0 {
+		return nil, fmt.Errorf("redis: odd number of values in a reply with scores: %d", len(list))
+	}
+
+	z := make([]Z, 0, len(list)/2)
+
+	for i := 0; i < len(list); i += 2 {
+		score, err := strconv.ParseFloat(list[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		z = append(z, Z{Score: score, Member: list[i]})
+	}
+
+	return z, nil
+}
+
+func replyScan(args Args) (cursor uint64, keys []string, err error) {
+	var reply struct {
+		_      struct{} `redis:",array"`
+		Cursor string
+		Keys   []string
+	}
+
+	if err = ParseArgs(args, &reply); err != nil {
+		return
+	}
+
+	cursor, err = strconv.ParseUint(reply.Cursor, 10, 64)
+	keys = reply.Keys
+	return
+}
@@ -0,0 +1,931 @@
+// Code generated by gencommands from commands.json; DO NOT EDIT.
+
+package redis
+
+import "context"
+
+// Append issues the APPEND command: Append a value to a key.
+func (c *Client) Append(ctx context.Context, key string, value interface{}) (int64, error) {
+	return replyInt64(c.Query(ctx, "APPEND", key, value))
+}
+
+// ConfigGet issues the CONFIG command: Get the value of configuration parameters.
+func (c *Client) ConfigGet(ctx context.Context, parameter string) (map[string]string, error) {
+	args := make([]interface{}, 0, 4)
+	args = append(args, "GET")
+	args = append(args, parameter)
+	return replyStringMap(c.Query(ctx, "CONFIG", args...))
+}
+
+// ConfigSet issues the CONFIG command: Set a configuration parameter to the given value.
+func (c *Client) ConfigSet(ctx context.Context, parameter string, value interface{}) error {
+	args := make([]interface{}, 0, 6)
+	args = append(args, "SET")
+	args = append(args, parameter)
+	args = append(args, value)
+	return replyStatus(c.Query(ctx, "CONFIG", args...))
+}
+
+// ConfigResetStat issues the CONFIG command: Reset the stats returned by INFO.
+func (c *Client) ConfigResetStat(ctx context.Context) error {
+	args := make([]interface{}, 0, 2)
+	args = append(args, "RESETSTAT")
+	return replyStatus(c.Query(ctx, "CONFIG", args...))
+}
+
+// DBSize issues the DBSIZE command: Return the number of keys in the selected database.
+func (c *Client) DBSize(ctx context.Context) (int64, error) {
+	return replyInt64(c.Query(ctx, "DBSIZE"))
+}
+
+// Decr issues the DECR command: Decrement the integer value of a key by one.
+func (c *Client) Decr(ctx context.Context, key string) (int64, error) {
+	return replyInt64(c.Query(ctx, "DECR", key))
+}
+
+// DecrBy issues the DECRBY command: Decrement the integer value of a key by the given number.
+func (c *Client) DecrBy(ctx context.Context, key string, decrement int64) (int64, error) {
+	return replyInt64(c.Query(ctx, "DECRBY", key, decrement))
+}
+
+// Del issues the DEL command: Delete a key.
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	args := make([]interface{}, 0, 2+len(keys))
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyInt64(c.Query(ctx, "DEL", args...))
+}
+
+// Dump issues the DUMP command: Return a serialized version of the value stored at the specified key.
+func (c *Client) Dump(ctx context.Context, key string) ([]byte, error) {
+	return replyBytes(c.Query(ctx, "DUMP", key))
+}
+
+// Echo issues the ECHO command: Echo the given string.
+func (c *Client) Echo(ctx context.Context, message interface{}) (string, error) {
+	return replyString(c.Query(ctx, "ECHO", message))
+}
+
+// Exists issues the EXISTS command: Determine if a key exists.
+func (c *Client) Exists(ctx context.Context, keys ...string) (int64, error) {
+	args := make([]interface{}, 0, 2+len(keys))
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyInt64(c.Query(ctx, "EXISTS", args...))
+}
+
+// Expire issues the EXPIRE command: Set a key's time to live in seconds.
+func (c *Client) Expire(ctx context.Context, key string, seconds int64) (bool, error) {
+	return replyBool(c.Query(ctx, "EXPIRE", key, seconds))
+}
+
+// ExpireAt issues the EXPIREAT command: Set the expiration for a key as a UNIX timestamp.
+func (c *Client) ExpireAt(ctx context.Context, key string, timestamp int64) (bool, error) {
+	return replyBool(c.Query(ctx, "EXPIREAT", key, timestamp))
+}
+
+// FlushAll issues the FLUSHALL command: Remove all keys from all databases.
+func (c *Client) FlushAll(ctx context.Context) error {
+	return replyStatus(c.Query(ctx, "FLUSHALL"))
+}
+
+// FlushDB issues the FLUSHDB command: Remove all keys from the current database.
+func (c *Client) FlushDB(ctx context.Context) error {
+	return replyStatus(c.Query(ctx, "FLUSHDB"))
+}
+
+// Get issues the GET command: Get the value of a key.
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	return replyString(c.Query(ctx, "GET", key))
+}
+
+// GetDel issues the GETDEL command: Get the value of a key and delete the key.
+func (c *Client) GetDel(ctx context.Context, key string) (string, error) {
+	return replyString(c.Query(ctx, "GETDEL", key))
+}
+
+// GetRange issues the GETRANGE command: Get a substring of the string stored at a key.
+func (c *Client) GetRange(ctx context.Context, key string, start int64, end int64) (string, error) {
+	return replyString(c.Query(ctx, "GETRANGE", key, start, end))
+}
+
+// GetSet issues the GETSET command: Set the string value of a key and return its old value.
+func (c *Client) GetSet(ctx context.Context, key string, value interface{}) (string, error) {
+	return replyString(c.Query(ctx, "GETSET", key, value))
+}
+
+// HDel issues the HDEL command: Delete one or more hash fields.
+func (c *Client) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	args := make([]interface{}, 0, 4+len(fields))
+	args = append(args, key)
+	for _, arg := range fields {
+		args = append(args, arg)
+	}
+	return replyInt64(c.Query(ctx, "HDEL", args...))
+}
+
+// HExists issues the HEXISTS command: Determine if a hash field exists.
+func (c *Client) HExists(ctx context.Context, key string, field string) (bool, error) {
+	return replyBool(c.Query(ctx, "HEXISTS", key, field))
+}
+
+// HGet issues the HGET command: Get the value of a hash field.
+func (c *Client) HGet(ctx context.Context, key string, field string) (string, error) {
+	return replyString(c.Query(ctx, "HGET", key, field))
+}
+
+// HGetAll issues the HGETALL command: Get all the fields and values in a hash.
+func (c *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return replyStringMap(c.Query(ctx, "HGETALL", key))
+}
+
+// HIncrBy issues the HINCRBY command: Increment the integer value of a hash field by the given number.
+func (c *Client) HIncrBy(ctx context.Context, key string, field string, increment int64) (int64, error) {
+	return replyInt64(c.Query(ctx, "HINCRBY", key, field, increment))
+}
+
+// HIncrByFloat issues the HINCRBYFLOAT command: Increment the float value of a hash field by the given amount.
+func (c *Client) HIncrByFloat(ctx context.Context, key string, field string, increment float64) (float64, error) {
+	return replyFloat64(c.Query(ctx, "HINCRBYFLOAT", key, field, increment))
+}
+
+// HKeys issues the HKEYS command: Get all the fields in a hash.
+func (c *Client) HKeys(ctx context.Context, key string) ([]string, error) {
+	return replyStrings(c.Query(ctx, "HKEYS", key))
+}
+
+// HLen issues the HLEN command: Get the number of fields in a hash.
+func (c *Client) HLen(ctx context.Context, key string) (int64, error) {
+	return replyInt64(c.Query(ctx, "HLEN", key))
+}
+
+// HMGet issues the HMGET command: Get the values of all the given hash fields.
+func (c *Client) HMGet(ctx context.Context, key string, fields ...string) ([]interface{}, error) {
+	args := make([]interface{}, 0, 4+len(fields))
+	args = append(args, key)
+	for _, arg := range fields {
+		args = append(args, arg)
+	}
+	return replyValues(c.Query(ctx, "HMGET", args...))
+}
+
+// HScan issues the HSCAN command: Incrementally iterate hash fields and associated values.
+func (c *Client) HScan(ctx context.Context, key string, cursor uint64, match string, count int64) (uint64, []string, error) {
+	args := make([]interface{}, 0, 8)
+	args = append(args, key)
+	args = append(args, cursor)
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count != 0 {
+		args = append(args, "COUNT", count)
+	}
+	return replyScan(c.Query(ctx, "HSCAN", args...))
+}
+
+// HSet issues the HSET command: Set the values of hash fields, fields may be a list of field/value pairs, or structs and maps.
+func (c *Client) HSet(ctx context.Context, key string, fields ...interface{}) (int64, error) {
+	args := make([]interface{}, 0, 4+len(fields))
+	args = append(args, key)
+	args = append(args, fields...)
+	return replyInt64(c.Query(ctx, "HSET", args...))
+}
+
+// HSetNX issues the HSETNX command: Set the value of a hash field, only if the field does not exist.
+func (c *Client) HSetNX(ctx context.Context, key string, field string, value interface{}) (bool, error) {
+	return replyBool(c.Query(ctx, "HSETNX", key, field, value))
+}
+
+// HStrLen issues the HSTRLEN command: Get the length of the value of a hash field.
+func (c *Client) HStrLen(ctx context.Context, key string, field string) (int64, error) {
+	return replyInt64(c.Query(ctx, "HSTRLEN", key, field))
+}
+
+// HVals issues the HVALS command: Get all the values in a hash.
+func (c *Client) HVals(ctx context.Context, key string) ([]string, error) {
+	return replyStrings(c.Query(ctx, "HVALS", key))
+}
+
+// Incr issues the INCR command: Increment the integer value of a key by one.
+func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
+	return replyInt64(c.Query(ctx, "INCR", key))
+}
+
+// IncrBy issues the INCRBY command: Increment the integer value of a key by the given amount.
+func (c *Client) IncrBy(ctx context.Context, key string, increment int64) (int64, error) {
+	return replyInt64(c.Query(ctx, "INCRBY", key, increment))
+}
+
+// IncrByFloat issues the INCRBYFLOAT command: Increment the float value of a key by the given amount.
+func (c *Client) IncrByFloat(ctx context.Context, key string, increment float64) (float64, error) {
+	return replyFloat64(c.Query(ctx, "INCRBYFLOAT", key, increment))
+}
+
+// Info issues the INFO command: Get information and statistics about the server.
+func (c *Client) Info(ctx context.Context, section string) (string, error) {
+	args := make([]interface{}, 0, 2)
+	if section != "" {
+		args = append(args, section)
+	}
+	return replyString(c.Query(ctx, "INFO", args...))
+}
+
+// Keys issues the KEYS command: Find all keys matching the given pattern.
+func (c *Client) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return replyStrings(c.Query(ctx, "KEYS", pattern))
+}
+
+// LastSave issues the LASTSAVE command: Get the UNIX time stamp of the last successful save to disk.
+func (c *Client) LastSave(ctx context.Context) (int64, error) {
+	return replyInt64(c.Query(ctx, "LASTSAVE"))
+}
+
+// LIndex issues the LINDEX command: Get an element from a list by its index.
+func (c *Client) LIndex(ctx context.Context, key string, index int64) (string, error) {
+	return replyString(c.Query(ctx, "LINDEX", key, index))
+}
+
+// LInsertBefore issues the LINSERT command: Insert an element before another element in a list.
+func (c *Client) LInsertBefore(ctx context.Context, key string, pivot interface{}, element interface{}) (int64, error) {
+	args := make([]interface{}, 0, 8)
+	args = append(args, key)
+	args = append(args, "BEFORE")
+	args = append(args, pivot)
+	args = append(args, element)
+	return replyInt64(c.Query(ctx, "LINSERT", args...))
+}
+
+// LInsertAfter issues the LINSERT command: Insert an element after another element in a list.
+func (c *Client) LInsertAfter(ctx context.Context, key string, pivot interface{}, element interface{}) (int64, error) {
+	args := make([]interface{}, 0, 8)
+	args = append(args, key)
+	args = append(args, "AFTER")
+	args = append(args, pivot)
+	args = append(args, element)
+	return replyInt64(c.Query(ctx, "LINSERT", args...))
+}
+
+// LLen issues the LLEN command: Get the length of a list.
+func (c *Client) LLen(ctx context.Context, key string) (int64, error) {
+	return replyInt64(c.Query(ctx, "LLEN", key))
+}
+
+// LPop issues the LPOP command: Remove and get the first element in a list.
+func (c *Client) LPop(ctx context.Context, key string) (string, error) {
+	return replyString(c.Query(ctx, "LPOP", key))
+}
+
+// LPush issues the LPUSH command: Prepend one or multiple elements to a list.
+func (c *Client) LPush(ctx context.Context, key string, elements ...interface{}) (int64, error) {
+	args := make([]interface{}, 0, 4+len(elements))
+	args = append(args, key)
+	args = append(args, elements...)
+	return replyInt64(c.Query(ctx, "LPUSH", args...))
+}
+
+// LPushX issues the LPUSHX command: Prepend an element to a list, only if the list exists.
+func (c *Client) LPushX(ctx context.Context, key string, elements ...interface{}) (int64, error) {
+	args := make([]interface{}, 0, 4+len(elements))
+	args = append(args, key)
+	args = append(args, elements...)
+	return replyInt64(c.Query(ctx, "LPUSHX", args...))
+}
+
+// LRange issues the LRANGE command: Get a range of elements from a list.
+func (c *Client) LRange(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	return replyStrings(c.Query(ctx, "LRANGE", key, start, stop))
+}
+
+// LRem issues the LREM command: Remove elements from a list.
+func (c *Client) LRem(ctx context.Context, key string, count int64, element interface{}) (int64, error) {
+	return replyInt64(c.Query(ctx, "LREM", key, count, element))
+}
+
+// LSet issues the LSET command: Set the value of an element in a list by its index.
+func (c *Client) LSet(ctx context.Context, key string, index int64, element interface{}) error {
+	return replyStatus(c.Query(ctx, "LSET", key, index, element))
+}
+
+// LTrim issues the LTRIM command: Trim a list to the specified range.
+func (c *Client) LTrim(ctx context.Context, key string, start int64, stop int64) error {
+	return replyStatus(c.Query(ctx, "LTRIM", key, start, stop))
+}
+
+// MGet issues the MGET command: Get the values of all the given keys.
+func (c *Client) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	args := make([]interface{}, 0, 2+len(keys))
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyValues(c.Query(ctx, "MGET", args...))
+}
+
+// MSet issues the MSET command: Set multiple keys to multiple values.
+func (c *Client) MSet(ctx context.Context, pairs ...interface{}) error {
+	args := make([]interface{}, 0, 2+len(pairs))
+	args = append(args, pairs...)
+	return replyStatus(c.Query(ctx, "MSET", args...))
+}
+
+// MSetNX issues the MSETNX command: Set multiple keys to multiple values, only if none of the keys exist.
+func (c *Client) MSetNX(ctx context.Context, pairs ...interface{}) (bool, error) {
+	args := make([]interface{}, 0, 2+len(pairs))
+	args = append(args, pairs...)
+	return replyBool(c.Query(ctx, "MSETNX", args...))
+}
+
+// Persist issues the PERSIST command: Remove the expiration from a key.
+func (c *Client) Persist(ctx context.Context, key string) (bool, error) {
+	return replyBool(c.Query(ctx, "PERSIST", key))
+}
+
+// PExpire issues the PEXPIRE command: Set a key's time to live in milliseconds.
+func (c *Client) PExpire(ctx context.Context, key string, milliseconds int64) (bool, error) {
+	return replyBool(c.Query(ctx, "PEXPIRE", key, milliseconds))
+}
+
+// PExpireAt issues the PEXPIREAT command: Set the expiration for a key as a UNIX timestamp specified in milliseconds.
+func (c *Client) PExpireAt(ctx context.Context, key string, timestamp int64) (bool, error) {
+	return replyBool(c.Query(ctx, "PEXPIREAT", key, timestamp))
+}
+
+// Ping issues the PING command: Ping the server.
+func (c *Client) Ping(ctx context.Context) (string, error) {
+	return replyString(c.Query(ctx, "PING"))
+}
+
+// PSetEX issues the PSETEX command: Set the value and expiration in milliseconds of a key.
+func (c *Client) PSetEX(ctx context.Context, key string, milliseconds int64, value interface{}) error {
+	return replyStatus(c.Query(ctx, "PSETEX", key, milliseconds, value))
+}
+
+// PTTL issues the PTTL command: Get the time to live for a key in milliseconds.
+func (c *Client) PTTL(ctx context.Context, key string) (int64, error) {
+	return replyInt64(c.Query(ctx, "PTTL", key))
+}
+
+// Publish issues the PUBLISH command: Post a message to a channel.
+func (c *Client) Publish(ctx context.Context, channel string, message interface{}) (int64, error) {
+	return replyInt64(c.Query(ctx, "PUBLISH", channel, message))
+}
+
+// RandomKey issues the RANDOMKEY command: Return a random key from the keyspace.
+func (c *Client) RandomKey(ctx context.Context) (string, error) {
+	return replyString(c.Query(ctx, "RANDOMKEY"))
+}
+
+// Rename issues the RENAME command: Rename a key.
+func (c *Client) Rename(ctx context.Context, key string, newkey string) error {
+	return replyStatus(c.Query(ctx, "RENAME", key, newkey))
+}
+
+// RenameNX issues the RENAMENX command: Rename a key, only if the new key does not exist.
+func (c *Client) RenameNX(ctx context.Context, key string, newkey string) (bool, error) {
+	return replyBool(c.Query(ctx, "RENAMENX", key, newkey))
+}
+
+// Restore issues the RESTORE command: Create a key using the provided serialized value, previously obtained using DUMP.
+func (c *Client) Restore(ctx context.Context, key string, ttl int64, value interface{}) error {
+	return replyStatus(c.Query(ctx, "RESTORE", key, ttl, value))
+}
+
+// RestoreReplace issues the RESTORE command: Create a key using the provided serialized value, replacing any existing value.
+func (c *Client) RestoreReplace(ctx context.Context, key string, ttl int64, value interface{}) error {
+	args := make([]interface{}, 0, 8)
+	args = append(args, key)
+	args = append(args, ttl)
+	args = append(args, value)
+	args = append(args, "REPLACE")
+	return replyStatus(c.Query(ctx, "RESTORE", args...))
+}
+
+// RPop issues the RPOP command: Remove and get the last element in a list.
+func (c *Client) RPop(ctx context.Context, key string) (string, error) {
+	return replyString(c.Query(ctx, "RPOP", key))
+}
+
+// RPopLPush issues the RPOPLPUSH command: Remove the last element in a list, prepend it to another list and return it.
+func (c *Client) RPopLPush(ctx context.Context, source string, destination string) (string, error) {
+	return replyString(c.Query(ctx, "RPOPLPUSH", source, destination))
+}
+
+// RPush issues the RPUSH command: Append one or multiple elements to a list.
+func (c *Client) RPush(ctx context.Context, key string, elements ...interface{}) (int64, error) {
+	args := make([]interface{}, 0, 4+len(elements))
+	args = append(args, key)
+	args = append(args, elements...)
+	return replyInt64(c.Query(ctx, "RPUSH", args...))
+}
+
+// RPushX issues the RPUSHX command: Append an element to a list, only if the list exists.
+func (c *Client) RPushX(ctx context.Context, key string, elements ...interface{}) (int64, error) {
+	args := make([]interface{}, 0, 4+len(elements))
+	args = append(args, key)
+	args = append(args, elements...)
+	return replyInt64(c.Query(ctx, "RPUSHX", args...))
+}
+
+// SAdd issues the SADD command: Add one or more members to a set.
+func (c *Client) SAdd(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	args := make([]interface{}, 0, 4+len(members))
+	args = append(args, key)
+	args = append(args, members...)
+	return replyInt64(c.Query(ctx, "SADD", args...))
+}
+
+// Scan issues the SCAN command: Incrementally iterate the keys space.
+func (c *Client) Scan(ctx context.Context, cursor uint64, match string, count int64) (uint64, []string, error) {
+	args := make([]interface{}, 0, 6)
+	args = append(args, cursor)
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count != 0 {
+		args = append(args, "COUNT", count)
+	}
+	return replyScan(c.Query(ctx, "SCAN", args...))
+}
+
+// SCard issues the SCARD command: Get the number of members in a set.
+func (c *Client) SCard(ctx context.Context, key string) (int64, error) {
+	return replyInt64(c.Query(ctx, "SCARD", key))
+}
+
+// SDiff issues the SDIFF command: Subtract multiple sets.
+func (c *Client) SDiff(ctx context.Context, keys ...string) ([]string, error) {
+	args := make([]interface{}, 0, 2+len(keys))
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyStrings(c.Query(ctx, "SDIFF", args...))
+}
+
+// SDiffStore issues the SDIFFSTORE command: Subtract multiple sets and store the resulting set in a key.
+func (c *Client) SDiffStore(ctx context.Context, destination string, keys ...string) (int64, error) {
+	args := make([]interface{}, 0, 4+len(keys))
+	args = append(args, destination)
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyInt64(c.Query(ctx, "SDIFFSTORE", args...))
+}
+
+// Set issues the SET command: Set the string value of a key.
+func (c *Client) Set(ctx context.Context, key string, value interface{}) error {
+	return replyStatus(c.Query(ctx, "SET", key, value))
+}
+
+// SetEX issues the SETEX command: Set the value and expiration of a key.
+func (c *Client) SetEX(ctx context.Context, key string, seconds int64, value interface{}) error {
+	return replyStatus(c.Query(ctx, "SETEX", key, seconds, value))
+}
+
+// SetNX issues the SETNX command: Set the value of a key, only if the key does not exist.
+func (c *Client) SetNX(ctx context.Context, key string, value interface{}) (bool, error) {
+	return replyBool(c.Query(ctx, "SETNX", key, value))
+}
+
+// SetRange issues the SETRANGE command: Overwrite part of a string at key starting at the specified offset.
+func (c *Client) SetRange(ctx context.Context, key string, offset int64, value interface{}) (int64, error) {
+	return replyInt64(c.Query(ctx, "SETRANGE", key, offset, value))
+}
+
+// SInter issues the SINTER command: Intersect multiple sets.
+func (c *Client) SInter(ctx context.Context, keys ...string) ([]string, error) {
+	args := make([]interface{}, 0, 2+len(keys))
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyStrings(c.Query(ctx, "SINTER", args...))
+}
+
+// SInterStore issues the SINTERSTORE command: Intersect multiple sets and store the resulting set in a key.
+func (c *Client) SInterStore(ctx context.Context, destination string, keys ...string) (int64, error) {
+	args := make([]interface{}, 0, 4+len(keys))
+	args = append(args, destination)
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyInt64(c.Query(ctx, "SINTERSTORE", args...))
+}
+
+// SIsMember issues the SISMEMBER command: Determine if a given value is a member of a set.
+func (c *Client) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	return replyBool(c.Query(ctx, "SISMEMBER", key, member))
+}
+
+// SMembers issues the SMEMBERS command: Get all the members in a set.
+func (c *Client) SMembers(ctx context.Context, key string) ([]string, error) {
+	return replyStrings(c.Query(ctx, "SMEMBERS", key))
+}
+
+// SMove issues the SMOVE command: Move a member from one set to another.
+func (c *Client) SMove(ctx context.Context, source string, destination string, member interface{}) (bool, error) {
+	return replyBool(c.Query(ctx, "SMOVE", source, destination, member))
+}
+
+// SPop issues the SPOP command: Remove and return one or multiple random members from a set.
+func (c *Client) SPop(ctx context.Context, key string) (string, error) {
+	return replyString(c.Query(ctx, "SPOP", key))
+}
+
+// SRandMember issues the SRANDMEMBER command: Get one or multiple random members from a set.
+func (c *Client) SRandMember(ctx context.Context, key string) (string, error) {
+	return replyString(c.Query(ctx, "SRANDMEMBER", key))
+}
+
+// SRem issues the SREM command: Remove one or more members from a set.
+func (c *Client) SRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	args := make([]interface{}, 0, 4+len(members))
+	args = append(args, key)
+	args = append(args, members...)
+	return replyInt64(c.Query(ctx, "SREM", args...))
+}
+
+// SScan issues the SSCAN command: Incrementally iterate Set elements.
+func (c *Client) SScan(ctx context.Context, key string, cursor uint64, match string, count int64) (uint64, []string, error) {
+	args := make([]interface{}, 0, 8)
+	args = append(args, key)
+	args = append(args, cursor)
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count != 0 {
+		args = append(args, "COUNT", count)
+	}
+	return replyScan(c.Query(ctx, "SSCAN", args...))
+}
+
+// StrLen issues the STRLEN command: Get the length of the value stored in a key.
+func (c *Client) StrLen(ctx context.Context, key string) (int64, error) {
+	return replyInt64(c.Query(ctx, "STRLEN", key))
+}
+
+// SUnion issues the SUNION command: Add multiple sets.
+func (c *Client) SUnion(ctx context.Context, keys ...string) ([]string, error) {
+	args := make([]interface{}, 0, 2+len(keys))
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyStrings(c.Query(ctx, "SUNION", args...))
+}
+
+// SUnionStore issues the SUNIONSTORE command: Add multiple sets and store the resulting set in a key.
+func (c *Client) SUnionStore(ctx context.Context, destination string, keys ...string) (int64, error) {
+	args := make([]interface{}, 0, 4+len(keys))
+	args = append(args, destination)
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyInt64(c.Query(ctx, "SUNIONSTORE", args...))
+}
+
+// Touch issues the TOUCH command: Alters the last access time of a key(s).
+func (c *Client) Touch(ctx context.Context, keys ...string) (int64, error) {
+	args := make([]interface{}, 0, 2+len(keys))
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyInt64(c.Query(ctx, "TOUCH", args...))
+}
+
+// TTL issues the TTL command: Get the time to live for a key.
+func (c *Client) TTL(ctx context.Context, key string) (int64, error) {
+	return replyInt64(c.Query(ctx, "TTL", key))
+}
+
+// Type issues the TYPE command: Determine the type stored at key.
+func (c *Client) Type(ctx context.Context, key string) (string, error) {
+	return replyString(c.Query(ctx, "TYPE", key))
+}
+
+// Unlink issues the UNLINK command: Delete a key asynchronously in another thread.
+func (c *Client) Unlink(ctx context.Context, keys ...string) (int64, error) {
+	args := make([]interface{}, 0, 2+len(keys))
+	for _, arg := range keys {
+		args = append(args, arg)
+	}
+	return replyInt64(c.Query(ctx, "UNLINK", args...))
+}
+
+// XAck issues the XACK command: Marks a pending message as correctly processed, effectively removing it from the pending entries list of the consumer group.
+func (c *Client) XAck(ctx context.Context, key string, group string, ids ...string) (int64, error) {
+	args := make([]interface{}, 0, 6+len(ids))
+	args = append(args, key)
+	args = append(args, group)
+	for _, arg := range ids {
+		args = append(args, arg)
+	}
+	return replyInt64(c.Query(ctx, "XACK", args...))
+}
+
+// XDel issues the XDEL command: Removes the specified entries from the stream.
+func (c *Client) XDel(ctx context.Context, key string, ids ...string) (int64, error) {
+	args := make([]interface{}, 0, 4+len(ids))
+	args = append(args, key)
+	for _, arg := range ids {
+		args = append(args, arg)
+	}
+	return replyInt64(c.Query(ctx, "XDEL", args...))
+}
+
+// XLen issues the XLEN command: Return the number of entries in a stream.
+func (c *Client) XLen(ctx context.Context, key string) (int64, error) {
+	return replyInt64(c.Query(ctx, "XLEN", key))
+}
+
+// XTrim issues the XTRIM command: Trims the stream to a certain size.
+func (c *Client) XTrim(ctx context.Context, key string, maxlen int64) (int64, error) {
+	args := make([]interface{}, 0, 6)
+	args = append(args, key)
+	args = append(args, "MAXLEN")
+	args = append(args, maxlen)
+	return replyInt64(c.Query(ctx, "XTRIM", args...))
+}
+
+// ZAdd issues the ZADD command: Add one or more members to a sorted set, or update its score if it already exists.
+func (c *Client) ZAdd(ctx context.Context, key string, members ...Z) (int64, error) {
+	args := make([]interface{}, 0, 4+2*len(members))
+	args = append(args, key)
+	for _, z := range members {
+		args = append(args, z.Score, z.Member)
+	}
+	return replyInt64(c.Query(ctx, "ZADD", args...))
+}
+
+// ZCard issues the ZCARD command: Get the number of members in a sorted set.
+func (c *Client) ZCard(ctx context.Context, key string) (int64, error) {
+	return replyInt64(c.Query(ctx, "ZCARD", key))
+}
+
+// ZCount issues the ZCOUNT command: Count the members in a sorted set with scores within the given values.
+func (c *Client) ZCount(ctx context.Context, key string, min string, max string) (int64, error) {
+	return replyInt64(c.Query(ctx, "ZCOUNT", key, min, max))
+}
+
+// ZIncrBy issues the ZINCRBY command: Increment the score of a member in a sorted set.
+func (c *Client) ZIncrBy(ctx context.Context, key string, increment float64, member interface{}) (float64, error) {
+	return replyFloat64(c.Query(ctx, "ZINCRBY", key, increment, member))
+}
+
+// ZRange issues the ZRANGE command: Return a range of members in a sorted set, by index.
+func (c *Client) ZRange(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	return replyStrings(c.Query(ctx, "ZRANGE", key, start, stop))
+}
+
+// ZRangeWithScores issues the ZRANGE command: Return a range of members in a sorted set, by index, with their scores.
+func (c *Client) ZRangeWithScores(ctx context.Context, key string, start int64, stop int64) ([]Z, error) {
+	args := make([]interface{}, 0, 8)
+	args = append(args, key)
+	args = append(args, start)
+	args = append(args, stop)
+	args = append(args, "WITHSCORES")
+	return replyZ(c.Query(ctx, "ZRANGE", args...))
+}
+
+// ZRangeByScore issues the ZRANGEBYSCORE command: Return a range of members in a sorted set, by score.
+func (c *Client) ZRangeByScore(ctx context.Context, key string, min string, max string) ([]string, error) {
+	return replyStrings(c.Query(ctx, "ZRANGEBYSCORE", key, min, max))
+}
+
+// ZRank issues the ZRANK command: Determine the index of a member in a sorted set.
+func (c *Client) ZRank(ctx context.Context, key string, member interface{}) (int64, error) {
+	return replyRank(c.Query(ctx, "ZRANK", key, member))
+}
+
+// ZRem issues the ZREM command: Remove one or more members from a sorted set.
+func (c *Client) ZRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	args := make([]interface{}, 0, 4+len(members))
+	args = append(args, key)
+	args = append(args, members...)
+	return replyInt64(c.Query(ctx, "ZREM", args...))
+}
+
+// ZRemRangeByRank issues the ZREMRANGEBYRANK command: Remove all members in a sorted set within the given indexes.
+func (c *Client) ZRemRangeByRank(ctx context.Context, key string, start int64, stop int64) (int64, error) {
+	return replyInt64(c.Query(ctx, "ZREMRANGEBYRANK", key, start, stop))
+}
+
+// ZRemRangeByScore issues the ZREMRANGEBYSCORE command: Remove all members in a sorted set within the given scores.
+func (c *Client) ZRemRangeByScore(ctx context.Context, key string, min string, max string) (int64, error) {
+	return replyInt64(c.Query(ctx, "ZREMRANGEBYSCORE", key, min, max))
+}
+
+// ZRevRange issues the ZREVRANGE command: Return a range of members in a sorted set, by index, with scores ordered from high to low.
+func (c *Client) ZRevRange(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	return replyStrings(c.Query(ctx, "ZREVRANGE", key, start, stop))
+}
+
+// ZRevRangeWithScores issues the ZREVRANGE command: Return a range of members in a sorted set, by index, with their scores ordered from high to low.
+func (c *Client) ZRevRangeWithScores(ctx context.Context, key string, start int64, stop int64) ([]Z, error) {
+	args := make([]interface{}, 0, 8)
+	args = append(args, key)
+	args = append(args, start)
+	args = append(args, stop)
+	args = append(args, "WITHSCORES")
+	return replyZ(c.Query(ctx, "ZREVRANGE", args...))
+}
+
+// ZRevRank issues the ZREVRANK command: Determine the index of a member in a sorted set, with scores ordered from high to low.
+func (c *Client) ZRevRank(ctx context.Context, key string, member interface{}) (int64, error) {
+	return replyRank(c.Query(ctx, "ZREVRANK", key, member))
+}
+
+// ZScan issues the ZSCAN command: Incrementally iterate sorted sets elements and associated scores.
+func (c *Client) ZScan(ctx context.Context, key string, cursor uint64, match string, count int64) (uint64, []string, error) {
+	args := make([]interface{}, 0, 8)
+	args = append(args, key)
+	args = append(args, cursor)
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count != 0 {
+		args = append(args, "COUNT", count)
+	}
+	return replyScan(c.Query(ctx, "ZSCAN", args...))
+}
+
+// ZScore issues the ZSCORE command: Get the score associated with the given member in a sorted set.
+func (c *Client) ZScore(ctx context.Context, key string, member interface{}) (float64, error) {
+	return replyFloat64(c.Query(ctx, "ZSCORE", key, member))
+}
+
+var commandTable = map[string]*CommandInfo{
+	"APPEND":           {Name: "APPEND", Group: "string", Summary: "Append a value to a key", Arity: 3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ASKING":           {Name: "ASKING", Group: "cluster", Summary: "Sent by cluster clients after an -ASK redirect", Arity: 1, Flags: []string{"fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"AUTH":             {Name: "AUTH", Group: "connection", Summary: "Authenticate to the server", Arity: -2, Flags: []string{"noscript", "loading", "stale", "skip_monitor", "skip_slowlog", "fast", "no_auth"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"BGREWRITEAOF":     {Name: "BGREWRITEAOF", Group: "server", Summary: "Asynchronously rewrite the append-only file", Arity: 1, Flags: []string{"admin", "noscript"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"BGSAVE":           {Name: "BGSAVE", Group: "server", Summary: "Asynchronously save the dataset to disk", Arity: -1, Flags: []string{"admin", "noscript"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"BITCOUNT":         {Name: "BITCOUNT", Group: "bitmap", Summary: "Count set bits in a string", Arity: -2, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"BLPOP":            {Name: "BLPOP", Group: "list", Summary: "Remove and get the first element in a list, or block until one is available", Arity: -3, Flags: []string{"write", "noscript", "blocking"}, FirstKey: 1, LastKey: -2, KeyStep: 1},
+	"BRPOP":            {Name: "BRPOP", Group: "list", Summary: "Remove and get the last element in a list, or block until one is available", Arity: -3, Flags: []string{"write", "noscript", "blocking"}, FirstKey: 1, LastKey: -2, KeyStep: 1},
+	"BRPOPLPUSH":       {Name: "BRPOPLPUSH", Group: "list", Summary: "Pop an element from a list, push it to another list and return it; or block until one is available", Arity: 4, Flags: []string{"write", "denyoom", "noscript", "blocking"}, FirstKey: 1, LastKey: 2, KeyStep: 1},
+	"BZPOPMAX":         {Name: "BZPOPMAX", Group: "sorted-set", Summary: "Remove and return the member with the highest score from one or more sorted sets, or block until one is available", Arity: -3, Flags: []string{"write", "noscript", "blocking", "fast"}, FirstKey: 1, LastKey: -2, KeyStep: 1},
+	"BZPOPMIN":         {Name: "BZPOPMIN", Group: "sorted-set", Summary: "Remove and return the member with the lowest score from one or more sorted sets, or block until one is available", Arity: -3, Flags: []string{"write", "noscript", "blocking", "fast"}, FirstKey: 1, LastKey: -2, KeyStep: 1},
+	"CLIENT":           {Name: "CLIENT", Group: "connection", Summary: "Manage the client connections", Arity: -2, Flags: []string{"admin", "noscript", "random", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"CLUSTER":          {Name: "CLUSTER", Group: "cluster", Summary: "A container for cluster commands", Arity: -2, Flags: []string{"admin", "random", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"COMMAND":          {Name: "COMMAND", Group: "server", Summary: "Get array of Redis command details", Arity: -1, Flags: []string{"random", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"CONFIG":           {Name: "CONFIG", Group: "server", Summary: "Get or set configuration parameters", Arity: -2, Flags: []string{"admin", "noscript", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"DBSIZE":           {Name: "DBSIZE", Group: "server", Summary: "Return the number of keys in the selected database", Arity: 1, Flags: []string{"readonly", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"DEBUG":            {Name: "DEBUG", Group: "server", Summary: "A container for debugging commands", Arity: -2, Flags: []string{"admin", "noscript", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"DECR":             {Name: "DECR", Group: "string", Summary: "Decrement the integer value of a key by one", Arity: 2, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"DECRBY":           {Name: "DECRBY", Group: "string", Summary: "Decrement the integer value of a key by the given number", Arity: 3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"DEL":              {Name: "DEL", Group: "generic", Summary: "Delete a key", Arity: -2, Flags: []string{"write"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"DISCARD":          {Name: "DISCARD", Group: "transactions", Summary: "Discard all commands issued after MULTI", Arity: 1, Flags: []string{"noscript", "loading", "stale", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"DUMP":             {Name: "DUMP", Group: "generic", Summary: "Return a serialized version of the value stored at the specified key", Arity: 2, Flags: []string{"readonly", "random"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ECHO":             {Name: "ECHO", Group: "connection", Summary: "Echo the given string", Arity: 2, Flags: []string{"fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"EVAL":             {Name: "EVAL", Group: "scripting", Summary: "Execute a Lua script server side", Arity: -3, Flags: []string{"noscript", "movablekeys"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"EVALSHA":          {Name: "EVALSHA", Group: "scripting", Summary: "Execute a Lua script server side", Arity: -3, Flags: []string{"noscript", "movablekeys"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"EXEC":             {Name: "EXEC", Group: "transactions", Summary: "Execute all commands issued after MULTI", Arity: 1, Flags: []string{"noscript", "loading", "stale", "skip_slowlog"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"EXISTS":           {Name: "EXISTS", Group: "generic", Summary: "Determine if a key exists", Arity: -2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"EXPIRE":           {Name: "EXPIRE", Group: "generic", Summary: "Set a key's time to live in seconds", Arity: 3, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"EXPIREAT":         {Name: "EXPIREAT", Group: "generic", Summary: "Set the expiration for a key as a UNIX timestamp", Arity: 3, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"FLUSHALL":         {Name: "FLUSHALL", Group: "server", Summary: "Remove all keys from all databases", Arity: -1, Flags: []string{"write"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"FLUSHDB":          {Name: "FLUSHDB", Group: "server", Summary: "Remove all keys from the current database", Arity: -1, Flags: []string{"write"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"GET":              {Name: "GET", Group: "string", Summary: "Get the value of a key", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"GETBIT":           {Name: "GETBIT", Group: "bitmap", Summary: "Returns the bit value at offset in the string value stored at key", Arity: 3, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"GETDEL":           {Name: "GETDEL", Group: "string", Summary: "Get the value of a key and delete the key", Arity: 2, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"GETRANGE":         {Name: "GETRANGE", Group: "string", Summary: "Get a substring of the string stored at a key", Arity: 4, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"GETSET":           {Name: "GETSET", Group: "string", Summary: "Set the string value of a key and return its old value", Arity: 3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HDEL":             {Name: "HDEL", Group: "hash", Summary: "Delete one or more hash fields", Arity: -3, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HELLO":            {Name: "HELLO", Group: "connection", Summary: "Handshake with Redis", Arity: -1, Flags: []string{"noscript", "loading", "stale", "skip_monitor", "skip_slowlog", "fast", "no_auth"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"HEXISTS":          {Name: "HEXISTS", Group: "hash", Summary: "Determine if a hash field exists", Arity: 3, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HGET":             {Name: "HGET", Group: "hash", Summary: "Get the value of a hash field", Arity: 3, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HGETALL":          {Name: "HGETALL", Group: "hash", Summary: "Get all the fields and values in a hash", Arity: 2, Flags: []string{"readonly", "random"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HINCRBY":          {Name: "HINCRBY", Group: "hash", Summary: "Increment the integer value of a hash field by the given number", Arity: 4, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HINCRBYFLOAT":     {Name: "HINCRBYFLOAT", Group: "hash", Summary: "Increment the float value of a hash field by the given amount", Arity: 4, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HKEYS":            {Name: "HKEYS", Group: "hash", Summary: "Get all the fields in a hash", Arity: 2, Flags: []string{"readonly", "sort_for_script"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HLEN":             {Name: "HLEN", Group: "hash", Summary: "Get the number of fields in a hash", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HMGET":            {Name: "HMGET", Group: "hash", Summary: "Get the values of all the given hash fields", Arity: -3, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HMSET":            {Name: "HMSET", Group: "hash", Summary: "Set multiple hash fields to multiple values", Arity: -4, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HSCAN":            {Name: "HSCAN", Group: "hash", Summary: "Incrementally iterate hash fields and associated values", Arity: -3, Flags: []string{"readonly", "random"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HSET":             {Name: "HSET", Group: "hash", Summary: "Set the string value of a hash field", Arity: -4, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HSETNX":           {Name: "HSETNX", Group: "hash", Summary: "Set the value of a hash field, only if the field does not exist", Arity: 4, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HSTRLEN":          {Name: "HSTRLEN", Group: "hash", Summary: "Get the length of the value of a hash field", Arity: 3, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"HVALS":            {Name: "HVALS", Group: "hash", Summary: "Get all the values in a hash", Arity: 2, Flags: []string{"readonly", "sort_for_script"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"INCR":             {Name: "INCR", Group: "string", Summary: "Increment the integer value of a key by one", Arity: 2, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"INCRBY":           {Name: "INCRBY", Group: "string", Summary: "Increment the integer value of a key by the given amount", Arity: 3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"INCRBYFLOAT":      {Name: "INCRBYFLOAT", Group: "string", Summary: "Increment the float value of a key by the given amount", Arity: 3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"INFO":             {Name: "INFO", Group: "server", Summary: "Get information and statistics about the server", Arity: -1, Flags: []string{"random", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"KEYS":             {Name: "KEYS", Group: "generic", Summary: "Find all keys matching the given pattern", Arity: 2, Flags: []string{"readonly", "sort_for_script"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"LASTSAVE":         {Name: "LASTSAVE", Group: "server", Summary: "Get the UNIX time stamp of the last successful save to disk", Arity: 1, Flags: []string{"random", "loading", "stale", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"LATENCY":          {Name: "LATENCY", Group: "server", Summary: "A container for latency diagnostics commands", Arity: -2, Flags: []string{"admin", "noscript", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"LINDEX":           {Name: "LINDEX", Group: "list", Summary: "Get an element from a list by its index", Arity: 3, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LINSERT":          {Name: "LINSERT", Group: "list", Summary: "Insert an element before or after another element in a list", Arity: 5, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LLEN":             {Name: "LLEN", Group: "list", Summary: "Get the length of a list", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LPOP":             {Name: "LPOP", Group: "list", Summary: "Remove and get the first element in a list", Arity: 2, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LPUSH":            {Name: "LPUSH", Group: "list", Summary: "Prepend one or multiple elements to a list", Arity: -3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LPUSHX":           {Name: "LPUSHX", Group: "list", Summary: "Prepend an element to a list, only if the list exists", Arity: -3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LRANGE":           {Name: "LRANGE", Group: "list", Summary: "Get a range of elements from a list", Arity: 4, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LREM":             {Name: "LREM", Group: "list", Summary: "Remove elements from a list", Arity: 4, Flags: []string{"write"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LSET":             {Name: "LSET", Group: "list", Summary: "Set the value of an element in a list by its index", Arity: 4, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"LTRIM":            {Name: "LTRIM", Group: "list", Summary: "Trim a list to the specified range", Arity: 4, Flags: []string{"write"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"MGET":             {Name: "MGET", Group: "string", Summary: "Get the values of all the given keys", Arity: -2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"MIGRATE":          {Name: "MIGRATE", Group: "generic", Summary: "Atomically transfer a key from a Redis instance to another one", Arity: -6, Flags: []string{"write", "random", "movablekeys"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"MONITOR":          {Name: "MONITOR", Group: "server", Summary: "Listen for all requests received by the server in real time", Arity: 1, Flags: []string{"admin", "noscript", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"MOVE":             {Name: "MOVE", Group: "generic", Summary: "Move a key to another database", Arity: 3, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"MSET":             {Name: "MSET", Group: "string", Summary: "Set multiple keys to multiple values", Arity: -3, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: -1, KeyStep: 2},
+	"MSETNX":           {Name: "MSETNX", Group: "string", Summary: "Set multiple keys to multiple values, only if none of the keys exist", Arity: -3, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: -1, KeyStep: 2},
+	"MULTI":            {Name: "MULTI", Group: "transactions", Summary: "Mark the start of a transaction block", Arity: 1, Flags: []string{"noscript", "loading", "stale", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"OBJECT":           {Name: "OBJECT", Group: "generic", Summary: "Inspect the internals of Redis objects", Arity: -2, Flags: []string{"readonly", "random"}, FirstKey: 2, LastKey: 2, KeyStep: 1},
+	"PERSIST":          {Name: "PERSIST", Group: "generic", Summary: "Remove the expiration from a key", Arity: 2, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"PEXPIRE":          {Name: "PEXPIRE", Group: "generic", Summary: "Set a key's time to live in milliseconds", Arity: 3, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"PEXPIREAT":        {Name: "PEXPIREAT", Group: "generic", Summary: "Set the expiration for a key as a UNIX timestamp specified in milliseconds", Arity: 3, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"PFADD":            {Name: "PFADD", Group: "hyperloglog", Summary: "Adds the specified elements to the specified HyperLogLog", Arity: -2, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"PFCOUNT":          {Name: "PFCOUNT", Group: "hyperloglog", Summary: "Return the approximated cardinality of the set(s) observed by the HyperLogLog at key(s)", Arity: -2, Flags: []string{"readonly"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"PING":             {Name: "PING", Group: "connection", Summary: "Ping the server", Arity: -1, Flags: []string{"stale", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"PSETEX":           {Name: "PSETEX", Group: "string", Summary: "Set the value and expiration in milliseconds of a key", Arity: 4, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"PSUBSCRIBE":       {Name: "PSUBSCRIBE", Group: "pubsub", Summary: "Listen for messages published to channels matching the given patterns", Arity: -2, Flags: []string{"pubsub", "noscript", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"PTTL":             {Name: "PTTL", Group: "generic", Summary: "Get the time to live for a key in milliseconds", Arity: 2, Flags: []string{"readonly", "random", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"PUBLISH":          {Name: "PUBLISH", Group: "pubsub", Summary: "Post a message to a channel", Arity: 3, Flags: []string{"pubsub", "loading", "stale", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"PUBSUB":           {Name: "PUBSUB", Group: "pubsub", Summary: "Inspect the state of the Pub/Sub subsystem", Arity: -2, Flags: []string{"pubsub", "random", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"PUNSUBSCRIBE":     {Name: "PUNSUBSCRIBE", Group: "pubsub", Summary: "Stop listening for messages posted to channels matching the given patterns", Arity: -1, Flags: []string{"pubsub", "noscript", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"QUIT":             {Name: "QUIT", Group: "connection", Summary: "Close the connection", Arity: 1, Flags: []string{"loading", "stale", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"RANDOMKEY":        {Name: "RANDOMKEY", Group: "generic", Summary: "Return a random key from the keyspace", Arity: 1, Flags: []string{"readonly", "random"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"READONLY":         {Name: "READONLY", Group: "cluster", Summary: "Enables read queries for a connection to a cluster replica node", Arity: 1, Flags: []string{"fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"READWRITE":        {Name: "READWRITE", Group: "cluster", Summary: "Disables read queries for a connection to a cluster replica node", Arity: 1, Flags: []string{"fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"RENAME":           {Name: "RENAME", Group: "generic", Summary: "Rename a key", Arity: 3, Flags: []string{"write"}, FirstKey: 1, LastKey: 2, KeyStep: 1},
+	"RENAMENX":         {Name: "RENAMENX", Group: "generic", Summary: "Rename a key, only if the new key does not exist", Arity: 3, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 2, KeyStep: 1},
+	"REPLICAOF":        {Name: "REPLICAOF", Group: "server", Summary: "Make the server a replica of another instance, or promote it as master", Arity: 3, Flags: []string{"admin", "noscript", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"RESTORE":          {Name: "RESTORE", Group: "generic", Summary: "Create a key using the provided serialized value, previously obtained using DUMP", Arity: -4, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ROLE":             {Name: "ROLE", Group: "server", Summary: "Return the role of the instance in the context of replication", Arity: 1, Flags: []string{"noscript", "loading", "stale", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"RPOP":             {Name: "RPOP", Group: "list", Summary: "Remove and get the last element in a list", Arity: 2, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"RPOPLPUSH":        {Name: "RPOPLPUSH", Group: "list", Summary: "Remove the last element in a list, prepend it to another list and return it", Arity: 3, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: 2, KeyStep: 1},
+	"RPUSH":            {Name: "RPUSH", Group: "list", Summary: "Append one or multiple elements to a list", Arity: -3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"RPUSHX":           {Name: "RPUSHX", Group: "list", Summary: "Append an element to a list, only if the list exists", Arity: -3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SADD":             {Name: "SADD", Group: "set", Summary: "Add one or more members to a set", Arity: -3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SAVE":             {Name: "SAVE", Group: "server", Summary: "Synchronously save the dataset to disk", Arity: 1, Flags: []string{"admin", "noscript"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"SCAN":             {Name: "SCAN", Group: "generic", Summary: "Incrementally iterate the keys space", Arity: -2, Flags: []string{"readonly", "random"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"SCARD":            {Name: "SCARD", Group: "set", Summary: "Get the number of members in a set", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SCRIPT":           {Name: "SCRIPT", Group: "scripting", Summary: "Manage the Lua scripts cache", Arity: -2, Flags: []string{"noscript"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"SDIFF":            {Name: "SDIFF", Group: "set", Summary: "Subtract multiple sets", Arity: -2, Flags: []string{"readonly", "sort_for_script"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"SDIFFSTORE":       {Name: "SDIFFSTORE", Group: "set", Summary: "Subtract multiple sets and store the resulting set in a key", Arity: -3, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"SELECT":           {Name: "SELECT", Group: "connection", Summary: "Change the selected database for the current connection", Arity: 2, Flags: []string{"loading", "stale", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"SENTINEL":         {Name: "SENTINEL", Group: "sentinel", Summary: "A container for Redis Sentinel commands", Arity: -2, Flags: []string{"admin", "noscript", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"SET":              {Name: "SET", Group: "string", Summary: "Set the string value of a key", Arity: -3, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SETBIT":           {Name: "SETBIT", Group: "bitmap", Summary: "Sets or clears the bit at offset in the string value stored at key", Arity: 4, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SETEX":            {Name: "SETEX", Group: "string", Summary: "Set the value and expiration of a key", Arity: 4, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SETNX":            {Name: "SETNX", Group: "string", Summary: "Set the value of a key, only if the key does not exist", Arity: 3, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SETRANGE":         {Name: "SETRANGE", Group: "string", Summary: "Overwrite part of a string at key starting at the specified offset", Arity: 4, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SHUTDOWN":         {Name: "SHUTDOWN", Group: "server", Summary: "Synchronously save the dataset to disk and then shut down the server", Arity: -1, Flags: []string{"admin", "noscript", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"SINTER":           {Name: "SINTER", Group: "set", Summary: "Intersect multiple sets", Arity: -2, Flags: []string{"readonly", "sort_for_script"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"SINTERSTORE":      {Name: "SINTERSTORE", Group: "set", Summary: "Intersect multiple sets and store the resulting set in a key", Arity: -3, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"SISMEMBER":        {Name: "SISMEMBER", Group: "set", Summary: "Determine if a given value is a member of a set", Arity: 3, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SLAVEOF":          {Name: "SLAVEOF", Group: "server", Summary: "Make the server a replica of another instance, or promote it as master", Arity: 3, Flags: []string{"admin", "noscript", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"SLOWLOG":          {Name: "SLOWLOG", Group: "server", Summary: "Manages the Redis slow queries log", Arity: -2, Flags: []string{"admin", "random", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"SMEMBERS":         {Name: "SMEMBERS", Group: "set", Summary: "Get all the members in a set", Arity: 2, Flags: []string{"readonly", "sort_for_script"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SMOVE":            {Name: "SMOVE", Group: "set", Summary: "Move a member from one set to another", Arity: 4, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 2, KeyStep: 1},
+	"SORT":             {Name: "SORT", Group: "generic", Summary: "Sort the elements in a list, set or sorted set", Arity: -2, Flags: []string{"write", "denyoom", "movablekeys"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SPOP":             {Name: "SPOP", Group: "set", Summary: "Remove and return one or multiple random members from a set", Arity: -2, Flags: []string{"write", "random", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SRANDMEMBER":      {Name: "SRANDMEMBER", Group: "set", Summary: "Get one or multiple random members from a set", Arity: -2, Flags: []string{"readonly", "random"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SREM":             {Name: "SREM", Group: "set", Summary: "Remove one or more members from a set", Arity: -3, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SSCAN":            {Name: "SSCAN", Group: "set", Summary: "Incrementally iterate Set elements", Arity: -3, Flags: []string{"readonly", "random"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"STRLEN":           {Name: "STRLEN", Group: "string", Summary: "Get the length of the value stored in a key", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"SUBSCRIBE":        {Name: "SUBSCRIBE", Group: "pubsub", Summary: "Listen for messages published to the given channels", Arity: -2, Flags: []string{"pubsub", "noscript", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"SUNION":           {Name: "SUNION", Group: "set", Summary: "Add multiple sets", Arity: -2, Flags: []string{"readonly", "sort_for_script"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"SUNIONSTORE":      {Name: "SUNIONSTORE", Group: "set", Summary: "Add multiple sets and store the resulting set in a key", Arity: -3, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"SWAPDB":           {Name: "SWAPDB", Group: "server", Summary: "Swaps two Redis databases", Arity: 3, Flags: []string{"write", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"TIME":             {Name: "TIME", Group: "server", Summary: "Return the current server time", Arity: 1, Flags: []string{"random", "loading", "stale", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"TOUCH":            {Name: "TOUCH", Group: "generic", Summary: "Alters the last access time of a key(s)", Arity: -2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"TTL":              {Name: "TTL", Group: "generic", Summary: "Get the time to live for a key", Arity: 2, Flags: []string{"readonly", "random", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"TYPE":             {Name: "TYPE", Group: "generic", Summary: "Determine the type stored at key", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"UNLINK":           {Name: "UNLINK", Group: "generic", Summary: "Delete a key asynchronously in another thread", Arity: -2, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"UNSUBSCRIBE":      {Name: "UNSUBSCRIBE", Group: "pubsub", Summary: "Stop listening for messages posted to the given channels", Arity: -1, Flags: []string{"pubsub", "noscript", "loading", "stale"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"UNWATCH":          {Name: "UNWATCH", Group: "transactions", Summary: "Forget about all watched keys", Arity: 1, Flags: []string{"noscript", "fast"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"WAIT":             {Name: "WAIT", Group: "generic", Summary: "Wait for the synchronous replication of all the write commands sent in the context of the current connection", Arity: 3, Flags: []string{"noscript", "blocking"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"WATCH":            {Name: "WATCH", Group: "transactions", Summary: "Watch the given keys to determine execution of the MULTI/EXEC block", Arity: -2, Flags: []string{"noscript", "fast"}, FirstKey: 1, LastKey: -1, KeyStep: 1},
+	"XACK":             {Name: "XACK", Group: "stream", Summary: "Marks a pending message as correctly processed, effectively removing it from the pending entries list of the consumer group", Arity: -4, Flags: []string{"write", "random", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XADD":             {Name: "XADD", Group: "stream", Summary: "Appends a new entry to a stream", Arity: -5, Flags: []string{"write", "denyoom", "random", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XAUTOCLAIM":       {Name: "XAUTOCLAIM", Group: "stream", Summary: "Changes (or acquires) ownership of messages in a consumer group, as if the messages were delivered to the specified consumer", Arity: -6, Flags: []string{"write", "random", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XCLAIM":           {Name: "XCLAIM", Group: "stream", Summary: "Changes (or acquires) ownership of a message in a consumer group, as if the message was delivered to the specified consumer", Arity: -6, Flags: []string{"write", "random", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XDEL":             {Name: "XDEL", Group: "stream", Summary: "Removes the specified entries from the stream", Arity: -3, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XGROUP":           {Name: "XGROUP", Group: "stream", Summary: "Create, destroy, and manage consumer groups", Arity: -2, Flags: []string{"write", "denyoom"}, FirstKey: 2, LastKey: 2, KeyStep: 1},
+	"XINFO":            {Name: "XINFO", Group: "stream", Summary: "Get information on streams and consumer groups", Arity: -2, Flags: []string{"readonly", "random"}, FirstKey: 2, LastKey: 2, KeyStep: 1},
+	"XLEN":             {Name: "XLEN", Group: "stream", Summary: "Return the number of entries in a stream", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XPENDING":         {Name: "XPENDING", Group: "stream", Summary: "Return information and entries from a stream consumer group pending entries list", Arity: -3, Flags: []string{"readonly", "random"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XRANGE":           {Name: "XRANGE", Group: "stream", Summary: "Return a range of elements in a stream, with IDs matching the specified IDs interval", Arity: -4, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XREAD":            {Name: "XREAD", Group: "stream", Summary: "Return never seen elements in multiple streams, with IDs greater than the ones reported by the caller for each stream", Arity: -4, Flags: []string{"readonly", "blocking", "movablekeys"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"XREADGROUP":       {Name: "XREADGROUP", Group: "stream", Summary: "Return new entries from a stream using a consumer group, or access the history of the pending entries for a given consumer", Arity: -7, Flags: []string{"write", "blocking", "movablekeys"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"XREVRANGE":        {Name: "XREVRANGE", Group: "stream", Summary: "Return a range of elements in a stream, with IDs matching the specified IDs interval, in reverse order", Arity: -4, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"XTRIM":            {Name: "XTRIM", Group: "stream", Summary: "Trims the stream to (approximately if '~' is passed) a certain size", Arity: -4, Flags: []string{"write", "random"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZADD":             {Name: "ZADD", Group: "sorted-set", Summary: "Add one or more members to a sorted set, or update its score if it already exists", Arity: -4, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZCARD":            {Name: "ZCARD", Group: "sorted-set", Summary: "Get the number of members in a sorted set", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZCOUNT":           {Name: "ZCOUNT", Group: "sorted-set", Summary: "Count the members in a sorted set with scores within the given values", Arity: 4, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZINCRBY":          {Name: "ZINCRBY", Group: "sorted-set", Summary: "Increment the score of a member in a sorted set", Arity: 4, Flags: []string{"write", "denyoom", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZINTERSTORE":      {Name: "ZINTERSTORE", Group: "sorted-set", Summary: "Intersect multiple sorted sets and store the resulting sorted set in a new key", Arity: -4, Flags: []string{"write", "denyoom", "movablekeys"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+	"ZPOPMAX":          {Name: "ZPOPMAX", Group: "sorted-set", Summary: "Remove and return members with the highest scores in a sorted set", Arity: -2, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZPOPMIN":          {Name: "ZPOPMIN", Group: "sorted-set", Summary: "Remove and return members with the lowest scores in a sorted set", Arity: -2, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZRANGE":           {Name: "ZRANGE", Group: "sorted-set", Summary: "Return a range of members in a sorted set, by index", Arity: -4, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZRANGEBYSCORE":    {Name: "ZRANGEBYSCORE", Group: "sorted-set", Summary: "Return a range of members in a sorted set, by score", Arity: -4, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZRANK":            {Name: "ZRANK", Group: "sorted-set", Summary: "Determine the index of a member in a sorted set", Arity: 3, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZREM":             {Name: "ZREM", Group: "sorted-set", Summary: "Remove one or more members from a sorted set", Arity: -3, Flags: []string{"write", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZREMRANGEBYRANK":  {Name: "ZREMRANGEBYRANK", Group: "sorted-set", Summary: "Remove all members in a sorted set within the given indexes", Arity: 4, Flags: []string{"write"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZREMRANGEBYSCORE": {Name: "ZREMRANGEBYSCORE", Group: "sorted-set", Summary: "Remove all members in a sorted set within the given scores", Arity: 4, Flags: []string{"write"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZREVRANGE":        {Name: "ZREVRANGE", Group: "sorted-set", Summary: "Return a range of members in a sorted set, by index, with scores ordered from high to low", Arity: -4, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZREVRANK":         {Name: "ZREVRANK", Group: "sorted-set", Summary: "Determine the index of a member in a sorted set, with scores ordered from high to low", Arity: 3, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZSCAN":            {Name: "ZSCAN", Group: "sorted-set", Summary: "Incrementally iterate sorted sets elements and associated scores", Arity: -3, Flags: []string{"readonly", "random"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZSCORE":           {Name: "ZSCORE", Group: "sorted-set", Summary: "Get the score associated with the given member in a sorted set", Arity: 3, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
+	"ZUNIONSTORE":      {Name: "ZUNIONSTORE", Group: "sorted-set", Summary: "Add multiple sorted sets and store the resulting sorted set in a new key", Arity: -4, Flags: []string{"write", "denyoom", "movablekeys"}, FirstKey: 0, LastKey: 0, KeyStep: 0},
+}
@@ -0,0 +1,275 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+func TestCommands(t *testing.T) {
+	type received struct {
+		cmd  string
+		args []string
+	}
+
+	var (
+		recv  = make(chan received, 1)
+		reply interface{}
+	)
+
+	srv, addr := redistest.FakeServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var args []string
+		req.Cmds[0].ParseArgs(&args)
+		recv <- received{cmd: req.Cmds[0].Cmd, args: args}
+		res.Write(reply)
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr, Timeout: time.Second}
+	ctx := context.Background()
+
+	tests := []struct {
+		scenario string
+		call     func() (interface{}, error)
+		cmd      string
+		args     []string
+		reply    interface{}
+		expect   interface{}
+	}{
+		{
+			scenario: "SET replies with a status",
+			call:     func() (interface{}, error) { return nil, client.Set(ctx, "a", 1) },
+			cmd:      "SET",
+			args:     []string{"a", "1"},
+			reply:    "OK",
+		},
+		{
+			scenario: "GET replies with a string",
+			call:     func() (interface{}, error) { return client.Get(ctx, "a") },
+			cmd:      "GET",
+			args:     []string{"a"},
+			reply:    "1",
+			expect:   "1",
+		},
+		{
+			scenario: "DEL accepts multiple keys",
+			call:     func() (interface{}, error) { return client.Del(ctx, "a", "b", "c") },
+			cmd:      "DEL",
+			args:     []string{"a", "b", "c"},
+			reply:    2,
+			expect:   int64(2),
+		},
+		{
+			scenario: "EXPIRE replies with a boolean",
+			call:     func() (interface{}, error) { return client.Expire(ctx, "a", 10) },
+			cmd:      "EXPIRE",
+			args:     []string{"a", "10"},
+			reply:    1,
+			expect:   true,
+		},
+		{
+			scenario: "INCRBYFLOAT replies with a double",
+			call:     func() (interface{}, error) { return client.IncrByFloat(ctx, "a", 0.5) },
+			cmd:      "INCRBYFLOAT",
+			args:     []string{"a", "0.5"},
+			reply:    "1.5",
+			expect:   1.5,
+		},
+		{
+			scenario: "HGETALL replies with a map",
+			call:     func() (interface{}, error) { return client.HGetAll(ctx, "h") },
+			cmd:      "HGETALL",
+			args:     []string{"h"},
+			reply:    []interface{}{"f1", "v1", "f2", "v2"},
+			expect:   map[string]string{"f1": "v1", "f2": "v2"},
+		},
+		{
+			scenario: "MGET replies with a list of values",
+			call:     func() (interface{}, error) { return client.MGet(ctx, "a", "b") },
+			cmd:      "MGET",
+			args:     []string{"a", "b"},
+			reply:    []interface{}{"1", nil},
+			expect:   []interface{}{"1", nil},
+		},
+		{
+			scenario: "LINSERT emits the BEFORE token",
+			call:     func() (interface{}, error) { return client.LInsertBefore(ctx, "l", "x", "y") },
+			cmd:      "LINSERT",
+			args:     []string{"l", "BEFORE", "x", "y"},
+			reply:    3,
+			expect:   int64(3),
+		},
+		{
+			scenario: "ZADD flattens scores and members",
+			call: func() (interface{}, error) {
+				return client.ZAdd(ctx, "z", redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 2.5, Member: "b"})
+			},
+			cmd:    "ZADD",
+			args:   []string{"z", "1", "a", "2.5", "b"},
+			reply:  2,
+			expect: int64(2),
+		},
+		{
+			scenario: "ZRANK replies with the rank of members",
+			call:     func() (interface{}, error) { return client.ZRank(ctx, "z", "a") },
+			cmd:      "ZRANK",
+			args:     []string{"z", "a"},
+			reply:    0,
+			expect:   int64(0),
+		},
+		{
+			scenario: "ZRANGE WITHSCORES replies with members and scores",
+			call:     func() (interface{}, error) { return client.ZRangeWithScores(ctx, "z", 0, -1) },
+			cmd:      "ZRANGE",
+			args:     []string{"z", "0", "-1", "WITHSCORES"},
+			reply:    []interface{}{"a", "1", "b", "2.5"},
+			expect:   []redis.Z{{Score: 1, Member: "a"}, {Score: 2.5, Member: "b"}},
+		},
+		{
+			scenario: "SCAN omits unset optional arguments",
+			call: func() (interface{}, error) {
+				cursor, keys, err := client.Scan(ctx, 0, "", 0)
+				return []interface{}{cursor, keys}, err
+			},
+			cmd:    "SCAN",
+			args:   []string{"0"},
+			reply:  []interface{}{"12", []interface{}{"a", "b"}},
+			expect: []interface{}{uint64(12), []string{"a", "b"}},
+		},
+		{
+			scenario: "SCAN emits MATCH and COUNT tokens",
+			call: func() (interface{}, error) {
+				cursor, keys, err := client.Scan(ctx, 12, "a*", 100)
+				return []interface{}{cursor, keys}, err
+			},
+			cmd:    "SCAN",
+			args:   []string{"12", "MATCH", "a*", "COUNT", "100"},
+			reply:  []interface{}{"0", []interface{}{}},
+			expect: []interface{}{uint64(0), []string{}},
+		},
+		{
+			scenario: "CONFIG GET emits the subcommand",
+			call:     func() (interface{}, error) { return client.ConfigGet(ctx, "maxmemory") },
+			cmd:      "CONFIG",
+			args:     []string{"GET", "maxmemory"},
+			reply:    []interface{}{"maxmemory", "0"},
+			expect:   map[string]string{"maxmemory": "0"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			it := assert.New(t)
+
+			reply = test.reply
+
+			v, err := test.call()
+			if it.Nil(err) {
+				r := <-recv
+				it.Equal(test.cmd, r.cmd)
+				it.Equal(test.args, r.args)
+				it.Equal(test.expect, v)
+			}
+		})
+	}
+}
+
+func TestCommandsNilReply(t *testing.T) {
+	it := assert.New(t)
+
+	srv, addr := redistest.FakeServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write(nil)
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr, Timeout: time.Second}
+
+	_, err := client.Get(context.Background(), "missing")
+	it.Equal(redis.ErrNil, err)
+
+	_, err = client.ZRank(context.Background(), "z", "missing")
+	it.Equal(redis.ErrNil, err)
+
+	_, err = client.ZRevRank(context.Background(), "z", "missing")
+	it.Equal(redis.ErrNil, err)
+}
+
+func TestLookupCommand(t *testing.T) {
+	tests := []struct {
+		scenario string
+		name     string
+		n        int
+		readonly bool
+		keys     []int
+	}{
+		{
+			scenario: "GET has a single key",
+			name:     "get",
+			n:        1,
+			readonly: true,
+			keys:     []int{0},
+		},
+		{
+			scenario: "DEL has keys in all positions",
+			name:     "DEL",
+			n:        3,
+			keys:     []int{0, 1, 2},
+		},
+		{
+			scenario: "MSET has keys every other position",
+			name:     "MSET",
+			n:        4,
+			keys:     []int{0, 2},
+		},
+		{
+			scenario: "BLPOP has a trailing timeout",
+			name:     "BLPOP",
+			n:        3,
+			keys:     []int{0, 1},
+		},
+		{
+			scenario: "BLPOP without arguments has no keys",
+			name:     "BLPOP",
+			n:        0,
+			keys:     nil,
+		},
+		{
+			scenario: "OBJECT without arguments has no keys",
+			name:     "OBJECT",
+			readonly: true,
+			n:        0,
+			keys:     nil,
+		},
+		{
+			scenario: "PING has no keys",
+			name:     "PING",
+			n:        0,
+			keys:     nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			it := assert.New(t)
+
+			cmd := redis.LookupCommand(test.name)
+			if it.NotNil(cmd) {
+				it.Equal(test.readonly, cmd.IsReadOnly())
+				it.Equal(test.keys, cmd.KeyIndexes(test.n))
+			}
+		})
+	}
+
+	assert.New(t).Nil(redis.LookupCommand("NOT-A-COMMAND"))
+}
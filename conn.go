@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"sync"
@@ -18,6 +19,9 @@ var (
 	// ErrDiscard is the error returned to indicate that transactions are
 	// discarded.
 	ErrDiscard = resp.NewError("EXECABORT Transaction discarded.")
+
+	// aLongTimeAgo is a deadline in the past, used to interrupt blocked reads.
+	aLongTimeAgo = time.Unix(1, 0)
 )
 
 // Conn is a low-level API to represent client connections to redis.
@@ -30,12 +34,37 @@ type Conn struct {
 	decoder objconv.StreamDecoder
 	parser  resp.Parser
 
+	// set by servers to limit the size of the requests read by ReadCommands
+	limits  requestLimits
+	request requestReader
+	rparser requestParser
+
 	wmutex  sync.Mutex
 	wbuffer bufio.Writer
 	encoder objconv.StreamEncoder
 	emitter resp.ClientEmitter
 
 	curState struct{ atomic uint64 }
+
+	// set by servers when the client authenticated
+	user string
+
+	// set by servers when the client switched to RESP3 with HELLO, the push
+	// messages sent while a response is written are queued until it is flushed
+	resp3    bool
+	replying bool
+	pushes   [][]byte
+
+	// set by servers to describe the client of the connection
+	client clientState
+
+	// set by servers to record the arguments of requests in the slow log
+	argv slowLogArgs
+
+	// set by the connection pools of transports
+	createdAt time.Time
+	idleAt    time.Time
+	blocking  bool
 }
 
 // Dial connects to the redis server at the given address, returning a new client
@@ -93,9 +122,11 @@ func NewServerConn(conn net.Conn, s *Server) *Conn {
 		rbuffer: *bufio.NewReader(conn),
 		wbuffer: *bufio.NewWriter(conn),
 	}
-	c.parser.Reset(&c.rbuffer)
+	c.request.r = &c.rbuffer
+	c.rparser = requestParser{Parser: &c.parser, limits: &c.limits}
+	c.parser.Reset(&c.request)
 	c.emitter.Reset(&c.wbuffer)
-	c.decoder = objconv.StreamDecoder{Parser: &c.parser}
+	c.decoder = objconv.StreamDecoder{Parser: &c.rparser}
 	c.encoder = objconv.StreamEncoder{Emitter: &c.emitter.Emitter}
 	return c
 }
@@ -217,6 +248,50 @@ func (c *Conn) Flush() error {
 	return err
 }
 
+// beginReply marks the start of a response written by a server on c, the push
+// messages sent to c are queued until the response is flushed.
+func (c *Conn) beginReply() {
+	c.wmutex.Lock()
+	c.replying = true
+	c.wmutex.Unlock()
+}
+
+// endReply writes the push messages queued while the response was written and
+// flushes the response.
+func (c *Conn) endReply() error {
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+
+	for _, msg := range c.pushes {
+		c.wbuffer.Write(msg)
+	}
+
+	c.pushes, c.replying = nil, false
+	return c.wbuffer.Flush()
+}
+
+// push sends the RESP3 push message msg to the client of c, between the
+// responses to its requests.
+func (c *Conn) push(msg []byte, timeout time.Duration) error {
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+
+	if c.replying {
+		c.pushes = append(c.pushes, msg)
+		return nil
+	}
+
+	c.setWriteTimeout(timeout)
+	c.wbuffer.Write(msg)
+
+	err := c.wbuffer.Flush()
+	if err != nil {
+		c.conn.Close()
+	}
+
+	return err
+}
+
 // ReadCommands returns a new CommandReader which reads the next set of commands
 // from c.
 //
@@ -227,6 +302,7 @@ func (c *Conn) ReadCommands(retry bool) *CommandReader {
 	c.rmutex.Lock()
 
 	c.resetDecoder()
+	c.request.reset(c.limits.maxRequestSize)
 
 	return &CommandReader{
 		conn:  c,
@@ -552,6 +628,137 @@ func (c *Conn) waitReadyRead(timeout time.Duration) (err error) {
 	return
 }
 
+// watchClose starts watching the connection for the peer closing it while a
+// handler is blocked, calling cancel if it happens. The arguments of the
+// request being served must have been fully read already.
+//
+// The returned function stops watching the connection, it must be called
+// before reading from the connection again, and leaves it without a read
+// deadline.
+func (c *Conn) watchClose(cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+
+	c.setReadTimeout(0)
+
+	go func() {
+		defer close(done)
+
+		// Peek doesn't consume the data that a client may have pipelined
+		// after the request, it stays buffered for the next read.
+		if _, err := c.rbuffer.Peek(1); err != nil && !isTimeout(err) {
+			cancel()
+		}
+	}()
+
+	return func() {
+		// Unblocks Peek, the timeout error is not retained by the buffer.
+		c.conn.SetReadDeadline(aLongTimeAgo)
+		<-done
+		c.setReadTimeout(0)
+	}
+}
+
+// requestLimits are the limits of the size of requests read by command readers,
+// zero values mean no limits.
+type requestLimits struct {
+	maxRequestSize  int
+	maxBulkLen      int
+	maxMultiBulkLen int
+}
+
+// requestParser is the parser of server connections, it fails when reading
+// commands or arguments exceeding the limits of requests.
+type requestParser struct {
+	*resp.Parser
+	limits *requestLimits
+}
+
+func (p *requestParser) ParseArrayBegin() (n int, err error) {
+	// The length is checked before anything is allocated for the values of
+	// the array.
+	if n, err = p.Parser.ParseArrayBegin(); err == nil && p.limits.maxMultiBulkLen > 0 && n > p.limits.maxMultiBulkLen {
+		n, err = 0, errInvalidMultiBulkLength
+	}
+	return
+}
+
+func (p *requestParser) ParseBytes() (b []byte, err error) {
+	// The length is checked before the content of the bulk string is
+	// buffered.
+	if p.limits.maxBulkLen > 0 && p.peekBulkLen() > p.limits.maxBulkLen {
+		return nil, errInvalidBulkLength
+	}
+	return p.Parser.ParseBytes()
+}
+
+// peekBulkLen returns the length declared by the header of the next bulk
+// string, without consuming it. Zero is returned if the next value isn't a
+// bulk string, the parser then reports the error.
+func (p *requestParser) peekBulkLen() int {
+	// ParseType buffers the header line, which the parser exposes as the
+	// beginning of its buffered data.
+	if _, err := p.Parser.ParseType(); err != nil {
+		return 0
+	}
+
+	var line [24]byte
+	n, _ := io.ReadFull(p.Parser.Buffered(), line[:])
+
+	if n == 0 || line[0] != '$' {
+		return 0
+	}
+
+	size := 0
+
+	for _, c := range line[1:n] {
+		switch {
+		case c == '\r':
+			return size
+		case c < '0' || c > '9':
+			return 0
+		}
+
+		size = 10*size + int(c-'0')
+	}
+
+	// The header is longer than any valid length.
+	return int(^uint(0) >> 1)
+}
+
+// requestReader is the reader of the parser of server connections, it fails
+// when the request being read exceeds the maximum size of requests.
+//
+// The parser reads ahead, so the data read for a request may include the
+// beginning of the next pipelined request.
+type requestReader struct {
+	r      *bufio.Reader
+	remain int
+	limit  bool
+}
+
+func (r *requestReader) Read(b []byte) (int, error) {
+	if !r.limit {
+		return r.r.Read(b)
+	}
+
+	if r.remain == 0 {
+		return 0, errRequestTooLarge
+	}
+
+	if len(b) > r.remain {
+		b = b[:r.remain]
+	}
+
+	n, err := r.r.Read(b)
+	r.remain -= n
+	return n, err
+}
+
+// reset starts reading a new request of up to size bytes, zero means no limit.
+func (r *requestReader) reset(size int) {
+	r.remain, r.limit = size, size > 0
+}
+
 func (c *Conn) setTimeout(timeout time.Duration) {
 	if timeout == 0 {
 		c.conn.SetDeadline(time.Time{})
@@ -583,6 +790,7 @@ type connArgs struct {
 	tx      *txArgs
 	respTyp objconv.Type
 	respErr *resp.Error
+	err     error
 }
 
 func (args *connArgs) Close() error {
@@ -615,6 +823,10 @@ func (args *connArgs) Close() error {
 		args.conn = nil
 	}
 
+	if err == nil && args.err != nil {
+		err = args.err
+	}
+
 	if args.tx != nil {
 		args.tx.mutex.Unlock()
 		args.tx = nil
@@ -634,6 +846,18 @@ func (args *connArgs) Len() (n int) {
 }
 
 func (args *connArgs) Next(dst interface{}) bool {
+	if isAggregate(dst) {
+		ok, err := decodeArgs(args, dst)
+		if err != nil {
+			args.mutex.Lock()
+			if args.err == nil {
+				args.err = err
+			}
+			args.mutex.Unlock()
+		}
+		return ok && err == nil
+	}
+
 	args.mutex.Lock()
 
 	var err error
@@ -230,7 +230,7 @@ func TestConn(t *testing.T) {
 				c1, c2 := newTestConnPair()
 
 				client := redis.NewClientConn(c1)
-				server := redis.NewServerConn(c2)
+				server := redis.NewServerConn(c2, nil)
 
 				deadline := time.Now().Add(4 * time.Second)
 				client.SetDeadline(deadline)
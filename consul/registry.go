@@ -0,0 +1,403 @@
+// Package consul implements a redis.ServerRegistry backed by the health API of
+// Consul.
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	redis "github.com/dolab/redis-go"
+)
+
+// Registry is an implementation of redis.ServerRegistry which exposes the
+// healthy instances of a Consul service.
+//
+// The registry watches the service with Consul blocking queries, the ring
+// returned by LookupServers is rebuilt when the health of the instances changes
+// and cached until then. The weights of the instances set the share of keys
+// they are assigned, they are scaled down to at most 10. The zone of the
+// instances is read from the "zone" key of the service or node metadata.
+//
+// Registries are safe for concurrent use by multiple goroutines.
+type Registry struct {
+	// Address is the address of the Consul agent, "localhost:8500" is used if
+	// it is empty.
+	Address string
+
+	// Service is the name of the Consul service of the redis servers.
+	Service string
+
+	// Tags is the list of tags that the instances of the service must have.
+	Tags []string
+
+	// Datacenter is the datacenter to query, the datacenter of the agent is
+	// used if it is empty.
+	Datacenter string
+
+	// Token is the ACL token sent with the queries.
+	Token string
+
+	// UserAgent is the User-Agent header sent with the queries, the default
+	// user agent of the HTTP client is used if it is empty.
+	UserAgent string
+
+	// WaitTime is the maximum duration of blocking queries. Zero means 5m.
+	WaitTime time.Duration
+
+	// BlacklistTimeout is the amount of time that blacklisted servers are
+	// removed from the ring for. Zero means 10s.
+	BlacklistTimeout time.Duration
+
+	// Client is the HTTP client used to query Consul, http.DefaultClient is
+	// used if it is nil.
+	Client *http.Client
+
+	once      sync.Once
+	cancel    context.CancelFunc
+	ready     chan struct{}
+	mutex     sync.RWMutex
+	endpoints []redis.ServerEndpoint
+	blacklist map[string]time.Time
+	ring      redis.ServerRing
+	err       error
+}
+
+// LookupServers satisfies the redis.ServerRegistry interface.
+//
+// The first call blocks until Consul responded, or ctx is done.
+func (r *Registry) LookupServers(ctx context.Context) (redis.ServerRing, error) {
+	r.once.Do(r.init)
+
+	select {
+	case <-r.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.ring == nil {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, fmt.Errorf("consul: no healthy instances of the %s service", r.Service)
+	}
+
+	return r.ring, nil
+}
+
+// BlacklistServer satisfies the redis.ServerBlacklist interface.
+func (r *Registry) BlacklistServer(endpoint redis.ServerEndpoint) {
+	r.once.Do(r.init)
+
+	timeout := r.BlacklistTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	r.mutex.Lock()
+	r.blacklist[endpoint.Addr] = time.Now().Add(timeout)
+	r.rebuild()
+	r.mutex.Unlock()
+
+	time.AfterFunc(timeout, func() {
+		r.mutex.Lock()
+		r.rebuild()
+		r.mutex.Unlock()
+	})
+}
+
+// Close stops watching the service.
+func (r *Registry) Close() error {
+	r.once.Do(r.init)
+	r.cancel()
+	return nil
+}
+
+func (r *Registry) init() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.cancel = cancel
+	r.ready = make(chan struct{})
+	r.blacklist = make(map[string]time.Time)
+
+	go r.watch(ctx)
+}
+
+// watch follows the changes of the health of the service, the first query
+// returns immediately and the next ones block until something changes.
+func (r *Registry) watch(ctx context.Context) {
+	var (
+		index    uint64
+		failures int
+		ready    = r.ready
+	)
+
+	for {
+		endpoints, next, err := r.query(ctx, index)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		r.mutex.Lock()
+
+		if err != nil {
+			r.err = err
+		} else {
+			r.err = nil
+			r.endpoints = endpoints
+			r.rebuild()
+		}
+
+		r.mutex.Unlock()
+
+		if ready != nil {
+			close(ready)
+			ready = nil
+		}
+
+		if err != nil {
+			failures++
+		} else {
+			failures = 0
+
+			// The index going backwards means Consul was reset, the next
+			// query must not block.
+			if next < index {
+				next = 0
+			}
+			index = next
+		}
+
+		if failures != 0 {
+			// Retry failed queries with a capped backoff to avoid hammering
+			// the agent when it's unavailable.
+			delay := time.Duration(failures) * 100 * time.Millisecond
+			if delay > 5*time.Second {
+				delay = 5 * time.Second
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// serviceEntry is the subset of the entries returned by /v1/health/service
+// that the registry uses.
+type serviceEntry struct {
+	Node struct {
+		Node       string
+		Address    string
+		Datacenter string
+		Meta       map[string]string
+	}
+	Service struct {
+		ID      string
+		Address string
+		Port    int
+		Tags    []string
+		Meta    map[string]string
+		Weights struct {
+			Passing int
+		}
+	}
+}
+
+func (r *Registry) query(ctx context.Context, index uint64) ([]redis.ServerEndpoint, uint64, error) {
+	q := url.Values{}
+	q.Set("passing", "1")
+
+	if index != 0 {
+		q.Set("index", strconv.FormatUint(index, 10))
+		q.Set("wait", r.waitTime().String())
+	}
+
+	if len(r.Datacenter) != 0 {
+		q.Set("dc", r.Datacenter)
+	}
+
+	for _, tag := range r.Tags {
+		q.Add("tag", tag)
+	}
+
+	address := r.Address
+	if len(address) == 0 {
+		address = "localhost:8500"
+	}
+
+	u := url.URL{
+		Scheme:   "http",
+		Host:     address,
+		Path:     "/v1/health/service/" + r.Service,
+		RawQuery: q.Encode(),
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+
+	if len(r.Token) != 0 {
+		req.Header.Set("X-Consul-Token", r.Token)
+	}
+
+	if len(r.UserAgent) != 0 {
+		req.Header.Set("User-Agent", r.UserAgent)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("consul: %s responded with %s", u.Path, res.Status)
+	}
+
+	next, err := strconv.ParseUint(res.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, 0, errors.New("consul: missing or invalid X-Consul-Index header")
+	}
+
+	var entries []serviceEntry
+
+	if err := json.NewDecoder(res.Body).Decode(&entries); err != nil {
+		return nil, 0, err
+	}
+
+	endpoints := make([]redis.ServerEndpoint, 0, len(entries))
+	max := 0
+
+	for _, entry := range entries {
+		if w := entry.Service.Weights.Passing; w > max {
+			max = w
+		}
+	}
+
+	for _, entry := range entries {
+		// Older versions of Consul don't filter on multiple tags.
+		if !hasTags(entry.Service.Tags, r.Tags) {
+			continue
+		}
+
+		host := entry.Service.Address
+		if len(host) == 0 {
+			host = entry.Node.Address
+		}
+
+		zone := entry.Service.Meta["zone"]
+		if len(zone) == 0 {
+			zone = entry.Node.Meta["zone"]
+		}
+
+		endpoints = append(endpoints, redis.ServerEndpoint{
+			Name:   entry.Service.ID,
+			Addr:   net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)),
+			Zone:   zone,
+			Weight: weight(entry.Service.Weights.Passing, max),
+		})
+	}
+
+	return endpoints, next, nil
+}
+
+// maxWeight is the maximum weight of the endpoints, the weights of Consul
+// services range up to 65535 while each unit of weight adds nodes to the ring.
+const maxWeight = 10
+
+// weight returns the weight of the endpoint of an instance of weight w, the
+// weights are scaled down to maxWeight relative to the largest weight max of
+// the instances. Instances of weight zero or less have a weight of one.
+func weight(w int, max int) int {
+	if w <= 0 {
+		return 1
+	}
+
+	if max <= maxWeight {
+		return w
+	}
+
+	// Rounded up so the smallest weights don't drop to zero.
+	return (w*maxWeight + max - 1) / max
+}
+
+// rebuild rebuilds the ring from the endpoints which are not blacklisted, the
+// registry's mutex must be held.
+func (r *Registry) rebuild() {
+	now := time.Now()
+	endpoints := make(redis.ServerList, 0, len(r.endpoints))
+
+	for addr, expiry := range r.blacklist {
+		if !now.Before(expiry) {
+			delete(r.blacklist, addr)
+		}
+	}
+
+	for _, endpoint := range r.endpoints {
+		if _, blacklisted := r.blacklist[endpoint.Addr]; !blacklisted {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	if len(endpoints) == 0 {
+		r.ring = nil
+		return
+	}
+
+	// The list was copied, its ring can be shared by all the callers.
+	r.ring, _ = endpoints.LookupServers(context.Background())
+}
+
+func (r *Registry) waitTime() time.Duration {
+	if wait := r.WaitTime; wait != 0 {
+		return wait
+	}
+
+	return 5 * time.Minute
+}
+
+func hasTags(tags []string, required []string) bool {
+	for _, req := range required {
+		found := false
+
+		for _, tag := range tags {
+			if tag == req {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,314 @@
+package consul_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/consul"
+	"github.com/dolab/redis-go/redistest"
+)
+
+// fakeConsul is a stand-in for the /v1/health/service endpoint of the Consul
+// API, supporting blocking queries.
+type fakeConsul struct {
+	mutex    sync.Mutex
+	index    uint64
+	services map[string][]instance
+	changed  chan struct{}
+	queries  int
+	agent    string
+}
+
+type instance struct {
+	ID     string
+	Port   int
+	Tags   []string
+	Weight int
+	Zone   string
+}
+
+func newFakeConsul() (*fakeConsul, *httptest.Server) {
+	c := &fakeConsul{
+		index:    1,
+		services: map[string][]instance{},
+		changed:  make(chan struct{}),
+	}
+	return c, httptest.NewServer(c)
+}
+
+func (c *fakeConsul) set(service string, instances ...instance) {
+	c.mutex.Lock()
+	c.services[service] = instances
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.mutex.Unlock()
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	service := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+	query := r.URL.Query()
+
+	c.mutex.Lock()
+	c.queries++
+	c.agent = r.UserAgent()
+	index, changed := c.index, c.changed
+	c.mutex.Unlock()
+
+	if i, _ := strconv.ParseUint(query.Get("index"), 10, 64); i != 0 && i >= index {
+		wait, _ := time.ParseDuration(query.Get("wait"))
+
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	c.mutex.Lock()
+	index, instances := c.index, c.services[service]
+	c.mutex.Unlock()
+
+	entries := []map[string]interface{}{}
+
+	for _, i := range instances {
+		entries = append(entries, map[string]interface{}{
+			"Node": map[string]interface{}{
+				"Node":       "node-" + i.ID,
+				"Address":    "127.0.0.1",
+				"Datacenter": "dc1",
+			},
+			"Service": map[string]interface{}{
+				"ID":      i.ID,
+				"Address": "",
+				"Port":    i.Port,
+				"Tags":    i.Tags,
+				"Meta":    map[string]string{"zone": i.Zone},
+				"Weights": map[string]int{"Passing": i.Weight, "Warning": 1},
+			},
+		})
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (c *fakeConsul) queryCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.queries
+}
+
+func (c *fakeConsul) userAgent() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.agent
+}
+
+func TestRegistry(t *testing.T) {
+	redistest.TestServerRegistry(t, func() (redis.ServerRegistry, string, redis.ServerEndpoint, func(), error) {
+		fake, server := newFakeConsul()
+
+		fake.set("redis",
+			instance{ID: "A", Port: 4242, Weight: 1},
+			instance{ID: "B", Port: 4243, Weight: 1, Zone: "us-east-1b"},
+			instance{ID: "C", Port: 4244, Weight: 1},
+		)
+
+		registry := &consul.Registry{
+			Address: strings.TrimPrefix(server.URL, "http://"),
+			Service: "redis",
+		}
+
+		endpoint := redis.ServerEndpoint{Name: "B", Addr: "127.0.0.1:4243", Zone: "us-east-1b", Weight: 1}
+
+		teardown := func() {
+			registry.Close()
+			server.Close()
+		}
+
+		return registry, "A", endpoint, teardown, nil
+	})
+}
+
+func TestRegistryWatch(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, *fakeConsul, *consul.Registry)
+	}{
+		{
+			scenario: "the ring is rebuilt when the health of the service changes",
+			function: testRegistryHealthChanges,
+		},
+		{
+			scenario: "the ring is cached until the health of the service changes",
+			function: testRegistryCache,
+		},
+		{
+			scenario: "only the instances with the registry's tags are used",
+			function: testRegistryTags,
+		},
+		{
+			scenario: "blacklisted servers are removed from the ring until the timeout expires",
+			function: testRegistryBlacklist,
+		},
+		{
+			scenario: "the weights of the instances are scaled down",
+			function: testRegistryWeights,
+		},
+		{
+			scenario: "the queries are sent with the registry's user agent",
+			function: testRegistryUserAgent,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			fake, server := newFakeConsul()
+			defer server.Close()
+
+			fake.set("redis", instance{ID: "A", Port: 4242, Tags: []string{"redis-cluster:a"}})
+
+			registry := &consul.Registry{
+				Address:          strings.TrimPrefix(server.URL, "http://"),
+				Service:          "redis",
+				BlacklistTimeout: 50 * time.Millisecond,
+			}
+			defer registry.Close()
+
+			testFunc(t, ctx, fake, registry)
+		})
+	}
+}
+
+func lookupAddr(ctx context.Context, registry redis.ServerRegistry) string {
+	ring, err := registry.LookupServers(ctx)
+	if err != nil {
+		return err.Error()
+	}
+	return ring.LookupServer("key").Addr
+}
+
+func waitForAddr(t *testing.T, ctx context.Context, registry redis.ServerRegistry, addr string) {
+	for lookupAddr(ctx, registry) != addr {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("the registry never returned %s", addr)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func testRegistryHealthChanges(t *testing.T, ctx context.Context, fake *fakeConsul, registry *consul.Registry) {
+	assert.New(t).Equal("127.0.0.1:4242", lookupAddr(ctx, registry))
+
+	fake.set("redis", instance{ID: "B", Port: 4243})
+	waitForAddr(t, ctx, registry, "127.0.0.1:4243")
+
+	fake.set("redis")
+	_, err := registry.LookupServers(ctx)
+	for err == nil && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+		_, err = registry.LookupServers(ctx)
+	}
+	assert.New(t).NotNil(err)
+}
+
+func testRegistryCache(t *testing.T, ctx context.Context, fake *fakeConsul, registry *consul.Registry) {
+	it := assert.New(t)
+
+	ring1, err := registry.LookupServers(ctx)
+	it.Nil(err)
+
+	for i := 0; i != 10; i++ {
+		ring2, err := registry.LookupServers(ctx)
+		it.Nil(err)
+		it.True(ring1 == ring2)
+	}
+
+	// the initial query and the blocking one
+	it.True(fake.queryCount() <= 2)
+}
+
+func testRegistryTags(t *testing.T, ctx context.Context, fake *fakeConsul, registry *consul.Registry) {
+	registry.Tags = []string{"redis-cluster:b"}
+
+	fake.set("redis",
+		instance{ID: "A", Port: 4242, Tags: []string{"redis-cluster:a"}},
+		instance{ID: "B", Port: 4243, Tags: []string{"redis-cluster:b"}},
+	)
+
+	assert.New(t).Equal("127.0.0.1:4243", lookupAddr(ctx, registry))
+}
+
+func testRegistryWeights(t *testing.T, ctx context.Context, fake *fakeConsul, registry *consul.Registry) {
+	it := assert.New(t)
+
+	fake.set("redis",
+		instance{ID: "A", Port: 4242, Weight: 1},
+		instance{ID: "B", Port: 4243, Weight: 1000},
+	)
+
+	ring, err := registry.LookupServers(ctx)
+	if !it.Nil(err) {
+		return
+	}
+
+	n := 0
+	for i := 0; i != 1000; i++ {
+		if ring.LookupServer(strconv.Itoa(i)).Addr == "127.0.0.1:4242" {
+			n++
+		}
+	}
+	it.True(n > 20, n)
+	it.True(n < 200, n)
+}
+
+func testRegistryBlacklist(t *testing.T, ctx context.Context, fake *fakeConsul, registry *consul.Registry) {
+	it := assert.New(t)
+
+	fake.set("redis",
+		instance{ID: "A", Port: 4242},
+		instance{ID: "B", Port: 4243},
+	)
+
+	// finds which of the two servers the key is hashed to
+	addrs := []string{"127.0.0.1:4242", "127.0.0.1:4243"}
+	if lookupAddr(ctx, redis.ServerList{{Addr: addrs[0]}, {Addr: addrs[1]}}) != addrs[1] {
+		addrs[0], addrs[1] = addrs[1], addrs[0]
+	}
+
+	waitForAddr(t, ctx, registry, addrs[1])
+
+	registry.BlacklistServer(redis.ServerEndpoint{Addr: addrs[1]})
+	it.Equal(addrs[0], lookupAddr(ctx, registry))
+
+	waitForAddr(t, ctx, registry, addrs[1])
+}
+
+func testRegistryUserAgent(t *testing.T, ctx context.Context, fake *fakeConsul, registry *consul.Registry) {
+	registry.UserAgent = "RED (test)"
+
+	it := assert.New(t)
+	it.Equal("127.0.0.1:4242", lookupAddr(ctx, registry))
+	it.Equal("RED (test)", fake.userAgent())
+}
@@ -0,0 +1,512 @@
+package redis
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The functions in this file convert values read from an argument list into
+// aggregate Go types: maps, structs and slices other than []byte.
+//
+// Structs are decoded from lists of field/value pairs, which is the shape of
+// replies to commands like HGETALL or CONFIG GET. Fields are matched by the
+// name set in their `redis` tag, or by their Go name if they have no tag, and
+// a tag of "-" excludes the field. A struct that embeds a blank field tagged
+// with the "array" option is decoded positionally instead, which is how nested
+// replies like XRANGE entries or CLUSTER SLOTS ranges are laid out:
+//
+//	type StreamEntry struct {
+//		_      struct{} `redis:",array"`
+//		ID     string
+//		Fields map[string]string
+//	}
+//
+// When decoding positionally the last field may be a slice other than []byte,
+// in which case it receives all the remaining values of the list, unless a
+// single value remains and it is a nested list.
+
+var (
+	errorInterface           = reflect.TypeOf((*error)(nil)).Elem()
+	textUnmarshalerInterface = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerInterface   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType                 = reflect.TypeOf(time.Time{})
+)
+
+// decodeArgs reads values from args into dst, which must be a pointer to an
+// aggregate type (see isAggregate).
+//
+// If the next value of args is itself an array it is decoded into dst, unless
+// dst is a slice of aggregates, in which case all the remaining values are
+// decoded as its elements. If the next value is a scalar all the remaining
+// values of args are loaded and decoded into dst, this is how a HGETALL reply
+// gets decoded into a map or a struct.
+//
+// The method returns false if args had no more values to read.
+func decodeArgs(args Args, dst interface{}) (bool, error) {
+	var v interface{}
+
+	if !args.Next(&v) {
+		return false, nil
+	}
+
+	if list, ok := v.([]interface{}); ok && !isAggregateSlice(reflect.TypeOf(dst)) {
+		return true, decodeValue(reflect.ValueOf(dst), list)
+	}
+
+	list := []interface{}{v}
+
+	for v = nil; args.Next(&v); v = nil {
+		list = append(list, v)
+	}
+
+	// A single nil value is a null reply (for example a blocking command that
+	// timed out), the destination is left to its zero value.
+	if len(list) == 1 && list[0] == nil {
+		return true, decodeValue(reflect.ValueOf(dst), nil)
+	}
+
+	return true, decodeValue(reflect.ValueOf(dst), list)
+}
+
+// isAggregate returns true if dst is a pointer to a map, a struct, or a slice
+// which is not a []byte.
+func isAggregate(dst interface{}) bool {
+	t := reflect.TypeOf(dst)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return false
+	}
+
+	return isAggregateType(indirectType(t))
+}
+
+func isAggregateSlice(t reflect.Type) bool {
+	t = indirectType(t)
+	return t.Kind() == reflect.Slice && isAggregateType(indirectType(t.Elem()))
+}
+
+// collectsRest returns true if the last field of a positional struct, of type
+// t, receives the remaining values rest of a list.
+func collectsRest(t reflect.Type, rest []interface{}) bool {
+	t = indirectType(t)
+
+	if t.Kind() != reflect.Slice || t.Elem().Kind() == reflect.Uint8 {
+		return false
+	}
+
+	if len(rest) != 1 {
+		return true
+	}
+
+	switch rest[0].(type) {
+	case nil, []interface{}:
+		return false
+	}
+
+	return true
+}
+
+func isAggregateType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Map:
+		return true
+
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Uint8
+
+	case reflect.Struct:
+		return !isScalarStruct(t)
+	}
+
+	return false
+}
+
+// isScalarStruct returns true for struct types that are represented by a
+// single value rather than a list of fields, like time.Time or errors.
+func isScalarStruct(t reflect.Type) bool {
+	p := reflect.PtrTo(t)
+
+	return t == timeType ||
+		p.Implements(errorInterface) ||
+		p.Implements(textUnmarshalerInterface) ||
+		t.Implements(textMarshalerInterface)
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func decodeValue(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		// Null replies reset the destination, pointers are set to nil instead
+		// of being allocated.
+		for !dst.CanSet() && dst.Kind() == reflect.Ptr && !dst.IsNil() {
+			dst = dst.Elem()
+		}
+		if dst.CanSet() {
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+		return nil
+	}
+
+	for dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			if !dst.CanSet() {
+				return fmt.Errorf("cannot decode redis value into a nil pointer of type %s", dst.Type())
+			}
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		dst = dst.Elem()
+	}
+
+	if dst.Kind() == reflect.Interface {
+		if v := reflect.ValueOf(src); v.Type().AssignableTo(dst.Type()) {
+			dst.Set(v)
+			return nil
+		}
+		return fmt.Errorf("cannot decode redis value of type %T into %s", src, dst.Type())
+	}
+
+	if err, ok := src.(error); ok {
+		return err
+	}
+
+	if dst.CanAddr() && dst.Addr().Type().Implements(textUnmarshalerInterface) {
+		b, err := scalarBytes(src)
+		if err != nil {
+			return err
+		}
+		return dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(b)
+	}
+
+	switch dst.Kind() {
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() != reflect.Uint8 {
+			return decodeSlice(dst, src)
+		}
+
+	case reflect.Map:
+		return decodeMap(dst, src)
+
+	case reflect.Struct:
+		return decodeStruct(dst, src)
+	}
+
+	b, err := scalarBytes(src)
+	if err != nil {
+		return fmt.Errorf("cannot decode redis value into %s: %s", dst.Type(), err)
+	}
+
+	return (&byteArgs{}).next(dst, append([]byte(nil), b...))
+}
+
+func decodeSlice(dst reflect.Value, src interface{}) error {
+	list, ok := src.([]interface{})
+	if !ok {
+		list = []interface{}{src}
+	}
+
+	s := reflect.MakeSlice(dst.Type(), len(list), len(list))
+
+	for i, v := range list {
+		if err := decodeValue(s.Index(i), v); err != nil {
+			return err
+		}
+	}
+
+	dst.Set(s)
+	return nil
+}
+
+func decodeMap(dst reflect.Value, src interface{}) error {
+	t := dst.Type()
+	m := reflect.MakeMap(t)
+
+	err := forEachPair(src, func(k interface{}, v interface{}) error {
+		mk := reflect.New(t.Key()).Elem()
+		mv := reflect.New(t.Elem()).Elem()
+
+		if err := decodeValue(mk, k); err != nil {
+			return err
+		}
+
+		if err := decodeValue(mv, v); err != nil {
+			return err
+		}
+
+		m.SetMapIndex(mk, mv)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	dst.Set(m)
+	return nil
+}
+
+func decodeStruct(dst reflect.Value, src interface{}) error {
+	st := structTypeOf(dst.Type())
+
+	if st.array {
+		list, ok := src.([]interface{})
+		if !ok {
+			return fmt.Errorf("cannot decode redis value of type %T into %s, an array was expected", src, dst.Type())
+		}
+
+		for i, f := range st.fields {
+			if i >= len(list) {
+				break
+			}
+
+			fv := dst.FieldByIndex(f.index)
+
+			// The last field of a positional struct collects all remaining
+			// values when it is a slice.
+			if i == len(st.fields)-1 && collectsRest(fv.Type(), list[i:]) {
+				return decodeValue(fv, list[i:])
+			}
+
+			if err := decodeValue(fv, list[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return forEachPair(src, func(k interface{}, v interface{}) error {
+		b, err := scalarBytes(k)
+		if err != nil {
+			return err
+		}
+
+		f := st.lookup(string(b))
+		if f == nil {
+			return nil // unknown fields are ignored
+		}
+
+		return decodeValue(dst.FieldByIndex(f.index), v)
+	})
+}
+
+// forEachPair calls fn with each key/value pair of src, which may either be a
+// map or a flat list of alternating keys and values.
+func forEachPair(src interface{}, fn func(interface{}, interface{}) error) error {
+	switch x := src.(type) {
+	case []interface{}:
+		if len(x)%2 != 0 {
+			return fmt.Errorf("cannot decode an odd number of redis values (%d) into field/value pairs", len(x))
+		}
+
+		for i := 0; i < len(x); i += 2 {
+			if err := fn(x[i], x[i+1]); err != nil {
+				return err
+			}
+		}
+
+	case map[interface{}]interface{}:
+		for k, v := range x {
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+
+	case map[string]interface{}:
+		for k, v := range x {
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("cannot decode redis value of type %T into field/value pairs", src)
+	}
+
+	return nil
+}
+
+func scalarBytes(v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case []byte:
+		return x, nil
+	case string:
+		return []byte(x), nil
+	case bool:
+		if x {
+			return []byte("1"), nil
+		}
+		return []byte("0"), nil
+	case int64:
+		return strconv.AppendInt(nil, x, 10), nil
+	case int:
+		return strconv.AppendInt(nil, int64(x), 10), nil
+	case uint64:
+		return strconv.AppendUint(nil, x, 10), nil
+	case float64:
+		return strconv.AppendFloat(nil, x, 'g', -1, 64), nil
+	case time.Time:
+		return x.MarshalText()
+	case time.Duration:
+		return []byte(x.String()), nil
+	case []interface{}:
+		return nil, fmt.Errorf("unexpected array of %d values where a scalar was expected", len(x))
+	}
+
+	return []byte(fmt.Sprint(v)), nil
+}
+
+// appendFields flattens v into a list of field/value pairs if it is a struct
+// or a map, or appends it unchanged to list otherwise.
+func appendFields(list []interface{}, v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() && isFieldsType(rv.Type().Elem()) {
+		rv = rv.Elem()
+	}
+
+	switch {
+	case rv.Kind() == reflect.Struct && isFieldsType(rv.Type()):
+		for _, f := range structTypeOf(rv.Type()).fields {
+			fv := rv.FieldByIndex(f.index)
+
+			if f.omitempty && isEmptyValue(fv) {
+				continue
+			}
+
+			list = append(list, f.name, fv.Interface())
+		}
+
+	case rv.Kind() == reflect.Map:
+		keys := rv.MapKeys()
+
+		sort.Slice(keys, func(i int, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+
+		for _, k := range keys {
+			list = append(list, k.Interface(), rv.MapIndex(k).Interface())
+		}
+
+	default:
+		list = append(list, v)
+	}
+
+	return list
+}
+
+func isFieldsType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Struct:
+		return !isScalarStruct(t)
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+type structField struct {
+	index     []int
+	name      string
+	omitempty bool
+}
+
+type structType struct {
+	array  bool
+	fields []structField
+	names  map[string]*structField
+}
+
+func (st *structType) lookup(name string) *structField {
+	if f := st.names[name]; f != nil {
+		return f
+	}
+
+	for i := range st.fields {
+		if strings.EqualFold(st.fields[i].name, name) {
+			return &st.fields[i]
+		}
+	}
+
+	return nil
+}
+
+var structTypeCache sync.Map // map[reflect.Type]*structType
+
+func structTypeOf(t reflect.Type) *structType {
+	if st, ok := structTypeCache.Load(t); ok {
+		return st.(*structType)
+	}
+
+	st := &structType{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts := parseTag(f.Tag.Get("redis"))
+
+		if f.Name == "_" {
+			st.array = st.array || opts["array"]
+			continue
+		}
+
+		if f.PkgPath != "" || name == "-" { // unexported or ignored
+			continue
+		}
+
+		if len(name) == 0 {
+			name = f.Name
+		}
+
+		st.fields = append(st.fields, structField{
+			index:     f.Index,
+			name:      name,
+			omitempty: opts["omitempty"],
+		})
+	}
+
+	st.names = make(map[string]*structField, len(st.fields))
+
+	for i := range st.fields {
+		st.names[st.fields[i].name] = &st.fields[i]
+	}
+
+	v, _ := structTypeCache.LoadOrStore(t, st)
+	return v.(*structType)
+}
+
+func parseTag(tag string) (name string, opts map[string]bool) {
+	parts := strings.Split(tag, ",")
+	name, opts = parts[0], make(map[string]bool, len(parts)-1)
+
+	for _, opt := range parts[1:] {
+		opts[opt] = true
+	}
+
+	return
+}
@@ -0,0 +1,241 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSRegistry is an implementation of ServerRegistry which resolves the list
+// of servers from DNS records, for example the records of a headless
+// Kubernetes service.
+//
+// When SRV is true the registry looks up the SRV records of Name, the weights
+// of the records set the share of keys assigned to their targets. Otherwise
+// the A and AAAA records of Name are resolved and combined with Port.
+//
+// The records are resolved again every RefreshInterval, the ring returned by
+// LookupServers is swapped atomically when they changed. Failed lookups are
+// reported to ErrorLog and the previous ring is kept.
+//
+// DNSRegistries are safe for concurrent use by multiple goroutines.
+type DNSRegistry struct {
+	// Name is the domain name to resolve.
+	Name string
+
+	// SRV selects the lookup of SRV records instead of A and AAAA records.
+	SRV bool
+
+	// Port is the port of the servers resolved from A and AAAA records. Zero
+	// means 6379.
+	Port int
+
+	// Resolver is used to lookup the records, net.DefaultResolver is used if
+	// it is nil.
+	Resolver *net.Resolver
+
+	// RefreshInterval is the amount of time between lookups of the records.
+	// Zero means 10s.
+	RefreshInterval time.Duration
+
+	// ErrorLog specifies an optional logger for errors resolving the records.
+	// If nil, errors are not logged.
+	ErrorLog Logger
+
+	once   sync.Once
+	cancel context.CancelFunc
+	ready  chan struct{}
+	mutex  sync.RWMutex
+	addrs  string
+	ring   ServerRing
+	err    error
+}
+
+// LookupServers satisfies the ServerRegistry interface.
+//
+// The first call blocks until the records were resolved, or ctx is done.
+func (r *DNSRegistry) LookupServers(ctx context.Context) (ServerRing, error) {
+	r.once.Do(r.init)
+
+	select {
+	case <-r.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.ring == nil {
+		return nil, r.err
+	}
+
+	return r.ring, nil
+}
+
+// Close stops resolving the records.
+func (r *DNSRegistry) Close() error {
+	r.once.Do(r.init)
+	r.cancel()
+	return nil
+}
+
+func (r *DNSRegistry) init() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.cancel = cancel
+	r.ready = make(chan struct{})
+
+	go r.watch(ctx)
+}
+
+func (r *DNSRegistry) watch(ctx context.Context) {
+	interval := r.RefreshInterval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for first := true; ; first = false {
+		if err := r.refresh(ctx); err != nil {
+			r.mutex.Lock()
+			r.err = err
+			r.mutex.Unlock()
+
+			if !first && r.ErrorLog != nil {
+				r.ErrorLog.Print(err)
+			}
+		}
+
+		if first {
+			close(r.ready)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refresh resolves the records and rebuilds the ring if they changed.
+func (r *DNSRegistry) refresh(ctx context.Context) error {
+	var (
+		endpoints []ServerEndpoint
+		err       error
+	)
+
+	if r.SRV {
+		endpoints, err = r.lookupSRV(ctx)
+	} else {
+		endpoints, err = r.lookupIPAddr(ctx)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(endpoints) == 0 {
+		return fmt.Errorf("redis: no servers found in the DNS records of %s", r.Name)
+	}
+
+	// The order of the records is not stable, the ring is rebuilt only when
+	// the set of servers changed.
+	keys := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		keys[i] = e.Addr + "/" + strconv.Itoa(e.Weight)
+	}
+	sort.Strings(keys)
+	addrs := strings.Join(keys, ",")
+
+	r.mutex.RLock()
+	unchanged := r.ring != nil && addrs == r.addrs
+	r.mutex.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	ring := newShardRing(endpoints)
+
+	r.mutex.Lock()
+	r.addrs = addrs
+	r.ring = ring
+	r.err = nil
+	r.mutex.Unlock()
+
+	return nil
+}
+
+func (r *DNSRegistry) lookupSRV(ctx context.Context) ([]ServerEndpoint, error) {
+	_, records, err := r.resolver().LookupSRV(ctx, "", "", r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]ServerEndpoint, 0, len(records))
+	max := 0
+
+	for _, srv := range records {
+		if w := int(srv.Weight); w > max {
+			max = w
+		}
+	}
+
+	for _, srv := range records {
+		host := strings.TrimSuffix(srv.Target, ".")
+
+		endpoints = append(endpoints, ServerEndpoint{
+			Name:   host,
+			Addr:   net.JoinHostPort(host, strconv.Itoa(int(srv.Port))),
+			Weight: scaleWeight(int(srv.Weight), max),
+		})
+	}
+
+	return endpoints, nil
+}
+
+func (r *DNSRegistry) lookupIPAddr(ctx context.Context) ([]ServerEndpoint, error) {
+	addrs, err := r.resolver().LookupIPAddr(ctx, r.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	port := r.Port
+	if port == 0 {
+		port = 6379
+	}
+
+	endpoints := make([]ServerEndpoint, 0, len(addrs))
+
+	for _, addr := range addrs {
+		endpoints = append(endpoints, ServerEndpoint{
+			Name: r.Name,
+			Addr: net.JoinHostPort(addr.String(), strconv.Itoa(port)),
+		})
+	}
+
+	return endpoints, nil
+}
+
+func (r *DNSRegistry) resolver() *net.Resolver {
+	if resolver := r.Resolver; resolver != nil {
+		return resolver
+	}
+
+	return net.DefaultResolver
+}
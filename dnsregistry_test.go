@@ -0,0 +1,338 @@
+package redis_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+const (
+	dnsTypeA   = 1
+	dnsTypeSRV = 33
+)
+
+// fakeDNS is a DNS server answering the A and SRV queries of redis.DNSRegistry,
+// queries of other types get empty answers.
+type fakeDNS struct {
+	conn  net.PacketConn
+	mutex sync.Mutex
+	a     map[string][]net.IP
+	srv   map[string][]net.SRV
+}
+
+func newFakeDNS() *fakeDNS {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	dns := &fakeDNS{
+		conn: conn,
+		a:    map[string][]net.IP{},
+		srv:  map[string][]net.SRV{},
+	}
+
+	go dns.serve()
+	return dns
+}
+
+func (dns *fakeDNS) Close() error {
+	return dns.conn.Close()
+}
+
+func (dns *fakeDNS) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", dns.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (dns *fakeDNS) setA(name string, ips ...string) {
+	dns.mutex.Lock()
+	defer dns.mutex.Unlock()
+
+	dns.a[name] = nil
+
+	for _, ip := range ips {
+		dns.a[name] = append(dns.a[name], net.ParseIP(ip).To4())
+	}
+}
+
+func (dns *fakeDNS) setSRV(name string, records ...net.SRV) {
+	dns.mutex.Lock()
+	defer dns.mutex.Unlock()
+
+	dns.srv[name] = records
+}
+
+func (dns *fakeDNS) serve() {
+	buf := make([]byte, 512)
+
+	for {
+		n, addr, err := dns.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		if res := dns.answer(buf[:n]); res != nil {
+			dns.conn.WriteTo(res, addr)
+		}
+	}
+}
+
+func (dns *fakeDNS) answer(req []byte) []byte {
+	if len(req) < 12 {
+		return nil
+	}
+
+	// The question starts right after the header, with the labels of the name
+	// followed by the type and class.
+	var labels []string
+	i := 12
+
+	for i < len(req) && req[i] != 0 {
+		n := int(req[i])
+		if i+1+n > len(req) {
+			return nil
+		}
+		labels = append(labels, string(req[i+1:i+1+n]))
+		i += 1 + n
+	}
+
+	if i+5 > len(req) {
+		return nil
+	}
+
+	name := strings.ToLower(strings.Join(labels, ".")) + "."
+	qtype := binary.BigEndian.Uint16(req[i+1:])
+	question := req[12 : i+5]
+
+	var answers [][]byte
+
+	dns.mutex.Lock()
+
+	switch qtype {
+	case dnsTypeA:
+		for _, ip := range dns.a[name] {
+			answers = append(answers, dnsRecord(dnsTypeA, ip))
+		}
+
+	case dnsTypeSRV:
+		for _, srv := range dns.srv[name] {
+			rdata := make([]byte, 6)
+			binary.BigEndian.PutUint16(rdata[0:], srv.Priority)
+			binary.BigEndian.PutUint16(rdata[2:], srv.Weight)
+			binary.BigEndian.PutUint16(rdata[4:], srv.Port)
+			answers = append(answers, dnsRecord(dnsTypeSRV, append(rdata, dnsName(srv.Target)...)))
+		}
+	}
+
+	dns.mutex.Unlock()
+
+	res := make([]byte, 12, 512)
+	copy(res, req[:2])
+	binary.BigEndian.PutUint16(res[2:], 0x8180) // response, recursion available
+	binary.BigEndian.PutUint16(res[4:], 1)
+	binary.BigEndian.PutUint16(res[6:], uint16(len(answers)))
+
+	res = append(res, question...)
+
+	for _, answer := range answers {
+		res = append(res, answer...)
+	}
+
+	return res
+}
+
+// dnsRecord encodes a resource record of the name of the question.
+func dnsRecord(rtype uint16, rdata []byte) []byte {
+	b := make([]byte, 12, 12+len(rdata))
+	binary.BigEndian.PutUint16(b[0:], 0xC00C) // pointer to the question's name
+	binary.BigEndian.PutUint16(b[2:], rtype)
+	binary.BigEndian.PutUint16(b[4:], 1) // IN
+	binary.BigEndian.PutUint32(b[6:], 60)
+	binary.BigEndian.PutUint16(b[10:], uint16(len(rdata)))
+	return append(b, rdata...)
+}
+
+func dnsName(name string) []byte {
+	var b []byte
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+
+	return append(b, 0)
+}
+
+func TestDNSRegistry(t *testing.T) {
+	t.Run("SRV", func(t *testing.T) {
+		redistest.TestServerRegistry(t, func() (redis.ServerRegistry, string, redis.ServerEndpoint, func(), error) {
+			dns := newFakeDNS()
+			dns.setSRV("_redis._tcp.redis.test.",
+				net.SRV{Target: "a.redis.test.", Port: 4242, Weight: 1},
+				net.SRV{Target: "b.redis.test.", Port: 4243, Weight: 1},
+				net.SRV{Target: "c.redis.test.", Port: 4244, Weight: 1},
+			)
+
+			registry := &redis.DNSRegistry{
+				Name:     "_redis._tcp.redis.test.",
+				SRV:      true,
+				Resolver: dns.resolver(),
+			}
+
+			endpoints := redis.ServerList{
+				{Name: "a.redis.test", Addr: "a.redis.test:4242", Weight: 1},
+				{Name: "b.redis.test", Addr: "b.redis.test:4243", Weight: 1},
+				{Name: "c.redis.test", Addr: "c.redis.test:4244", Weight: 1},
+			}
+
+			ring, _ := endpoints.LookupServers(context.Background())
+
+			teardown := func() {
+				registry.Close()
+				dns.Close()
+			}
+
+			return registry, "A", ring.LookupServer("A"), teardown, nil
+		})
+	})
+
+	t.Run("A", func(t *testing.T) {
+		redistest.TestServerRegistry(t, func() (redis.ServerRegistry, string, redis.ServerEndpoint, func(), error) {
+			dns := newFakeDNS()
+			dns.setA("redis.test.", "127.0.0.1", "127.0.0.2", "127.0.0.3")
+
+			registry := &redis.DNSRegistry{
+				Name:     "redis.test.",
+				Port:     4242,
+				Resolver: dns.resolver(),
+			}
+
+			endpoints := redis.ServerList{
+				{Name: "redis.test.", Addr: "127.0.0.1:4242"},
+				{Name: "redis.test.", Addr: "127.0.0.2:4242"},
+				{Name: "redis.test.", Addr: "127.0.0.3:4242"},
+			}
+
+			ring, _ := endpoints.LookupServers(context.Background())
+
+			teardown := func() {
+				registry.Close()
+				dns.Close()
+			}
+
+			return registry, "A", ring.LookupServer("A"), teardown, nil
+		})
+	})
+}
+
+func TestDNSRegistryRefresh(t *testing.T) {
+	it := assert.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	dns := newFakeDNS()
+	defer dns.Close()
+
+	dns.setA("redis.test.", "127.0.0.1")
+
+	registry := &redis.DNSRegistry{
+		Name:            "redis.test.",
+		Resolver:        dns.resolver(),
+		RefreshInterval: 10 * time.Millisecond,
+	}
+	defer registry.Close()
+
+	ring1, err := registry.LookupServers(ctx)
+	if !it.Nil(err) {
+		return
+	}
+	it.Equal("127.0.0.1:6379", ring1.LookupServer("key").Addr)
+
+	// the ring is kept while the records are unchanged
+	time.Sleep(50 * time.Millisecond)
+
+	ring2, err := registry.LookupServers(ctx)
+	it.Nil(err)
+	it.True(ring1 == ring2)
+
+	dns.setA("redis.test.", "127.0.0.2")
+	waitForRegistryAddr(t, ctx, registry, "127.0.0.2:6379")
+
+	// the previous ring is kept when the records disappear
+	dns.setA("redis.test.")
+	time.Sleep(50 * time.Millisecond)
+	it.Equal("127.0.0.2:6379", lookupRegistryAddr(ctx, registry))
+}
+
+func TestDNSRegistrySRVWeights(t *testing.T) {
+	it := assert.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	dns := newFakeDNS()
+	defer dns.Close()
+
+	dns.setSRV("_redis._tcp.redis.test.",
+		net.SRV{Target: "a.redis.test.", Port: 4242, Weight: 0},
+		net.SRV{Target: "b.redis.test.", Port: 4243, Weight: 65535},
+	)
+
+	registry := &redis.DNSRegistry{
+		Name:     "_redis._tcp.redis.test.",
+		SRV:      true,
+		Resolver: dns.resolver(),
+	}
+	defer registry.Close()
+
+	ring, err := registry.LookupServers(ctx)
+	if !it.Nil(err) {
+		return
+	}
+
+	// the weights are scaled down, the server of weight zero still gets a
+	// share of the keys
+	n := 0
+	for i := 0; i != 1000; i++ {
+		if ring.LookupServer(strconv.Itoa(i)).Addr == "a.redis.test:4242" {
+			n++
+		}
+	}
+	it.True(n > 20, n)
+	it.True(n < 200, n)
+}
+
+func lookupRegistryAddr(ctx context.Context, registry redis.ServerRegistry) string {
+	ring, err := registry.LookupServers(ctx)
+	if err != nil {
+		return err.Error()
+	}
+	return ring.LookupServer("key").Addr
+}
+
+func waitForRegistryAddr(t *testing.T, ctx context.Context, registry redis.ServerRegistry, addr string) {
+	for lookupRegistryAddr(ctx, registry) != addr {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("the registry never returned %s", addr)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
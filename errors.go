@@ -16,4 +16,5 @@ var (
 	ErrNotHijackable                 = errors.New("the response writer is not hijackable")
 	ErrNotRetryable                  = errors.New("the request cannot retry")
 	ErrNotPipeline                   = errors.New("redis: not pipeline")
+	ErrCircuitOpen                   = errors.New("redis: circuit breaker is open")
 )
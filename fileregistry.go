@@ -0,0 +1,219 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/dolab/objconv/yaml"
+)
+
+// FileRegistry is an implementation of ServerRegistry which reads the list of
+// servers from a YAML or JSON file, for example a Kubernetes ConfigMap mounted
+// in a pod:
+//
+//	servers:
+//	- name: redis-0
+//	  addr: 10.0.0.1:6379
+//	  group: redis-0
+//	  weight: 2
+//	- name: redis-0-replica
+//	  addr: 10.0.0.2:6379
+//	  role: replica
+//	  group: redis-0
+//
+// The weights range from 0 to 65535, they are scaled down to at most 10. The
+// file may also contain only the list of servers. The registry polls the
+// file for changes and swaps its ring atomically when it was modified, a file
+// which cannot be parsed is reported to ErrorLog and the previous ring is kept.
+//
+// FileRegistries are safe for concurrent use by multiple goroutines.
+type FileRegistry struct {
+	// Path is the path of the file.
+	Path string
+
+	// PollInterval is the amount of time between checks of the file for
+	// changes. Zero means 1s.
+	PollInterval time.Duration
+
+	// ErrorLog specifies an optional logger for errors reloading the file. If
+	// nil, errors are not logged.
+	ErrorLog Logger
+
+	once    sync.Once
+	cancel  context.CancelFunc
+	mutex   sync.RWMutex
+	content []byte
+	ring    ServerRing
+	err     error
+}
+
+type fileEndpoint struct {
+	Name   string     `objconv:"name"`
+	Addr   string     `objconv:"addr"`
+	Role   ServerRole `objconv:"role"`
+	Group  string     `objconv:"group"`
+	Zone   string     `objconv:"zone"`
+	Weight int        `objconv:"weight"`
+}
+
+// LookupServers satisfies the ServerRegistry interface.
+func (r *FileRegistry) LookupServers(ctx context.Context) (ServerRing, error) {
+	r.once.Do(r.init)
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.ring == nil {
+		return nil, r.err
+	}
+
+	return r.ring, nil
+}
+
+// Close stops watching the file.
+func (r *FileRegistry) Close() error {
+	r.once.Do(r.init)
+	r.cancel()
+	return nil
+}
+
+func (r *FileRegistry) init() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	if err := r.reload(); err != nil {
+		r.err = err
+	}
+
+	go r.watch(ctx)
+}
+
+func (r *FileRegistry) watch(ctx context.Context) {
+	interval := r.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := r.reload(); err != nil && r.ErrorLog != nil {
+			r.ErrorLog.Print(err)
+		}
+	}
+}
+
+// reload reads the file and rebuilds the ring if its content changed. The
+// content is compared rather than the modification time because ConfigMaps are
+// updated by swapping symbolic links.
+func (r *FileRegistry) reload() error {
+	content, err := ioutil.ReadFile(r.Path)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.RLock()
+	unchanged := r.content != nil && bytes.Equal(content, r.content)
+	r.mutex.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	endpoints, err := parseServerFile(content)
+	if err != nil {
+		return fmt.Errorf("redis: parsing %s: %s", r.Path, err)
+	}
+
+	ring := newShardRing(endpoints)
+
+	r.mutex.Lock()
+	r.content = content
+	r.ring = ring
+	r.err = nil
+	r.mutex.Unlock()
+
+	return nil
+}
+
+func parseServerFile(content []byte) ([]ServerEndpoint, error) {
+	var list []fileEndpoint
+
+	// JSON documents are valid YAML documents, the same parser is used for
+	// both formats.
+	if err := yaml.Unmarshal(content, &list); err != nil {
+		var file struct {
+			Servers []fileEndpoint `objconv:"servers"`
+		}
+
+		if err := yaml.Unmarshal(content, &file); err != nil {
+			return nil, err
+		}
+
+		list = file.Servers
+	}
+
+	if len(list) == 0 {
+		return nil, errors.New("no servers")
+	}
+
+	endpoints := make([]ServerEndpoint, len(list))
+	max := 0
+
+	for _, e := range list {
+		if e.Weight > max {
+			max = e.Weight
+		}
+	}
+
+	for i, e := range list {
+		if len(e.Addr) == 0 {
+			return nil, fmt.Errorf("missing address of server #%d", i)
+		}
+
+		switch e.Role {
+		case "", PrimaryRole, ReplicaRole:
+		default:
+			return nil, fmt.Errorf("invalid role of server %s: %q", e.Addr, e.Role)
+		}
+
+		if e.Weight < 0 || e.Weight > 65535 {
+			return nil, fmt.Errorf("invalid weight of server %s: %d", e.Addr, e.Weight)
+		}
+
+		// Servers without weights keep the default weight.
+		weight := e.Weight
+		if weight != 0 {
+			weight = scaleWeight(weight, max)
+		}
+
+		endpoints[i] = ServerEndpoint{
+			Name:   e.Name,
+			Addr:   e.Addr,
+			Role:   e.Role,
+			Group:  e.Group,
+			Zone:   e.Zone,
+			Weight: weight,
+		}
+	}
+
+	return endpoints, nil
+}
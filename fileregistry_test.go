@@ -0,0 +1,229 @@
+package redis_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+func writeServerFile(t *testing.T, path string, content string) {
+	// Writes to a temporary file which is renamed, like Kubernetes updates
+	// ConfigMaps, so the registry never reads a partial file.
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileRegistry(t *testing.T) {
+	files := []struct {
+		format  string
+		content string
+	}{
+		{
+			format: "YAML",
+			content: `servers:
+- name: A
+  addr: 127.0.0.1:4242
+- name: B
+  addr: 127.0.0.1:4243
+- name: C
+  addr: 127.0.0.1:4244
+`,
+		},
+		{
+			format: "JSON",
+			content: `[
+  {"name": "A", "addr": "127.0.0.1:4242"},
+  {"name": "B", "addr": "127.0.0.1:4243"},
+  {"name": "C", "addr": "127.0.0.1:4244"}
+]`,
+		},
+	}
+
+	for _, file := range files {
+		content := file.content
+
+		t.Run(file.format, func(t *testing.T) {
+			redistest.TestServerRegistry(t, func() (redis.ServerRegistry, string, redis.ServerEndpoint, func(), error) {
+				dir, err := ioutil.TempDir("", "redis-go")
+				if err != nil {
+					return nil, "", redis.ServerEndpoint{}, nil, err
+				}
+
+				path := filepath.Join(dir, "servers")
+				writeServerFile(t, path, content)
+
+				registry := &redis.FileRegistry{Path: path}
+
+				teardown := func() {
+					registry.Close()
+					os.RemoveAll(dir)
+				}
+
+				return registry, "A", redis.ServerEndpoint{Name: "B", Addr: "127.0.0.1:4243"}, teardown, nil
+			})
+		})
+	}
+}
+
+func TestFileRegistryReload(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, string, *redis.FileRegistry)
+	}{
+		{
+			scenario: "the ring is swapped when the file changes",
+			function: testFileRegistryChanges,
+		},
+		{
+			scenario: "the previous ring is kept when the file is invalid",
+			function: testFileRegistryInvalidFile,
+		},
+		{
+			scenario: "the roles and groups of the servers are loaded from the file",
+			function: testFileRegistryReplicas,
+		},
+		{
+			scenario: "the weights of the servers are scaled down",
+			function: testFileRegistryWeights,
+		},
+		{
+			scenario: "looking up servers fails when the file cannot be loaded",
+			function: testFileRegistryMissingFile,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			dir, err := ioutil.TempDir("", "redis-go")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "servers.yml")
+
+			registry := &redis.FileRegistry{
+				Path:         path,
+				PollInterval: 10 * time.Millisecond,
+			}
+			defer registry.Close()
+
+			testFunc(t, ctx, path, registry)
+		})
+	}
+}
+
+func testFileRegistryChanges(t *testing.T, ctx context.Context, path string, registry *redis.FileRegistry) {
+	it := assert.New(t)
+
+	writeServerFile(t, path, "- addr: 127.0.0.1:4242\n")
+	it.Equal("127.0.0.1:4242", lookupRegistryAddr(ctx, registry))
+
+	ring1, _ := registry.LookupServers(ctx)
+	ring2, _ := registry.LookupServers(ctx)
+	it.True(ring1 == ring2)
+
+	writeServerFile(t, path, "- addr: 127.0.0.1:4243\n")
+	waitForRegistryAddr(t, ctx, registry, "127.0.0.1:4243")
+}
+
+func testFileRegistryInvalidFile(t *testing.T, ctx context.Context, path string, registry *redis.FileRegistry) {
+	it := assert.New(t)
+
+	writeServerFile(t, path, "- addr: 127.0.0.1:4242\n")
+	it.Equal("127.0.0.1:4242", lookupRegistryAddr(ctx, registry))
+
+	writeServerFile(t, path, "- name: A\n  role: nope\n")
+	time.Sleep(50 * time.Millisecond)
+	it.Equal("127.0.0.1:4242", lookupRegistryAddr(ctx, registry))
+
+	writeServerFile(t, path, "[]")
+	time.Sleep(50 * time.Millisecond)
+	it.Equal("127.0.0.1:4242", lookupRegistryAddr(ctx, registry))
+
+	for _, weight := range []string{"-1", "65536"} {
+		writeServerFile(t, path, "- addr: 127.0.0.1:4243\n  weight: "+weight+"\n")
+		time.Sleep(50 * time.Millisecond)
+		it.Equal("127.0.0.1:4242", lookupRegistryAddr(ctx, registry), weight)
+	}
+}
+
+func testFileRegistryWeights(t *testing.T, ctx context.Context, path string, registry *redis.FileRegistry) {
+	it := assert.New(t)
+
+	writeServerFile(t, path, `- addr: 127.0.0.1:4242
+  weight: 1
+- addr: 127.0.0.1:4243
+  weight: 1000
+`)
+
+	ring, err := registry.LookupServers(ctx)
+	if !it.Nil(err) {
+		return
+	}
+
+	// the weights are scaled down, the server of the smallest weight still
+	// gets a share of the keys
+	n := 0
+	for i := 0; i != 1000; i++ {
+		if ring.LookupServer(strconv.Itoa(i)).Addr == "127.0.0.1:4242" {
+			n++
+		}
+	}
+	it.True(n > 20, n)
+	it.True(n < 200, n)
+}
+
+func testFileRegistryReplicas(t *testing.T, ctx context.Context, path string, registry *redis.FileRegistry) {
+	it := assert.New(t)
+
+	writeServerFile(t, path, `servers:
+- name: A
+  addr: 127.0.0.1:4242
+  weight: 2
+  group: A
+  zone: a
+- name: A-replica
+  addr: 127.0.0.1:4243
+  role: replica
+  group: A
+  zone: b
+`)
+
+	ring, err := registry.LookupServers(ctx)
+	if !it.Nil(err) {
+		return
+	}
+
+	it.Equal(redis.ServerEndpoint{Name: "A", Addr: "127.0.0.1:4242", Group: "A", Zone: "a", Weight: 2}, ring.LookupServer("key"))
+	it.Equal([]redis.ServerEndpoint{
+		{Name: "A-replica", Addr: "127.0.0.1:4243", Role: redis.ReplicaRole, Group: "A", Zone: "b"},
+	}, ring.(redis.ReplicaRing).LookupReplicas("key"))
+}
+
+func testFileRegistryMissingFile(t *testing.T, ctx context.Context, path string, registry *redis.FileRegistry) {
+	_, err := registry.LookupServers(ctx)
+	assert.New(t).NotNil(err)
+}
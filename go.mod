@@ -10,7 +10,6 @@ require (
 	github.com/google/uuid v1.1.1
 	github.com/prometheus/client_golang v1.0.0
 	github.com/segmentio/conf v1.1.0
-	github.com/segmentio/consul-go v1.3.0
 	github.com/segmentio/events v2.1.0+incompatible
 	github.com/segmentio/fasthash v1.0.0
 	github.com/segmentio/stats v4.1.0+incompatible
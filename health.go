@@ -0,0 +1,429 @@
+package redis
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/fasthash/jody"
+)
+
+// EndpointHealth is the state of an endpoint observed by a
+// HealthCheckedRegistry.
+type EndpointHealth struct {
+	Endpoint ServerEndpoint
+
+	// Healthy is true if the endpoint passed its last health checks.
+	Healthy bool
+
+	// BlacklistedUntil is the time at which the endpoint stops being
+	// blacklisted, it is zero if the endpoint isn't blacklisted.
+	BlacklistedUntil time.Time
+
+	// Failures and Successes are the numbers of consecutive failed and
+	// successful health checks of the endpoint.
+	Failures  int
+	Successes int
+
+	// Latency is the round trip time of the last health check.
+	Latency time.Duration
+
+	// CheckedAt is the time of the last health check, and Err its error.
+	CheckedAt time.Time
+	Err       error
+}
+
+// Available returns true if the endpoint is healthy and not blacklisted at the
+// given time.
+func (h EndpointHealth) Available(now time.Time) bool {
+	return h.Healthy && !now.Before(h.BlacklistedUntil)
+}
+
+// HealthCheckedRegistry is an implementation of ServerRegistry which removes
+// unhealthy servers from the rings of another registry.
+//
+// The registry sends a PING to each endpoint every CheckInterval, endpoints are
+// marked unhealthy after FailureThreshold consecutive failures, and healthy
+// again after SuccessThreshold consecutive successes. New endpoints are assumed
+// healthy until their first checks fail. The registry also implements
+// ServerBlacklist, blacklisted endpoints are removed from the rings for
+// BlacklistTimeout.
+//
+// Only rings implementing EndpointRing can be filtered, the rings returned by
+// ServerList, FileRegistry or DNSRegistry for example. When endpoints are
+// removed keys are distributed over the remaining ones with the same hashing as
+// ServerList. When no primaries are available the ring of the wrapped registry
+// is returned as is, since routing to possibly unhealthy servers is better than
+// failing all requests.
+//
+// HealthCheckedRegistries are safe for concurrent use by multiple goroutines.
+type HealthCheckedRegistry struct {
+	// Registry is the registry exposing the servers to check.
+	Registry ServerRegistry
+
+	// Transport is used to send health checks, if nil DefaultTransport is
+	// used.
+	Transport RoundTripper
+
+	// CheckInterval is the amount of time between health checks of the
+	// endpoints. Zero means 1s.
+	CheckInterval time.Duration
+
+	// CheckTimeout is the amount of time that the registry waits for responses
+	// to health checks. Zero means 1s.
+	CheckTimeout time.Duration
+
+	// FailureThreshold is the number of consecutive failed health checks after
+	// which an endpoint is considered unhealthy. Zero means 3.
+	FailureThreshold int
+
+	// SuccessThreshold is the number of consecutive successful health checks
+	// after which an unhealthy endpoint is considered healthy again. Zero means
+	// 2.
+	SuccessThreshold int
+
+	// BlacklistTimeout is the amount of time that blacklisted endpoints are
+	// removed from the rings for. Zero means 10s.
+	BlacklistTimeout time.Duration
+
+	// OnHealthChange, if not nil, is called when the health of an endpoint
+	// changes.
+	OnHealthChange func(endpoint ServerEndpoint, healthy bool)
+
+	once       sync.Once
+	cancel     context.CancelFunc
+	mutex      sync.Mutex
+	health     map[string]*EndpointHealth
+	version    uint64
+	nextExpiry time.Time
+	cache      healthRingCache
+}
+
+// healthRingCache caches the filtered ring of a list of endpoints, it is valid
+// as long as neither the endpoints nor their health changed.
+type healthRingCache struct {
+	fingerprint uint64
+	version     uint64
+	ring        ServerRing
+}
+
+// LookupServers satisfies the ServerRegistry interface.
+func (r *HealthCheckedRegistry) LookupServers(ctx context.Context) (ServerRing, error) {
+	r.once.Do(r.init)
+
+	ring, err := r.Registry.LookupServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := ring.(EndpointRing)
+	if !ok {
+		return ring, nil
+	}
+
+	endpoints := list.Endpoints()
+	fingerprint := fingerprintEndpoints(endpoints)
+	now := time.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.expireBlacklist(now)
+
+	if c := r.cache; c.ring != nil && c.fingerprint == fingerprint && c.version == r.version {
+		return c.ring, nil
+	}
+
+	available := make(ServerList, 0, len(endpoints))
+	primaries := 0
+
+	for _, endpoint := range endpoints {
+		if h := r.health[endpoint.Addr]; h == nil || h.Available(now) {
+			available = append(available, endpoint)
+
+			if !endpoint.IsReplica() {
+				primaries++
+			}
+		}
+	}
+
+	if len(available) != len(endpoints) && primaries != 0 {
+		ring = newShardRing(available)
+	}
+
+	r.cache = healthRingCache{
+		fingerprint: fingerprint,
+		version:     r.version,
+		ring:        ring,
+	}
+
+	return ring, nil
+}
+
+// BlacklistServer satisfies the ServerBlacklist interface.
+func (r *HealthCheckedRegistry) BlacklistServer(endpoint ServerEndpoint) {
+	r.once.Do(r.init)
+
+	timeout := r.BlacklistTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	expiry := time.Now().Add(timeout)
+
+	r.mutex.Lock()
+
+	h := r.health[endpoint.Addr]
+	if h == nil {
+		h = &EndpointHealth{Endpoint: endpoint, Healthy: true}
+		r.health[endpoint.Addr] = h
+	}
+
+	h.BlacklistedUntil = expiry
+	r.version++
+
+	if r.nextExpiry.IsZero() || expiry.Before(r.nextExpiry) {
+		r.nextExpiry = expiry
+	}
+
+	r.mutex.Unlock()
+}
+
+// Health returns the state of the endpoints known to the registry, sorted by
+// address.
+func (r *HealthCheckedRegistry) Health() []EndpointHealth {
+	r.once.Do(r.init)
+
+	r.mutex.Lock()
+	health := make([]EndpointHealth, 0, len(r.health))
+
+	for _, h := range r.health {
+		health = append(health, *h)
+	}
+
+	r.mutex.Unlock()
+
+	sort.Slice(health, func(i int, j int) bool {
+		return health[i].Endpoint.Addr < health[j].Endpoint.Addr
+	})
+
+	return health
+}
+
+// Close stops the health checks, it doesn't close the wrapped registry.
+func (r *HealthCheckedRegistry) Close() error {
+	r.once.Do(r.init)
+	r.cancel()
+	return nil
+}
+
+func (r *HealthCheckedRegistry) init() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.cancel = cancel
+	r.health = make(map[string]*EndpointHealth)
+
+	go r.run(ctx)
+}
+
+func (r *HealthCheckedRegistry) run(ctx context.Context) {
+	ticker := time.NewTicker(r.checkInterval())
+	defer ticker.Stop()
+
+	for {
+		r.checkAll(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkAll sends health checks to all the endpoints of the wrapped registry and
+// waits for their results.
+func (r *HealthCheckedRegistry) checkAll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, r.checkTimeout())
+	defer cancel()
+
+	ring, err := r.Registry.LookupServers(ctx)
+	if err != nil {
+		return
+	}
+
+	list, ok := ring.(EndpointRing)
+	if !ok {
+		return
+	}
+
+	endpoints := list.Endpoints()
+	results := make([]EndpointHealth, len(endpoints))
+	wg := sync.WaitGroup{}
+
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(result *EndpointHealth, endpoint ServerEndpoint) {
+			defer wg.Done()
+			start := time.Now()
+			result.Endpoint = endpoint
+			result.Err = r.check(ctx, endpoint.Addr)
+			result.CheckedAt = time.Now()
+			result.Latency = result.CheckedAt.Sub(start)
+		}(&results[i], endpoint)
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil && ctx.Err() != context.DeadlineExceeded {
+		return // the registry was closed
+	}
+
+	type change struct {
+		endpoint ServerEndpoint
+		healthy  bool
+	}
+
+	var changes []change
+
+	now := time.Now()
+	present := make(map[string]bool, len(results))
+
+	r.mutex.Lock()
+
+	for _, result := range results {
+		addr := result.Endpoint.Addr
+		present[addr] = true
+
+		h := r.health[addr]
+		if h == nil {
+			h = &EndpointHealth{Healthy: true}
+			r.health[addr] = h
+		}
+
+		h.Endpoint = result.Endpoint
+		h.Latency = result.Latency
+		h.CheckedAt = result.CheckedAt
+		h.Err = result.Err
+
+		if result.Err != nil {
+			h.Failures++
+			h.Successes = 0
+
+			if h.Healthy && h.Failures >= r.failureThreshold() {
+				h.Healthy = false
+				changes = append(changes, change{h.Endpoint, false})
+			}
+		} else {
+			h.Successes++
+			h.Failures = 0
+
+			if !h.Healthy && h.Successes >= r.successThreshold() {
+				h.Healthy = true
+				changes = append(changes, change{h.Endpoint, true})
+			}
+		}
+	}
+
+	for addr, h := range r.health {
+		// Endpoints which left the registry are forgotten, unless they are
+		// blacklisted.
+		if !present[addr] && !now.Before(h.BlacklistedUntil) {
+			delete(r.health, addr)
+		}
+	}
+
+	if len(changes) != 0 {
+		r.version++
+	}
+
+	r.mutex.Unlock()
+
+	if r.OnHealthChange != nil {
+		for _, c := range changes {
+			r.OnHealthChange(c.endpoint, c.healthy)
+		}
+	}
+}
+
+func (r *HealthCheckedRegistry) check(ctx context.Context, addr string) error {
+	var pong string
+	client := &Client{Addr: addr, Transport: r.Transport}
+	// The response is decoded so that errors returned by the server fail the
+	// check.
+	return ParseArgs(client.Query(ctx, "PING"), &pong)
+}
+
+// expireBlacklist removes the blacklisting of endpoints that expired, the
+// registry's mutex must be held.
+func (r *HealthCheckedRegistry) expireBlacklist(now time.Time) {
+	if r.nextExpiry.IsZero() || now.Before(r.nextExpiry) {
+		return
+	}
+
+	r.nextExpiry = time.Time{}
+
+	for _, h := range r.health {
+		if h.BlacklistedUntil.IsZero() {
+			continue
+		}
+
+		if !now.Before(h.BlacklistedUntil) {
+			h.BlacklistedUntil = time.Time{}
+		} else if r.nextExpiry.IsZero() || h.BlacklistedUntil.Before(r.nextExpiry) {
+			r.nextExpiry = h.BlacklistedUntil
+		}
+	}
+
+	r.version++
+}
+
+func (r *HealthCheckedRegistry) checkInterval() time.Duration {
+	if interval := r.CheckInterval; interval != 0 {
+		return interval
+	}
+
+	return time.Second
+}
+
+func (r *HealthCheckedRegistry) checkTimeout() time.Duration {
+	if timeout := r.CheckTimeout; timeout != 0 {
+		return timeout
+	}
+
+	return time.Second
+}
+
+func (r *HealthCheckedRegistry) failureThreshold() int {
+	if threshold := r.FailureThreshold; threshold > 0 {
+		return threshold
+	}
+
+	return 3
+}
+
+func (r *HealthCheckedRegistry) successThreshold() int {
+	if threshold := r.SuccessThreshold; threshold > 0 {
+		return threshold
+	}
+
+	return 2
+}
+
+// fingerprintEndpoints returns a hash of the list of endpoints, which is used
+// to detect changes of the lists returned by registries.
+func fingerprintEndpoints(endpoints []ServerEndpoint) uint64 {
+	h := jody.HashUint64(uint64(len(endpoints)))
+
+	for _, e := range endpoints {
+		h = jody.AddString64(h, e.Name)
+		h = jody.AddString64(h, e.Addr)
+		h = jody.AddString64(h, string(e.Role))
+		h = jody.AddString64(h, e.Group)
+		h = jody.AddString64(h, e.Zone)
+		h = jody.AddUint64(h, uint64(e.Weight))
+	}
+
+	return h
+}
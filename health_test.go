@@ -0,0 +1,262 @@
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+func TestHealthCheckedRegistry(t *testing.T) {
+	redistest.TestServerRegistry(t, func() (redis.ServerRegistry, string, redis.ServerEndpoint, func(), error) {
+		endpoints := redis.ServerList{
+			{Name: "A", Addr: "127.0.0.1:4242"},
+			{Name: "B", Addr: "127.0.0.1:4243"},
+			{Name: "C", Addr: "127.0.0.1:4244"},
+		}
+
+		registry := &redis.HealthCheckedRegistry{
+			Registry:      endpoints,
+			CheckInterval: time.Hour,
+		}
+
+		return registry, "A", endpoints[1], func() { registry.Close() }, nil
+	})
+}
+
+// newToggleServer starts a server which responds to commands with an error
+// while down is non-zero. redis.Server answers PING itself, the protocol is
+// implemented by hand so the responses can be controlled.
+func newToggleServer() (net.Listener, string, *int32) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	down := new(int32)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+
+					// skips the bulk strings of the command
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					for i := 0; i != 2*n; i++ {
+						if _, err := r.ReadString('\n'); err != nil {
+							return
+						}
+					}
+
+					if atomic.LoadInt32(down) != 0 {
+						conn.Write([]byte("-ERR down\r\n"))
+					} else {
+						conn.Write([]byte("+PONG\r\n"))
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return l, l.Addr().String(), down
+}
+
+func TestHealthCheckedRegistryChecks(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, *redis.HealthCheckedRegistry, []string, []*int32)
+	}{
+		{
+			scenario: "endpoints are removed from the ring after consecutive failed checks and restored after consecutive successful checks",
+			function: testHealthCheckedRegistryThresholds,
+		},
+		{
+			scenario: "blacklisted endpoints are removed from the ring until the timeout expires",
+			function: testHealthCheckedRegistryBlacklist,
+		},
+		{
+			scenario: "the ring is returned as is when all primaries are unhealthy",
+			function: testHealthCheckedRegistryFailOpen,
+		},
+		{
+			scenario: "the health of the endpoints is exposed by the registry",
+			function: testHealthCheckedRegistryHealth,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			srv1, addr1, down1 := newToggleServer()
+			defer srv1.Close()
+
+			srv2, addr2, down2 := newToggleServer()
+			defer srv2.Close()
+
+			transport := &redis.Transport{}
+			defer transport.CloseIdleConnections()
+
+			registry := &redis.HealthCheckedRegistry{
+				Registry:         redis.ServerList{{Addr: addr1}, {Addr: addr2}},
+				Transport:        transport,
+				CheckInterval:    10 * time.Millisecond,
+				CheckTimeout:     100 * time.Millisecond,
+				FailureThreshold: 2,
+				SuccessThreshold: 2,
+				BlacklistTimeout: 50 * time.Millisecond,
+			}
+			defer registry.Close()
+
+			testFunc(t, ctx, registry, []string{addr1, addr2}, []*int32{down1, down2})
+		})
+	}
+}
+
+func availableAddrs(ctx context.Context, registry redis.ServerRegistry) []string {
+	ring, err := registry.LookupServers(ctx)
+	if err != nil {
+		return nil
+	}
+
+	var addrs []string
+	for _, endpoint := range ring.(redis.EndpointRing).Endpoints() {
+		addrs = append(addrs, endpoint.Addr)
+	}
+	return addrs
+}
+
+func waitForAvailableAddrs(t *testing.T, ctx context.Context, registry redis.ServerRegistry, addrs ...string) {
+	for {
+		available := availableAddrs(ctx, registry)
+
+		if len(available) == len(addrs) {
+			match := true
+			for i := range addrs {
+				match = match && available[i] == addrs[i]
+			}
+			if match {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("the registry never returned %v, last: %v", addrs, available)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func testHealthCheckedRegistryThresholds(t *testing.T, ctx context.Context, registry *redis.HealthCheckedRegistry, addrs []string, down []*int32) {
+	changes := make(chan bool, 10)
+	registry.OnHealthChange = func(endpoint redis.ServerEndpoint, healthy bool) {
+		if endpoint.Addr == addrs[0] {
+			changes <- healthy
+		}
+	}
+
+	it := assert.New(t)
+	it.Equal(addrs, availableAddrs(ctx, registry))
+
+	atomic.StoreInt32(down[0], 1)
+	waitForAvailableAddrs(t, ctx, registry, addrs[1])
+	it.Equal(false, <-changes)
+
+	ring, err := registry.LookupServers(ctx)
+	if it.Nil(err) {
+		it.Equal(addrs[1], ring.LookupServer("key").Addr)
+	}
+
+	atomic.StoreInt32(down[0], 0)
+	waitForAvailableAddrs(t, ctx, registry, addrs...)
+	it.Equal(true, <-changes)
+}
+
+func testHealthCheckedRegistryBlacklist(t *testing.T, ctx context.Context, registry *redis.HealthCheckedRegistry, addrs []string, down []*int32) {
+	it := assert.New(t)
+
+	registry.BlacklistServer(redis.ServerEndpoint{Addr: addrs[1]})
+	it.Equal([]string{addrs[0]}, availableAddrs(ctx, registry))
+
+	waitForAvailableAddrs(t, ctx, registry, addrs...)
+}
+
+func testHealthCheckedRegistryFailOpen(t *testing.T, ctx context.Context, registry *redis.HealthCheckedRegistry, addrs []string, down []*int32) {
+	atomic.StoreInt32(down[0], 1)
+	waitForAvailableAddrs(t, ctx, registry, addrs[1])
+
+	atomic.StoreInt32(down[1], 1)
+
+	for {
+		health := registry.Health()
+		if len(health) == 2 && !health[0].Healthy && !health[1].Healthy {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatal("the endpoints never became unhealthy")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	assert.New(t).Equal(addrs, availableAddrs(ctx, registry))
+}
+
+func testHealthCheckedRegistryHealth(t *testing.T, ctx context.Context, registry *redis.HealthCheckedRegistry, addrs []string, down []*int32) {
+	it := assert.New(t)
+
+	atomic.StoreInt32(down[1], 1)
+	waitForAvailableAddrs(t, ctx, registry, addrs[0])
+
+	registry.BlacklistServer(redis.ServerEndpoint{Addr: addrs[0]})
+
+	health := registry.Health()
+	if !it.Equal(2, len(health)) {
+		return
+	}
+
+	byAddr := map[string]redis.EndpointHealth{}
+	for _, h := range health {
+		byAddr[h.Endpoint.Addr] = h
+	}
+
+	healthy, unhealthy := byAddr[addrs[0]], byAddr[addrs[1]]
+
+	it.True(healthy.Healthy)
+	it.False(healthy.BlacklistedUntil.IsZero())
+	it.False(healthy.Available(time.Now()))
+	it.Nil(healthy.Err)
+	it.True(healthy.Latency > 0)
+
+	it.False(unhealthy.Healthy)
+	it.True(unhealthy.Failures >= 2)
+	it.Equal(0, unhealthy.Successes)
+	it.NotNil(unhealthy.Err)
+}
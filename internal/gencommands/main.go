@@ -0,0 +1,246 @@
+// Command gencommands generates the typed command API of redis.Client and the
+// redis command table from a JSON command spec.
+//
+// It is invoked by go generate from the root of the repository:
+//
+//	go run ./internal/gencommands -input commands.json -output commands_gen.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+)
+
+// spec is the representation of a single command of the JSON command spec.
+type spec struct {
+	Name     string   `json:"name"`
+	Group    string   `json:"group"`
+	Summary  string   `json:"summary"`
+	Arity    int      `json:"arity"`
+	Flags    []string `json:"flags"`
+	FirstKey int      `json:"first_key"`
+	LastKey  int      `json:"last_key"`
+	Step     int      `json:"step"`
+	Methods  []method `json:"methods"`
+}
+
+// method describes a typed method of redis.Client issuing the command.
+type method struct {
+	Name      string     `json:"name"`
+	Summary   string     `json:"summary"`
+	Arguments []argument `json:"arguments"`
+	Reply     string     `json:"reply"`
+}
+
+type argument struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Token    string `json:"token"`
+	Optional bool   `json:"optional"`
+	Multiple bool   `json:"multiple"`
+}
+
+var argumentTypes = map[string]string{
+	"key":     "string",
+	"string":  "string",
+	"pattern": "string",
+	"value":   "interface{}",
+	"integer": "int64",
+	"double":  "float64",
+	"cursor":  "uint64",
+	"z":       "Z",
+}
+
+var replyTypes = map[string]struct {
+	types  string
+	helper string
+}{
+	"status":  {"error", "replyStatus"},
+	"string":  {"(string, error)", "replyString"},
+	"bytes":   {"([]byte, error)", "replyBytes"},
+	"integer": {"(int64, error)", "replyInt64"},
+	"rank":    {"(int64, error)", "replyRank"},
+	"boolean": {"(bool, error)", "replyBool"},
+	"double":  {"(float64, error)", "replyFloat64"},
+	"strings": {"([]string, error)", "replyStrings"},
+	"values":  {"([]interface{}, error)", "replyValues"},
+	"map":     {"(map[string]string, error)", "replyStringMap"},
+	"z":       {"([]Z, error)", "replyZ"},
+	"scan":    {"(uint64, []string, error)", "replyScan"},
+}
+
+func main() {
+	input := flag.String("input", "commands.json", "path to the JSON command spec")
+	output := flag.String("output", "commands_gen.go", "path to the generated Go file")
+	flag.Parse()
+
+	b, err := ioutil.ReadFile(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var specs []spec
+	if err := json.Unmarshal(b, &specs); err != nil {
+		log.Fatalf("%s: %s", *input, err)
+	}
+
+	sort.Slice(specs, func(i int, j int) bool { return specs[i].Name < specs[j].Name })
+
+	src, err := generate(*input, specs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generate(input string, specs []spec) ([]byte, error) {
+	w := &bytes.Buffer{}
+
+	fmt.Fprintf(w, "// Code generated by gencommands from %s; DO NOT EDIT.\n\n", input)
+	fmt.Fprintf(w, "package redis\n\n")
+	fmt.Fprintf(w, "import \"context\"\n\n")
+
+	methods := map[string]bool{}
+
+	for _, s := range specs {
+		for _, m := range s.Methods {
+			if methods[m.Name] {
+				return nil, fmt.Errorf("%s: duplicate method %s", s.Name, m.Name)
+			}
+			methods[m.Name] = true
+
+			if err := generateMethod(w, s, m); err != nil {
+				return nil, fmt.Errorf("%s: %s", s.Name, err)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "var commandTable = map[string]*CommandInfo{\n")
+
+	for _, s := range specs {
+		fmt.Fprintf(w, "%q: {Name: %q, Group: %q, Summary: %q, Arity: %d, Flags: %#v, FirstKey: %d, LastKey: %d, KeyStep: %d},\n",
+			s.Name, s.Name, s.Group, s.Summary, s.Arity, s.Flags, s.FirstKey, s.LastKey, s.Step)
+	}
+
+	fmt.Fprintf(w, "}\n")
+
+	return format.Source(w.Bytes())
+}
+
+func generateMethod(w *bytes.Buffer, s spec, m method) error {
+	reply, ok := replyTypes[m.Reply]
+	if !ok {
+		return fmt.Errorf("%s: unsupported reply type %q", m.Name, m.Reply)
+	}
+
+	var (
+		params []string
+		simple = true
+	)
+
+	for i, a := range m.Arguments {
+		if a.Type == "token" {
+			simple = false
+			continue
+		}
+
+		typ, ok := argumentTypes[a.Type]
+		if !ok {
+			return fmt.Errorf("%s: unsupported argument type %q", m.Name, a.Type)
+		}
+
+		if a.Multiple {
+			if i != len(m.Arguments)-1 {
+				return fmt.Errorf("%s: only the last argument can be repeated", m.Name)
+			}
+			typ = "..." + typ
+		}
+
+		if a.Multiple || a.Optional || a.Type == "z" {
+			simple = false
+		}
+
+		params = append(params, a.Name+" "+typ)
+	}
+
+	summary := m.Summary
+	if len(summary) == 0 {
+		summary = s.Summary
+	}
+
+	fmt.Fprintf(w, "// %s issues the %s command: %s.\n", m.Name, s.Name, strings.TrimSuffix(summary, "."))
+	fmt.Fprintf(w, "func (c *Client) %s(%s) %s {\n", m.Name, strings.Join(append([]string{"ctx context.Context"}, params...), ", "), reply.types)
+
+	if simple {
+		names := []string{"ctx", fmt.Sprintf("%q", s.Name)}
+		for _, a := range m.Arguments {
+			names = append(names, a.Name)
+		}
+		fmt.Fprintf(w, "return %s(c.Query(%s))\n}\n\n", reply.helper, strings.Join(names, ", "))
+		return nil
+	}
+
+	size := fmt.Sprint(len(m.Arguments) * 2)
+
+	if last := m.Arguments[len(m.Arguments)-1]; last.Multiple {
+		if last.Type == "z" {
+			size += fmt.Sprintf("+2*len(%s)", last.Name)
+		} else {
+			size += fmt.Sprintf("+len(%s)", last.Name)
+		}
+	}
+
+	fmt.Fprintf(w, "args := make([]interface{}, 0, %s)\n", size)
+
+	for _, a := range m.Arguments {
+		switch {
+		case a.Type == "token":
+			fmt.Fprintf(w, "args = append(args, %q)\n", a.Value)
+
+		case a.Multiple && a.Type == "z":
+			fmt.Fprintf(w, "for _, z := range %s {\nargs = append(args, z.Score, z.Member)\n}\n", a.Name)
+
+		case a.Type == "z":
+			fmt.Fprintf(w, "args = append(args, %s.Score, %s.Member)\n", a.Name, a.Name)
+
+		case a.Multiple && argumentTypes[a.Type] == "interface{}":
+			fmt.Fprintf(w, "args = append(args, %s...)\n", a.Name)
+
+		case a.Multiple:
+			fmt.Fprintf(w, "for _, arg := range %s {\nargs = append(args, arg)\n}\n", a.Name)
+
+		case a.Optional:
+			zero := "0"
+			if argumentTypes[a.Type] == "string" {
+				zero = `""`
+			} else if argumentTypes[a.Type] == "interface{}" {
+				zero = "nil"
+			}
+
+			fmt.Fprintf(w, "if %s != %s {\n", a.Name, zero)
+			if len(a.Token) != 0 {
+				fmt.Fprintf(w, "args = append(args, %q, %s)\n", a.Token, a.Name)
+			} else {
+				fmt.Fprintf(w, "args = append(args, %s)\n", a.Name)
+			}
+			fmt.Fprintf(w, "}\n")
+
+		default:
+			fmt.Fprintf(w, "args = append(args, %s)\n", a.Name)
+		}
+	}
+
+	fmt.Fprintf(w, "return %s(c.Query(ctx, %q, args...))\n}\n\n", reply.helper, s.Name)
+	return nil
+}
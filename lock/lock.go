@@ -0,0 +1,371 @@
+// Package lock implements distributed locks on independent redis servers with
+// the Redlock algorithm.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mathrand "math/rand"
+	"sync"
+	"time"
+
+	redis "github.com/dolab/redis-go"
+)
+
+var (
+	// ErrNotAcquired is returned by Locker.Lock when the lock could not be
+	// acquired on a quorum of servers after all the attempts.
+	ErrNotAcquired = errors.New("lock: the lock could not be acquired")
+
+	// ErrNotExtended is returned by Lock.Extend when the lock could not be
+	// extended on a quorum of servers, it remains valid until Lock.Until.
+	ErrNotExtended = errors.New("lock: the lock could not be extended")
+
+	// ErrLockLost is returned by Lock.Err when the lock expired before it
+	// could be refreshed.
+	ErrLockLost = errors.New("lock: the lock was lost")
+
+	// ErrNotReleased is returned by Lock.Unlock when the lock could not be
+	// released on a quorum of servers, it then expires after its TTL.
+	ErrNotReleased = errors.New("lock: the lock could not be released")
+)
+
+// The scripts only delete or expire the key of a lock when it still holds the
+// token of the lock, so a client can't release a lock acquired by another
+// client after its own lock expired.
+const (
+	unlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+	extendScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+)
+
+// A Locker acquires locks on independent redis servers with the Redlock
+// algorithm: a lock is held when it was set on a majority of the servers
+// within its TTL, minus an allowance for the clock drift between the servers.
+//
+// The servers must be independent primaries, not replicas of each other, the
+// replicas of the server list are ignored.
+//
+// Lockers are safe for concurrent use by multiple goroutines.
+type Locker struct {
+	// Servers is the list of servers that the locks are acquired on.
+	Servers redis.ServerList
+
+	// Client is the client used to send the commands to the servers, its Addr
+	// is ignored. redis.DefaultClient is used if it is nil.
+	Client *redis.Client
+
+	// Timeout is the time limit of the requests to each server, it should be
+	// small compared to the TTL of the locks so unavailable servers don't
+	// consume their validity. Zero means 50ms.
+	Timeout time.Duration
+
+	// MaxAttempts is the maximum number of times Lock tries to acquire a
+	// lock, including the first attempt. Zero means 3 attempts.
+	MaxAttempts int
+
+	// RetryDelay is the delay between the attempts to acquire a lock, the
+	// actual delays are randomly jittered between half and the full delay so
+	// clients competing for a lock don't retry in lockstep. Zero means 200ms.
+	RetryDelay time.Duration
+
+	// DriftFactor is the fraction of the TTL of the locks allowed for the
+	// clock drift between the servers. Zero means 0.01.
+	DriftFactor float64
+
+	// AutoRefresh enables extending the locks in the background, every third
+	// of their TTL, until they are unlocked.
+	AutoRefresh bool
+}
+
+// Lock acquires the lock with name for ttl. It returns ErrNotAcquired if the
+// lock is held by another client after all the attempts, or the error of ctx
+// if it is canceled while waiting between attempts.
+func (l *Locker) Lock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		n := l.each(ctx, func(ctx context.Context, addr string) bool {
+			var status string
+			err := l.query(ctx, addr, &status, "SET", name, token, "NX", "PX", milliseconds(ttl))
+			return err == nil && status == "OK"
+		})
+
+		if until, ok := l.valid(start, n, ttl); ok {
+			lock := &Lock{
+				locker: l,
+				name:   name,
+				token:  token,
+				ttl:    ttl,
+				until:  until,
+				done:   make(chan struct{}),
+			}
+
+			if l.AutoRefresh {
+				go lock.refresh()
+			}
+
+			return lock, nil
+		}
+
+		// The lock is released on all the servers, including those which may
+		// have set it without responding in time.
+		l.release(ctx, name, token)
+
+		if attempt >= l.maxAttempts() {
+			return nil, ErrNotAcquired
+		}
+
+		timer := time.NewTimer(l.retryDelay())
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// valid returns the validity deadline of a lock which was set on n servers
+// for ttl in the attempt which started at start, and whether the lock is held.
+func (l *Locker) valid(start time.Time, n int, ttl time.Duration) (time.Time, bool) {
+	drift := time.Duration(float64(ttl)*l.driftFactor()) + 2*time.Millisecond
+	validity := ttl - time.Since(start) - drift
+	return start.Add(validity), n >= l.quorum() && validity > 0
+}
+
+// release runs the unlock script on all the servers, it returns the number of
+// servers which were reached.
+func (l *Locker) release(ctx context.Context, name string, token string) int {
+	return l.each(ctx, func(ctx context.Context, addr string) bool {
+		var n int
+		return l.query(ctx, addr, &n, "EVAL", unlockScript, 1, name, token) == nil
+	})
+}
+
+// each calls do concurrently for the address of each server, with the context
+// bounded by the timeout of the requests. It returns the number of calls which
+// returned true.
+func (l *Locker) each(ctx context.Context, do func(context.Context, string) bool) int {
+	servers := l.servers()
+	results := make(chan bool, len(servers))
+
+	for _, server := range servers {
+		go func(addr string) {
+			ctx, cancel := context.WithTimeout(ctx, l.timeout())
+			defer cancel()
+			results <- do(ctx, addr)
+		}(server.Addr)
+	}
+
+	n := 0
+
+	for range servers {
+		if <-results {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (l *Locker) query(ctx context.Context, addr string, dst interface{}, cmd string, args ...interface{}) error {
+	client := l.Client
+	if client == nil {
+		client = redis.DefaultClient
+	}
+
+	res, err := client.Do(&redis.Request{
+		Addr:    addr,
+		Cmds:    []redis.Command{{Cmd: cmd, Args: redis.List(args...)}},
+		Context: ctx,
+	})
+	if err != nil {
+		return err
+	}
+
+	return redis.ParseArgs(res.Args, dst)
+}
+
+func (l *Locker) servers() []redis.ServerEndpoint {
+	servers := make([]redis.ServerEndpoint, 0, len(l.Servers))
+
+	for _, server := range l.Servers {
+		if !server.IsReplica() {
+			servers = append(servers, server)
+		}
+	}
+
+	return servers
+}
+
+func (l *Locker) quorum() int {
+	return len(l.servers())/2 + 1
+}
+
+func (l *Locker) timeout() time.Duration {
+	if l.Timeout == 0 {
+		return 50 * time.Millisecond
+	}
+	return l.Timeout
+}
+
+func (l *Locker) maxAttempts() int {
+	if l.MaxAttempts <= 0 {
+		return 3
+	}
+	return l.MaxAttempts
+}
+
+func (l *Locker) retryDelay() time.Duration {
+	delay := l.RetryDelay
+	if delay == 0 {
+		delay = 200 * time.Millisecond
+	}
+	return delay/2 + time.Duration(mathrand.Int63n(int64(delay/2)+1))
+}
+
+func (l *Locker) driftFactor() float64 {
+	if l.DriftFactor == 0 {
+		return 0.01
+	}
+	return l.DriftFactor
+}
+
+// Lock is a lock acquired by a Locker.
+//
+// Locks are safe for concurrent use by multiple goroutines.
+type Lock struct {
+	locker *Locker
+	name   string
+	token  string
+	ttl    time.Duration
+
+	mutex    sync.Mutex
+	until    time.Time
+	err      error
+	done     chan struct{}
+	released bool
+}
+
+// Name returns the name of the lock.
+func (lock *Lock) Name() string {
+	return lock.name
+}
+
+// Token returns the random value identifying the lock on the servers.
+func (lock *Lock) Token() string {
+	return lock.token
+}
+
+// Until returns the time until which the lock is known to be held.
+func (lock *Lock) Until() time.Time {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	return lock.until
+}
+
+// Done returns a channel which is closed when the lock is unlocked, or lost
+// because it could not be refreshed in time.
+func (lock *Lock) Done() <-chan struct{} {
+	return lock.done
+}
+
+// Err returns ErrLockLost if the lock was lost, or nil.
+func (lock *Lock) Err() error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	return lock.err
+}
+
+// Extend sets the TTL of the lock to ttl. It returns ErrNotExtended if the lock
+// could not be extended on a quorum of servers within ttl, because it expired
+// or the servers are unavailable.
+func (lock *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	l := lock.locker
+	start := time.Now()
+
+	n := l.each(ctx, func(ctx context.Context, addr string) bool {
+		var ok int
+		err := l.query(ctx, addr, &ok, "EVAL", extendScript, 1, lock.name, lock.token, milliseconds(ttl))
+		return err == nil && ok == 1
+	})
+
+	until, ok := l.valid(start, n, ttl)
+	if !ok {
+		return ErrNotExtended
+	}
+
+	lock.mutex.Lock()
+	lock.until = until
+	lock.mutex.Unlock()
+	return nil
+}
+
+// Unlock releases the lock and stops its refreshes. It returns ErrNotReleased
+// if fewer than a quorum of servers could be reached, the lock then expires
+// after its TTL.
+func (lock *Lock) Unlock(ctx context.Context) error {
+	lock.close(nil)
+
+	if lock.locker.release(ctx, lock.name, lock.token) < lock.locker.quorum() {
+		return ErrNotReleased
+	}
+
+	return nil
+}
+
+// close closes the done channel of the lock the first time it is called, with
+// the error reported by Err.
+func (lock *Lock) close(err error) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	if !lock.released {
+		lock.released = true
+		lock.err = err
+		close(lock.done)
+	}
+}
+
+// refresh extends the lock every third of its TTL until it is unlocked, the
+// lock is lost if it expires before an extension succeeds.
+func (lock *Lock) refresh() {
+	ticker := time.NewTicker(lock.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-lock.done:
+			return
+		}
+
+		ctx, cancel := context.WithDeadline(context.Background(), lock.Until())
+		err := lock.Extend(ctx, lock.ttl)
+		cancel()
+
+		if err != nil && !time.Now().Before(lock.Until()) {
+			lock.close(ErrLockLost)
+			return
+		}
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
@@ -0,0 +1,377 @@
+package lock_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/lock"
+)
+
+func TestLocker(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, []*lockServer)
+	}{
+		{
+			scenario: "locks are exclusive until they are unlocked",
+			function: testLockerExclusive,
+		},
+		{
+			scenario: "locks are acquired on a quorum of servers when some are partitioned",
+			function: testLockerPartition,
+		},
+		{
+			scenario: "slow servers don't count toward the quorum",
+			function: testLockerSlow,
+		},
+		{
+			scenario: "the validity of locks accounts for the time spent acquiring them",
+			function: testLockerValidity,
+		},
+		{
+			scenario: "locks are only extended and released with their token",
+			function: testLockerToken,
+		},
+		{
+			scenario: "locks are refreshed in the background until they are unlocked",
+			function: testLockerAutoRefresh,
+		},
+		{
+			scenario: "locks which can't be refreshed are lost",
+			function: testLockerLost,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			servers := make([]*lockServer, 3)
+			for i := range servers {
+				servers[i] = startLockServer(t)
+				defer servers[i].Close()
+			}
+
+			testFunc(t, ctx, servers)
+		})
+	}
+}
+
+func newLocker(servers []*lockServer) *lock.Locker {
+	list := make(redis.ServerList, len(servers))
+	for i, srv := range servers {
+		list[i] = redis.ServerEndpoint{Addr: srv.addr}
+	}
+
+	return &lock.Locker{
+		Servers:    list,
+		Client:     &redis.Client{Transport: &redis.Transport{}},
+		RetryDelay: 10 * time.Millisecond,
+	}
+}
+
+func testLockerExclusive(t *testing.T, ctx context.Context, servers []*lockServer) {
+	it := assert.New(t)
+
+	l1, l2 := newLocker(servers), newLocker(servers)
+
+	lk, err := l1.Lock(ctx, "resource", time.Second)
+	if !it.Nil(err) {
+		return
+	}
+	it.Equal("resource", lk.Name())
+
+	for _, srv := range servers {
+		it.Equal(lk.Token(), srv.get("resource"))
+	}
+
+	_, err = l2.Lock(ctx, "resource", time.Second)
+	it.Equal(lock.ErrNotAcquired, err)
+
+	it.Nil(lk.Unlock(ctx))
+
+	select {
+	case <-lk.Done():
+	default:
+		t.Error("the lock is not done after being unlocked")
+	}
+
+	lk, err = l2.Lock(ctx, "resource", time.Second)
+	if it.Nil(err) {
+		it.Nil(lk.Unlock(ctx))
+	}
+}
+
+func testLockerPartition(t *testing.T, ctx context.Context, servers []*lockServer) {
+	it := assert.New(t)
+
+	locker := newLocker(servers)
+
+	servers[0].Close()
+
+	lk, err := locker.Lock(ctx, "resource", time.Second)
+	if it.Nil(err) {
+		it.Nil(lk.Unlock(ctx))
+	}
+
+	servers[1].Close()
+
+	_, err = locker.Lock(ctx, "resource", time.Second)
+	it.Equal(lock.ErrNotAcquired, err)
+
+	// The lock set on the only server reachable was released.
+	it.Equal("", servers[2].get("resource"))
+}
+
+func testLockerSlow(t *testing.T, ctx context.Context, servers []*lockServer) {
+	it := assert.New(t)
+
+	locker := newLocker(servers)
+	locker.MaxAttempts = 1
+
+	servers[0].setDelay(200 * time.Millisecond)
+
+	lk, err := locker.Lock(ctx, "resource", time.Second)
+	if it.Nil(err) {
+		it.Nil(lk.Unlock(ctx))
+	}
+
+	servers[1].setDelay(200 * time.Millisecond)
+
+	_, err = locker.Lock(ctx, "resource", time.Second)
+	it.Equal(lock.ErrNotAcquired, err)
+}
+
+func testLockerValidity(t *testing.T, ctx context.Context, servers []*lockServer) {
+	it := assert.New(t)
+
+	locker := newLocker(servers)
+	locker.MaxAttempts = 1
+	locker.Timeout = time.Second
+
+	start := time.Now()
+
+	lk, err := locker.Lock(ctx, "resource", time.Second)
+	if it.Nil(err) {
+		// The clock drift allowance is 1% of the TTL plus 2ms.
+		it.True(lk.Until().Before(start.Add(time.Second - 12*time.Millisecond)))
+		it.Nil(lk.Unlock(ctx))
+	}
+
+	// The servers respond after the TTL of the lock.
+	for _, srv := range servers {
+		srv.setDelay(50 * time.Millisecond)
+	}
+
+	_, err = locker.Lock(ctx, "resource", 40*time.Millisecond)
+	it.Equal(lock.ErrNotAcquired, err)
+}
+
+func testLockerToken(t *testing.T, ctx context.Context, servers []*lockServer) {
+	it := assert.New(t)
+
+	locker := newLocker(servers)
+
+	lk, err := locker.Lock(ctx, "resource", 100*time.Millisecond)
+	if !it.Nil(err) {
+		return
+	}
+
+	until := lk.Until()
+	it.Nil(lk.Extend(ctx, time.Second))
+	it.True(lk.Until().After(until))
+
+	time.Sleep(150 * time.Millisecond)
+
+	for _, srv := range servers {
+		it.Equal(lk.Token(), srv.get("resource"))
+	}
+
+	// Another client took over the lock after it expired.
+	for _, srv := range servers {
+		srv.set("resource", "other", time.Second)
+	}
+
+	it.Equal(lock.ErrNotExtended, lk.Extend(ctx, time.Second))
+	it.Nil(lk.Unlock(ctx))
+
+	for _, srv := range servers {
+		it.Equal("other", srv.get("resource"))
+	}
+}
+
+func testLockerAutoRefresh(t *testing.T, ctx context.Context, servers []*lockServer) {
+	it := assert.New(t)
+
+	locker := newLocker(servers)
+	locker.AutoRefresh = true
+
+	lk, err := locker.Lock(ctx, "resource", 90*time.Millisecond)
+	if !it.Nil(err) {
+		return
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	other := newLocker(servers)
+	other.MaxAttempts = 1
+
+	_, err = other.Lock(ctx, "resource", time.Second)
+	it.Equal(lock.ErrNotAcquired, err)
+
+	it.Nil(lk.Unlock(ctx))
+	it.Nil(lk.Err())
+
+	_, err = other.Lock(ctx, "resource", time.Second)
+	it.Nil(err)
+}
+
+func testLockerLost(t *testing.T, ctx context.Context, servers []*lockServer) {
+	it := assert.New(t)
+
+	locker := newLocker(servers)
+	locker.AutoRefresh = true
+
+	lk, err := locker.Lock(ctx, "resource", 90*time.Millisecond)
+	if !it.Nil(err) {
+		return
+	}
+
+	servers[0].Close()
+	servers[1].Close()
+
+	select {
+	case <-lk.Done():
+		it.Equal(lock.ErrLockLost, lk.Err())
+		it.False(time.Now().Before(lk.Until()))
+	case <-ctx.Done():
+		t.Error("the lock was not lost")
+	}
+
+	it.Equal(lock.ErrNotReleased, lk.Unlock(ctx))
+}
+
+// lockServer is a redis server implementing the commands used by the locks,
+// the scripts are recognized by the command they run. Its responses can be
+// delayed to simulate slow servers.
+type lockServer struct {
+	*redis.Server
+	listener net.Listener
+	addr     string
+
+	mutex  sync.Mutex
+	values map[string]lockValue
+	delay  time.Duration
+}
+
+type lockValue struct {
+	value   string
+	expires time.Time
+}
+
+func startLockServer(t *testing.T) *lockServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &lockServer{
+		listener: l,
+		addr:     l.Addr().String(),
+		values:   map[string]lockValue{},
+	}
+	srv.Server = &redis.Server{Handler: srv}
+
+	go srv.Serve(l)
+	return srv
+}
+
+// Close closes the listener of the server before the server, which may not
+// have started serving it yet.
+func (srv *lockServer) Close() error {
+	srv.listener.Close()
+	return srv.Server.Close()
+}
+
+func (srv *lockServer) setDelay(delay time.Duration) {
+	srv.mutex.Lock()
+	srv.delay = delay
+	srv.mutex.Unlock()
+}
+
+func (srv *lockServer) get(key string) string {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+
+	v, ok := srv.values[key]
+	if !ok || time.Now().After(v.expires) {
+		return ""
+	}
+	return v.value
+}
+
+func (srv *lockServer) set(key string, value string, ttl time.Duration) {
+	srv.mutex.Lock()
+	srv.values[key] = lockValue{value: value, expires: time.Now().Add(ttl)}
+	srv.mutex.Unlock()
+}
+
+func (srv *lockServer) ServeRedis(w redis.ResponseWriter, r *redis.Request) {
+	var args []string
+	r.Cmds[0].ParseArgs(&args)
+
+	srv.mutex.Lock()
+	delay := srv.delay
+	srv.mutex.Unlock()
+
+	time.Sleep(delay)
+
+	switch r.Cmds[0].Cmd {
+	case "SET":
+		// SET key value NX PX ms
+		ms, _ := strconv.Atoi(args[4])
+
+		if srv.get(args[0]) != "" {
+			w.Write(nil)
+			return
+		}
+
+		srv.set(args[0], args[1], time.Duration(ms)*time.Millisecond)
+		w.Write("OK")
+
+	case "EVAL":
+		// EVAL script 1 key token [ms]
+		key, token := args[2], args[3]
+
+		srv.mutex.Lock()
+		defer srv.mutex.Unlock()
+
+		v, ok := srv.values[key]
+		if !ok || v.value != token || time.Now().After(v.expires) {
+			w.Write(0)
+			return
+		}
+
+		if strings.Contains(args[0], "pexpire") {
+			ms, _ := strconv.Atoi(args[4])
+			v.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			srv.values[key] = v
+		} else {
+			delete(srv.values, key)
+		}
+
+		w.Write(1)
+	}
+}
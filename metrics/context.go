@@ -222,3 +222,67 @@ func (m *Metrics) IncErrors(remoteAddr, localAddr string, cmds []string) {
 
 	m.monitor.server.errors.With(labels).Inc()
 }
+
+func (m *Metrics) IncScannedKeys(remoteAddr string, n int) {
+	if !m.Enabled() {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"remote_addr": remoteAddr,
+	}
+
+	m.monitor.scanned.With(labels).Add(float64(n))
+}
+
+func (m *Metrics) IncMigratedKeys(fromAddr, toAddr, result string) {
+	if !m.Enabled() {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"from_addr": fromAddr,
+		"to_addr":   toAddr,
+		"result":    result,
+	}
+
+	m.monitor.migrated.With(labels).Inc()
+}
+
+func (m *Metrics) IncShadowRequests(cmd, result string) {
+	if !m.Enabled() {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"cmd":    cmd,
+		"result": result,
+	}
+
+	m.monitor.shadowed.With(labels).Inc()
+}
+
+func (m *Metrics) IncRateLimited(by, action string) {
+	if !m.Enabled() {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"by":     by,
+		"action": action,
+	}
+
+	m.monitor.limited.With(labels).Inc()
+}
+
+func (m *Metrics) IncClientCache(event string) {
+	if !m.Enabled() {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"event": event,
+	}
+
+	m.monitor.cached.With(labels).Inc()
+}
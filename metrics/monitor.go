@@ -6,8 +6,13 @@ import (
 
 // A Monitor defines metrics for gRPC
 type Monitor struct {
-	dialer *prometheus.CounterVec
-	server *Matrix
+	dialer   *prometheus.CounterVec
+	scanned  *prometheus.CounterVec
+	migrated *prometheus.CounterVec
+	shadowed *prometheus.CounterVec
+	limited  *prometheus.CounterVec
+	cached   *prometheus.CounterVec
+	server   *Matrix
 }
 
 // NewMonitor creates Monitor for starting
@@ -23,20 +28,89 @@ func NewMonitor(subsystem string, labels prometheus.Labels) *Monitor {
 		[]string{"local_addr", "remote_addr"},
 	)
 
+	scanned := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "redis",
+			Subsystem:   subsystem,
+			Name:        "migration_scanned_keys_total",
+			Help:        "Total number of keys scanned by the migrator of reverse proxies.",
+			ConstLabels: labels,
+		},
+		[]string{"remote_addr"},
+	)
+	migrated := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "redis",
+			Subsystem:   subsystem,
+			Name:        "migration_keys_total",
+			Help:        "Total number of keys moved between redis back servers by reverse proxies.",
+			ConstLabels: labels,
+		},
+		[]string{"from_addr", "to_addr", "result"},
+	)
+
+	shadowed := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "redis",
+			Subsystem:   subsystem,
+			Name:        "shadow_requests_total",
+			Help:        "Total number of requests mirrored to shadow servers by reverse proxies.",
+			ConstLabels: labels,
+		},
+		[]string{"cmd", "result"},
+	)
+
+	limited := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "redis",
+			Subsystem:   subsystem,
+			Name:        "rate_limited_requests_total",
+			Help:        "Total number of requests limited by rate limiters.",
+			ConstLabels: labels,
+		},
+		[]string{"by", "action"},
+	)
+
+	cached := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "redis",
+			Subsystem:   subsystem,
+			Name:        "client_cache_events_total",
+			Help:        "Total number of hits, misses, invalidations and flushes of client-side caches.",
+			ConstLabels: labels,
+		},
+		[]string{"event"},
+	)
+
 	return &Monitor{
-		dialer: dialer,
-		server: NewServerMatrix(subsystem, labels),
+		dialer:   dialer,
+		scanned:  scanned,
+		migrated: migrated,
+		shadowed: shadowed,
+		limited:  limited,
+		cached:   cached,
+		server:   NewServerMatrix(subsystem, labels),
 	}
 }
 
 // Describe implements prometheus Collector interface.
 func (m *Monitor) Describe(in chan<- *prometheus.Desc) {
 	m.dialer.Describe(in)
+	m.scanned.Describe(in)
+	m.migrated.Describe(in)
+	m.shadowed.Describe(in)
+	m.limited.Describe(in)
+	m.cached.Describe(in)
 	m.server.Describe(in)
 }
 
 // Collect implements prometheus Collector interface.
 func (m *Monitor) Collect(in chan<- prometheus.Metric) {
 	m.dialer.Collect(in)
+	m.scanned.Collect(in)
+	m.migrated.Collect(in)
+	m.shadowed.Collect(in)
+	m.limited.Collect(in)
+	m.cached.Collect(in)
 	m.server.Collect(in)
 }
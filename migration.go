@@ -0,0 +1,359 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Migration describes a change of the servers that a ReverseProxy routes
+// requests to, for example the addition of a server to a ServerList, during
+// which keys are moved from their old owners to their new ones.
+//
+// While a migration is set on a proxy, keys are looked up on the rings of both
+// the old (From) and new (ReverseProxy.Registry) servers:
+//
+//   - writes are sent to the new owners of keys, keys which moved are migrated
+//     before so writes never apply to missing or stale values
+//   - reads are sent to the new owners of keys, falling back to the old owners
+//     for keys which were not migrated yet, or migrating them first when
+//     CopyOnRead is true
+//
+// The proxy also runs a background migrator which SCANs the old servers and
+// moves the keys whose owner changed. Keys are moved with DUMP and RESTORE, a
+// key which already exists on its new owner is never overwritten.
+//
+// Migrations are safe for concurrent use by multiple goroutines.
+type Migration struct {
+	// From exposes the servers before the change. Its rings must implement
+	// EndpointRing for the background migrator to know the servers to scan.
+	From ServerRegistry
+
+	// CopyOnRead, when true, migrates the keys read by the proxy which were
+	// not migrated yet, instead of reading them from their old owner.
+	CopyOnRead bool
+
+	// ScanCount is the COUNT hint of the SCAN commands sent by the background
+	// migrator. Zero means 100.
+	ScanCount int
+
+	// ErrorLog specifies an optional logger for errors of the background
+	// migrator. If nil, errors are not logged.
+	ErrorLog Logger
+
+	once      sync.Once
+	startOnce sync.Once
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	err       error
+	scanned   int64
+	moved     int64
+	failed    int64
+}
+
+// MigrationProgress reports the progress of a Migration.
+type MigrationProgress struct {
+	// Scanned is the number of keys scanned by the background migrator.
+	Scanned int64
+
+	// Moved is the number of keys moved to their new owner, by the background
+	// migrator or the proxy.
+	Moved int64
+
+	// Failed is the number of keys which could not be moved.
+	Failed int64
+
+	// Done is true when the background migrator scanned all the old servers,
+	// Err is the error that stopped it, if any.
+	Done bool
+	Err  error
+}
+
+// Progress returns the progress of the migration.
+func (m *Migration) Progress() MigrationProgress {
+	m.once.Do(m.init)
+
+	progress := MigrationProgress{
+		Scanned: atomic.LoadInt64(&m.scanned),
+		Moved:   atomic.LoadInt64(&m.moved),
+		Failed:  atomic.LoadInt64(&m.failed),
+	}
+
+	select {
+	case <-m.done:
+		progress.Done, progress.Err = true, m.err
+	default:
+	}
+
+	return progress
+}
+
+// Done returns a channel which is closed when the background migrator
+// completed.
+func (m *Migration) Done() <-chan struct{} {
+	m.once.Do(m.init)
+	return m.done
+}
+
+// Close stops the background migrator, or prevents it from starting.
+func (m *Migration) Close() error {
+	m.once.Do(m.init)
+	m.cancel()
+	m.startOnce.Do(func() {
+		m.err = context.Canceled
+		close(m.done)
+	})
+	return nil
+}
+
+func (m *Migration) init() {
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.done = make(chan struct{})
+}
+
+// start runs the background migrator to the servers of registry, once.
+func (m *Migration) start(registry ServerRegistry, transport RoundTripper) {
+	m.once.Do(m.init)
+	m.startOnce.Do(func() {
+		go func() {
+			err := m.migrate(m.ctx, registry, transport)
+
+			if err != nil && m.ErrorLog != nil {
+				m.ErrorLog.Print(err)
+			}
+
+			m.err = err
+			close(m.done)
+		}()
+	})
+}
+
+// route returns the address of the server that a request for keys must be
+// sent to, migrating the keys that need to be. keys must all be hashed to the
+// same server of the new ring, moved is true if some of them changed owner.
+func (m *Migration) route(ctx context.Context, transport RoundTripper, ring ServerRing, keys []string, readOnly bool) (addr string, moved bool, err error) {
+	addr = ring.LookupServer(keys[0]).Addr
+
+	// All the keys were moved by the background migrator, the old servers
+	// don't need to be checked anymore.
+	if m.complete() {
+		return
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	oldRing, err := m.From.LookupServers(ctx)
+	if err != nil {
+		return
+	}
+
+	var (
+		oldAddrs  []string
+		movedKeys []string
+	)
+
+	for _, key := range keys {
+		if oldAddr := oldRing.LookupServer(key).Addr; oldAddr != addr {
+			oldAddrs = append(oldAddrs, oldAddr)
+			movedKeys = append(movedKeys, key)
+		}
+	}
+
+	if moved = len(movedKeys) != 0; !moved {
+		return
+	}
+
+	if readOnly && !m.CopyOnRead {
+		var missing int
+
+		for _, key := range movedKeys {
+			var exists int
+			if err = ParseArgs(m.client(addr, transport).Query(ctx, "EXISTS", key), &exists); err != nil {
+				return
+			}
+			if exists == 0 {
+				missing++
+			}
+		}
+
+		if missing == 0 {
+			return
+		}
+
+		// When all the keys are missing on the new owner and have the same old
+		// owner the request is served by the old owner, otherwise the missing
+		// keys are migrated so the request sees all of them.
+		if missing == len(keys) && sameStrings(oldAddrs) {
+			addr = oldAddrs[0]
+			return
+		}
+	}
+
+	for i, key := range movedKeys {
+		if err = m.move(ctx, transport, key, oldAddrs[i], addr); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// complete returns true if the background migrator completed and moved all the
+// keys whose owner changed.
+func (m *Migration) complete() bool {
+	select {
+	case <-m.done:
+		return m.err == nil && atomic.LoadInt64(&m.failed) == 0
+	default:
+		return false
+	}
+}
+
+// migrate scans the old servers and moves the keys whose owner changed to the
+// servers of registry.
+func (m *Migration) migrate(ctx context.Context, registry ServerRegistry, transport RoundTripper) error {
+	oldRing, err := m.From.LookupServers(ctx)
+	if err != nil {
+		return err
+	}
+
+	list, ok := oldRing.(EndpointRing)
+	if !ok {
+		return errors.New("redis: the old servers of the migration cannot be listed, their ring doesn't implement EndpointRing")
+	}
+
+	for _, endpoint := range list.Endpoints() {
+		if endpoint.IsReplica() {
+			continue // replicas have the keys of their primary
+		}
+
+		if err := m.scan(ctx, registry, transport, endpoint.Addr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Migration) scan(ctx context.Context, registry ServerRegistry, transport RoundTripper, from string) error {
+	count := m.ScanCount
+	if count <= 0 {
+		count = 100
+	}
+
+	cursor := "0"
+
+	for {
+		var keys []string
+
+		if err := ParseArgs(m.client(from, transport).Query(ctx, "SCAN", cursor, "COUNT", count), &cursor, &keys); err != nil {
+			return err
+		}
+
+		atomic.AddInt64(&m.scanned, int64(len(keys)))
+		gometrics.IncScannedKeys(from, len(keys))
+
+		// The registry is looked up for each batch to follow its changes.
+		ring, err := registry.LookupServers(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			if to := ring.LookupServer(key).Addr; to != from {
+				// Failures are counted and the key is moved when it is
+				// accessed, it doesn't stop the migration.
+				m.move(ctx, transport, key, from, to)
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// move moves key from the server at address from to the server at address to.
+func (m *Migration) move(ctx context.Context, transport RoundTripper, key string, from string, to string) (err error) {
+	moved := false
+
+	defer func() {
+		switch {
+		case err != nil:
+			atomic.AddInt64(&m.failed, 1)
+			gometrics.IncMigratedKeys(from, to, "failed")
+		case moved:
+			atomic.AddInt64(&m.moved, 1)
+			gometrics.IncMigratedKeys(from, to, "moved")
+		}
+	}()
+
+	var (
+		payload []byte
+		ttl     int64
+	)
+
+	src := m.client(from, transport)
+
+	if err = ParseArgs(src.Query(ctx, "DUMP", key), &payload); err != nil {
+		return
+	}
+
+	if payload == nil {
+		return // the key doesn't exist or was already moved
+	}
+
+	if err = ParseArgs(src.Query(ctx, "PTTL", key), &ttl); err != nil {
+		return
+	}
+
+	switch {
+	case ttl == -2:
+		return // the key expired
+	case ttl < 0:
+		ttl = 0
+	}
+
+	var (
+		status  string
+		deleted int
+	)
+
+	err = ParseArgs(m.client(to, transport).Query(ctx, "RESTORE", key, strconv.FormatInt(ttl, 10), payload), &status)
+
+	// The key was written to its new owner since the migration started, the
+	// new value wins.
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYKEY") {
+		return
+	}
+
+	if err = ParseArgs(src.Query(ctx, "DEL", key), &deleted); err != nil {
+		return
+	}
+
+	moved = true
+	return
+}
+
+func (m *Migration) client(addr string, transport RoundTripper) *Client {
+	return &Client{Addr: addr, Transport: transport}
+}
+
+func sameStrings(list []string) bool {
+	for _, s := range list[1:] {
+		if s != list[0] {
+			return false
+		}
+	}
+	return true
+}
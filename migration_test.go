@@ -0,0 +1,433 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dolab/objconv/resp"
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+// fakeStore is a redis.Handler implementing the subset of the string commands
+// and of the keyspace commands used by migrations.
+type fakeStore struct {
+	mutex     sync.Mutex
+	data      map[string]string
+	published []string
+	calls     map[string]int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{data: map[string]string{}, calls: map[string]int{}}
+}
+
+// count returns the number of cmd commands served by the store.
+func (s *fakeStore) count(cmd string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.calls[cmd]
+}
+
+func (s *fakeStore) get(key string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	value, ok := s.data[key]
+	return value, ok
+}
+
+func (s *fakeStore) set(key string, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.data[key] = value
+}
+
+func (s *fakeStore) ServeRedis(res redis.ResponseWriter, req *redis.Request) {
+	var args []string
+	req.Cmds[0].ParseArgs(&args)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.calls[req.Cmds[0].Cmd]++
+
+	switch req.Cmds[0].Cmd {
+	case "GET":
+		if value, ok := s.data[args[0]]; ok {
+			res.Write(value)
+		} else {
+			res.Write(nil)
+		}
+
+	case "SET":
+		s.data[args[0]] = args[1]
+		res.Write("OK")
+
+	case "DEL", "EXISTS":
+		n := 0
+		for _, key := range args {
+			if _, ok := s.data[key]; ok {
+				n++
+				if req.Cmds[0].Cmd == "DEL" {
+					delete(s.data, key)
+				}
+			}
+		}
+		res.Write(n)
+
+	case "DUMP":
+		if value, ok := s.data[args[0]]; ok {
+			res.Write([]byte("dump:" + value))
+		} else {
+			res.Write(nil)
+		}
+
+	case "PTTL":
+		if _, ok := s.data[args[0]]; ok {
+			res.Write(-1)
+		} else {
+			res.Write(-2)
+		}
+
+	case "RESTORE":
+		if _, ok := s.data[args[0]]; ok {
+			res.Write(resp.NewError("BUSYKEY Target key name already exists."))
+			return
+		}
+		s.data[args[0]] = strings.TrimPrefix(args[2], "dump:")
+		res.Write("OK")
+
+	case "KEYS":
+		keys := []string{}
+		for key := range s.data {
+			if ok, _ := path.Match(args[0], key); ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		res.Write(keys)
+
+	case "RANDOMKEY":
+		var min interface{}
+		for key := range s.data {
+			if min == nil || key < min.(string) {
+				min = key
+			}
+		}
+		res.Write(min)
+
+	case "PUBLISH":
+		s.published = append(s.published, args[0])
+		res.Write(0)
+
+	case "SCAN":
+		// Returns a single key per page, the cursor is the last key returned
+		// so that deleting keys during the scan doesn't skip any.
+		match := "*"
+		if len(args) == 3 && args[1] == "MATCH" {
+			match = args[2]
+		}
+
+		keys := make([]string, 0, len(s.data))
+		for key := range s.data {
+			if ok, _ := path.Match(match, key); ok && (args[0] == "0" || key > args[0]) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		switch len(keys) {
+		case 0:
+			res.Write([]interface{}{"0", []string{}})
+		case 1:
+			res.Write([]interface{}{"0", keys})
+		default:
+			res.Write([]interface{}{keys[0], keys[:1]})
+		}
+
+	default:
+		res.Write(resp.NewError("ERR unknown command " + req.Cmds[0].Cmd))
+	}
+}
+
+type migrationTest struct {
+	stores  map[string]*fakeStore
+	oldRing redis.ServerRing
+	newRing redis.ServerRing
+	keys    []string
+	moved   []string
+	client  *redis.Client
+	proxy   *redis.ReverseProxy
+}
+
+func TestMigration(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, *migrationTest)
+	}{
+		{
+			scenario: "the background migrator moves the keys whose owner changed",
+			function: testMigrationBackground,
+		},
+		{
+			scenario: "reads of keys which were not migrated are served by their old owner",
+			function: testMigrationReadFallback,
+		},
+		{
+			scenario: "reads of keys which were not migrated copy them when CopyOnRead is enabled",
+			function: testMigrationCopyOnRead,
+		},
+		{
+			scenario: "writes are sent to the new owner after migrating the keys",
+			function: testMigrationWrites,
+		},
+		{
+			scenario: "keys written to their new owner are not overwritten by the migrator",
+			function: testMigrationBusyKeys,
+		},
+		{
+			scenario: "requests don't check the old owners of keys once the migration completed",
+			function: testMigrationComplete,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			var (
+				stores    = map[string]*fakeStore{}
+				endpoints redis.ServerList
+			)
+
+			for i := 0; i != 3; i++ {
+				store := newFakeStore()
+				srv, addr := redistest.FakeServer(store)
+				defer srv.Close()
+
+				stores[addr] = store
+				endpoints = append(endpoints, redis.ServerEndpoint{Addr: addr})
+			}
+
+			// The weight of the new server scatters its nodes on the ring, so
+			// some keys are guaranteed to move.
+			endpoints[2].Weight = 4
+			oldServers, newServers := endpoints[:2], endpoints
+			oldRing, _ := oldServers.LookupServers(ctx)
+			newRing, _ := newServers.LookupServers(ctx)
+
+			test := &migrationTest{
+				stores:  stores,
+				oldRing: oldRing,
+				newRing: newRing,
+			}
+
+			for i := 0; i != 100; i++ {
+				key := fmt.Sprintf("key-%02d", i)
+				stores[oldRing.LookupServer(key).Addr].set(key, "value-"+key)
+
+				test.keys = append(test.keys, key)
+
+				if oldRing.LookupServer(key).Addr != newRing.LookupServer(key).Addr {
+					test.moved = append(test.moved, key)
+				}
+			}
+
+			if len(test.moved) < 2 {
+				t.Fatal("not enough keys changed owner")
+			}
+
+			transport := &redis.Transport{}
+			defer transport.CloseIdleConnections()
+
+			test.proxy = &redis.ReverseProxy{
+				Transport: transport,
+				Registry:  newServers,
+				Migration: &redis.Migration{From: oldServers},
+			}
+			defer test.proxy.Migration.Close()
+
+			proxy, proxyAddr := redistest.FakeServer(test.proxy)
+			defer proxy.Close()
+
+			test.client = &redis.Client{Addr: proxyAddr, Transport: transport}
+
+			testFunc(t, ctx, test)
+		})
+	}
+}
+
+func (test *migrationTest) owner(key string, ring redis.ServerRing) *fakeStore {
+	return test.stores[ring.LookupServer(key).Addr]
+}
+
+func (test *migrationTest) get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := redis.ParseArgs(test.client.Query(ctx, "GET", key), &value)
+	return value, err
+}
+
+func testMigrationBackground(t *testing.T, ctx context.Context, test *migrationTest) {
+	it := assert.New(t)
+
+	// the migrator is started by the first request
+	value, err := test.get(ctx, test.keys[0])
+	it.Nil(err)
+	it.Equal("value-"+test.keys[0], value)
+
+	select {
+	case <-test.proxy.Migration.Done():
+	case <-ctx.Done():
+		t.Fatal("the migration never completed")
+	}
+
+	progress := test.proxy.Migration.Progress()
+	it.True(progress.Done)
+	it.Nil(progress.Err)
+	it.Equal(int64(0), progress.Failed)
+	it.Equal(int64(len(test.moved)), progress.Moved)
+	it.True(progress.Scanned >= int64(len(test.keys)))
+
+	for _, key := range test.keys {
+		value, ok := test.owner(key, test.newRing).get(key)
+		it.True(ok, key)
+		it.Equal("value-"+key, value)
+	}
+
+	for _, key := range test.moved {
+		_, ok := test.owner(key, test.oldRing).get(key)
+		it.False(ok, key)
+	}
+}
+
+func testMigrationReadFallback(t *testing.T, ctx context.Context, test *migrationTest) {
+	it := assert.New(t)
+
+	test.proxy.Migration.Close() // prevents the migrator from starting
+
+	for _, key := range test.moved {
+		value, err := test.get(ctx, key)
+		it.Nil(err)
+		it.Equal("value-"+key, value)
+
+		_, ok := test.owner(key, test.oldRing).get(key)
+		it.True(ok, "the key stays on its old owner")
+	}
+
+	it.Equal(int64(0), test.proxy.Migration.Progress().Moved)
+}
+
+func testMigrationCopyOnRead(t *testing.T, ctx context.Context, test *migrationTest) {
+	it := assert.New(t)
+
+	test.proxy.Migration.CopyOnRead = true
+	test.proxy.Migration.Close()
+
+	for _, key := range test.moved {
+		value, err := test.get(ctx, key)
+		it.Nil(err)
+		it.Equal("value-"+key, value)
+
+		_, ok := test.owner(key, test.oldRing).get(key)
+		it.False(ok, "the key was removed from its old owner")
+
+		value, _ = test.owner(key, test.newRing).get(key)
+		it.Equal("value-"+key, value)
+	}
+
+	it.Equal(int64(len(test.moved)), test.proxy.Migration.Progress().Moved)
+}
+
+func testMigrationWrites(t *testing.T, ctx context.Context, test *migrationTest) {
+	it := assert.New(t)
+
+	test.proxy.Migration.Close()
+
+	key := test.moved[0]
+
+	it.Nil(test.client.Exec(ctx, "SET", key, "updated"))
+
+	value, _ := test.owner(key, test.newRing).get(key)
+	it.Equal("updated", value)
+
+	_, ok := test.owner(key, test.oldRing).get(key)
+	it.False(ok, "the key was removed from its old owner")
+
+	// deleted keys must not be read from their old owner
+	var n int
+	it.Nil(redis.ParseArgs(test.client.Query(ctx, "DEL", test.moved[1]), &n))
+	it.Equal(1, n)
+
+	var values []interface{}
+	it.Nil(redis.ParseArgs(test.client.Query(ctx, "GET", test.moved[1]), &values))
+	it.Equal(0, len(values))
+}
+
+func testMigrationBusyKeys(t *testing.T, ctx context.Context, test *migrationTest) {
+	it := assert.New(t)
+
+	key := test.moved[0]
+	test.owner(key, test.newRing).set(key, "fresh")
+
+	// starts the migrator
+	it.Nil(test.client.Exec(ctx, "SET", "other-key", "value"))
+
+	select {
+	case <-test.proxy.Migration.Done():
+	case <-ctx.Done():
+		t.Fatal("the migration never completed")
+	}
+
+	value, _ := test.owner(key, test.newRing).get(key)
+	it.Equal("fresh", value)
+
+	_, ok := test.owner(key, test.oldRing).get(key)
+	it.False(ok)
+}
+
+func testMigrationComplete(t *testing.T, ctx context.Context, test *migrationTest) {
+	it := assert.New(t)
+
+	_, err := test.get(ctx, test.keys[0])
+	it.Nil(err)
+
+	select {
+	case <-test.proxy.Migration.Done():
+	case <-ctx.Done():
+		t.Fatal("the migration never completed")
+	}
+
+	count := func() (n int) {
+		for _, store := range test.stores {
+			n += store.count("EXISTS") + store.count("DUMP")
+		}
+		return
+	}
+
+	before := count()
+
+	for _, key := range test.moved {
+		value, err := test.get(ctx, key)
+		it.Nil(err)
+		it.Equal("value-"+key, value)
+
+		it.Nil(test.client.Exec(ctx, "SET", key, "new-"+key))
+	}
+
+	it.Equal(before, count())
+}
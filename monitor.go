@@ -0,0 +1,329 @@
+package redis
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMonitorBufferSize is the default number of commands buffered for each
+// client of MONITOR.
+const DefaultMonitorBufferSize = 1024
+
+// CommandEvent describes a command served by a server, it is passed to the
+// Observer of the server.
+type CommandEvent struct {
+	// Time is the time at which the request of the command was received.
+	Time time.Time
+
+	// Addr is the address of the client, and User the user it authenticated
+	// as, which is empty if the authentication is not enabled.
+	Addr string
+	User string
+
+	// DB is the database of the command, always 0 since servers don't
+	// support SELECT.
+	DB int
+
+	// Cmd is the name of the command, and Args its arguments. The arguments
+	// of AUTH and HELLO are redacted.
+	Cmd  string
+	Args []string
+
+	// Duration is the time it took to serve the request of the command, and
+	// Err the first error that the server answered the request with, or the
+	// error that interrupted it. The commands of transactions share the
+	// duration and the error of the transaction.
+	Duration time.Duration
+	Err      error
+}
+
+// A CommandObserver receives the commands served by a server, it can be used to
+// write audit logs.
+type CommandObserver interface {
+	// ObserveCommand is called by the goroutines serving the connections of
+	// the server after each command, it must not block.
+	ObserveCommand(CommandEvent)
+}
+
+// The CommandObserverFunc type is an adapter to allow the use of ordinary
+// functions as command observers.
+type CommandObserverFunc func(CommandEvent)
+
+// ObserveCommand implements the CommandObserver interface, calling fn.
+func (fn CommandObserverFunc) ObserveCommand(e CommandEvent) {
+	fn(e)
+}
+
+// connFeed is a bounded queue of messages sent to a connection by other
+// goroutines, like the commands sent to monitors or the messages sent to
+// subscribers.
+type connFeed struct {
+	conn  *Conn
+	lines chan []byte
+	once  sync.Once
+	done  chan struct{}
+}
+
+func newConnFeed(c *Conn, size int) *connFeed {
+	return &connFeed{
+		conn:  c,
+		lines: make(chan []byte, size),
+		done:  make(chan struct{}),
+	}
+}
+
+// feed queues line to be sent to the connection, which is disconnected if it
+// doesn't keep up.
+func (f *connFeed) feed(line []byte) {
+	select {
+	case f.lines <- line:
+	default:
+		f.close()
+	}
+}
+
+// close stops the feed, the connection is closed to unblock the writes in
+// progress.
+func (f *connFeed) close() {
+	f.once.Do(func() {
+		close(f.done)
+		f.conn.Close()
+	})
+}
+
+// write sends line and the other queued lines to the connection.
+func (f *connFeed) write(line []byte, timeout time.Duration) error {
+	c := f.conn
+
+	c.wmutex.Lock()
+	defer c.wmutex.Unlock()
+
+	c.setWriteTimeout(timeout)
+	c.wbuffer.Write(line)
+
+	for n := len(f.lines); n != 0; n-- {
+		c.wbuffer.Write(<-f.lines)
+	}
+
+	return c.wbuffer.Flush()
+}
+
+// monitor answers MONITOR, the connection switches to MONITOR mode after the
+// response.
+func (s *Server) monitor(c *Conn, cmd Command) interface{} {
+	if err := cmd.ParseArgs(); err != nil {
+		return err
+	}
+
+	c.client.mutex.Lock()
+	c.client.monitor = true
+	c.client.mutex.Unlock()
+	return "OK"
+}
+
+func (c *Conn) monitoring() bool {
+	c.client.mutex.Lock()
+	defer c.client.mutex.Unlock()
+	return c.client.monitor
+}
+
+// serveMonitor sends the commands served by the other connections of the
+// server to c until it disconnects.
+func (s *Server) serveMonitor(ctx context.Context, c *Conn, config serverConfig) {
+	size := s.MonitorBufferSize
+	if size <= 0 {
+		size = DefaultMonitorBufferSize
+	}
+
+	m := newConnFeed(c, size)
+
+	s.addMonitor(m)
+	defer s.removeMonitor(m)
+
+	go func() {
+		// Monitors can't send commands anymore, their input is discarded
+		// until they disconnect.
+		c.setReadTimeout(0)
+		io.Copy(ioutil.Discard, &c.rbuffer)
+		m.close()
+	}()
+
+	for {
+		select {
+		case line := <-m.lines:
+			if err := m.write(line, config.writeTimeout); err != nil {
+				return
+			}
+
+		case <-m.done:
+			return
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Server) addMonitor(m *connFeed) {
+	s.mutex.Lock()
+
+	if s.monitors == nil {
+		s.monitors = map[*connFeed]struct{}{}
+	}
+
+	s.monitors[m] = struct{}{}
+	atomic.StoreInt32(&s.nmonitors, int32(len(s.monitors)))
+	s.mutex.Unlock()
+}
+
+func (s *Server) removeMonitor(m *connFeed) {
+	s.mutex.Lock()
+	delete(s.monitors, m)
+	atomic.StoreInt32(&s.nmonitors, int32(len(s.monitors)))
+	s.mutex.Unlock()
+}
+
+// observed returns true if the commands served must be passed to monitors or
+// to the observer of the server.
+func (s *Server) observed() bool {
+	return s.Observer != nil || atomic.LoadInt32(&s.nmonitors) != 0
+}
+
+// feedMonitors sends the commands cmds received from c at t to the monitors of
+// the server.
+func (s *Server) feedMonitors(c *Conn, t time.Time, cmds []Command, argv [][]string) {
+	if atomic.LoadInt32(&s.nmonitors) == 0 {
+		return
+	}
+
+	addr := c.RemoteAddr().String()
+	lines := make([][]byte, len(cmds))
+
+	for i, cmd := range cmds {
+		lines[i] = formatMonitorLine(t, addr, cmd.Cmd, argv[i])
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for m := range s.monitors {
+		if m.conn == c {
+			continue
+		}
+
+		for _, line := range lines {
+			m.feed(line)
+		}
+	}
+}
+
+// observeCommands passes the commands served to the observer of the server.
+func (s *Server) observeCommands(c *Conn, addr string, t time.Time, cmds []string, argv [][]string, d time.Duration, err error) {
+	if s.Observer == nil {
+		return
+	}
+
+	for i, cmd := range cmds {
+		s.Observer.ObserveCommand(CommandEvent{
+			Time:     t,
+			Addr:     addr,
+			User:     c.user,
+			Cmd:      cmd,
+			Args:     argv[i],
+			Duration: d,
+			Err:      err,
+		})
+	}
+}
+
+// observeArgs loads the arguments of cmds in memory and returns them, with the
+// arguments of AUTH and HELLO redacted.
+func observeArgs(cmds []Command) [][]string {
+	argv := make([][]string, len(cmds))
+
+	for i := range cmds {
+		cmds[i].loadByteArgs()
+
+		args, _ := cmds[i].Args.(*byteArgs)
+		if args == nil {
+			continue
+		}
+
+		redacted := false
+		switch strings.ToUpper(cmds[i].Cmd) {
+		case "AUTH", "HELLO":
+			redacted = true
+		}
+
+		argv[i] = make([]string, len(args.args))
+
+		for j, arg := range args.args {
+			if redacted {
+				argv[i][j] = "(redacted)"
+			} else {
+				argv[i][j] = string(arg)
+			}
+		}
+	}
+
+	return argv
+}
+
+// formatMonitorLine returns the line describing a command in the format of
+// MONITOR.
+func formatMonitorLine(t time.Time, addr string, cmd string, args []string) []byte {
+	b := make([]byte, 0, 64)
+	b = append(b, '+')
+	b = strconv.AppendInt(b, t.Unix(), 10)
+	b = append(b, '.')
+	b = append(b, strconv.Itoa(1000000 + t.Nanosecond()/1000)[1:]...)
+	b = append(b, " [0 "...)
+	b = append(b, addr...)
+	b = append(b, ']', ' ')
+	b = appendQuoted(b, cmd)
+
+	for _, arg := range args {
+		b = append(b, ' ')
+		b = appendQuoted(b, arg)
+	}
+
+	return append(b, '\r', '\n')
+}
+
+// appendQuoted appends s to b, quoted and escaped like redis does.
+func appendQuoted(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	b = append(b, '"')
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		case '\a':
+			b = append(b, '\\', 'a')
+		case '\b':
+			b = append(b, '\\', 'b')
+		default:
+			if c < ' ' || c > '~' {
+				b = append(b, '\\', 'x', hex[c>>4], hex[c&0xf])
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+
+	return append(b, '"')
+}
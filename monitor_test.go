@@ -0,0 +1,187 @@
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+)
+
+func TestServerMonitor(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, *redis.Server, string)
+	}{
+		{
+			scenario: "MONITOR streams the commands of the other connections",
+			function: testServerMonitorFeed,
+		},
+		{
+			scenario: "monitors which don't keep up are disconnected",
+			function: testServerMonitorOverflow,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			srv := &redis.Server{EnableBuiltins: true, MonitorBufferSize: 1}
+			addr := startServer(t, srv)
+			defer srv.Close()
+
+			testFunc(t, ctx, srv, addr)
+		})
+	}
+}
+
+// dialMonitor opens a connection to addr in MONITOR mode.
+func dialMonitor(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	conn.Write([]byte("*1\r\n$7\r\nMONITOR\r\n"))
+
+	r := bufio.NewReader(conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line == "+OK\r\n" {
+			return conn, r
+		}
+	}
+}
+
+func testServerMonitorFeed(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	mon, r := dialMonitor(t, addr)
+	defer mon.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var name string
+	it.Nil(conn.query(&name, "SET", "key", "va\"l\n\x01"))
+
+	line, err := r.ReadString('\n')
+	if it.Nil(err) {
+		it.True(regexp.MustCompile(`^\+\d+\.\d{6} \[0 127\.0\.0\.1:\d+\] "SET" "key" "va\\"l\\n\\x01"\r\n$`).MatchString(line), line)
+		it.Contains(line, conn.LocalAddr().String())
+	}
+
+	var list string
+	it.Nil(conn.query(&list, "CLIENT", "LIST"))
+	it.Contains(list, " flags=O ")
+
+	line, err = r.ReadString('\n')
+	if it.Nil(err) {
+		it.True(strings.HasSuffix(line, `"CLIENT" "LIST"`+"\r\n"), line)
+	}
+}
+
+func testServerMonitorOverflow(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	mon, _ := dialMonitor(t, addr)
+	defer mon.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	// The monitor doesn't read the commands, which fill the buffers of the
+	// connection until the server gives up.
+	value := strings.Repeat("v", 1<<20)
+
+	for len(srv.Connections()) == 2 {
+		var name string
+		if !it.Nil(conn.query(&name, "SET", "key", value)) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Error("the monitor was not disconnected")
+			return
+		default:
+		}
+	}
+
+	it.Equal(1, len(srv.Connections()))
+}
+
+func TestServerObserver(t *testing.T) {
+	it := assert.New(t)
+
+	var (
+		mutex  sync.Mutex
+		events []redis.CommandEvent
+	)
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(w redis.ResponseWriter, r *redis.Request) {
+			if r.Cmds[0].Cmd == "DEL" {
+				w.Write(errors.New("ERR failed"))
+				return
+			}
+			echoHandler.ServeRedis(w, r)
+		}),
+		Authenticate: func(user string, password string) error { return nil },
+		Observer: redis.CommandObserverFunc(func(e redis.CommandEvent) {
+			mutex.Lock()
+			events = append(events, e)
+			mutex.Unlock()
+		}),
+	}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	conn := dialAuthConn(t, addr, "alice")
+	defer conn.Close()
+
+	var name string
+	it.Nil(conn.query(&name, "SET", "key", "value"))
+	it.NotNil(conn.query(&name, "DEL", "key"))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !it.Equal(3, len(events)) {
+		return
+	}
+
+	it.Equal("AUTH", events[0].Cmd)
+	it.Equal([]string{"(redacted)", "(redacted)"}, events[0].Args)
+
+	it.Equal("SET", events[1].Cmd)
+	it.Equal([]string{"key", "value"}, events[1].Args)
+	it.Equal("alice", events[1].User)
+	it.Equal(conn.LocalAddr().String(), events[1].Addr)
+	it.False(events[1].Time.IsZero())
+	it.Nil(events[1].Err)
+
+	it.Equal("DEL", events[2].Cmd)
+	if it.NotNil(events[2].Err) {
+		it.Equal("ERR failed", events[2].Err.Error())
+	}
+}
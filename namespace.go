@@ -0,0 +1,358 @@
+package redis
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Namespace isolates the keys of tenants sharing the servers of a ReverseProxy
+// by prefixing them.
+//
+// The tenant of a request is chosen by the user that its connection
+// authenticated as (see Server.Authenticate), or by the address of the listener
+// that its connection arrived on. Requests of connections which have no
+// tenant are rejected.
+//
+// Keys are found at the positions given by the command spec, and at the
+// positions described by the arguments of the commands with movable keys
+// (SORT, XREAD, XREADGROUP, ZINTERSTORE and ZUNIONSTORE). The
+// patterns of KEYS, SCAN and PUBSUB CHANNELS are restricted to the prefix, and
+// the names of Pub/Sub channels are prefixed as well. Prefixes are stripped
+// from the keys and channels of replies, a key returned by RANDOMKEY which
+// belongs to another tenant is replaced by nil.
+//
+// Commands which can escape a namespace are rejected, like administrative
+// commands, FLUSHALL, FLUSHDB, SELECT or MIGRATE. Lua scripts are rejected as
+// well since they can access any key, EVAL, EVALSHA and SCRIPT are not
+// available in namespaces.
+type Namespace struct {
+	// Users maps the names of authenticated users to the prefixes of their
+	// keys.
+	Users map[string]string
+
+	// Listeners maps the addresses of listeners to the prefixes of the keys of
+	// the requests they receive. Addresses are matched as host:port, then as
+	// :port to match listeners bound to all interfaces.
+	Listeners map[string]string
+}
+
+// namespaceRejected is the set of commands which cannot be used in a
+// namespace, in addition to the administrative commands.
+var namespaceRejected = map[string]bool{
+	"EVAL":     true,
+	"EVALSHA":  true,
+	"FLUSHALL": true,
+	"FLUSHDB":  true,
+	"MIGRATE":  true,
+	"MOVE":     true,
+	"SCRIPT":   true,
+	"SELECT":   true,
+	"SWAPDB":   true,
+}
+
+// namespaceRequest strips the prefix of a namespace from the replies to the
+// commands of a request.
+type namespaceRequest struct {
+	prefix string
+	cmds   []string
+}
+
+// rewrite prefixes the keys of the commands of req, the returned value strips
+// the prefix from their replies. Errors are *resp.Error values that can be
+// sent to clients.
+func (ns *Namespace) rewrite(req *Request) (*namespaceRequest, error) {
+	if ns == nil {
+		return nil, nil
+	}
+
+	prefix, ok := ns.lookup(req)
+	if !ok {
+		return nil, errorf("NOPERM No key namespace is configured for the connection.")
+	}
+
+	r := &namespaceRequest{
+		prefix: prefix,
+		cmds:   make([]string, len(req.Cmds)),
+	}
+
+	for i := range req.Cmds {
+		cmd := &req.Cmds[i]
+		r.cmds[i] = cmd.Cmd
+
+		info := LookupCommand(cmd.Cmd)
+		if info == nil || info.HasFlag("admin") || namespaceRejected[info.Name] {
+			return nil, errorf("NOPERM The '%s' command is not allowed in a key namespace.", strings.ToLower(cmd.Cmd))
+		}
+
+		if cmd.Args == nil {
+			continue
+		}
+
+		var (
+			args [][]byte
+			arg  []byte
+		)
+
+		for cmd.Args.Next(&arg) {
+			args = append(args, arg)
+			arg = nil
+		}
+
+		if err := cmd.Args.Close(); err != nil {
+			cmd.Args = newArgsError(err)
+			continue // the request fails when it is sent
+		}
+
+		args, err := r.rewriteArgs(info, args)
+		if err != nil {
+			return nil, err
+		}
+
+		list := make([]interface{}, len(args))
+		for j, a := range args {
+			list[j] = a
+		}
+
+		cmd.Args = newValueArgs(list)
+	}
+
+	return r, nil
+}
+
+func (ns *Namespace) lookup(req *Request) (string, bool) {
+	if req.Context == nil {
+		return "", false
+	}
+
+	if user, ok := req.Context.Value(UserContextKey).(string); ok {
+		if prefix, ok := ns.Users[user]; ok {
+			return prefix, true
+		}
+	}
+
+	if addr, ok := req.Context.Value(LocalAddrContextKey).(net.Addr); ok {
+		if prefix, ok := ns.Listeners[addr.String()]; ok {
+			return prefix, true
+		}
+
+		if _, port, err := net.SplitHostPort(addr.String()); err == nil {
+			if prefix, ok := ns.Listeners[":"+port]; ok {
+				return prefix, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// rewriteArgs prefixes the keys, channels and patterns found in the arguments
+// of a command.
+func (r *namespaceRequest) rewriteArgs(info *CommandInfo, args [][]byte) ([][]byte, error) {
+	prefixKeys := func(from int, to int) {
+		for i := from; i < to && i < len(args); i++ {
+			args[i] = r.prefixKey(args[i])
+		}
+	}
+
+	switch info.Name {
+	case "KEYS":
+		if len(args) != 0 {
+			args[0] = r.prefixPattern(args[0])
+		}
+
+	case "SCAN":
+		args = r.rewriteMatch(args, 1)
+
+	case "ZINTERSTORE", "ZUNIONSTORE":
+		prefixKeys(0, 1)
+
+		if len(args) <= 1 {
+			return args, nil
+		}
+
+		n, err := strconv.Atoi(string(args[1]))
+		if err != nil || n < 0 {
+			return nil, errorf("ERR value is not an integer or out of range")
+		}
+
+		prefixKeys(2, 2+n)
+
+	case "XREAD", "XREADGROUP":
+		for i, a := range args {
+			if strings.EqualFold(string(a), "STREAMS") {
+				// The keys are the first half of the arguments that follow
+				// STREAMS, the second half are the IDs.
+				n := (len(args) - i - 1) / 2
+				prefixKeys(i+1, i+1+n)
+				break
+			}
+		}
+
+	case "SORT":
+		prefixKeys(0, 1)
+
+		for i := 1; i < len(args)-1; i++ {
+			switch strings.ToUpper(string(args[i])) {
+			case "STORE":
+				i++
+				args[i] = r.prefixKey(args[i])
+			case "BY", "GET":
+				i++
+				// "#" refers to the elements, patterns without "*" don't
+				// refer to keys.
+				if bytes.IndexByte(args[i], '*') >= 0 {
+					args[i] = r.prefixKey(args[i])
+				}
+			case "LIMIT":
+				i += 2
+			}
+		}
+
+	case "PUBLISH":
+		prefixKeys(0, 1)
+
+	case "SUBSCRIBE", "UNSUBSCRIBE":
+		prefixKeys(0, len(args))
+
+	case "PSUBSCRIBE", "PUNSUBSCRIBE":
+		for i := range args {
+			args[i] = r.prefixPattern(args[i])
+		}
+
+	case "PUBSUB":
+		if len(args) == 0 {
+			return args, nil
+		}
+
+		switch strings.ToUpper(string(args[0])) {
+		case "CHANNELS":
+			if len(args) == 1 {
+				args = append(args, []byte("*"))
+			}
+			args[1] = r.prefixPattern(args[1])
+		case "NUMSUB":
+			prefixKeys(1, len(args))
+		}
+
+	default:
+		for _, i := range info.KeyIndexes(len(args)) {
+			prefixKeys(i, i+1)
+		}
+	}
+
+	return args, nil
+}
+
+// rewriteMatch prefixes the MATCH pattern of a SCAN-like command whose options
+// start at index i, or restricts the command to the prefix if it has no MATCH
+// option.
+func (r *namespaceRequest) rewriteMatch(args [][]byte, i int) [][]byte {
+	for ; i < len(args)-1; i += 2 {
+		if strings.EqualFold(string(args[i]), "MATCH") {
+			args[i+1] = r.prefixPattern(args[i+1])
+			return args
+		}
+	}
+	return append(args, []byte("MATCH"), r.prefixPattern([]byte("*")))
+}
+
+func (r *namespaceRequest) prefixKey(key []byte) []byte {
+	return append([]byte(r.prefix), key...)
+}
+
+// prefixPattern prefixes a glob-style pattern, the special characters of the
+// prefix are escaped.
+func (r *namespaceRequest) prefixPattern(pattern []byte) []byte {
+	return append([]byte(r.patternPrefix()), pattern...)
+}
+
+func (r *namespaceRequest) patternPrefix() string {
+	escaped := make([]byte, 0, 2*len(r.prefix))
+
+	for i := 0; i != len(r.prefix); i++ {
+		switch c := r.prefix[i]; c {
+		case '*', '?', '[', ']', '\\':
+			escaped = append(escaped, '\\', c)
+		default:
+			escaped = append(escaped, c)
+		}
+	}
+
+	return string(escaped)
+}
+
+// strip removes the prefix from v, the value at index i of the reply to the
+// command at index cmd.
+func (r *namespaceRequest) strip(cmd int, i int, v interface{}) interface{} {
+	if r == nil || cmd >= len(r.cmds) {
+		return v
+	}
+
+	switch r.cmds[cmd] {
+	case "KEYS":
+		return r.stripValue(v, r.prefix, true)
+
+	case "RANDOMKEY":
+		return r.stripValue(v, r.prefix, false)
+
+	case "SUBSCRIBE", "UNSUBSCRIBE":
+		// the replies are the kind of the reply, the channel and the number of
+		// subscriptions
+		if i == 1 {
+			return r.stripValue(v, r.prefix, true)
+		}
+
+	case "PSUBSCRIBE", "PUNSUBSCRIBE":
+		if i == 1 {
+			return r.stripValue(v, r.patternPrefix(), true)
+		}
+
+	case "SCAN":
+		if list, ok := v.([]interface{}); ok && i == 1 {
+			for j := range list {
+				list[j] = r.stripValue(list[j], r.prefix, true)
+			}
+		}
+
+	case "BLPOP", "BRPOP", "BZPOPMIN", "BZPOPMAX":
+		if i == 0 {
+			return r.stripValue(v, r.prefix, true)
+		}
+
+	case "XREAD", "XREADGROUP":
+		if stream, ok := v.([]interface{}); ok && len(stream) != 0 {
+			stream[0] = r.stripValue(stream[0], r.prefix, true)
+		}
+
+	case "PUBSUB":
+		// CHANNELS replies with a list of channels, NUMSUB with a list of
+		// channels and numbers of subscribers.
+		return r.stripValue(v, r.prefix, true)
+	}
+
+	return v
+}
+
+// stripValue removes prefix from v if v is a string that has it. Strings that
+// don't have the prefix are returned as is if keep is true, or replaced by nil.
+func (r *namespaceRequest) stripValue(v interface{}, prefix string, keep bool) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		if bytes.HasPrefix(x, []byte(prefix)) {
+			return x[len(prefix):]
+		}
+	case string:
+		if strings.HasPrefix(x, prefix) {
+			return x[len(prefix):]
+		}
+	default:
+		return v
+	}
+
+	if keep {
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+type namespaceTest struct {
+	store *fakeStore
+	addr  string
+}
+
+// dial opens a connection to the proxy, the commands of a connection share its
+// authentication.
+func (test *namespaceTest) dial(t *testing.T) *clientConn {
+	return dialClientConn(t, test.addr)
+}
+
+// clientConn is a connection to a server, it is used by tests which depend on
+// the state of connections.
+type clientConn struct {
+	*redis.Conn
+}
+
+func dialClientConn(t *testing.T, addr string) *clientConn {
+	conn, err := redis.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &clientConn{conn}
+}
+
+// query sends a command and parses its reply into dst.
+func (c *clientConn) query(dst interface{}, cmd string, args ...interface{}) error {
+	c.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if err := c.WriteCommands(redis.Command{Cmd: cmd, Args: redis.List(args...)}); err != nil {
+		return err
+	}
+
+	return redis.ParseArgs(c.ReadArgs(), dst)
+}
+
+func TestNamespace(t *testing.T) {
+	tests := []struct {
+		scenario string
+		auth     bool
+		function func(*testing.T, context.Context, *namespaceTest)
+	}{
+		{
+			scenario: "keys are prefixed with the prefix of the listener",
+			function: testNamespaceListener,
+		},
+		{
+			scenario: "keys are prefixed with the prefix of the authenticated user",
+			auth:     true,
+			function: testNamespaceUsers,
+		},
+		{
+			scenario: "commands are rejected until the connection authenticated",
+			auth:     true,
+			function: testNamespaceAuth,
+		},
+		{
+			scenario: "keys returned by KEYS, SCAN and RANDOMKEY are restricted to the namespace",
+			function: testNamespaceReplies,
+		},
+		{
+			scenario: "commands which can escape the namespace are rejected",
+			function: testNamespaceRejected,
+		},
+		{
+			scenario: "Pub/Sub channels are prefixed",
+			function: testNamespaceChannels,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc, auth := test.function, test.auth
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			store := newFakeStore()
+
+			upstream, upstreamAddr := redistest.FakeServer(store)
+			defer upstream.Close()
+
+			transport := &redis.Transport{}
+			defer transport.CloseIdleConnections()
+
+			namespace := &redis.Namespace{
+				Users: map[string]string{
+					"alice": "alice:",
+					"bob":   "bob:",
+				},
+			}
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proxy := &redis.Server{
+				Handler: &redis.ReverseProxy{
+					Transport: transport,
+					Registry:  redis.ServerList{{Addr: upstreamAddr}},
+					Namespace: namespace,
+				},
+			}
+			proxyAddr := l.Addr().String()
+
+			// The tenant is the user of connections when the authentication is
+			// enabled, and the listener otherwise.
+			if auth {
+				proxy.Authenticate = func(user string, password string) error {
+					if password != user+"-password" {
+						return errors.New("invalid password")
+					}
+					return nil
+				}
+			} else {
+				namespace.Listeners = map[string]string{proxyAddr: "tenant:"}
+			}
+
+			go proxy.Serve(l)
+			defer proxy.Close()
+
+			testFunc(t, ctx, &namespaceTest{
+				store: store,
+				addr:  proxyAddr,
+			})
+		})
+	}
+}
+
+func testNamespaceListener(t *testing.T, ctx context.Context, test *namespaceTest) {
+	it := assert.New(t)
+
+	conn := test.dial(t)
+	defer conn.Close()
+
+	var status, value string
+
+	it.Nil(conn.query(&status, "SET", "key", "value"))
+	it.Equal("OK", status)
+
+	it.Nil(conn.query(&value, "GET", "key"))
+	it.Equal("value", value)
+
+	value, ok := test.store.get("tenant:key")
+	it.True(ok)
+	it.Equal("value", value)
+
+	_, ok = test.store.get("key")
+	it.False(ok)
+}
+
+func testNamespaceUsers(t *testing.T, ctx context.Context, test *namespaceTest) {
+	it := assert.New(t)
+
+	alice, bob := test.dial(t), test.dial(t)
+	defer alice.Close()
+	defer bob.Close()
+
+	var status string
+
+	it.Nil(alice.query(&status, "AUTH", "alice", "alice-password"))
+	it.Nil(bob.query(&status, "AUTH", "bob", "bob-password"))
+
+	it.Nil(alice.query(&status, "SET", "key", "A"))
+	it.Nil(bob.query(&status, "SET", "key", "B"))
+
+	var value string
+
+	it.Nil(alice.query(&value, "GET", "key"))
+	it.Equal("A", value)
+
+	it.Nil(bob.query(&value, "GET", "key"))
+	it.Equal("B", value)
+
+	value, _ = test.store.get("alice:key")
+	it.Equal("A", value)
+
+	value, _ = test.store.get("bob:key")
+	it.Equal("B", value)
+}
+
+func testNamespaceAuth(t *testing.T, ctx context.Context, test *namespaceTest) {
+	it := assert.New(t)
+
+	conn := test.dial(t)
+	defer conn.Close()
+
+	var value, status string
+
+	err := conn.query(&value, "GET", "key")
+	if it.NotNil(err) {
+		it.Contains(err.Error(), "NOAUTH")
+	}
+
+	err = conn.query(&status, "AUTH", "alice", "wrong")
+	if it.NotNil(err) {
+		it.Contains(err.Error(), "WRONGPASS")
+	}
+
+	// users without a namespace are rejected by the proxy
+	it.Nil(conn.query(&status, "AUTH", "carol", "carol-password"))
+
+	err = conn.query(&value, "GET", "key")
+	if it.NotNil(err) {
+		it.Contains(err.Error(), "NOPERM")
+	}
+}
+
+func testNamespaceReplies(t *testing.T, ctx context.Context, test *namespaceTest) {
+	it := assert.New(t)
+
+	test.store.set("0-other:key", "value") // the smallest key, returned by RANDOMKEY
+	test.store.set("tenant:a", "value")
+	test.store.set("tenant:b", "value")
+
+	conn := test.dial(t)
+	defer conn.Close()
+
+	var keys []string
+	it.Nil(conn.query(&keys, "KEYS", "*"))
+	it.Equal([]string{"a", "b"}, keys)
+
+	var (
+		cursor  = "0"
+		scanned []string
+	)
+
+	for {
+		var page []string
+		if !it.Nil(conn.query(&struct {
+			_      struct{} `redis:",array"`
+			Cursor *string
+			Keys   *[]string
+		}{Cursor: &cursor, Keys: &page}, "SCAN", cursor)) {
+			return
+		}
+
+		scanned = append(scanned, page...)
+
+		if cursor == "0" {
+			break
+		}
+	}
+
+	it.Equal([]string{"a", "b"}, scanned)
+
+	var key []byte
+	it.Nil(conn.query(&key, "RANDOMKEY"))
+	it.Nil(key)
+}
+
+func testNamespaceRejected(t *testing.T, ctx context.Context, test *namespaceTest) {
+	it := assert.New(t)
+
+	conn := test.dial(t)
+	defer conn.Close()
+
+	for _, cmd := range [][]interface{}{
+		{"FLUSHALL"},
+		{"SCRIPT", "FLUSH"},
+		{"EVAL", "return redis.call('keys', '*')", 0},
+		{"EVALSHA", "0123456789abcdef0123456789abcdef01234567", 0},
+		{"CONFIG", "GET", "*"},
+		{"SELECT", "1"},
+	} {
+		var status string
+
+		err := conn.query(&status, cmd[0].(string), cmd[1:]...)
+		if it.NotNil(err, cmd[0]) {
+			it.Contains(err.Error(), "NOPERM")
+		}
+	}
+}
+
+func testNamespaceChannels(t *testing.T, ctx context.Context, test *namespaceTest) {
+	it := assert.New(t)
+
+	conn := test.dial(t)
+	defer conn.Close()
+
+	var n int
+	it.Nil(conn.query(&n, "PUBLISH", "channel", "message"))
+
+	test.store.mutex.Lock()
+	it.Equal([]string{"tenant:channel"}, test.store.published)
+	test.store.mutex.Unlock()
+}
@@ -0,0 +1,231 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NotifyFlags selects the keyspace notifications delivered by a server, like
+// the notify-keyspace-events option of redis.
+type NotifyFlags uint16
+
+const (
+	// NotifyKeyspace publishes the events on "__keyspace@<db>__:<key>"
+	// channels, with the name of the event as message.
+	NotifyKeyspace NotifyFlags = 1 << iota
+
+	// NotifyKeyevent publishes the events on "__keyevent@<db>__:<event>"
+	// channels, with the key as message.
+	NotifyKeyevent
+
+	// NotifyGeneric, NotifyString, NotifyList, NotifySet, NotifyHash,
+	// NotifyZSet and NotifyStream are the classes of events of the commands
+	// on the types of keys, NotifyExpired and NotifyEvicted the classes of
+	// the keys which expired or were evicted, NotifyKeyMiss the class of the
+	// commands accessing missing keys, and NotifyNew the class of the keys
+	// being created.
+	NotifyGeneric
+	NotifyString
+	NotifyList
+	NotifySet
+	NotifyHash
+	NotifyZSet
+	NotifyExpired
+	NotifyEvicted
+	NotifyStream
+	NotifyKeyMiss
+	NotifyNew
+
+	// NotifyAll is the alias of the classes of events selected by "A", which
+	// exclude NotifyKeyMiss and NotifyNew.
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifySet | NotifyHash | NotifyZSet | NotifyExpired | NotifyEvicted | NotifyStream
+)
+
+// notifyChars are the characters of the flags in notify-keyspace-events, in
+// the order that redis formats them.
+var notifyChars = []struct {
+	char byte
+	flag NotifyFlags
+}{
+	{'g', NotifyGeneric},
+	{'$', NotifyString},
+	{'l', NotifyList},
+	{'s', NotifySet},
+	{'h', NotifyHash},
+	{'z', NotifyZSet},
+	{'x', NotifyExpired},
+	{'e', NotifyEvicted},
+	{'t', NotifyStream},
+	{'K', NotifyKeyspace},
+	{'E', NotifyKeyevent},
+	{'m', NotifyKeyMiss},
+	{'n', NotifyNew},
+}
+
+// ParseNotifyFlags parses flags in the format of the notify-keyspace-events
+// option of redis, like "KEA" or "Elg".
+func ParseNotifyFlags(s string) (NotifyFlags, error) {
+	var flags NotifyFlags
+
+next:
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'A' {
+			flags |= NotifyAll
+			continue
+		}
+
+		for _, c := range notifyChars {
+			if c.char == s[i] {
+				flags |= c.flag
+				continue next
+			}
+		}
+
+		return 0, fmt.Errorf("redis: invalid keyspace notification flag %q in %q", s[i], s)
+	}
+
+	return flags, nil
+}
+
+// String returns the representation of flags in the format of the
+// notify-keyspace-events option of redis.
+func (flags NotifyFlags) String() string {
+	b := make([]byte, 0, len(notifyChars))
+
+	for _, c := range notifyChars {
+		switch {
+		case flags&NotifyAll == NotifyAll && c.flag&NotifyAll != 0:
+			if c.flag == NotifyGeneric {
+				b = append(b, 'A')
+			}
+		case flags&c.flag != 0:
+			b = append(b, c.char)
+		}
+	}
+
+	return string(b)
+}
+
+// NotifyKeyspaceEvent publishes the keyspace notifications of event on key to
+// the PubSub broker of the server, if class is enabled by the
+// NotifyKeyspaceEvents of the server. Handlers call it after mutating keys,
+// with the class and the name of the event that redis uses for the command,
+// like NotifyString and "set", NotifyGeneric and "del", or NotifyList and
+// "lpush", and with NotifyExpired and "expired" or NotifyEvicted and "evicted"
+// when keys are removed.
+func (s *Server) NotifyKeyspaceEvent(class NotifyFlags, event string, key string) {
+	if s.PubSub == nil {
+		return
+	}
+
+	flags := s.currentConfig().notifyFlags
+
+	if flags&class == 0 {
+		return
+	}
+
+	if flags&NotifyKeyspace != 0 {
+		s.PubSub.Publish(KeyspaceChannel(0, key), event)
+	}
+
+	if flags&NotifyKeyevent != 0 {
+		s.PubSub.Publish(KeyeventChannel(0, event), key)
+	}
+}
+
+// NotifyKeyspaceEvent publishes the keyspace notifications of event on key to
+// the server serving the request of ctx, see Server.NotifyKeyspaceEvent. It
+// does nothing if ctx is not the context of a request.
+func NotifyKeyspaceEvent(ctx context.Context, class NotifyFlags, event string, key string) {
+	if s, _ := ctx.Value(ServerContextKey).(*Server); s != nil {
+		s.NotifyKeyspaceEvent(class, event, key)
+	}
+}
+
+// KeyspaceEvent is a keyspace notification received by a subscriber.
+type KeyspaceEvent struct {
+	// DB is the database of the key.
+	DB int
+
+	// Key is the key that the event happened on, and Event the name of the
+	// event, like "set", "del" or "expired".
+	Key   string
+	Event string
+}
+
+const (
+	keyspacePrefix = "__keyspace@"
+	keyeventPrefix = "__keyevent@"
+)
+
+// KeyspaceChannel returns the channel of the keyspace notifications of key.
+func KeyspaceChannel(db int, key string) string {
+	return keyspacePrefix + strconv.Itoa(db) + "__:" + key
+}
+
+// KeyeventChannel returns the channel of the keyspace notifications of event.
+func KeyeventChannel(db int, event string) string {
+	return keyeventPrefix + strconv.Itoa(db) + "__:" + event
+}
+
+// ParseKeyspaceEvent parses a message received on the channel of a keyspace
+// notification, it returns false if channel is not such a channel.
+func ParseKeyspaceEvent(channel string, message []byte) (KeyspaceEvent, bool) {
+	var prefix string
+
+	switch {
+	case strings.HasPrefix(channel, keyspacePrefix):
+		prefix = keyspacePrefix
+	case strings.HasPrefix(channel, keyeventPrefix):
+		prefix = keyeventPrefix
+	default:
+		return KeyspaceEvent{}, false
+	}
+
+	rest := channel[len(prefix):]
+
+	i := strings.Index(rest, "__:")
+	if i < 0 {
+		return KeyspaceEvent{}, false
+	}
+
+	db, err := strconv.Atoi(rest[:i])
+	if err != nil {
+		return KeyspaceEvent{}, false
+	}
+
+	e := KeyspaceEvent{DB: db}
+
+	if prefix == keyspacePrefix {
+		e.Key, e.Event = rest[i+3:], string(message)
+	} else {
+		e.Key, e.Event = string(message), rest[i+3:]
+	}
+
+	return e, true
+}
+
+// errNotKeyspaceEvent is returned by ReadKeyspaceEvent when the connection
+// receives a message which is not a keyspace notification.
+var errNotKeyspaceEvent = errors.New("redis: the message is not a keyspace notification")
+
+// ReadKeyspaceEvent reads the next message from the connection and parses it
+// as a keyspace notification. The connection must be subscribed to keyspace
+// or keyevent channels, other messages cause ReadKeyspaceEvent to return an
+// error.
+func (sub *SubConn) ReadKeyspaceEvent() (KeyspaceEvent, error) {
+	channel, message, err := sub.ReadMessage()
+	if err != nil {
+		return KeyspaceEvent{}, err
+	}
+
+	e, ok := ParseKeyspaceEvent(channel, message)
+	if !ok {
+		return KeyspaceEvent{}, errNotKeyspaceEvent
+	}
+
+	return e, nil
+}
@@ -0,0 +1,145 @@
+package redis_test
+
+import (
+	"testing"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+)
+
+func TestParseNotifyFlags(t *testing.T) {
+	tests := []struct {
+		flags  string
+		value  redis.NotifyFlags
+		format string
+	}{
+		{flags: "", value: 0, format: ""},
+		{flags: "KEA", value: redis.NotifyKeyspace | redis.NotifyKeyevent | redis.NotifyAll, format: "AKE"},
+		{flags: "Elg", value: redis.NotifyKeyevent | redis.NotifyList | redis.NotifyGeneric, format: "glE"},
+		{flags: "Kx$m", value: redis.NotifyKeyspace | redis.NotifyExpired | redis.NotifyString | redis.NotifyKeyMiss, format: "$xKm"},
+		{flags: "g$lshzxetKE", value: redis.NotifyKeyspace | redis.NotifyKeyevent | redis.NotifyAll, format: "AKE"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.flags, func(t *testing.T) {
+			it := assert.New(t)
+
+			flags, err := redis.ParseNotifyFlags(test.flags)
+			if it.Nil(err) {
+				it.Equal(test.value, flags)
+				it.Equal(test.format, flags.String())
+			}
+		})
+	}
+
+	_, err := redis.ParseNotifyFlags("KEy")
+	assert.New(t).NotNil(err)
+}
+
+func TestParseKeyspaceEvent(t *testing.T) {
+	tests := []struct {
+		channel string
+		message string
+		event   redis.KeyspaceEvent
+		ok      bool
+	}{
+		{
+			channel: "__keyspace@0__:user:1",
+			message: "set",
+			event:   redis.KeyspaceEvent{DB: 0, Key: "user:1", Event: "set"},
+			ok:      true,
+		},
+		{
+			channel: "__keyevent@3__:expired",
+			message: "session:__:1",
+			event:   redis.KeyspaceEvent{DB: 3, Key: "session:__:1", Event: "expired"},
+			ok:      true,
+		},
+		{
+			channel: "__keyspace@x__:key",
+			message: "set",
+		},
+		{
+			channel: "news",
+			message: "hello",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.channel, func(t *testing.T) {
+			it := assert.New(t)
+
+			event, ok := redis.ParseKeyspaceEvent(test.channel, []byte(test.message))
+			it.Equal(test.ok, ok)
+			it.Equal(test.event, event)
+		})
+	}
+}
+
+func TestServerKeyspaceNotifications(t *testing.T) {
+	it := assert.New(t)
+
+	// The handler notifies the mutations of SET and LPUSH.
+	handler := redis.HandlerFunc(func(w redis.ResponseWriter, r *redis.Request) {
+		var key string
+		r.Cmds[0].ParseArgs(&key)
+
+		switch r.Cmds[0].Cmd {
+		case "SET":
+			redis.NotifyKeyspaceEvent(r.Context, redis.NotifyString, "set", key)
+		case "LPUSH":
+			redis.NotifyKeyspaceEvent(r.Context, redis.NotifyList, "lpush", key)
+		}
+
+		w.Write("OK")
+	})
+
+	srv := &redis.Server{
+		Handler:              handler,
+		PubSub:               &redis.PubSub{},
+		NotifyKeyspaceEvents: redis.NotifyKeyspace | redis.NotifyKeyevent | redis.NotifyString,
+		EnableBuiltins:       true,
+	}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	sub := dialSubConn(t, srv, addr, "PSUBSCRIBE", "__key*@0__:*")
+	defer sub.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var status string
+	it.Nil(conn.query(&status, "LPUSH", "list", "a"))
+	it.Nil(conn.query(&status, "SET", "key", "value"))
+
+	// LPUSH isn't notified, the events of SET are published on the keyspace
+	// channel first.
+	for _, want := range []redis.KeyspaceEvent{
+		{Key: "key", Event: "set"},
+		{Key: "key", Event: "set"},
+	} {
+		event, err := sub.ReadKeyspaceEvent()
+		if it.Nil(err) {
+			it.Equal(want, event)
+		}
+	}
+
+	var config map[string]string
+	it.Nil(conn.query(&config, "CONFIG", "GET", "notify-keyspace-events"))
+	it.Equal("$KE", config["notify-keyspace-events"])
+
+	it.Nil(conn.query(&status, "CONFIG", "SET", "notify-keyspace-events", "El"))
+	it.Nil(conn.query(&status, "SET", "key", "value"))
+	it.Nil(conn.query(&status, "LPUSH", "list", "b"))
+
+	channel, message, err := sub.ReadMessage()
+	if it.Nil(err) {
+		it.Equal("__keyevent@0__:lpush", channel)
+		it.Equal("list", string(message))
+	}
+
+	// Servers without a PubSub broker ignore the notifications.
+	(&redis.Server{NotifyKeyspaceEvents: redis.NotifyKeyspace | redis.NotifyAll}).NotifyKeyspaceEvent(redis.NotifyGeneric, "del", "key")
+}
@@ -0,0 +1,146 @@
+package redis
+
+import (
+	"strings"
+	"sync"
+)
+
+// CommandPolicy is a Handler which filters the commands of requests before
+// passing them to another handler.
+//
+// Commands are matched by name, or by category when prefixed with "@" (see
+// CommandInfo.Categories), "@all" matches all commands. A command is allowed if
+// Allow is empty or matches it, and Deny doesn't match it. Requests made of
+// commands which are not allowed are answered with an error, a transaction is
+// discarded when any of its commands is not allowed.
+//
+// Rename maps the names of commands to the names that clients must use instead,
+// like the rename-command directive of redis. The original names become unknown
+// commands, and commands renamed to an empty string are disabled. Commands are
+// passed to the handler under their original names.
+//
+// The fields of a CommandPolicy must not be modified after it served its first
+// request.
+type CommandPolicy struct {
+	// Handler is the handler that allowed requests are passed to.
+	Handler Handler
+
+	// Allow and Deny are the lists of names and categories of the allowed and
+	// denied commands.
+	Allow []string
+	Deny  []string
+
+	// Rename maps the names of commands to their new names.
+	Rename map[string]string
+
+	once    sync.Once
+	allow   map[string]bool
+	deny    map[string]bool
+	renamed map[string]string
+}
+
+// ServeRedis satisfies the Handler interface.
+func (p *CommandPolicy) ServeRedis(w ResponseWriter, r *Request) {
+	p.once.Do(p.init)
+
+	for i := range r.Cmds {
+		cmd := &r.Cmds[i]
+		name, err := p.check(cmd.Cmd)
+
+		if err != nil {
+			if r.inTransaction() {
+				err = errorf("EXECABORT Transaction discarded because of previous errors.")
+			}
+
+			w.Write(err)
+			return
+		}
+
+		cmd.Cmd = name
+	}
+
+	p.Handler.ServeRedis(w, r)
+}
+
+// Allowed returns true if the policy allows the command with the given
+// original name.
+func (p *CommandPolicy) Allowed(name string) bool {
+	p.once.Do(p.init)
+
+	name = strings.ToUpper(name)
+
+	if len(p.allow) != 0 && !p.match(p.allow, name) {
+		return false
+	}
+
+	return !p.match(p.deny, name)
+}
+
+// check returns the original name of the command that a client sent as name,
+// or an error if the command is not allowed.
+func (p *CommandPolicy) check(name string) (string, error) {
+	upper := strings.ToUpper(name)
+
+	original, ok := p.renamed[upper]
+	if !ok {
+		original = upper
+	}
+
+	if len(original) == 0 {
+		return "", errorf("ERR unknown command '%s'", strings.ToLower(name))
+	}
+
+	if !p.Allowed(original) {
+		return "", errorf("ERR The '%s' command is not allowed.", strings.ToLower(original))
+	}
+
+	return original, nil
+}
+
+func (p *CommandPolicy) match(set map[string]bool, name string) bool {
+	if set[name] || set["@all"] {
+		return true
+	}
+
+	if info := LookupCommand(name); info != nil {
+		for _, c := range info.Categories() {
+			if set["@"+c] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p *CommandPolicy) init() {
+	p.allow = makePolicySet(p.Allow)
+	p.deny = makePolicySet(p.Deny)
+	p.renamed = make(map[string]string, 2*len(p.Rename))
+
+	// The original names of renamed commands are unknown, unless another
+	// command was renamed to them.
+	for name := range p.Rename {
+		p.renamed[strings.ToUpper(name)] = ""
+	}
+
+	for name, newName := range p.Rename {
+		if len(newName) != 0 {
+			p.renamed[strings.ToUpper(newName)] = strings.ToUpper(name)
+		}
+	}
+}
+
+func makePolicySet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+
+	for _, s := range list {
+		if strings.HasPrefix(s, "@") {
+			set[strings.ToLower(s)] = true
+		} else {
+			set[strings.ToUpper(s)] = true
+		}
+	}
+
+	return set
+}
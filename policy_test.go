@@ -0,0 +1,169 @@
+package redis_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+// echoHandler responds to commands with their names.
+var echoHandler = redis.HandlerFunc(func(w redis.ResponseWriter, r *redis.Request) {
+	if len(r.Cmds) == 1 {
+		w.Write(r.Cmds[0].Cmd)
+		return
+	}
+
+	w.WriteStream(len(r.Cmds))
+
+	for _, cmd := range r.Cmds {
+		w.Write(cmd.Cmd)
+	}
+})
+
+func TestCommandPolicy(t *testing.T) {
+	tests := []struct {
+		scenario string
+		policy   *redis.CommandPolicy
+		function func(*testing.T, context.Context, *clientConn)
+	}{
+		{
+			scenario: "commands of the deny list are rejected",
+			policy:   &redis.CommandPolicy{Deny: []string{"flushall", "@admin"}},
+			function: testCommandPolicyDeny,
+		},
+		{
+			scenario: "only the commands of the allow list are accepted",
+			policy:   &redis.CommandPolicy{Allow: []string{"@read", "DEL"}, Deny: []string{"@dangerous"}},
+			function: testCommandPolicyAllow,
+		},
+		{
+			scenario: "renamed commands are accepted under their new names only",
+			policy:   &redis.CommandPolicy{Rename: map[string]string{"CONFIG": "b840fc02", "flushall": ""}},
+			function: testCommandPolicyRename,
+		},
+		{
+			scenario: "transactions are discarded when one of their commands is rejected",
+			policy:   &redis.CommandPolicy{Deny: []string{"FLUSHALL"}},
+			function: testCommandPolicyTransaction,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc, policy := test.function, test.policy
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			policy.Handler = echoHandler
+
+			srv, addr := redistest.FakeServer(policy)
+			defer srv.Close()
+
+			conn := dialClientConn(t, addr)
+			defer conn.Close()
+
+			testFunc(t, ctx, conn)
+		})
+	}
+}
+
+func testCommandPolicyDeny(t *testing.T, ctx context.Context, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+
+	it.Nil(conn.query(&name, "SET", "key", "value"))
+	it.Equal("SET", name)
+
+	for _, cmd := range []string{"FLUSHALL", "CONFIG", "SHUTDOWN", "MONITOR"} {
+		err := conn.query(&name, cmd)
+		if it.NotNil(err, cmd) {
+			it.Equal("ERR The '"+strings.ToLower(cmd)+"' command is not allowed.", err.Error())
+		}
+	}
+}
+
+func testCommandPolicyAllow(t *testing.T, ctx context.Context, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+
+	it.Nil(conn.query(&name, "GET", "key"))
+	it.Equal("GET", name)
+
+	it.Nil(conn.query(&name, "DEL", "key"))
+	it.Equal("DEL", name)
+
+	it.NotNil(conn.query(&name, "SET", "key", "value"))
+	it.NotNil(conn.query(&name, "KEYS", "*"), "denied commands are rejected even if allowed")
+}
+
+func testCommandPolicyRename(t *testing.T, ctx context.Context, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+
+	it.Nil(conn.query(&name, "b840fc02", "GET", "timeout"))
+	it.Equal("CONFIG", name)
+
+	err := conn.query(&name, "CONFIG", "GET", "timeout")
+	if it.NotNil(err) {
+		it.Equal("ERR unknown command 'config'", err.Error())
+	}
+
+	err = conn.query(&name, "FLUSHALL")
+	if it.NotNil(err) {
+		it.Equal("ERR unknown command 'flushall'", err.Error())
+	}
+}
+
+func testCommandPolicyTransaction(t *testing.T, ctx context.Context, conn *clientConn) {
+	it := assert.New(t)
+
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	it.Nil(conn.WriteCommands(
+		redis.Command{Cmd: "MULTI"},
+		redis.Command{Cmd: "SET", Args: redis.List("key", "value")},
+		redis.Command{Cmd: "FLUSHALL"},
+		redis.Command{Cmd: "EXEC"},
+	))
+
+	// the server acknowledges each command of the transaction
+	for i := 0; i != 4; i++ {
+		var status string
+		it.Nil(redis.ParseArgs(conn.ReadArgs(), &status))
+	}
+
+	var names []string
+
+	err := redis.ParseArgs(conn.ReadArgs(), &names)
+	if it.NotNil(err) {
+		it.Equal("EXECABORT Transaction discarded because of previous errors.", err.Error())
+	}
+
+	// transactions of a single command are discarded as well
+	it.Nil(conn.WriteCommands(
+		redis.Command{Cmd: "MULTI"},
+		redis.Command{Cmd: "FLUSHALL"},
+		redis.Command{Cmd: "EXEC"},
+	))
+
+	for i := 0; i != 3; i++ {
+		var status string
+		it.Nil(redis.ParseArgs(conn.ReadArgs(), &status))
+	}
+
+	err = redis.ParseArgs(conn.ReadArgs(), &names)
+	if it.NotNil(err) {
+		it.Equal("EXECABORT Transaction discarded because of previous errors.", err.Error())
+	}
+}
@@ -1,79 +1,252 @@
 package redis
 
 import (
+	"context"
 	"sync"
 	"time"
 )
 
+// ConnStats reports the state of the connections that a Transport maintains to
+// a host, similarly to sql.DBStats.
+type ConnStats struct {
+	// MaxOpenConnections is the maximum number of connections to the host,
+	// zero means no limit.
+	MaxOpenConnections int
+
+	// OpenConnections is the number of established connections to the host,
+	// both in use and idle. InUse and Idle break it down.
+	OpenConnections int
+	InUse           int
+	Idle            int
+
+	// MaxBlockingConnections is the maximum number of connections to the host
+	// used for blocking commands, zero means no limit. BlockingConnections is
+	// the number of those connections, they are included in OpenConnections.
+	MaxBlockingConnections int
+	BlockingConnections    int
+
+	// WaitCount is the total number of requests that waited for a connection
+	// because the limit was reached, and WaitDuration the total time they
+	// waited. Timeouts counts the waits that ended because the request context
+	// expired or was canceled.
+	WaitCount    int64
+	WaitDuration time.Duration
+	Timeouts     int64
+
+	// Dials is the total number of connections dialed to the host, including
+	// the ones that failed to be established.
+	Dials int64
+
+	// MaxIdleTimeClosed and MaxLifetimeClosed are the total numbers of
+	// connections closed because of the transport's IdleTimeout and
+	// MaxConnLifetime.
+	MaxIdleTimeClosed int64
+	MaxLifetimeClosed int64
+}
+
 type connPool struct {
 	// immutable configuration
 	maxIdleConns        int
 	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	maxBlockingPerHost  int
+	minIdleConns        int
+	maxConnLifetime     time.Duration
+	idleTimeout         time.Duration
+	dialTimeout         time.Duration
+	dial                func(context.Context, string) (*Conn, error)
 
 	// mutable state of the connection pool
 	mutex sync.Mutex
 	calls int
 	idles int
-	conns map[string]*connList
+	conns map[string]*hostConns
+}
+
+// hostConns is the state of the connections to a single host, it is protected
+// by the mutex of the pool.
+//
+// Connections used for blocking commands are kept apart from the regular ones,
+// each kind has its own limit of connections to the host.
+type hostConns struct {
+	idle         connList
+	blockingIdle connList
+	open         int
+	blockingOpen int
+	waiters      []connWaiter
+	stats        ConnStats
+	flushedAt    time.Time
+	warmed       bool
+}
+
+// connWaiter is a request waiting for a connection to a host, blocking tells
+// the kind of connection it needs.
+type connWaiter struct {
+	ch       chan *Conn
+	blocking bool
 }
 
-func (p *connPool) getConn(host string) *Conn {
-	var list *connList
-	var conn *Conn
+// getConn returns a connection to host, which is either an idle connection or
+// a newly dialed one. When the pool has as many connections to host as allowed
+// the call waits in line for a connection to be released, or for ctx to be
+// done. Blocking connections are only reused by blocking requests, and don't
+// take the slots of the regular connections.
+func (p *connPool) getConn(ctx context.Context, host string, blocking bool) (*Conn, error) {
+	var expired []*Conn
 
 	p.mutex.Lock()
+	h := p.host(host)
+	idle := h.idleList(blocking)
+	now := time.Now()
+
+	for {
+		conn := idle.pop()
+		if conn == nil {
+			break
+		}
+		p.idles--
+
+		if p.expired(h, conn, now) {
+			*h.opened(blocking)--
+			expired = append(expired, conn)
+			continue
+		}
+
+		p.mutex.Unlock()
+		closeConns(expired)
 
-	if list = p.conns[host]; list != nil {
-		conn = list.pop()
+		conn.SetDeadline(time.Time{}) // don't leak deadlines
+		return conn, nil
 	}
 
-	if p.calls++; p.calls == 1000 {
-		p.calls = 0
-		// Every 1000 calls to getConn we cleanup empty entries in the host
-		// map to avoid leaking memory.
-		for host, list := range p.conns {
-			if list.len() == 0 {
-				delete(p.conns, host)
+	if p.hasRoom(h, blocking) {
+		*h.opened(blocking)++
+		p.mutex.Unlock()
+		closeConns(expired)
+
+		return p.dialConn(ctx, host, blocking)
+	}
+
+	// Waiters are served in the order they arrived, connections released to
+	// the pool are handed over directly to the first waiter of their kind.
+	w := make(chan *Conn, 1)
+	h.waiters = append(h.waiters, connWaiter{ch: w, blocking: blocking})
+	h.stats.WaitCount++
+
+	p.mutex.Unlock()
+	closeConns(expired)
+
+	select {
+	case conn := <-w:
+		p.mutex.Lock()
+		h.stats.WaitDuration += time.Since(now)
+		p.mutex.Unlock()
+
+		if conn == nil {
+			// A connection was closed, the waiter was given its slot.
+			return p.dialConn(ctx, host, blocking)
+		}
+
+		conn.SetDeadline(time.Time{})
+		return conn, nil
+
+	case <-ctx.Done():
+		p.mutex.Lock()
+		h.stats.WaitDuration += time.Since(now)
+		h.stats.Timeouts++
+		removed := h.removeWaiter(w)
+		p.mutex.Unlock()
+
+		if !removed {
+			// The waiter was served concurrently, the connection or slot is
+			// given back to the pool.
+			if conn := <-w; conn != nil {
+				p.putConn(host, conn)
+			} else {
+				p.releaseConn(host, blocking)
 			}
 		}
+
+		return nil, ctx.Err()
 	}
+}
 
-	if conn != nil {
-		p.idles--
+func (p *connPool) dialConn(ctx context.Context, host string, blocking bool) (*Conn, error) {
+	start := time.Now()
+	conn, err := p.dial(ctx, host)
+
+	p.mutex.Lock()
+	h := p.host(host)
+	h.stats.Dials++
+
+	warm := 0
+
+	if err != nil {
+		*h.opened(blocking)--
+		p.grantSlot(h, blocking)
+	} else if !blocking && !h.warmed {
+		// First regular connection to the host, the idle pool gets
+		// pre-warmed.
+		h.warmed = true
+		warm = p.reserveIdleConns(h)
 	}
 
 	p.mutex.Unlock()
 
-	if conn != nil {
-		conn.SetDeadline(time.Time{}) // don't leak deadlines
+	if err != nil {
+		return nil, err
 	}
 
-	return conn
+	for i := 0; i != warm; i++ {
+		go p.warmConn(host)
+	}
+
+	conn.createdAt = start
+	conn.blocking = blocking
+	return conn, nil
 }
 
+// putConn gives a connection obtained from getConn back to the pool.
 func (p *connPool) putConn(host string, conn *Conn) {
 	if conn == nil {
 		return
 	}
 
-	var list *connList
 	p.mutex.Lock()
+	h := p.host(host)
+	now := time.Now()
+	expired := p.expired(h, conn, now)
 
-	if p.maxIdleConns == 0 || p.idles < p.maxIdleConns {
-		if p.conns == nil {
-			p.conns = make(map[string]*connList)
-		}
+	if h.hasWaiter(conn.blocking) {
+		if !expired {
+			w := h.popWaiter(conn.blocking)
+			p.mutex.Unlock()
 
-		if list = p.conns[host]; list == nil {
-			list = new(connList)
-			p.conns[host] = list
+			w.ch <- conn
+			return
 		}
+
+		// The connection can't be reused, it is closed and the waiter is
+		// given its slot instead.
+		*h.opened(conn.blocking)--
+		p.grantSlot(h, conn.blocking)
+		p.mutex.Unlock()
+
+		conn.Close()
+		return
 	}
 
-	if list != nil && (p.maxIdleConnsPerHost == 0 || list.len() < p.maxIdleConnsPerHost) {
-		list.push(conn)
+	keep := !expired &&
+		(p.maxIdleConns == 0 || p.idles < p.maxIdleConns) &&
+		(p.maxIdleConnsPerHost == 0 || h.idleLen() < p.maxIdleConnsPerHost)
+
+	if keep {
+		conn.idleAt = now
+		h.idleList(conn.blocking).push(conn)
 		p.idles++
 		conn = nil
+	} else {
+		*h.opened(conn.blocking)--
 	}
 
 	p.mutex.Unlock()
@@ -83,30 +256,235 @@ func (p *connPool) putConn(host string, conn *Conn) {
 	}
 }
 
+// discardConn closes a connection obtained from getConn which cannot be
+// reused.
+func (p *connPool) discardConn(host string, conn *Conn) {
+	conn.Close()
+	p.releaseConn(host, conn.blocking)
+}
+
+// releaseConn releases the slot of a connection which was closed, or which
+// failed to be established.
+func (p *connPool) releaseConn(host string, blocking bool) {
+	p.mutex.Lock()
+	h := p.host(host)
+	*h.opened(blocking)--
+	p.grantSlot(h, blocking)
+	p.mutex.Unlock()
+}
+
+// grantSlot lets the first waiter of h for a connection of the given kind dial
+// a new connection, if the pool has room for it. The pool's mutex must be
+// held.
+func (p *connPool) grantSlot(h *hostConns, blocking bool) {
+	if h.hasWaiter(blocking) && p.hasRoom(h, blocking) {
+		w := h.popWaiter(blocking)
+		*h.opened(blocking)++
+		w.ch <- nil
+	}
+}
+
+// hasRoom returns true if the pool can open a new connection of the given kind
+// to h. The pool's mutex must be held.
+func (p *connPool) hasRoom(h *hostConns, blocking bool) bool {
+	max := p.maxConnsPerHost
+	if blocking {
+		max = p.maxBlockingPerHost
+	}
+	return max == 0 || *h.opened(blocking) < max
+}
+
+// host returns the state of the connections to the given host. The pool's
+// mutex must be held.
+func (p *connPool) host(host string) *hostConns {
+	if p.conns == nil {
+		p.conns = make(map[string]*hostConns)
+	}
+
+	if p.calls++; p.calls == 1000 {
+		p.calls = 0
+		// Every 1000 calls we cleanup the hosts that have no connections in
+		// the host map to avoid leaking memory.
+		for host, h := range p.conns {
+			if h.open == 0 && h.blockingOpen == 0 && len(h.waiters) == 0 {
+				delete(p.conns, host)
+			}
+		}
+	}
+
+	h := p.conns[host]
+	if h == nil {
+		h = &hostConns{}
+		p.conns[host] = h
+	}
+
+	return h
+}
+
+// expired returns true if conn has reached the maximum lifetime or idle time
+// of connections in the pool, or was dialed before the connections to the host
+// were flushed, updating the stats of h. The pool's mutex must be held.
+func (p *connPool) expired(h *hostConns, conn *Conn, now time.Time) bool {
+	if conn.createdAt.Before(h.flushedAt) {
+		return true
+	}
+
+	if p.maxConnLifetime != 0 && now.Sub(conn.createdAt) >= p.maxConnLifetime {
+		h.stats.MaxLifetimeClosed++
+		return true
+	}
+
+	if p.idleTimeout != 0 && !conn.idleAt.IsZero() && now.Sub(conn.idleAt) >= p.idleTimeout {
+		h.stats.MaxIdleTimeClosed++
+		return true
+	}
+
+	return false
+}
+
 func (p *connPool) closeIdleConnections() {
+	var conns []*Conn
+
 	p.mutex.Lock()
 
-	for _, conns := range p.conns {
-		for conn := conns.pop(); conn != nil; conn = conns.pop() {
-			conn.Close()
+	for _, h := range p.conns {
+		for _, blocking := range []bool{false, true} {
+			idle := h.idleList(blocking)
+
+			for conn := idle.pop(); conn != nil; conn = idle.pop() {
+				conns = append(conns, conn)
+				*h.opened(blocking)--
+				p.idles--
+			}
 		}
 	}
 
 	p.mutex.Unlock()
+
+	closeConns(conns)
+}
+
+// flushConnections closes the idle connections to host, the connections in use
+// are closed when they are put back in the pool.
+func (p *connPool) flushConnections(host string) {
+	var conns []*Conn
+
+	p.mutex.Lock()
+
+	if h := p.conns[host]; h != nil {
+		h.flushedAt = time.Now()
+		for _, blocking := range []bool{false, true} {
+			flushed := h.idleList(blocking).filter(func(*Conn) bool { return false })
+			*h.opened(blocking) -= len(flushed)
+			p.idles -= len(flushed)
+			conns = append(conns, flushed...)
+		}
+	}
+
+	p.mutex.Unlock()
+
+	closeConns(conns)
 }
 
 func (p *connPool) pingIdleConnections(timeout time.Duration) {
 	for _, host := range p.hosts() {
-		if conn := p.getConn(host); conn != nil {
-			if ping(conn, timeout) != nil {
-				conn.Close()
-			} else {
-				p.putConn(host, conn)
+		for _, blocking := range []bool{false, true} {
+			if conn := p.popIdleConn(host, blocking); conn != nil {
+				if ping(conn, timeout) != nil {
+					p.discardConn(host, conn)
+				} else {
+					p.putConn(host, conn)
+				}
 			}
 		}
 	}
 }
 
+// popIdleConn returns an idle connection to host of the given kind, or nil if
+// there are none.
+func (p *connPool) popIdleConn(host string, blocking bool) (conn *Conn) {
+	p.mutex.Lock()
+
+	if h := p.conns[host]; h != nil {
+		if conn = h.idleList(blocking).pop(); conn != nil {
+			p.idles--
+		}
+	}
+
+	p.mutex.Unlock()
+	return
+}
+
+// evictIdleConnections closes the idle connections which reached their
+// maximum lifetime or idle time, and dials new connections to the hosts that
+// have less than the minimum number of idle connections.
+func (p *connPool) evictIdleConnections() {
+	var (
+		now     = time.Now()
+		expired []*Conn
+		warm    = map[string]int{}
+	)
+
+	p.mutex.Lock()
+
+	for host, h := range p.conns {
+		keep := func(conn *Conn) bool { return !p.expired(h, conn, now) }
+
+		for _, blocking := range []bool{false, true} {
+			for _, conn := range h.idleList(blocking).filter(keep) {
+				expired = append(expired, conn)
+				*h.opened(blocking)--
+				p.idles--
+			}
+		}
+
+		if h.open > 0 {
+			if n := p.reserveIdleConns(h); n > 0 {
+				warm[host] = n
+			}
+		}
+	}
+
+	p.mutex.Unlock()
+
+	closeConns(expired)
+
+	for host, n := range warm {
+		for i := 0; i != n; i++ {
+			go p.warmConn(host)
+		}
+	}
+}
+
+// reserveIdleConns reserves the slots of the connections that h needs to have
+// the minimum number of regular idle connections, returning how many. The pool's mutex
+// must be held.
+func (p *connPool) reserveIdleConns(h *hostConns) int {
+	n := p.minIdleConns - h.idle.len()
+
+	if p.maxConnsPerHost != 0 && n > p.maxConnsPerHost-h.open {
+		n = p.maxConnsPerHost - h.open
+	}
+
+	if n < 0 {
+		n = 0
+	}
+
+	h.open += n
+	return n
+}
+
+// warmConn dials a connection to host and puts it in the idle pool, the slot
+// of the connection must have been reserved already.
+func (p *connPool) warmConn(host string) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.dialTimeout)
+	defer cancel()
+
+	if conn, err := p.dialConn(ctx, host, false); err == nil {
+		p.putConn(host, conn)
+	}
+}
+
 func (p *connPool) hosts() (hosts []string) {
 	p.mutex.Lock()
 	hosts = make([]string, 0, len(p.conns))
@@ -119,6 +497,86 @@ func (p *connPool) hosts() (hosts []string) {
 	return
 }
 
+func (p *connPool) stats() map[string]ConnStats {
+	p.mutex.Lock()
+	stats := make(map[string]ConnStats, len(p.conns))
+
+	for host, h := range p.conns {
+		s := h.stats
+		s.MaxOpenConnections = p.maxConnsPerHost
+		s.MaxBlockingConnections = p.maxBlockingPerHost
+		s.OpenConnections = h.open + h.blockingOpen
+		s.BlockingConnections = h.blockingOpen
+		s.Idle = h.idleLen()
+		s.InUse = s.OpenConnections - s.Idle
+		stats[host] = s
+	}
+
+	p.mutex.Unlock()
+	return stats
+}
+
+// idleList returns the list of idle connections of the given kind.
+func (h *hostConns) idleList(blocking bool) *connList {
+	if blocking {
+		return &h.blockingIdle
+	}
+	return &h.idle
+}
+
+// opened returns the number of open connections of the given kind.
+func (h *hostConns) opened(blocking bool) *int {
+	if blocking {
+		return &h.blockingOpen
+	}
+	return &h.open
+}
+
+// hasWaiter returns true if requests are waiting for a connection of the given
+// kind.
+func (h *hostConns) hasWaiter(blocking bool) bool {
+	for _, w := range h.waiters {
+		if w.blocking == blocking {
+			return true
+		}
+	}
+	return false
+}
+
+// popWaiter removes the first waiter for a connection of the given kind, which
+// must exist.
+func (h *hostConns) popWaiter(blocking bool) (w connWaiter) {
+	for _, w = range h.waiters {
+		if w.blocking == blocking {
+			h.removeWaiter(w.ch)
+			break
+		}
+	}
+	return
+}
+
+func (h *hostConns) idleLen() int {
+	return h.idle.len() + h.blockingIdle.len()
+}
+
+func (h *hostConns) removeWaiter(w chan *Conn) bool {
+	for i, x := range h.waiters {
+		if x.ch == w {
+			copy(h.waiters[i:], h.waiters[i+1:])
+			h.waiters[len(h.waiters)-1] = connWaiter{}
+			h.waiters = h.waiters[:len(h.waiters)-1]
+			return true
+		}
+	}
+	return false
+}
+
+func closeConns(conns []*Conn) {
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
 func ping(conn *Conn, timeout time.Duration) (err error) {
 	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
 		return
@@ -160,6 +618,33 @@ func (c *connList) push(conn *Conn) {
 	c.pushList = append(c.pushList, conn)
 }
 
+// filter removes the connections for which keep returns false from the list,
+// and returns them.
+func (c *connList) filter(keep func(*Conn) bool) (removed []*Conn) {
+	c.popList, removed = filterConns(c.popList, keep, removed)
+	c.pushList, removed = filterConns(c.pushList, keep, removed)
+	return
+}
+
+func filterConns(conns []*Conn, keep func(*Conn) bool, removed []*Conn) ([]*Conn, []*Conn) {
+	i := 0
+
+	for _, conn := range conns {
+		if keep(conn) {
+			conns[i] = conn
+			i++
+		} else {
+			removed = append(removed, conn)
+		}
+	}
+
+	for j := i; j < len(conns); j++ {
+		conns[j] = nil
+	}
+
+	return conns[:i], removed
+}
+
 func reverse(conns []*Conn) {
 	for i, j := 0, len(conns)-1; i < j; {
 		conns[i], conns[j] = conns[j], conns[i]
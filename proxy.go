@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"time"
 
 	"github.com/dolab/objconv/resp"
 )
@@ -22,6 +23,25 @@ type ReverseProxy struct {
 	// requests to.
 	Registry ServerRegistry
 
+	// Replicas, if not nil, routes read-only requests to the replicas of the
+	// registry's servers.
+	Replicas *ReplicaRouter
+
+	// Migration, if not nil, moves keys from the servers that the registry
+	// exposed before a change to the servers that it exposes now. Requests for
+	// keys that changed owner are not routed to replicas.
+	Migration *Migration
+
+	// Shadow, if not nil, mirrors a sample of the requests to a second set of
+	// servers and compares their responses, without delaying the responses of
+	// the proxy.
+	Shadow *Shadow
+
+	// Namespace, if not nil, prefixes the keys of requests with the prefix of
+	// the tenant that sent them, isolating the keys of tenants sharing the
+	// servers of the registry.
+	Namespace *Namespace
+
 	// ErrorLog specifies an optional logger for errors accepting connections
 	// and unexpected behavior from handlers. If nil, logging goes to os.Stderr
 	// via the log package's standard logger.
@@ -34,6 +54,12 @@ func (proxy *ReverseProxy) ServeRedis(w ResponseWriter, r *Request) {
 }
 
 func (proxy *ReverseProxy) serveRequest(w ResponseWriter, req *Request) {
+	ns, err := proxy.Namespace.rewrite(req)
+	if err != nil {
+		w.Write(err)
+		return
+	}
+
 	cmds := req.Cmds
 	keys := make([]string, 0, 10)
 
@@ -41,6 +67,12 @@ func (proxy *ReverseProxy) serveRequest(w ResponseWriter, req *Request) {
 		keys = cmds[i].getKeys(keys)
 	}
 
+	if len(keys) == 0 && ns != nil {
+		// Requests without keys, like RANDOMKEY, are sent to the server that
+		// the prefix of the namespace hashes to.
+		keys = append(keys, ns.prefix)
+	}
+
 	// TODO: looking up servers and rebuilding the hash ring for every request
 	// is not efficient, we should cache and reuse the state.
 	ring, err := proxy.lookupServers(req.Context)
@@ -63,17 +95,49 @@ func (proxy *ReverseProxy) serveRequest(w ResponseWriter, req *Request) {
 		}
 	}
 
+	moved := false
+
+	if proxy.Migration != nil && len(keys) != 0 {
+		proxy.Migration.start(proxy.Registry, proxy.transport())
+
+		if upstream, moved, err = proxy.Migration.route(req.Context, proxy.transport(), ring, keys, req.IsReadOnly()); err != nil {
+			proxy.log(err)
+
+			w.Write(errorf("ERR Migrating the keys of the request to the upstream (%s) server failed.", upstream))
+			return
+		}
+	}
+
+	replica := false
+
+	if proxy.Replicas != nil && len(keys) != 0 && !moved && req.IsReadOnly() {
+		endpoint := proxy.Replicas.LookupServer(ring, keys[0], true)
+		upstream, replica = endpoint.Addr, endpoint.IsReplica()
+	}
+
 	req.Addr = upstream
 
+	mirror := proxy.Shadow.mirror(req, keys)
+	defer mirror.finish()
+
+	start := time.Now()
 	res, err := proxy.roundTrip(req)
+	recordUpstreamTime(req.Context, time.Since(start))
+
 	switch err.(type) {
 	case nil:
 	case *resp.Error:
+		mirror.record(err)
 		w.Write(err)
 		return
 	default:
+		mirror.fail()
 		proxy.log(err)
 
+		if replica {
+			proxy.Replicas.MarkDown(upstream)
+		}
+
 		proxy.blacklistServer(upstream)
 
 		w.Write(errorf("ERR Connecting to the upstream (%s) server failed.", upstream))
@@ -81,26 +145,28 @@ func (proxy *ReverseProxy) serveRequest(w ResponseWriter, req *Request) {
 	}
 
 	if res.Args != nil {
-		err = proxy.writeArgs(w, res)
+		err = proxy.writeArgs(w, res, ns, mirror)
 	} else {
-		err = proxy.writeTxArgs(w, res)
+		err = proxy.writeTxArgs(w, res, ns, mirror)
 	}
 
 	if err != nil {
+		mirror.fail()
+
 		// Get caught by the server, that way the connection is closed and not
 		// left in an unpredictable state.
 		panic(err)
 	}
 }
 
-func (proxy *ReverseProxy) writeTxArgs(w ResponseWriter, res *Response) (err error) {
+func (proxy *ReverseProxy) writeTxArgs(w ResponseWriter, res *Response, ns *namespaceRequest, mirror *shadowRequest) (err error) {
 	if res.IsRespArray() {
 		w.WriteStream(res.TxArgs.Len())
 	}
 
 	var v []interface{} // TODO: figure out a way to avoid loading values in memory
 
-	for a := res.TxArgs.Next(); a != nil; a = res.TxArgs.Next() {
+	for i, a := 0, res.TxArgs.Next(); a != nil; i, a = i+1, res.TxArgs.Next() {
 		n := 0
 		v = append(v, nil)
 
@@ -116,6 +182,12 @@ func (proxy *ReverseProxy) writeTxArgs(w ResponseWriter, res *Response) (err err
 			n++
 		}
 
+		mirror.record(v[:n])
+
+		for j := range v[:n] {
+			v[j] = ns.strip(i, j, v[j])
+		}
+
 		w.Write(v[:n])
 	}
 
@@ -126,20 +198,22 @@ func (proxy *ReverseProxy) writeTxArgs(w ResponseWriter, res *Response) (err err
 	return
 }
 
-func (proxy *ReverseProxy) writeArgs(w ResponseWriter, res *Response) (err error) {
+func (proxy *ReverseProxy) writeArgs(w ResponseWriter, res *Response, ns *namespaceRequest, mirror *shadowRequest) (err error) {
 	if res.IsRespArray() {
 		w.WriteStream(res.Args.Len())
 	}
 
 	var v interface{}
-	for res.Args.Next(&v) {
-		w.Write(v)
+	for i := 0; res.Args.Next(&v); i++ {
+		mirror.record(v)
+		w.Write(ns.strip(0, i, v))
 		v = nil
 	}
 
 	err = res.Args.Close()
 
 	if e, ok := err.(*resp.Error); ok {
+		mirror.record(e)
 		w.Write(e)
 		err = nil
 	}
@@ -0,0 +1,546 @@
+package redis
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSubscriberBufferSize is the default number of messages buffered for
+// each subscriber of a PubSub broker.
+const DefaultSubscriberBufferSize = 1024
+
+// PubSub is a broker of Pub/Sub messages. When it is set on a server, the
+// server answers SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE, PUNSUBSCRIBE, PUBLISH and
+// PUBSUB itself, and delivers the messages published by clients and by
+// handlers calling Publish to its subscribers.
+//
+// A PubSub must not be shared by multiple servers.
+type PubSub struct {
+	// BufferSize is the number of messages buffered for each subscriber,
+	// DefaultSubscriberBufferSize if zero. Subscribers which don't read their
+	// messages fast enough are disconnected.
+	BufferSize int
+
+	mutex    sync.Mutex
+	channels map[string]map[*subscriber]struct{}
+	patterns map[string]map[*subscriber]struct{}
+}
+
+// subscriber is a connection in Pub/Sub mode, its subscriptions are guarded by
+// the mutex of the broker.
+type subscriber struct {
+	*connFeed
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+// Publish sends message to the subscribers of channel, and to the subscribers
+// of the patterns matching channel. It returns the number of subscribers that
+// the message was sent to.
+func (ps *PubSub) Publish(channel string, message string) int {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	n := 0
+
+	if subs := ps.channels[channel]; len(subs) != 0 {
+		msg := formatPubSubMessage("message", "", channel, message)
+		for sub := range subs {
+			sub.feed(msg)
+			n++
+		}
+	}
+
+	for pattern, subs := range ps.patterns {
+		if !matchPattern(pattern, channel) {
+			continue
+		}
+
+		msg := formatPubSubMessage("pmessage", pattern, channel, message)
+		for sub := range subs {
+			sub.feed(msg)
+			n++
+		}
+	}
+
+	return n
+}
+
+// sendTo sends msg to the subscriber of channel served on the connection of
+// the client with id, it returns false if there is no such subscriber.
+func (ps *PubSub) sendTo(id uint64, channel string, msg []byte) bool {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	for sub := range ps.channels[channel] {
+		if sub.conn.clientID() == id {
+			sub.feed(msg)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ps *PubSub) bufferSize() int {
+	if ps.BufferSize <= 0 {
+		return DefaultSubscriberBufferSize
+	}
+	return ps.BufferSize
+}
+
+// subscribe subscribes sub to the channel or the pattern name, it returns the
+// number of subscriptions of sub.
+func (ps *PubSub) subscribe(sub *subscriber, name string, pattern bool) int {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	index, names := &ps.channels, sub.channels
+	if pattern {
+		index, names = &ps.patterns, sub.patterns
+	}
+
+	if *index == nil {
+		*index = map[string]map[*subscriber]struct{}{}
+	}
+
+	subs := (*index)[name]
+	if subs == nil {
+		subs = map[*subscriber]struct{}{}
+		(*index)[name] = subs
+	}
+
+	subs[sub] = struct{}{}
+	names[name] = struct{}{}
+	return sub.count()
+}
+
+// unsubscribe unsubscribes sub from the channel or the pattern name, it
+// returns the number of subscriptions of sub.
+func (ps *PubSub) unsubscribe(sub *subscriber, name string, pattern bool) int {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	index, names := ps.channels, sub.channels
+	if pattern {
+		index, names = ps.patterns, sub.patterns
+	}
+
+	if subs := index[name]; subs != nil {
+		if delete(subs, sub); len(subs) == 0 {
+			delete(index, name)
+		}
+	}
+
+	delete(names, name)
+	return sub.count()
+}
+
+// unsubscribeAll removes all the subscriptions of sub.
+func (ps *PubSub) unsubscribeAll(sub *subscriber) {
+	for _, name := range ps.subscriptions(sub, false) {
+		ps.unsubscribe(sub, name, false)
+	}
+	for _, name := range ps.subscriptions(sub, true) {
+		ps.unsubscribe(sub, name, true)
+	}
+}
+
+// subscriptions returns the channels or the patterns that sub is subscribed
+// to, sorted by name.
+func (ps *PubSub) subscriptions(sub *subscriber, pattern bool) []string {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	names := sub.channels
+	if pattern {
+		names = sub.patterns
+	}
+
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// count returns the number of subscriptions of sub.
+func (ps *PubSub) count(sub *subscriber) int {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	return sub.count()
+}
+
+// count returns the number of subscriptions of sub and reports them to CLIENT
+// LIST, the mutex of the broker must be held.
+func (sub *subscriber) count() int {
+	n := len(sub.channels) + len(sub.patterns)
+
+	c := sub.conn
+	c.client.mutex.Lock()
+	c.client.subs = len(sub.channels)
+	c.client.psubs = len(sub.patterns)
+	c.client.mutex.Unlock()
+
+	return n
+}
+
+// isSubscribeCommand returns true if name is one of the commands switching
+// connections to Pub/Sub mode.
+func isSubscribeCommand(name string) bool {
+	switch strings.ToUpper(name) {
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		return true
+	}
+	return false
+}
+
+// serveSubscriber serves c in Pub/Sub mode, starting with the command name and
+// its arguments. It returns true if the connection left Pub/Sub mode after
+// unsubscribing from all its channels and patterns, or false if it must be
+// closed.
+func (s *Server) serveSubscriber(ctx context.Context, c *Conn, name string, args []string, config serverConfig) bool {
+	ps := s.PubSub
+
+	sub := &subscriber{
+		connFeed: newConnFeed(c, ps.bufferSize()),
+		channels: map[string]struct{}{},
+		patterns: map[string]struct{}{},
+	}
+
+	stop := make(chan struct{})
+	exit := make(chan struct{})
+
+	go func() {
+		defer close(exit)
+
+		for {
+			select {
+			case line := <-sub.lines:
+				if err := sub.write(line, config.writeTimeout); err != nil {
+					sub.close()
+					return
+				}
+
+			case <-sub.done:
+				return
+
+			case <-stop:
+				return
+
+			case <-ctx.Done():
+				sub.close()
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		close(stop)
+		<-exit
+	}()
+	defer ps.unsubscribeAll(sub)
+
+	// Subscribers wait for messages, their connections never time out.
+	c.setReadTimeout(0)
+
+	for {
+		if strings.ToUpper(name) == "QUIT" {
+			sub.write([]byte("+OK\r\n"), config.writeTimeout)
+			return false
+		}
+
+		if err := sub.write(s.subscriberReply(sub, name, args), config.writeTimeout); err != nil {
+			return false
+		}
+
+		if ps.count(sub) == 0 && isSubscribeCommand(name) {
+			return true
+		}
+
+		cmdReader := c.ReadCommands(false)
+
+		var cmd Command
+		if !cmdReader.Read(&cmd) {
+			s.log(cmdReader.Close())
+			return false
+		}
+
+		name, args = cmd.Cmd, nil
+		c.beginRequest([]string{name}, time.Now())
+
+		err := cmd.ParseArgs(&args)
+		if cerr := cmdReader.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			s.log(err)
+			return false
+		}
+	}
+}
+
+// subscriberReply applies the command name sent by a subscriber and returns
+// the response.
+func (s *Server) subscriberReply(sub *subscriber, name string, args []string) []byte {
+	ps := s.PubSub
+
+	var b []byte
+
+	switch cmd := strings.ToUpper(name); cmd {
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		if len(args) == 0 {
+			return formatPubSubError("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd))
+		}
+
+		for _, arg := range args {
+			n := ps.subscribe(sub, arg, cmd == "PSUBSCRIBE")
+			b = appendPubSubReply(b, strings.ToLower(cmd), &arg, n)
+		}
+
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		pattern := cmd == "PUNSUBSCRIBE"
+
+		if len(args) == 0 {
+			args = ps.subscriptions(sub, pattern)
+		}
+
+		if len(args) == 0 {
+			return appendPubSubReply(b, strings.ToLower(cmd), nil, ps.count(sub))
+		}
+
+		for _, arg := range args {
+			n := ps.unsubscribe(sub, arg, pattern)
+			b = appendPubSubReply(b, strings.ToLower(cmd), &arg, n)
+		}
+
+	case "PING":
+		if len(args) > 1 {
+			return formatPubSubError("ERR wrong number of arguments for 'ping' command")
+		}
+
+		msg := ""
+		if len(args) == 1 {
+			msg = args[0]
+		}
+
+		b = append(b, "*2\r\n"...)
+		b = appendBulkString(b, "pong")
+		b = appendBulkString(b, msg)
+
+	default:
+		return formatPubSubError("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(name))
+	}
+
+	return b
+}
+
+// publish answers PUBLISH channel message.
+func (s *Server) publish(c *Conn, cmd Command) interface{} {
+	var channel, message string
+
+	if err := cmd.ParseArgs(&channel, &message); err != nil {
+		return errorf("ERR wrong number of arguments for 'publish' command")
+	}
+
+	return int64(s.PubSub.Publish(channel, message))
+}
+
+// pubsubCommand answers PUBSUB CHANNELS [pattern], PUBSUB NUMSUB [channel ...]
+// and PUBSUB NUMPAT.
+func (s *Server) pubsubCommand(c *Conn, cmd Command) interface{} {
+	var args []string
+
+	if err := cmd.ParseArgs(&args); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errorf("ERR wrong number of arguments for 'pubsub' command")
+	}
+
+	sub, args := strings.ToUpper(args[0]), args[1:]
+
+	ps := s.PubSub
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	switch {
+	case sub == "CHANNELS" && len(args) <= 1:
+		names := make([]string, 0, len(ps.channels))
+		for name := range ps.channels {
+			if len(args) == 0 || matchPattern(args[0], name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		list := make([]interface{}, len(names))
+		for i, name := range names {
+			list[i] = name
+		}
+
+		return list
+
+	case sub == "NUMSUB":
+		list := make([]interface{}, 0, 2*len(args))
+		for _, name := range args {
+			list = append(list, name, int64(len(ps.channels[name])))
+		}
+		return list
+
+	case sub == "NUMPAT" && len(args) == 0:
+		n := 0
+		for _, subs := range ps.patterns {
+			n += len(subs)
+		}
+		return int64(n)
+	}
+
+	return errorf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try PUBSUB HELP.", strings.ToLower(sub))
+}
+
+// formatPubSubMessage returns a message sent to subscribers, pattern is only
+// included in "pmessage" messages.
+func formatPubSubMessage(kind string, pattern string, channel string, message string) []byte {
+	b := make([]byte, 0, 32+len(pattern)+len(channel)+len(message))
+
+	if kind == "pmessage" {
+		b = append(b, "*4\r\n"...)
+		b = appendBulkString(b, kind)
+		b = appendBulkString(b, pattern)
+	} else {
+		b = append(b, "*3\r\n"...)
+		b = appendBulkString(b, kind)
+	}
+
+	b = appendBulkString(b, channel)
+	return appendBulkString(b, message)
+}
+
+// appendPubSubReply appends the response to a (un)subscription to b, name is
+// nil when a client unsubscribes without subscriptions.
+func appendPubSubReply(b []byte, kind string, name *string, count int) []byte {
+	b = append(b, "*3\r\n"...)
+	b = appendBulkString(b, kind)
+
+	if name == nil {
+		b = append(b, "$-1\r\n"...)
+	} else {
+		b = appendBulkString(b, *name)
+	}
+
+	b = append(b, ':')
+	b = strconv.AppendInt(b, int64(count), 10)
+	return append(b, '\r', '\n')
+}
+
+func formatPubSubError(format string, args ...interface{}) []byte {
+	return []byte("-" + errorf(format, args...).Error() + "\r\n")
+}
+
+func appendBulkString(b []byte, s string) []byte {
+	b = append(b, '$')
+	b = strconv.AppendInt(b, int64(len(s)), 10)
+	b = append(b, '\r', '\n')
+	b = append(b, s...)
+	return append(b, '\r', '\n')
+}
+
+// matchPattern returns true if s matches the glob-style pattern, with the
+// semantics of redis: "*" matches any sequence of bytes, "?" any byte,
+// "[...]" a set of bytes, which may be negated with "^" and contain ranges,
+// and "\" escapes the next byte.
+func matchPattern(pattern string, s string) bool {
+	for len(pattern) != 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+
+			if len(pattern) == 1 {
+				return true
+			}
+
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+
+			return false
+
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+
+			pattern = pattern[1:]
+
+			not := len(pattern) != 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+
+			match := false
+
+			for len(pattern) != 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) >= 2:
+					pattern = pattern[1:]
+					match = match || pattern[0] == s[0]
+
+				case len(pattern) >= 3 && pattern[1] == '-':
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					match = match || (lo <= s[0] && s[0] <= hi)
+					pattern = pattern[2:]
+
+				default:
+					match = match || pattern[0] == s[0]
+				}
+
+				pattern = pattern[1:]
+			}
+
+			if match == not {
+				return false
+			}
+
+			// An unterminated set ends with the pattern.
+			if len(pattern) == 0 {
+				return len(s) == 1
+			}
+
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+
+		pattern, s = pattern[1:], s[1:]
+	}
+
+	return len(s) == 0
+}
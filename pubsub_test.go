@@ -0,0 +1,220 @@
+package redis_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+)
+
+func TestServerPubSub(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, *redis.Server, string)
+	}{
+		{
+			scenario: "PUBLISH sends messages to the subscribers of channels and patterns",
+			function: testServerPubSubPublish,
+		},
+		{
+			scenario: "patterns are matched like redis does",
+			function: testServerPubSubPatterns,
+		},
+		{
+			scenario: "subscribers leave Pub/Sub mode after unsubscribing",
+			function: testServerPubSubUnsubscribe,
+		},
+		{
+			scenario: "subscribers which don't keep up are disconnected",
+			function: testServerPubSubOverflow,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			srv := &redis.Server{PubSub: &redis.PubSub{BufferSize: 1}, EnableBuiltins: true}
+			addr := startServer(t, srv)
+			defer srv.Close()
+
+			testFunc(t, ctx, srv, addr)
+		})
+	}
+}
+
+// dialSubConn opens a connection to addr and sends cmd with channels, it waits
+// for the server to register the subscriptions.
+func dialSubConn(t *testing.T, srv *redis.Server, addr string, cmd string, channels ...string) *redis.SubConn {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := redis.NewSubConn(conn)
+	sub.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if err := sub.WriteCommand(cmd, channels...); err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, info := range srv.Connections() {
+			if info.Addr == conn.LocalAddr().String() && info.Subscriptions+info.PatternSubscriptions == len(channels) {
+				return sub
+			}
+		}
+	}
+
+	t.Fatal("the subscriptions were not registered")
+	return nil
+}
+
+func testServerPubSubPublish(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	sub1 := dialSubConn(t, srv, addr, "SUBSCRIBE", "news")
+	defer sub1.Close()
+
+	sub2 := dialSubConn(t, srv, addr, "PSUBSCRIBE", "n*")
+	defer sub2.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var n int
+	it.Nil(conn.query(&n, "PUBLISH", "news", "hello"))
+	it.Equal(2, n)
+
+	for _, sub := range []*redis.SubConn{sub1, sub2} {
+		channel, message, err := sub.ReadMessage()
+		if it.Nil(err) {
+			it.Equal("news", channel)
+			it.Equal("hello", string(message))
+		}
+	}
+
+	var numsub []interface{}
+	it.Nil(conn.query(&numsub, "PUBSUB", "NUMSUB", "news", "other"))
+	it.Equal([]interface{}{"news", int64(1), "other", int64(0)}, numsub)
+
+	it.Nil(conn.query(&n, "PUBSUB", "NUMPAT"))
+	it.Equal(1, n)
+
+	var list string
+	it.Nil(conn.query(&list, "CLIENT", "LIST", "TYPE", "pubsub"))
+
+	clients := parseClientList(list)
+	if it.Equal(2, len(clients)) {
+		it.Equal("P", clients[0]["flags"])
+		it.Equal("1", clients[0]["sub"])
+		it.Equal("1", clients[1]["psub"])
+	}
+}
+
+func testServerPubSubPatterns(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	sub := dialSubConn(t, srv, addr, "SUBSCRIBE", "hallo", "hello", "hillo", "h*llo", "hllo")
+	defer sub.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	tests := []struct {
+		pattern  string
+		channels []string
+	}{
+		{pattern: "h?llo", channels: []string{"h*llo", "hallo", "hello", "hillo"}},
+		{pattern: "h*llo", channels: []string{"h*llo", "hallo", "hello", "hillo", "hllo"}},
+		{pattern: "h[ae]llo", channels: []string{"hallo", "hello"}},
+		{pattern: "h[^e]llo", channels: []string{"h*llo", "hallo", "hillo"}},
+		{pattern: "h[a-f]llo", channels: []string{"hallo", "hello"}},
+		{pattern: `h\*llo`, channels: []string{"h*llo"}},
+		{pattern: "hello", channels: []string{"hello"}},
+	}
+
+	for _, test := range tests {
+		var channels []string
+		it.Nil(conn.query(&channels, "PUBSUB", "CHANNELS", test.pattern))
+		it.Equal(test.channels, channels, test.pattern)
+	}
+}
+
+func testServerPubSubUnsubscribe(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var (
+		kind, channel string
+		count         int
+	)
+
+	it.Nil(conn.WriteCommands(redis.Command{Cmd: "SUBSCRIBE", Args: redis.List("news")}))
+	it.Nil(redis.ParseArgs(conn.ReadArgs(), &kind, &channel, &count))
+	it.Equal("subscribe", kind)
+	it.Equal("news", channel)
+	it.Equal(1, count)
+
+	var name string
+	err := conn.query(&name, "GET", "key")
+	if it.NotNil(err) {
+		it.Equal("ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", err.Error())
+	}
+
+	var pong, message string
+	it.Nil(conn.WriteCommands(redis.Command{Cmd: "PING", Args: redis.List("hi")}))
+	it.Nil(redis.ParseArgs(conn.ReadArgs(), &pong, &message))
+	it.Equal("pong", pong)
+	it.Equal("hi", message)
+
+	it.Nil(conn.WriteCommands(redis.Command{Cmd: "UNSUBSCRIBE"}))
+	it.Nil(redis.ParseArgs(conn.ReadArgs(), &kind, &channel, &count))
+	it.Equal("unsubscribe", kind)
+	it.Equal("news", channel)
+	it.Equal(0, count)
+
+	it.Nil(conn.query(&name, "GET", "key"))
+	it.Equal("GET", name)
+}
+
+func testServerPubSubOverflow(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	sub := dialSubConn(t, srv, addr, "SUBSCRIBE", "news")
+	defer sub.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	// The subscriber doesn't read the messages, which fill the buffers of the
+	// connection until the server gives up.
+	message := strings.Repeat("m", 1<<20)
+
+	for len(srv.Connections()) == 2 {
+		var n int
+		if !it.Nil(conn.query(&n, "PUBLISH", "news", message)) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Error("the subscriber was not disconnected")
+			return
+		default:
+		}
+	}
+
+	it.Equal(1, len(srv.Connections()))
+}
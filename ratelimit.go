@@ -0,0 +1,398 @@
+package redis
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitKey is the property of requests that a RateLimitRule groups them
+// by.
+type RateLimitKey string
+
+const (
+	// RateLimitByAddr groups requests by the IP address of their client.
+	RateLimitByAddr RateLimitKey = "addr"
+
+	// RateLimitByConn groups requests by the connection of their client,
+	// identified by its remote ip:port.
+	RateLimitByConn RateLimitKey = "conn"
+
+	// RateLimitByUser groups requests by the user that their connection
+	// authenticated as, requests of unauthenticated connections are not
+	// limited.
+	RateLimitByUser RateLimitKey = "user"
+
+	// RateLimitByCommand groups commands by name, each command of a request
+	// takes a token.
+	RateLimitByCommand RateLimitKey = "command"
+
+	// RateLimitByPrefix groups requests by the prefix of their first key,
+	// only the prefixes set as Match of rules are limited.
+	RateLimitByPrefix RateLimitKey = "prefix"
+)
+
+// RateLimitRule describes the limits applied to a group of requests.
+type RateLimitRule struct {
+	// By is the property of the requests that the rule groups them by.
+	By RateLimitKey
+
+	// Match, if not empty, restricts the rule to the requests whose property
+	// is Match, overriding the rule with the same By and no Match for these
+	// requests. For example the rule {By: RateLimitByCommand, Match: "KEYS"}
+	// sets the limits of KEYS while {By: RateLimitByCommand} sets the limits of
+	// other commands.
+	Match string
+
+	// Rate is the number of requests per second allowed for each group, and
+	// Burst the number of requests that can be made at once. A zero Rate means
+	// the rate isn't limited, a zero Burst means max(1, Rate).
+	Rate  float64
+	Burst int
+
+	// Concurrency, if not zero, is the maximum number of requests of each
+	// group being served at the same time.
+	Concurrency int
+}
+
+// RateLimiter is a Handler which limits the rate of requests passed to another
+// handler.
+//
+// Requests are grouped by each rule, a token bucket and an in-flight counter
+// are maintained for each group. Requests exceeding the limits of any rule are
+// answered with an error, or delayed for up to MaxDelay until tokens become
+// available. Limited requests are counted by the rate_limited_requests_total
+// metric.
+//
+// The rules can be changed at runtime by calling SetRules, which resets the
+// state of the groups.
+//
+// RateLimiters are safe for concurrent use by multiple goroutines.
+type RateLimiter struct {
+	// Handler is the handler that requests are passed to.
+	Handler Handler
+
+	// Rules is the initial list of rules of the rate limiter.
+	Rules []RateLimitRule
+
+	// MaxDelay is the maximum amount of time that requests exceeding a rate
+	// are delayed for. Zero means the requests are rejected.
+	MaxDelay time.Duration
+
+	once      sync.Once
+	mutex     sync.Mutex
+	rules     []RateLimitRule
+	version   uint64
+	buckets   map[rateLimitGroup]*rateLimitBucket
+	lastSweep time.Time
+}
+
+// rateLimitGroup identifies the group of requests of a rule, version is the
+// version of the rules that rule is an index of.
+type rateLimitGroup struct {
+	version uint64
+	rule    int
+	value   string
+}
+
+type rateLimitBucket struct {
+	tokens   float64
+	last     time.Time
+	inFlight int
+}
+
+// ServeRedis satisfies the Handler interface.
+func (l *RateLimiter) ServeRedis(w ResponseWriter, r *Request) {
+	l.once.Do(l.init)
+
+	groups, delay, err := l.acquire(l.describe(r), time.Now())
+	if err != nil {
+		w.Write(err)
+		return
+	}
+
+	defer l.release(groups)
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-timer.C:
+		case <-r.Context.Done():
+			timer.Stop()
+			w.Write(errorf("ERR The request was canceled while delayed by the rate limit."))
+			return
+		}
+	}
+
+	l.Handler.ServeRedis(w, r)
+}
+
+// SetRules replaces the rules of the rate limiter.
+func (l *RateLimiter) SetRules(rules []RateLimitRule) {
+	l.once.Do(l.init)
+
+	l.mutex.Lock()
+	l.rules = append([]RateLimitRule(nil), rules...)
+	l.buckets = make(map[rateLimitGroup]*rateLimitBucket)
+	l.version++
+	l.mutex.Unlock()
+}
+
+func (l *RateLimiter) init() {
+	l.rules = append([]RateLimitRule(nil), l.Rules...)
+	l.buckets = make(map[rateLimitGroup]*rateLimitBucket)
+}
+
+// rateLimitRequest holds the properties of a request that rules group
+// requests by.
+type rateLimitRequest struct {
+	addr    string
+	conn    string
+	user    string
+	hasUser bool
+	cmds    []string
+	key     string
+	hasKey  bool
+}
+
+func (l *RateLimiter) describe(r *Request) rateLimitRequest {
+	req := rateLimitRequest{
+		addr: r.Addr,
+		conn: r.Addr,
+		cmds: make([]string, len(r.Cmds)),
+	}
+
+	if host, _, err := net.SplitHostPort(r.Addr); err == nil {
+		req.addr = host
+	}
+
+	if r.Context != nil {
+		req.user, req.hasUser = r.Context.Value(UserContextKey).(string)
+	}
+
+	for i, cmd := range r.Cmds {
+		req.cmds[i] = strings.ToUpper(cmd.Cmd)
+	}
+
+	// Reading the key of the request is avoided when no rules need it.
+	if len(r.Cmds) != 0 && l.hasPrefixRules() {
+		if keys := r.Cmds[0].getKeys(nil); len(keys) != 0 {
+			req.key, req.hasKey = keys[0], true
+		}
+	}
+
+	return req
+}
+
+func (l *RateLimiter) hasPrefixRules() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, r := range l.rules {
+		if r.By == RateLimitByPrefix {
+			return true
+		}
+	}
+
+	return false
+}
+
+// groups returns the groups of req for each property that rules group requests
+// by, a group appears once for each token that the request takes. The rate
+// limiter's mutex must be held.
+func (l *RateLimiter) groups(req rateLimitRequest) []rateLimitGroup {
+	groups := make([]rateLimitGroup, 0, 4)
+
+	groups = l.appendGroup(groups, RateLimitByAddr, req.addr, true)
+	groups = l.appendGroup(groups, RateLimitByConn, req.conn, true)
+	groups = l.appendGroup(groups, RateLimitByUser, req.user, req.hasUser)
+
+	for _, cmd := range req.cmds {
+		groups = l.appendGroup(groups, RateLimitByCommand, cmd, true)
+	}
+
+	if req.hasKey {
+		// The rule with the longest matching prefix applies.
+		rule := -1
+
+		for i, r := range l.rules {
+			if r.By == RateLimitByPrefix && strings.HasPrefix(req.key, r.Match) && (rule < 0 || len(r.Match) > len(l.rules[rule].Match)) {
+				rule = i
+			}
+		}
+
+		if rule >= 0 {
+			groups = append(groups, rateLimitGroup{version: l.version, rule: rule, value: l.rules[rule].Match})
+		}
+	}
+
+	return groups
+}
+
+// appendGroup appends the group of value for the rule grouping requests by, the
+// rule matching value has precedence over the default rule.
+func (l *RateLimiter) appendGroup(groups []rateLimitGroup, by RateLimitKey, value string, ok bool) []rateLimitGroup {
+	if !ok {
+		return groups
+	}
+
+	rule := -1
+
+	for i, r := range l.rules {
+		if r.By != by {
+			continue
+		}
+
+		if r.Match == value {
+			rule = i
+			break
+		}
+
+		if len(r.Match) == 0 && rule < 0 {
+			rule = i
+		}
+	}
+
+	if rule >= 0 {
+		groups = append(groups, rateLimitGroup{version: l.version, rule: rule, value: value})
+	}
+
+	return groups
+}
+
+// acquire takes a token from the buckets of the groups of req and increments
+// their in-flight counters, returning the groups and how long the request must
+// be delayed for. If the request exceeds a limit nothing is acquired and an
+// error is returned.
+func (l *RateLimiter) acquire(req rateLimitRequest, now time.Time) (groups []rateLimitGroup, delay time.Duration, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.sweep(now)
+
+	groups = l.groups(req)
+	delayed := -1
+
+	buckets := make([]*rateLimitBucket, len(groups))
+	exceeded := -1
+
+	for i, g := range groups {
+		rule := l.rules[g.rule]
+		b := l.buckets[g]
+
+		if b == nil {
+			b = &rateLimitBucket{tokens: float64(rule.burst()), last: now}
+			l.buckets[g] = b
+		}
+
+		buckets[i] = b
+
+		if rule.Concurrency > 0 && b.inFlight >= rule.Concurrency {
+			exceeded = i
+			err = errorf("ERR Concurrency limit of %s '%s' exceeded.", rule.By, g.value)
+			break
+		}
+
+		if rule.Rate <= 0 {
+			continue
+		}
+
+		if wait := b.take(rule.Rate, rule.burst(), now); wait > 0 {
+			if wait > l.MaxDelay {
+				b.tokens++
+				exceeded = i
+				err = errorf("ERR Rate limit of %s '%s' exceeded.", rule.By, g.value)
+				break
+			}
+
+			if wait > delay {
+				delay, delayed = wait, i
+			}
+		}
+	}
+
+	if err != nil {
+		// The tokens taken from the buckets of the previous groups are given
+		// back since the request isn't served.
+		for i, g := range groups[:exceeded] {
+			if l.rules[g.rule].Rate > 0 {
+				buckets[i].tokens++
+			}
+		}
+
+		gometrics.IncRateLimited(string(l.rules[groups[exceeded].rule].By), "rejected")
+		return nil, 0, err
+	}
+
+	for _, b := range buckets {
+		b.inFlight++
+	}
+
+	if delayed >= 0 {
+		gometrics.IncRateLimited(string(l.rules[groups[delayed].rule].By), "delayed")
+	}
+
+	return groups, delay, nil
+}
+
+func (l *RateLimiter) release(groups []rateLimitGroup) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, g := range groups {
+		// The buckets are reset when the rules change.
+		if b := l.buckets[g]; b != nil && b.inFlight > 0 {
+			b.inFlight--
+		}
+	}
+}
+
+// sweep removes the buckets which are full and have no requests in flight,
+// they are equivalent to new buckets. The rate limiter's mutex must be held.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+
+	l.lastSweep = now
+
+	for g, b := range l.buckets {
+		rule := l.rules[g.rule]
+
+		if b.inFlight == 0 && (rule.Rate <= 0 || b.tokens+now.Sub(b.last).Seconds()*rule.Rate >= float64(rule.burst())) {
+			delete(l.buckets, g)
+		}
+	}
+}
+
+// take refills the bucket at rate tokens per second up to burst tokens, then
+// takes a token from it, returning how long to wait for the token to be
+// available.
+func (b *rateLimitBucket) take(rate float64, burst int, now time.Time) time.Duration {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	b.last = now
+
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+
+	if b.tokens--; b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+func (r RateLimitRule) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+
+	if r.Rate > 1 {
+		return int(r.Rate)
+	}
+
+	return 1
+}
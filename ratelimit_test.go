@@ -0,0 +1,232 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		scenario string
+		limiter  *redis.RateLimiter
+		function func(*testing.T, context.Context, *redis.RateLimiter, *clientConn)
+	}{
+		{
+			scenario: "requests exceeding the rate of their address are rejected",
+			limiter: &redis.RateLimiter{Rules: []redis.RateLimitRule{
+				{By: redis.RateLimitByAddr, Rate: 0.001, Burst: 2},
+			}},
+			function: testRateLimiterAddr,
+		},
+		{
+			scenario: "requests exceeding the rate of their connection are rejected",
+			limiter: &redis.RateLimiter{Rules: []redis.RateLimitRule{
+				{By: redis.RateLimitByConn, Rate: 0.001},
+			}},
+			function: testRateLimiterConn,
+		},
+		{
+			scenario: "rules matching a command override the default rule",
+			limiter: &redis.RateLimiter{Rules: []redis.RateLimitRule{
+				{By: redis.RateLimitByCommand, Rate: 1000},
+				{By: redis.RateLimitByCommand, Match: "KEYS", Rate: 0.001},
+			}},
+			function: testRateLimiterCommand,
+		},
+		{
+			scenario: "requests are limited by the longest prefix of their key",
+			limiter: &redis.RateLimiter{Rules: []redis.RateLimitRule{
+				{By: redis.RateLimitByPrefix, Match: "user:", Rate: 1000},
+				{By: redis.RateLimitByPrefix, Match: "user:1:", Rate: 0.001},
+			}},
+			function: testRateLimiterPrefix,
+		},
+		{
+			scenario: "requests exceeding the rate are delayed for up to MaxDelay",
+			limiter: &redis.RateLimiter{
+				Rules: []redis.RateLimitRule{
+					{By: redis.RateLimitByAddr, Rate: 10},
+				},
+				MaxDelay: time.Second,
+			},
+			function: testRateLimiterDelay,
+		},
+		{
+			scenario: "requests exceeding the concurrency of their group are rejected",
+			limiter: &redis.RateLimiter{Rules: []redis.RateLimitRule{
+				{By: redis.RateLimitByCommand, Match: "BLPOP", Concurrency: 1},
+			}},
+			function: testRateLimiterConcurrency,
+		},
+		{
+			scenario: "changing the rules resets the limits",
+			limiter: &redis.RateLimiter{Rules: []redis.RateLimitRule{
+				{By: redis.RateLimitByAddr, Rate: 0.001},
+			}},
+			function: testRateLimiterSetRules,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc, limiter := test.function, test.limiter
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			limiter.Handler = redis.HandlerFunc(func(w redis.ResponseWriter, r *redis.Request) {
+				// BLPOP blocks until the client closes its connection.
+				if r.Cmds[0].Cmd == "BLPOP" {
+					<-r.Context.Done()
+				}
+				echoHandler.ServeRedis(w, r)
+			})
+
+			srv, addr := redistest.FakeServer(limiter)
+			defer srv.Close()
+
+			conn := dialClientConn(t, addr)
+			defer conn.Close()
+
+			testFunc(t, ctx, limiter, conn)
+		})
+	}
+}
+
+func testRateLimiterAddr(t *testing.T, ctx context.Context, limiter *redis.RateLimiter, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+
+	it.Nil(conn.query(&name, "GET", "key"))
+	it.Nil(conn.query(&name, "SET", "key", "value"))
+
+	err := conn.query(&name, "GET", "key")
+	if it.NotNil(err) {
+		it.Equal("ERR Rate limit of addr '127.0.0.1' exceeded.", err.Error())
+	}
+}
+
+func testRateLimiterConn(t *testing.T, ctx context.Context, limiter *redis.RateLimiter, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+
+	it.Nil(conn.query(&name, "GET", "key"))
+
+	err := conn.query(&name, "GET", "key")
+	if it.NotNil(err) {
+		it.Equal("ERR Rate limit of conn '"+conn.LocalAddr().String()+"' exceeded.", err.Error())
+	}
+
+	other, err := redis.Dial("tcp", conn.RemoteAddr().String())
+	if !it.Nil(err) {
+		return
+	}
+	defer other.Close()
+
+	client := &clientConn{other}
+	it.Nil(client.query(&name, "GET", "key"), "other connections of the address are not limited")
+}
+
+func testRateLimiterCommand(t *testing.T, ctx context.Context, limiter *redis.RateLimiter, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+
+	it.Nil(conn.query(&name, "KEYS", "*"))
+
+	err := conn.query(&name, "KEYS", "*")
+	if it.NotNil(err) {
+		it.Equal("ERR Rate limit of command 'KEYS' exceeded.", err.Error())
+	}
+
+	for i := 0; i != 10; i++ {
+		it.Nil(conn.query(&name, "GET", "key"))
+		it.Equal("GET", name)
+	}
+}
+
+func testRateLimiterPrefix(t *testing.T, ctx context.Context, limiter *redis.RateLimiter, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+
+	it.Nil(conn.query(&name, "GET", "user:1:name"))
+
+	err := conn.query(&name, "GET", "user:1:email")
+	if it.NotNil(err) {
+		it.Equal("ERR Rate limit of prefix 'user:1:' exceeded.", err.Error())
+	}
+
+	it.Nil(conn.query(&name, "GET", "user:2:name"))
+	it.Nil(conn.query(&name, "GET", "other"), "keys without a matching prefix are not limited")
+}
+
+func testRateLimiterDelay(t *testing.T, ctx context.Context, limiter *redis.RateLimiter, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+
+	start := time.Now()
+
+	for i := 0; i != 13; i++ {
+		it.Nil(conn.query(&name, "GET", "key"))
+	}
+
+	// The burst of 10 requests is served at once, the next requests are
+	// delayed by 100ms each.
+	it.True(time.Since(start) >= 250*time.Millisecond, "requests were not delayed")
+}
+
+func testRateLimiterConcurrency(t *testing.T, ctx context.Context, limiter *redis.RateLimiter, conn *clientConn) {
+	it := assert.New(t)
+
+	// The first BLPOP blocks until its connection is closed.
+	it.Nil(conn.WriteCommands(redis.Command{Cmd: "BLPOP", Args: redis.List("list", 0)}))
+	time.Sleep(100 * time.Millisecond)
+
+	other, err := redis.Dial("tcp", conn.RemoteAddr().String())
+	if !it.Nil(err) {
+		return
+	}
+	defer other.Close()
+
+	client := &clientConn{other}
+
+	var name string
+
+	err = client.query(&name, "BLPOP", "list", 0)
+	if it.NotNil(err) {
+		it.Equal("ERR Concurrency limit of command 'BLPOP' exceeded.", err.Error())
+	}
+
+	it.Nil(client.query(&name, "GET", "key"))
+	it.Equal("GET", name)
+}
+
+func testRateLimiterSetRules(t *testing.T, ctx context.Context, limiter *redis.RateLimiter, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+
+	it.Nil(conn.query(&name, "GET", "key"))
+	it.NotNil(conn.query(&name, "GET", "key"))
+
+	limiter.SetRules([]redis.RateLimitRule{
+		{By: redis.RateLimitByCommand, Match: "SET", Rate: 0.001},
+	})
+
+	it.Nil(conn.query(&name, "GET", "key"))
+	it.Nil(conn.query(&name, "GET", "key"))
+
+	it.Nil(conn.query(&name, "SET", "key", "value"))
+	it.NotNil(conn.query(&name, "SET", "key", "value"))
+}
@@ -25,6 +25,26 @@ type ServerBlacklist interface {
 	BlacklistServer(ServerEndpoint)
 }
 
+// ReplicaRing is implemented by ServerRings which know the replicas of the
+// servers that keys are hashed to.
+type ReplicaRing interface {
+	ServerRing
+
+	// LookupReplicas returns the replicas of the shard group that key is
+	// hashed to, which may be empty.
+	LookupReplicas(key string) []ServerEndpoint
+}
+
+// EndpointRing is implemented by ServerRings which can list the endpoints that
+// they distribute keys to.
+type EndpointRing interface {
+	ServerRing
+
+	// Endpoints returns the list of endpoints of the ring, including replicas.
+	// The returned slice must not be modified.
+	Endpoints() []ServerEndpoint
+}
+
 // A ServerRingFunc satisfies the ServerRing interface of custom hashing func.
 type ServerRingFunc func(key string) ServerEndpoint
 
@@ -33,10 +53,51 @@ func (fn ServerRingFunc) LookupServer(key string) ServerEndpoint {
 	return fn(key)
 }
 
+// ServerRole is the role of a redis server in its shard group.
+type ServerRole string
+
+const (
+	// PrimaryRole is the role of servers which accept writes, endpoints
+	// without a role are primaries.
+	PrimaryRole ServerRole = "primary"
+
+	// ReplicaRole is the role of servers which replicate a primary and only
+	// serve reads.
+	ReplicaRole ServerRole = "replica"
+)
+
 // A ServerEndpoint represents a single backend redis server.
 type ServerEndpoint struct {
 	Name string
 	Addr string
+
+	// Role is the role of the server, the zero value means PrimaryRole.
+	Role ServerRole
+
+	// Group is the name of the shard group that the server belongs to, a
+	// primary and its replicas share the same group. The group of primaries
+	// defaults to their address, replicas must set it.
+	Group string
+
+	// Zone is the availability zone that the server runs in, it is used to
+	// route reads to nearby replicas.
+	Zone string
+
+	// Weight is the relative share of keys that hash rings assign to the
+	// server, the zero value means 1.
+	Weight int
+}
+
+// IsReplica returns true if the endpoint is a replica.
+func (endpoint ServerEndpoint) IsReplica() bool {
+	return endpoint.Role == ReplicaRole
+}
+
+func (endpoint ServerEndpoint) group() string {
+	if len(endpoint.Group) != 0 {
+		return endpoint.Group
+	}
+	return endpoint.Addr
 }
 
 // LookupServers satisfies the ServerRegistry interface.
@@ -45,13 +106,27 @@ func (endpoint ServerEndpoint) LookupServers(ctx context.Context) (ServerRing, e
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
-		return ServerRingFunc(func(_ string) ServerEndpoint {
-			return endpoint
-		}), nil
+		return endpointRing{endpoint}, nil
 	}
 }
 
+// endpointRing is the implementation of EndpointRing for single endpoints.
+type endpointRing [1]ServerEndpoint
+
+// LookupServer satisfies the ServerRing interface.
+func (r endpointRing) LookupServer(_ string) ServerEndpoint {
+	return r[0]
+}
+
+// Endpoints satisfies the EndpointRing interface.
+func (r endpointRing) Endpoints() []ServerEndpoint {
+	return r[:]
+}
+
 // A ServerList represents a list of backend redis servers.
+//
+// Keys are hashed to the primaries of the list, the replicas are exposed by the
+// ring through the ReplicaRing interface.
 type ServerList []ServerEndpoint
 
 // LookupServers satisfies the ServerRegistry interface.
@@ -60,14 +135,56 @@ func (list ServerList) LookupServers(ctx context.Context) (ServerRing, error) {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
-		endpoints := make([]ServerEndpoint, len(list))
-		copy(endpoints, list)
+		return newShardRing(list), nil
+	}
+}
+
+// shardRing is the implementation of ReplicaRing for server lists.
+type shardRing struct {
+	ring      ServerRing
+	replicas  map[string][]ServerEndpoint
+	endpoints []ServerEndpoint
+}
+
+func newShardRing(endpoints []ServerEndpoint) *shardRing {
+	var (
+		primaries = make([]ServerEndpoint, 0, len(endpoints))
+		replicas  = make(map[string][]ServerEndpoint)
+	)
 
-		return ServerRingFunc(func(key string) ServerEndpoint {
-			// TODO: rebuilding the hash ring for every request is not efficient, we should cache and reuse the state.
-			ring := NewHashRing(endpoints...)
+	for _, endpoint := range endpoints {
+		if endpoint.IsReplica() {
+			group := endpoint.group()
+			replicas[group] = append(replicas[group], endpoint)
+		} else {
+			primaries = append(primaries, endpoint)
+		}
+	}
+
+	return &shardRing{
+		ring:      NewHashRing(primaries...),
+		replicas:  replicas,
+		endpoints: endpoints,
+	}
+}
+
+// LookupServer satisfies the ServerRing interface.
+func (r *shardRing) LookupServer(key string) ServerEndpoint {
+	if r.ring == nil {
+		return ServerEndpoint{}
+	}
+	return r.ring.LookupServer(key)
+}
 
-			return ring.LookupServer(key)
-		}), nil
+// LookupReplicas satisfies the ReplicaRing interface.
+func (r *shardRing) LookupReplicas(key string) []ServerEndpoint {
+	if r.ring == nil {
+		return nil
 	}
+	return r.replicas[r.ring.LookupServer(key).group()]
+}
+
+// Endpoints satisfies the EndpointRing interface.
+func (r *shardRing) Endpoints() []ServerEndpoint {
+	return r.endpoints
 }
@@ -0,0 +1,397 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplicaStatus is the state of a replica observed by a ReplicaRouter.
+type ReplicaStatus struct {
+	Endpoint ServerEndpoint
+
+	// Latency is the round trip time of the last health check of the replica.
+	Latency time.Duration
+
+	// Lag is the time since the replica last heard from its primary, as
+	// reported by INFO replication.
+	Lag time.Duration
+}
+
+// A ReplicaPolicy selects the replica that a read is sent to.
+type ReplicaPolicy interface {
+	// PickReplica returns the replica to send a read to among a non-empty
+	// list of healthy replicas.
+	PickReplica(replicas []ReplicaStatus) ServerEndpoint
+}
+
+// A ReplicaPolicyFunc satisfies the ReplicaPolicy interface of custom selection
+// func.
+type ReplicaPolicyFunc func(replicas []ReplicaStatus) ServerEndpoint
+
+// PickReplica satisfies the ReplicaPolicy interface.
+func (fn ReplicaPolicyFunc) PickReplica(replicas []ReplicaStatus) ServerEndpoint {
+	return fn(replicas)
+}
+
+var (
+	// RandomReplica is a ReplicaPolicy which spreads reads randomly across
+	// replicas.
+	RandomReplica ReplicaPolicy = ReplicaPolicyFunc(func(replicas []ReplicaStatus) ServerEndpoint {
+		return replicas[rand.Intn(len(replicas))].Endpoint
+	})
+
+	// LeastLatencyReplica is a ReplicaPolicy which sends reads to the replica
+	// that responded the fastest to its last health check.
+	LeastLatencyReplica ReplicaPolicy = ReplicaPolicyFunc(func(replicas []ReplicaStatus) ServerEndpoint {
+		best := replicas[0]
+
+		for _, replica := range replicas[1:] {
+			if replica.Latency < best.Latency {
+				best = replica
+			}
+		}
+
+		return best.Endpoint
+	})
+)
+
+// SameZoneReplica returns a ReplicaPolicy which sends reads to the replicas of
+// the given zone, falling back to the fallback policy (or RandomReplica if it
+// is nil) when there are no healthy replicas in the zone.
+func SameZoneReplica(zone string, fallback ReplicaPolicy) ReplicaPolicy {
+	if fallback == nil {
+		fallback = RandomReplica
+	}
+
+	return ReplicaPolicyFunc(func(replicas []ReplicaStatus) ServerEndpoint {
+		local := make([]ReplicaStatus, 0, len(replicas))
+
+		for _, replica := range replicas {
+			if replica.Endpoint.Zone == zone {
+				local = append(local, replica)
+			}
+		}
+
+		if len(local) == 0 {
+			return fallback.PickReplica(replicas)
+		}
+
+		return fallback.PickReplica(local)
+	})
+}
+
+// A ReplicaRouter routes reads to the replicas of shard groups, falling back to
+// their primary when the replicas are down or lag behind.
+//
+// The router checks the health of replicas in the background with the INFO
+// replication command, replicas are not used until their first health check
+// succeeded.
+//
+// ReplicaRouters are safe for concurrent use by multiple goroutines.
+type ReplicaRouter struct {
+	// Transport is used to send health checks to the replicas, if nil
+	// DefaultTransport is used.
+	Transport RoundTripper
+
+	// Policy selects the replica that reads are sent to, RandomReplica is used
+	// if it is nil.
+	Policy ReplicaPolicy
+
+	// MaxLag, if non-zero, is the maximum time since a replica last heard from
+	// its primary for reads to be sent to it.
+	MaxLag time.Duration
+
+	// CheckInterval is the amount of time between health checks of replicas.
+	// Zero means 1s.
+	CheckInterval time.Duration
+
+	// CheckTimeout is the amount of time that the router waits for responses
+	// to health checks. Zero means 1s.
+	CheckTimeout time.Duration
+
+	mutex    sync.Mutex
+	replicas map[string]*replicaState
+}
+
+type replicaState struct {
+	status    ReplicaStatus
+	healthy   bool
+	checking  bool
+	checkedAt time.Time
+}
+
+// LookupServer returns the endpoint that a request for key should be sent to,
+// which is one of the replicas of the key's shard group for read-only requests
+// when ring implements ReplicaRing and one of them is healthy, or the primary
+// otherwise.
+func (r *ReplicaRouter) LookupServer(ring ServerRing, key string, readOnly bool) ServerEndpoint {
+	primary := ring.LookupServer(key)
+
+	if readOnly {
+		if replicas, ok := ring.(ReplicaRing); ok {
+			return r.Pick(primary, replicas.LookupReplicas(key))
+		}
+	}
+
+	return primary
+}
+
+// Pick returns one of the healthy replicas selected by the router's policy, or
+// primary if there are none.
+func (r *ReplicaRouter) Pick(primary ServerEndpoint, replicas []ServerEndpoint) ServerEndpoint {
+	if len(replicas) == 0 {
+		return primary
+	}
+
+	var (
+		now     = time.Now()
+		healthy = make([]ReplicaStatus, 0, len(replicas))
+		checks  []*replicaState
+	)
+
+	r.mutex.Lock()
+
+	if r.replicas == nil {
+		r.replicas = make(map[string]*replicaState)
+	}
+
+	for _, endpoint := range replicas {
+		state := r.replicas[endpoint.Addr]
+		if state == nil {
+			state = &replicaState{}
+			r.replicas[endpoint.Addr] = state
+		}
+		state.status.Endpoint = endpoint
+
+		if !state.checking && now.Sub(state.checkedAt) >= r.checkInterval() {
+			state.checking = true
+			checks = append(checks, state)
+		}
+
+		if state.healthy {
+			healthy = append(healthy, state.status)
+		}
+	}
+
+	r.mutex.Unlock()
+
+	for _, state := range checks {
+		go r.check(state)
+	}
+
+	if len(healthy) == 0 {
+		return primary
+	}
+
+	return r.policy().PickReplica(healthy)
+}
+
+// MarkDown reports that the replica at addr failed to serve a request, reads
+// are sent to other replicas or the primary until it passes a health check.
+func (r *ReplicaRouter) MarkDown(addr string) {
+	r.mutex.Lock()
+
+	if state := r.replicas[addr]; state != nil {
+		state.healthy = false
+		state.checkedAt = time.Now()
+	}
+
+	r.mutex.Unlock()
+}
+
+// Replicas returns the status of the healthy replicas known to the router.
+func (r *ReplicaRouter) Replicas() []ReplicaStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	replicas := make([]ReplicaStatus, 0, len(r.replicas))
+
+	for _, state := range r.replicas {
+		if state.healthy {
+			replicas = append(replicas, state.status)
+		}
+	}
+
+	return replicas
+}
+
+func (r *ReplicaRouter) check(state *replicaState) {
+	r.mutex.Lock()
+	addr := state.status.Endpoint.Addr
+	r.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.checkTimeout())
+	defer cancel()
+
+	start := time.Now()
+	lag, err := r.checkReplication(ctx, addr)
+	latency := time.Since(start)
+
+	r.mutex.Lock()
+
+	state.checking = false
+	state.checkedAt = time.Now()
+	state.healthy = err == nil && (r.MaxLag == 0 || lag <= r.MaxLag)
+	state.status.Latency = latency
+	state.status.Lag = lag
+
+	r.mutex.Unlock()
+}
+
+// checkReplication sends INFO replication to the replica at addr, returning
+// the time since it last heard from its primary, or an error if the replica is
+// not connected to its primary.
+func (r *ReplicaRouter) checkReplication(ctx context.Context, addr string) (time.Duration, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = DefaultTransport
+	}
+
+	req := NewRequest(addr, "INFO", List("replication"))
+	req.Context = ctx
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+
+	var info string
+	if err = ParseArgs(res.Args, &info); err != nil {
+		return 0, err
+	}
+
+	return parseReplicationInfo(info)
+}
+
+// parseReplicationInfo parses the output of INFO replication of a replica.
+func parseReplicationInfo(info string) (lag time.Duration, err error) {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(info))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if i := strings.IndexByte(line, ':'); i > 0 && line[0] != '#' {
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+
+	switch {
+	case fields["role"] != "slave" && fields["role"] != "replica":
+		err = errorf("ERR the server is not a replica (role:%s)", fields["role"])
+		return
+
+	case fields["master_link_status"] != "up":
+		err = errorf("ERR the replica is not connected to its primary (master_link_status:%s)", fields["master_link_status"])
+		return
+
+	case fields["master_sync_in_progress"] == "1":
+		err = errorf("ERR the replica is synchronizing with its primary")
+		return
+	}
+
+	if s, ok := fields["master_last_io_seconds_ago"]; ok {
+		var seconds int64
+
+		if seconds, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return
+		}
+
+		lag = time.Duration(seconds) * time.Second
+	}
+
+	return
+}
+
+func (r *ReplicaRouter) policy() ReplicaPolicy {
+	if policy := r.Policy; policy != nil {
+		return policy
+	}
+
+	return RandomReplica
+}
+
+func (r *ReplicaRouter) checkInterval() time.Duration {
+	if interval := r.CheckInterval; interval != 0 {
+		return interval
+	}
+
+	return time.Second
+}
+
+func (r *ReplicaRouter) checkTimeout() time.Duration {
+	if timeout := r.CheckTimeout; timeout != 0 {
+		return timeout
+	}
+
+	return time.Second
+}
+
+// RoutingTransport is an implementation of RoundTripper which sends requests to
+// the servers of a registry, ignoring the address set on the requests.
+//
+// Requests are routed by hashing their first key, read-only requests are sent
+// to replicas when Replicas is set.
+type RoutingTransport struct {
+	// Transport is the RoundTripper used to send requests, DefaultTransport is
+	// used if it is nil.
+	Transport RoundTripper
+
+	// Registry exposes the servers that requests are routed to.
+	Registry ServerRegistry
+
+	// Replicas, if not nil, routes read-only requests to replicas.
+	Replicas *ReplicaRouter
+}
+
+// RoundTrip implements the RoundTripper interface.
+func (t *RoutingTransport) RoundTrip(req *Request) (*Response, error) {
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ring, err := t.Registry.LookupServers(ctx)
+	if err != nil {
+		req.Close()
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(req.Cmds))
+	for i := range req.Cmds {
+		keys = req.Cmds[i].getKeys(keys)
+	}
+
+	key := ""
+	if len(keys) != 0 {
+		key = keys[0]
+	}
+
+	var endpoint ServerEndpoint
+
+	if t.Replicas != nil {
+		endpoint = t.Replicas.LookupServer(ring, key, req.IsReadOnly())
+	} else {
+		endpoint = ring.LookupServer(key)
+	}
+
+	transport := t.Transport
+	if transport == nil {
+		transport = DefaultTransport
+	}
+
+	r := *req
+	r.Addr = endpoint.Addr
+
+	res, err := transport.RoundTrip(&r)
+	if err != nil && t.Replicas != nil && endpoint.IsReplica() {
+		t.Replicas.MarkDown(endpoint.Addr)
+	}
+
+	return res, err
+}
@@ -0,0 +1,233 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+func TestServerListReplicas(t *testing.T) {
+	it := assert.New(t)
+
+	list := redis.ServerList{
+		{Name: "A", Addr: "127.0.0.1:4242", Group: "shard-1"},
+		{Name: "A1", Addr: "127.0.0.1:4243", Group: "shard-1", Role: redis.ReplicaRole},
+		{Name: "A2", Addr: "127.0.0.1:4244", Group: "shard-1", Role: redis.ReplicaRole},
+	}
+
+	ring, err := list.LookupServers(context.Background())
+	if !it.Nil(err) {
+		return
+	}
+
+	// keys are only hashed to primaries
+	for i := 0; i != 100; i++ {
+		it.Equal(list[0], ring.LookupServer(fmt.Sprint(i)))
+	}
+
+	replicas, ok := ring.(redis.ReplicaRing)
+	if it.True(ok) {
+		it.Equal([]redis.ServerEndpoint{list[1], list[2]}, replicas.LookupReplicas("key"))
+	}
+}
+
+func TestReplicaPolicies(t *testing.T) {
+	replicas := []redis.ReplicaStatus{
+		{Endpoint: redis.ServerEndpoint{Addr: "A", Zone: "us-east-1a"}, Latency: 3 * time.Millisecond},
+		{Endpoint: redis.ServerEndpoint{Addr: "B", Zone: "us-east-1b"}, Latency: 1 * time.Millisecond},
+		{Endpoint: redis.ServerEndpoint{Addr: "C", Zone: "us-east-1b"}, Latency: 2 * time.Millisecond},
+	}
+
+	tests := []struct {
+		scenario string
+		policy   redis.ReplicaPolicy
+		expected []string
+	}{
+		{
+			scenario: "random replicas",
+			policy:   redis.RandomReplica,
+			expected: []string{"A", "B", "C"},
+		},
+		{
+			scenario: "least latency replicas",
+			policy:   redis.LeastLatencyReplica,
+			expected: []string{"B"},
+		},
+		{
+			scenario: "replicas in the same zone",
+			policy:   redis.SameZoneReplica("us-east-1a", nil),
+			expected: []string{"A"},
+		},
+		{
+			scenario: "least latency replicas in the same zone",
+			policy:   redis.SameZoneReplica("us-east-1b", redis.LeastLatencyReplica),
+			expected: []string{"B"},
+		},
+		{
+			scenario: "replicas in another zone when the zone has none",
+			policy:   redis.SameZoneReplica("us-east-1c", redis.LeastLatencyReplica),
+			expected: []string{"B"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			it := assert.New(t)
+
+			for i := 0; i != 20; i++ {
+				it.Contains(test.expected, test.policy.PickReplica(replicas).Addr)
+			}
+		})
+	}
+}
+
+// newReplicaServer starts a server which responds to reads with its name and
+// to INFO replication with the given state of its link to the primary.
+func newReplicaServer(name string, linkStatus string, lastIO int) (*redis.Server, string, *int64) {
+	writes := new(int64)
+
+	srv, addr := redistest.FakeServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		req.Cmds[0].ParseArgs(nil)
+
+		switch req.Cmds[0].Cmd {
+		case "INFO":
+			res.Write(fmt.Sprintf("# Replication\r\nrole:slave\r\nmaster_link_status:%s\r\nmaster_last_io_seconds_ago:%d\r\nmaster_sync_in_progress:0\r\n", linkStatus, lastIO))
+		case "SET":
+			atomic.AddInt64(writes, 1)
+			res.Write("OK")
+		default:
+			res.Write(name)
+		}
+	}))
+
+	return srv, addr, writes
+}
+
+func TestReplicaRouting(t *testing.T) {
+	tests := []struct {
+		scenario   string
+		linkStatus string
+		lastIO     int
+		expected   string
+	}{
+		{
+			scenario:   "reads are sent to healthy replicas",
+			linkStatus: "up",
+			lastIO:     1,
+			expected:   "replica",
+		},
+		{
+			scenario:   "reads are sent to the primary when replicas are down",
+			linkStatus: "down",
+			lastIO:     1,
+			expected:   "primary",
+		},
+		{
+			scenario:   "reads are sent to the primary when replicas lag behind",
+			linkStatus: "up",
+			lastIO:     30,
+			expected:   "primary",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+			it := assert.New(t)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			primary, primaryAddr, primaryWrites := newReplicaServer("primary", "up", 0)
+			defer primary.Close()
+
+			replica, replicaAddr, replicaWrites := newReplicaServer("replica", test.linkStatus, test.lastIO)
+			defer replica.Close()
+
+			transport := &redis.Transport{}
+			defer transport.CloseIdleConnections()
+
+			router := &redis.ReplicaRouter{
+				Transport:     transport,
+				MaxLag:        10 * time.Second,
+				CheckInterval: 10 * time.Millisecond,
+			}
+
+			client := &redis.Client{
+				Transport: &redis.RoutingTransport{
+					Transport: transport,
+					Registry: redis.ServerList{
+						{Addr: primaryAddr, Group: "shard"},
+						{Addr: replicaAddr, Group: "shard", Role: redis.ReplicaRole},
+					},
+					Replicas: router,
+				},
+			}
+
+			// the first read triggers the health check of the replica
+			s, err := client.Get(ctx, "key")
+			it.Nil(err)
+			it.Equal("primary", s)
+
+			for i := 0; i != 20 && s != test.expected; i++ {
+				time.Sleep(10 * time.Millisecond)
+				s, _ = client.Get(ctx, "key")
+			}
+			it.Equal(test.expected, s)
+
+			it.Nil(client.Set(ctx, "key", "value"))
+			it.EqualValues(1, atomic.LoadInt64(primaryWrites))
+			it.EqualValues(0, atomic.LoadInt64(replicaWrites))
+		})
+	}
+}
+
+func TestReverseProxyReplicas(t *testing.T) {
+	it := assert.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	primary, primaryAddr, primaryWrites := newReplicaServer("primary", "up", 0)
+	defer primary.Close()
+
+	replica, replicaAddr, _ := newReplicaServer("replica", "up", 0)
+	defer replica.Close()
+
+	transport := &redis.Transport{}
+	defer transport.CloseIdleConnections()
+
+	proxy, proxyAddr := redistest.FakeServer(&redis.ReverseProxy{
+		Transport: transport,
+		Registry: redis.ServerList{
+			{Addr: primaryAddr, Group: "shard"},
+			{Addr: replicaAddr, Group: "shard", Role: redis.ReplicaRole},
+		},
+		Replicas: &redis.ReplicaRouter{
+			Transport:     transport,
+			CheckInterval: 10 * time.Millisecond,
+		},
+	})
+	defer proxy.Close()
+
+	client := &redis.Client{Addr: proxyAddr, Transport: transport}
+
+	s, err := client.Get(ctx, "key")
+	for i := 0; i != 20 && err == nil && s != "replica"; i++ {
+		time.Sleep(10 * time.Millisecond)
+		s, err = client.Get(ctx, "key")
+	}
+	it.Nil(err)
+	it.Equal("replica", s)
+
+	it.Nil(client.Set(ctx, "key", "value"))
+	it.EqualValues(1, atomic.LoadInt64(primaryWrites))
+}
@@ -23,6 +23,10 @@ type Request struct {
 	// If not nil, this context is used to control asynchronous cancellation of
 	// the request when it is passed to a RoundTripper.
 	Context context.Context
+
+	// set by servers on the requests of transactions, whose commands don't
+	// include MULTI and EXEC
+	multi bool
 }
 
 // NewRequest returns a new Request, given an address, command, and list of
@@ -55,6 +59,48 @@ func (req *Request) IsTransaction() bool {
 	return len(req.Cmds) == 0 || req.Cmds[0].Cmd == "MULTI"
 }
 
+// inTransaction returns true if the request is a transaction, either sent by a
+// client or received by a server between MULTI and EXEC.
+func (req *Request) inTransaction() bool {
+	return req.multi || req.IsTransaction()
+}
+
+// IsBlocking returns true if the request contains commands that may block the
+// connection while waiting for data (BLPOP, XREAD, ...), false otherwise.
+//
+// Commands never block within a transaction.
+func (req *Request) IsBlocking() bool {
+	if req.IsTransaction() {
+		return false
+	}
+
+	for _, cmd := range req.Cmds {
+		if info := LookupCommand(cmd.Cmd); info != nil && info.HasFlag("blocking") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsReadOnly returns true if the request is made of read-only commands only,
+// which can be served by replicas, false otherwise.
+//
+// Transactions are never read-only.
+func (req *Request) IsReadOnly() bool {
+	if req.IsTransaction() {
+		return false
+	}
+
+	for _, cmd := range req.Cmds {
+		if info := LookupCommand(cmd.Cmd); info == nil || !info.IsReadOnly() {
+			return false
+		}
+	}
+
+	return true
+}
+
 // newRequest returns a request for reuse, see Response.Retry() for details.
 //
 // NOTE: It CANNOT be exported cause it should ensure the command is idempotent, see Response.Retry() for details!
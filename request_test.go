@@ -106,3 +106,36 @@ func TestServerTransportWithRetry(t *testing.T) {
 	err := client.Exec(context.Background(), cmd, key, value, "ex", time.Second)
 	it.Nil(err)
 }
+
+func TestRequestIsBlocking(t *testing.T) {
+	tests := []struct {
+		scenario string
+		cmds     []string
+		blocking bool
+	}{
+		{
+			scenario: "regular commands do not block",
+			cmds:     []string{"GET"},
+		},
+		{
+			scenario: "blocking commands block",
+			cmds:     []string{"xreadgroup"},
+			blocking: true,
+		},
+		{
+			scenario: "blocking commands do not block in transactions",
+			cmds:     []string{"MULTI", "BLPOP", "EXEC"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			req := &redis.Request{}
+			for _, cmd := range test.cmds {
+				req.Cmds = append(req.Cmds, redis.Command{Cmd: cmd})
+			}
+
+			assert.New(t).Equal(test.blocking, req.IsBlocking())
+		})
+	}
+}
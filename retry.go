@@ -0,0 +1,469 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dolab/objconv"
+	"github.com/dolab/objconv/resp"
+)
+
+// RetryTransport is an implementation of RoundTripper which retries requests
+// that failed because of temporary errors, optionally tracking the health of
+// the hosts with a circuit breaker.
+//
+// Requests are retried when the connection failed (dial errors, connection
+// resets, unexpected EOF, ...), or when the server responded with one of the
+// LOADING, TRYAGAIN, BUSY, MASTERDOWN or CLUSTERDOWN errors. Only requests made
+// of read-only commands are retried unless RetryWrites is set, since a write
+// may have been applied before the connection failed. Transactions are never
+// retried.
+//
+// RetryTransports are safe for concurrent use by multiple goroutines.
+type RetryTransport struct {
+	// Transport is the RoundTripper used to send requests, DefaultTransport is
+	// used if it is nil.
+	Transport RoundTripper
+
+	// MaxAttempts is the maximum number of times a request is sent, including
+	// the first attempt. Zero means 3 attempts.
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff bound the exponential backoff between
+	// attempts, the actual delays are randomly jittered between half and the
+	// full backoff. Zero values mean 10ms and 1s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// RetryWrites allows requests made of commands which are not read-only to
+	// be retried.
+	RetryWrites bool
+
+	// Breaker, if not nil, tracks the failures of the hosts that requests are
+	// sent to, rejecting requests to unhealthy hosts with ErrCircuitOpen.
+	Breaker *CircuitBreaker
+}
+
+// RoundTrip implements the RoundTripper interface.
+func (t *RetryTransport) RoundTrip(req *Request) (*Response, error) {
+	if !t.retryable(req) {
+		return t.roundTrip(req)
+	}
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// The arguments are consumed by each attempt, they are buffered so the
+	// request can be sent again.
+	cmds := make([][]interface{}, len(req.Cmds))
+
+	for i, cmd := range req.Cmds {
+		if cmd.Args == nil {
+			continue
+		}
+
+		var val interface{}
+
+		for cmd.Args.Next(&val) {
+			cmds[i] = append(cmds[i], val)
+			val = nil
+		}
+
+		if err := cmd.Args.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		r := &Request{
+			Addr:    req.Addr,
+			Cmds:    make([]Command, len(req.Cmds)),
+			Context: req.Context,
+		}
+
+		for i, cmd := range req.Cmds {
+			r.Cmds[i].Cmd = cmd.Cmd
+
+			if cmd.Args != nil {
+				r.Cmds[i].Args = &argsList{
+					dec: objconv.StreamDecoder{
+						Parser: objconv.NewValueParser(cmds[i]),
+					},
+				}
+			}
+		}
+
+		res, err := t.roundTrip(r)
+		retry := false
+
+		if err != nil {
+			retry = isRetryable(ctx, err)
+		} else if res.IsRespError() {
+			// The error is read to tell whether the request can be retried,
+			// the response is rebuilt so the caller still observes it.
+			rerr := res.Close()
+			res = &Response{Args: newArgsError(rerr), request: r, respTyp: objconv.Error}
+			retry = isTemporaryRespError(rerr)
+		}
+
+		if !retry || ctx.Err() != nil || attempt >= t.maxAttempts() {
+			return res, err
+		}
+
+		timer := time.NewTimer(t.backoff(attempt))
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (t *RetryTransport) roundTrip(req *Request) (*Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = DefaultTransport
+	}
+
+	if t.Breaker == nil {
+		return transport.RoundTrip(req)
+	}
+
+	if err := t.Breaker.allow(req.Addr); err != nil {
+		req.Close()
+		return nil, err
+	}
+
+	res, err := transport.RoundTrip(req)
+
+	switch {
+	case err != nil:
+		if ctx := req.Context; ctx != nil && ctx.Err() != nil {
+			// The request was abandoned, this says nothing of the host.
+			t.Breaker.release(req.Addr)
+		} else {
+			t.Breaker.report(req.Addr, isRetryable(ctx, err))
+		}
+
+	case res.IsRespError():
+		rerr := res.Close()
+		res = &Response{Args: newArgsError(rerr), request: req, respTyp: objconv.Error}
+
+		t.Breaker.report(req.Addr, isUnavailableRespError(rerr))
+
+	default:
+		t.Breaker.report(req.Addr, false)
+	}
+
+	return res, err
+}
+
+func (t *RetryTransport) retryable(req *Request) bool {
+	if t.maxAttempts() <= 1 || req.IsTransaction() {
+		return false
+	}
+
+	return t.RetryWrites || req.IsReadOnly()
+}
+
+func (t *RetryTransport) maxAttempts() int {
+	if n := t.MaxAttempts; n != 0 {
+		return n
+	}
+
+	return 3
+}
+
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	minBackoff, maxBackoff := t.MinBackoff, t.MaxBackoff
+	if minBackoff == 0 {
+		minBackoff = 10 * time.Millisecond
+	}
+	if maxBackoff == 0 {
+		maxBackoff = time.Second
+	}
+
+	backoff := minBackoff
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+// isRetryable returns true if err is an error that a request may succeed after,
+// the request context must not be done.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx != nil && ctx.Err() != nil {
+		return false
+	}
+
+	switch err {
+	case context.Canceled, context.DeadlineExceeded, ErrCircuitOpen:
+		return false
+	}
+
+	if e, ok := err.(*net.OpError); ok {
+		switch e.Err {
+		case context.Canceled, context.DeadlineExceeded:
+			return false
+		}
+		return true
+	}
+
+	return isTemporaryRespError(err)
+}
+
+// isTemporaryRespError returns true if err is an error response of a server
+// which couldn't process the command at the time.
+func isTemporaryRespError(err error) bool {
+	if e, ok := err.(*resp.Error); ok {
+		switch e.Type() {
+		case "TRYAGAIN", "BUSY":
+			return true
+		}
+	}
+
+	return isUnavailableRespError(err)
+}
+
+// isUnavailableRespError returns true if err is an error response of a server
+// which is not able to serve any command.
+func isUnavailableRespError(err error) bool {
+	if e, ok := err.(*resp.Error); ok {
+		switch e.Type() {
+		case "LOADING", "MASTERDOWN", "CLUSTERDOWN":
+			return true
+		}
+	}
+
+	return false
+}
+
+// CircuitState is the state of the circuit of a host in a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed is the state of healthy hosts, requests are sent to them.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen is the state of hosts that failed too many times, requests
+	// are rejected with ErrCircuitOpen.
+	CircuitOpen
+
+	// CircuitHalfOpen is the state of hosts that were open for long enough to
+	// be probed, a single request is sent to test whether they recovered.
+	CircuitHalfOpen
+)
+
+// String satisfies the fmt.Stringer interface.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// A CircuitBreaker tracks the failures of requests sent to hosts, and stops
+// sending requests to the hosts that keep failing.
+//
+// The circuit of a host opens after FailureThreshold consecutive failures, the
+// requests to the host are then rejected for OpenTimeout. Once the timeout
+// expires the circuit is half-open: a single request probes the host, closing
+// the circuit if it succeeds or opening it again if it fails.
+//
+// CircuitBreakers are safe for concurrent use by multiple goroutines.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures that open the
+	// circuit of a host. Zero means 5 failures.
+	FailureThreshold int
+
+	// OpenTimeout is the amount of time that the circuit of a host stays open
+	// before it is probed. Zero means 1s.
+	OpenTimeout time.Duration
+
+	// Blacklist, if not nil, is notified of the hosts that the circuit opens
+	// for. It is typically the ServerRegistry that the hosts were obtained
+	// from.
+	Blacklist ServerBlacklist
+
+	// OnStateChange, if not nil, is called when the circuit of a host changes
+	// state.
+	OnStateChange func(addr string, from CircuitState, to CircuitState)
+
+	mutex sync.Mutex
+	hosts map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// State returns the state of the circuit of the host at addr.
+func (b *CircuitBreaker) State(addr string) CircuitState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if c := b.hosts[addr]; c != nil {
+		if c.state == CircuitOpen && time.Since(c.openedAt) >= b.openTimeout() {
+			return CircuitHalfOpen
+		}
+		return c.state
+	}
+
+	return CircuitClosed
+}
+
+// allow returns ErrCircuitOpen if no requests can be sent to addr.
+func (b *CircuitBreaker) allow(addr string) (err error) {
+	var changes []stateChange
+
+	b.mutex.Lock()
+
+	if c := b.hosts[addr]; c != nil && c.state != CircuitClosed {
+		if c.state == CircuitOpen && time.Since(c.openedAt) >= b.openTimeout() {
+			changes = c.setState(addr, CircuitHalfOpen, changes)
+		}
+
+		if c.state == CircuitHalfOpen && !c.probing {
+			c.probing = true
+		} else {
+			err = ErrCircuitOpen
+		}
+	}
+
+	b.mutex.Unlock()
+
+	b.notify(changes)
+	return
+}
+
+// report records the outcome of a request sent to addr.
+func (b *CircuitBreaker) report(addr string, failed bool) {
+	var (
+		changes []stateChange
+		opened  bool
+	)
+
+	b.mutex.Lock()
+
+	if b.hosts == nil {
+		b.hosts = make(map[string]*circuit)
+	}
+
+	c := b.hosts[addr]
+	if c == nil && failed {
+		c = &circuit{}
+		b.hosts[addr] = c
+	}
+
+	switch {
+	case c == nil:
+		// healthy host
+
+	case !failed:
+		if c.state == CircuitHalfOpen {
+			changes = c.setState(addr, CircuitClosed, changes)
+		}
+
+		// Healthy hosts aren't tracked, this prevents the map from growing
+		// with the hosts that came and went.
+		if c.state == CircuitClosed {
+			delete(b.hosts, addr)
+		}
+
+	case c.state == CircuitHalfOpen:
+		c.openedAt = time.Now()
+		changes = c.setState(addr, CircuitOpen, changes)
+		opened = true
+
+	case c.state == CircuitClosed:
+		if c.failures++; c.failures >= b.failureThreshold() {
+			c.openedAt = time.Now()
+			changes = c.setState(addr, CircuitOpen, changes)
+			opened = true
+		}
+	}
+
+	if c != nil {
+		c.probing = false
+	}
+
+	b.mutex.Unlock()
+
+	b.notify(changes)
+
+	if opened && b.Blacklist != nil {
+		b.Blacklist.BlacklistServer(ServerEndpoint{Addr: addr})
+	}
+}
+
+// release records that a request sent to addr was abandoned, letting another
+// request probe the host if it was the probe.
+func (b *CircuitBreaker) release(addr string) {
+	b.mutex.Lock()
+
+	if c := b.hosts[addr]; c != nil {
+		c.probing = false
+	}
+
+	b.mutex.Unlock()
+}
+
+func (b *CircuitBreaker) notify(changes []stateChange) {
+	if b.OnStateChange != nil {
+		for _, change := range changes {
+			b.OnStateChange(change.addr, change.from, change.to)
+		}
+	}
+}
+
+func (b *CircuitBreaker) failureThreshold() int {
+	if n := b.FailureThreshold; n != 0 {
+		return n
+	}
+
+	return 5
+}
+
+func (b *CircuitBreaker) openTimeout() time.Duration {
+	if timeout := b.OpenTimeout; timeout != 0 {
+		return timeout
+	}
+
+	return time.Second
+}
+
+type stateChange struct {
+	addr string
+	from CircuitState
+	to   CircuitState
+}
+
+// setState changes the state of the circuit of addr, appending the change to
+// changes. The mutex of the breaker must be held.
+func (c *circuit) setState(addr string, state CircuitState, changes []stateChange) []stateChange {
+	changes = append(changes, stateChange{addr: addr, from: c.state, to: state})
+	c.state = state
+	return changes
+}
@@ -0,0 +1,290 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dolab/objconv/resp"
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context)
+	}{
+		{
+			scenario: "read-only commands are retried on LOADING errors",
+			function: testRetryTransportLoading,
+		},
+		{
+			scenario: "write commands are not retried",
+			function: testRetryTransportWrites,
+		},
+		{
+			scenario: "requests are sent at most MaxAttempts times",
+			function: testRetryTransportMaxAttempts,
+		},
+		{
+			scenario: "requests are retried on connection errors",
+			function: testRetryTransportConnectionErrors,
+		},
+		{
+			scenario: "errors which are not temporary are returned immediately",
+			function: testRetryTransportPermanentErrors,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			testFunc(t, ctx)
+		})
+	}
+}
+
+// newFailingServer starts a server which responds with err to the first
+// failures requests, and with the first argument of the command afterwards.
+func newFailingServer(failures int64, err error) (*redis.Server, string, *int64) {
+	calls := new(int64)
+
+	srv, addr := redistest.FakeServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var args []string
+		req.Cmds[0].ParseArgs(&args)
+
+		if atomic.AddInt64(calls, 1) <= failures {
+			res.Write(err)
+			return
+		}
+
+		res.Write(args[0])
+	}))
+
+	return srv, addr, calls
+}
+
+func testRetryTransportLoading(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, calls := newFailingServer(2, resp.NewError("LOADING Redis is loading the dataset in memory"))
+	defer srv.Close()
+
+	client := &redis.Client{
+		Addr:      addr,
+		Transport: &redis.RetryTransport{Transport: &redis.Transport{}, MinBackoff: time.Millisecond},
+	}
+
+	s, err := client.Get(ctx, "hello")
+	it.Nil(err)
+	it.Equal("hello", s)
+	it.EqualValues(3, atomic.LoadInt64(calls))
+}
+
+func testRetryTransportWrites(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, calls := newFailingServer(1, resp.NewError("LOADING Redis is loading the dataset in memory"))
+	defer srv.Close()
+
+	client := &redis.Client{
+		Addr:      addr,
+		Transport: &redis.RetryTransport{Transport: &redis.Transport{}, MinBackoff: time.Millisecond},
+	}
+
+	err := client.Exec(ctx, "SET", "hello", "world")
+	if it.NotNil(err) {
+		it.Equal("LOADING", err.(*resp.Error).Type())
+	}
+	it.EqualValues(1, atomic.LoadInt64(calls))
+}
+
+func testRetryTransportMaxAttempts(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, calls := newFailingServer(10, resp.NewError("TRYAGAIN Multiple keys request during rehashing of slot"))
+	defer srv.Close()
+
+	client := &redis.Client{
+		Addr: addr,
+		Transport: &redis.RetryTransport{
+			Transport:   &redis.Transport{},
+			MaxAttempts: 4,
+			MinBackoff:  time.Millisecond,
+		},
+	}
+
+	_, err := client.Get(ctx, "hello")
+	if it.NotNil(err) {
+		it.Equal("TRYAGAIN", err.(*resp.Error).Type())
+	}
+	it.EqualValues(4, atomic.LoadInt64(calls))
+}
+
+func testRetryTransportConnectionErrors(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, calls := newFailingServer(0, nil)
+	defer srv.Close()
+
+	tr := &flakyTransport{failures: 2, transport: &redis.Transport{}}
+
+	client := &redis.Client{
+		Addr:      addr,
+		Transport: &redis.RetryTransport{Transport: tr, MinBackoff: time.Millisecond},
+	}
+
+	s, err := client.Get(ctx, "hello")
+	it.Nil(err)
+	it.Equal("hello", s)
+	it.EqualValues(3, tr.calls())
+	it.EqualValues(1, atomic.LoadInt64(calls))
+}
+
+func testRetryTransportPermanentErrors(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, calls := newFailingServer(1, resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value"))
+	defer srv.Close()
+
+	client := &redis.Client{
+		Addr:      addr,
+		Transport: &redis.RetryTransport{Transport: &redis.Transport{}, MinBackoff: time.Millisecond},
+	}
+
+	_, err := client.Get(ctx, "hello")
+	if it.NotNil(err) {
+		it.Equal("WRONGTYPE", err.(*resp.Error).Type())
+	}
+	it.EqualValues(1, atomic.LoadInt64(calls))
+}
+
+// flakyTransport fails the first requests with connection errors, and sends
+// the next ones with transport.
+type flakyTransport struct {
+	mutex     sync.Mutex
+	failures  int
+	count     int
+	transport redis.RoundTripper
+}
+
+func (t *flakyTransport) RoundTrip(req *redis.Request) (*redis.Response, error) {
+	t.mutex.Lock()
+	t.count++
+	fail := t.count <= t.failures
+	t.mutex.Unlock()
+
+	if fail {
+		req.Close()
+		return nil, &net.OpError{Op: "request", Net: "redis", Err: errors.New("connection reset by peer")}
+	}
+
+	return t.transport.RoundTrip(req)
+}
+
+func (t *flakyTransport) setFailures(n int) {
+	t.mutex.Lock()
+	t.failures = t.count + n
+	t.mutex.Unlock()
+}
+
+func (t *flakyTransport) calls() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.count
+}
+
+type recordingBlacklist struct {
+	mutex     sync.Mutex
+	endpoints []redis.ServerEndpoint
+}
+
+func (b *recordingBlacklist) BlacklistServer(endpoint redis.ServerEndpoint) {
+	b.mutex.Lock()
+	b.endpoints = append(b.endpoints, endpoint)
+	b.mutex.Unlock()
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	it := assert.New(t)
+
+	srv, addr, _ := newFailingServer(0, nil)
+	defer srv.Close()
+
+	var (
+		blacklist = &recordingBlacklist{}
+		changes   []string
+	)
+
+	breaker := &redis.CircuitBreaker{
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+		Blacklist:        blacklist,
+		OnStateChange: func(addr string, from redis.CircuitState, to redis.CircuitState) {
+			changes = append(changes, from.String()+" -> "+to.String())
+		},
+	}
+
+	tr := &flakyTransport{failures: 3, transport: &redis.Transport{}}
+
+	client := &redis.Client{
+		Addr:      addr,
+		Transport: &redis.RetryTransport{Transport: tr, MaxAttempts: 1, Breaker: breaker},
+	}
+
+	ctx := context.Background()
+
+	// the circuit opens after 2 consecutive failures
+	_, err := client.Get(ctx, "hello")
+	it.NotNil(err)
+	it.Equal(redis.CircuitClosed, breaker.State(addr))
+
+	_, err = client.Get(ctx, "hello")
+	it.NotNil(err)
+	it.Equal(redis.CircuitOpen, breaker.State(addr))
+	it.Equal([]redis.ServerEndpoint{{Addr: addr}}, blacklist.endpoints)
+
+	// requests are rejected without being sent while the circuit is open
+	_, err = client.Get(ctx, "hello")
+	it.Equal(redis.ErrCircuitOpen, err)
+	it.Equal(2, tr.calls())
+
+	// a failed probe opens the circuit again
+	time.Sleep(30 * time.Millisecond)
+	it.Equal(redis.CircuitHalfOpen, breaker.State(addr))
+
+	_, err = client.Get(ctx, "hello")
+	it.NotNil(err)
+	it.Equal(redis.CircuitOpen, breaker.State(addr))
+	it.Equal(2, len(blacklist.endpoints))
+
+	// a successful probe closes the circuit
+	tr.setFailures(0)
+	time.Sleep(30 * time.Millisecond)
+
+	s, err := client.Get(ctx, "hello")
+	it.Nil(err)
+	it.Equal("hello", s)
+	it.Equal(redis.CircuitClosed, breaker.State(addr))
+
+	it.Equal([]string{
+		"closed -> open",
+		"open -> half-open",
+		"half-open -> open",
+		"open -> half-open",
+		"half-open -> closed",
+	}, changes)
+}
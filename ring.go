@@ -25,6 +25,29 @@ type ringNode struct {
 // keys to server addresses.
 type hashRing []ringNode
 
+// maxServerWeight is the maximum weight of the endpoints returned by the
+// registries, the weights of their sources range up to 65535 while each unit
+// of weight adds nodes to the ring.
+const maxServerWeight = 10
+
+// scaleWeight returns the weight of an endpoint of weight w, the weights are
+// scaled down to maxServerWeight relative to the largest weight max of the
+// endpoints. Endpoints of weight zero have a weight of one.
+func scaleWeight(w int, max int) int {
+	if w <= 0 {
+		return 1
+	}
+
+	if max <= maxServerWeight {
+		return w
+	}
+
+	// Rounded up so the smallest weights don't drop to zero.
+	return (w*maxServerWeight + max - 1) / max
+}
+
+// NewHashRing returns a ServerRing which distributes keys to the endpoints with
+// consistent hashing, in proportion of their weights.
 func NewHashRing(endpoints ...ServerEndpoint) ServerRing {
 	if len(endpoints) == 0 {
 		return nil
@@ -35,12 +58,28 @@ func NewHashRing(endpoints ...ServerEndpoint) ServerRing {
 	for _, endpoint := range endpoints {
 		h := jody.HashString64(endpoint.Addr)
 
+		weight := endpoint.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+
 		for i := 0; i != maxRingReplication; i++ {
 			ring = append(ring, ringNode{
 				endpoint: endpoint,
 				hash:     consistentHash(jody.AddUint64(h, uint64(i))),
 			})
 		}
+
+		// The nodes above are hashed from consecutive values, which jody
+		// doesn't mix well, but they are kept as they are so rings without
+		// weights don't change. The hashes of the nodes of the extra weight
+		// go through mix64 to be scattered across the ring.
+		for i := maxRingReplication; i < maxRingReplication*weight; i++ {
+			ring = append(ring, ringNode{
+				endpoint: endpoint,
+				hash:     consistentHash(mix64(jody.AddUint64(h, uint64(i)))),
+			})
+		}
 	}
 
 	sort.Sort(ring)
@@ -60,6 +99,21 @@ func (r hashRing) LookupServer(key string) ServerEndpoint {
 	return r[i].endpoint
 }
 
+// Endpoints satisfies the EndpointRing interface.
+func (r hashRing) Endpoints() []ServerEndpoint {
+	endpoints := make([]ServerEndpoint, 0, len(r)/maxRingReplication)
+	seen := make(map[string]bool, cap(endpoints))
+
+	for _, node := range r {
+		if !seen[node.endpoint.Addr] {
+			seen[node.endpoint.Addr] = true
+			endpoints = append(endpoints, node.endpoint)
+		}
+	}
+
+	return endpoints
+}
+
 func (r hashRing) Len() int {
 	return len(r)
 }
@@ -72,6 +126,13 @@ func (r hashRing) Swap(i int, j int) {
 	r[i], r[j] = r[j], r[i]
 }
 
+// mix64 is the finalizer of splitmix64.
+func mix64(h uint64) uint64 {
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	return h ^ (h >> 31)
+}
+
 func consistentHash(h uint64) uint64 {
 	const radix = 1e9
 	return h % radix
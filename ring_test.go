@@ -116,3 +116,26 @@ func BenchmarkHashRing(b *testing.B) {
 		}
 	})
 }
+
+func TestHashRingWeights(t *testing.T) {
+	ring := NewHashRing(
+		ServerEndpoint{Addr: "127.0.0.1:1000", Weight: 3},
+		ServerEndpoint{Addr: "127.0.0.1:1001"},
+	)
+
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	counts := map[string]int{}
+	for _, addr := range distribute(ring, keys...) {
+		counts[addr]++
+	}
+
+	// the first server should get most of the keys, the distribution isn't
+	// exact with so few servers
+	if n := (100 * counts["127.0.0.1:1000"]) / len(keys); n < 65 {
+		t.Errorf("the server with a weight of 3 got %d%% of the keys", n)
+	}
+}
@@ -0,0 +1,365 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SentinelRegistry is an implementation of ServerRegistry which discovers the
+// primary and replicas of a redis deployment monitored by Sentinel.
+//
+// The registry queries the sentinels for the address of the primary and the
+// list of its replicas, then subscribes to the +switch-master events of one of
+// the sentinels to follow failovers. When a failover happens the ring returned
+// by LookupServers is updated immediately, and the connections of the
+// transport to the old primary are flushed.
+//
+// The servers are exposed as a single shard group named after the master, the
+// ring implements ReplicaRing so reads can be routed to replicas with a
+// ReplicaRouter.
+//
+// SentinelRegistries are safe for concurrent use by multiple goroutines.
+type SentinelRegistry struct {
+	// Sentinels is the list of addresses of the sentinels monitoring the
+	// master.
+	Sentinels []string
+
+	// MasterName is the name of the master monitored by the sentinels.
+	MasterName string
+
+	// Transport is used to query the sentinels, its connections to old
+	// primaries are flushed after failovers. It is typically the transport that
+	// requests are sent to the servers with. If nil, DefaultTransport is used.
+	Transport *Transport
+
+	// RefreshInterval is the amount of time between queries of the sentinels,
+	// which catch up with failovers that the registry missed while it wasn't
+	// subscribed and with changes of the list of replicas. Zero means 30s.
+	RefreshInterval time.Duration
+
+	// Timeout is the maximum duration of the queries of the sentinels, the
+	// next sentinel is queried when one doesn't reply in time. Zero means 5s.
+	Timeout time.Duration
+
+	// OnFailover, if not nil, is called with the old and new primary when the
+	// registry observes a failover.
+	OnFailover func(from ServerEndpoint, to ServerEndpoint)
+
+	once     sync.Once
+	tr       *Transport
+	cancel   context.CancelFunc
+	refresh  chan struct{}
+	mutex    sync.RWMutex
+	ring     ServerRing
+	primary  ServerEndpoint
+	replicas []ServerEndpoint
+	err      error
+	ready    chan struct{}
+}
+
+// LookupServers satisfies the ServerRegistry interface.
+//
+// The first call blocks until the sentinels were queried, or ctx is done.
+func (r *SentinelRegistry) LookupServers(ctx context.Context) (ServerRing, error) {
+	r.once.Do(r.init)
+
+	select {
+	case <-r.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.ring == nil {
+		return nil, r.err
+	}
+
+	return r.ring, nil
+}
+
+// BlacklistServer satisfies the ServerBlacklist interface.
+//
+// Blacklisting the primary triggers a query of the sentinels, since it may
+// have been replaced.
+func (r *SentinelRegistry) BlacklistServer(endpoint ServerEndpoint) {
+	r.once.Do(r.init)
+
+	r.mutex.RLock()
+	primary := r.primary.Addr
+	r.mutex.RUnlock()
+
+	if endpoint.Addr == primary {
+		select {
+		case r.refresh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close stops the background goroutines of the registry.
+func (r *SentinelRegistry) Close() error {
+	r.once.Do(r.init)
+	r.cancel()
+	return nil
+}
+
+func (r *SentinelRegistry) init() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r.tr = r.Transport
+
+	if r.tr == nil {
+		if t, ok := DefaultTransport.(*Transport); ok {
+			r.tr = t
+		} else {
+			// DefaultTransport was replaced by a RoundTripper which cannot be
+			// used to subscribe or flush connections.
+			r.tr = &Transport{}
+		}
+	}
+
+	r.cancel = cancel
+	r.refresh = make(chan struct{}, 1)
+	r.ready = make(chan struct{})
+
+	go r.discover(ctx)
+	go r.subscribe(ctx)
+}
+
+// discover queries the sentinels periodically, or when it is asked to.
+func (r *SentinelRegistry) discover(ctx context.Context) {
+	ticker := time.NewTicker(r.refreshInterval())
+	defer ticker.Stop()
+
+	for first := true; ; first = false {
+		err := r.query(ctx)
+
+		if first {
+			if err != nil {
+				r.mutex.Lock()
+				r.err = err
+				r.mutex.Unlock()
+			}
+			close(r.ready)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.refresh:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// query asks the sentinels for the primary and replicas of the master, the
+// first sentinel which knows the master is used.
+func (r *SentinelRegistry) query(ctx context.Context) (err error) {
+	err = errors.New("redis: no sentinels to query")
+
+	for _, sentinel := range r.Sentinels {
+		var (
+			primary  ServerEndpoint
+			replicas []ServerEndpoint
+		)
+
+		if primary, err = r.queryPrimary(ctx, sentinel); err != nil {
+			continue
+		}
+
+		if replicas, err = r.queryReplicas(ctx, sentinel); err != nil {
+			continue
+		}
+
+		r.update(primary, replicas)
+		return
+	}
+
+	return
+}
+
+func (r *SentinelRegistry) queryPrimary(ctx context.Context, sentinel string) (primary ServerEndpoint, err error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout())
+	defer cancel()
+
+	var addr []string
+
+	if err = ParseArgs(r.client(sentinel).Query(ctx, "SENTINEL", "get-master-addr-by-name", r.MasterName), &addr); err != nil {
+		return
+	}
+
+	if len(addr) != 2 {
+		err = errorf("ERR sentinel %s doesn't know master %s", sentinel, r.MasterName)
+		return
+	}
+
+	primary = r.endpoint(net.JoinHostPort(addr[0], addr[1]), PrimaryRole)
+	return
+}
+
+func (r *SentinelRegistry) queryReplicas(ctx context.Context, sentinel string) (replicas []ServerEndpoint, err error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout())
+	defer cancel()
+
+	var list []map[string]string
+
+	if err = ParseArgs(r.client(sentinel).Query(ctx, "SENTINEL", "replicas", r.MasterName), &list); err != nil {
+		return
+	}
+
+	for _, replica := range list {
+		if !isHealthySentinelReplica(replica["flags"]) {
+			continue
+		}
+
+		replicas = append(replicas, r.endpoint(net.JoinHostPort(replica["ip"], replica["port"]), ReplicaRole))
+	}
+
+	return
+}
+
+// subscribe follows the +switch-master events of the sentinels, moving on to
+// the next sentinel when the subscription fails.
+func (r *SentinelRegistry) subscribe(ctx context.Context) {
+	for i := 0; ; i++ {
+		if len(r.Sentinels) != 0 {
+			r.watch(ctx, r.Sentinels[i%len(r.Sentinels)])
+		}
+
+		// Failovers may have been missed while the registry wasn't subscribed.
+		select {
+		case r.refresh <- struct{}{}:
+		default:
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *SentinelRegistry) watch(ctx context.Context, sentinel string) {
+	network, address := splitNetworkAddress(sentinel)
+
+	sub, err := r.tr.Subscribe(ctx, network, address, "+switch-master")
+	if err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		_, msg, err := sub.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// <master name> <old ip> <old port> <new ip> <new port>
+		fields := strings.Fields(string(msg))
+
+		if len(fields) == 5 && fields[0] == r.MasterName {
+			r.failover(r.endpoint(net.JoinHostPort(fields[3], fields[4]), PrimaryRole))
+		}
+	}
+}
+
+// failover makes primary the new primary, the old primary is removed from the
+// replicas until the sentinels are queried again.
+func (r *SentinelRegistry) failover(primary ServerEndpoint) {
+	r.mutex.RLock()
+	replicas := make([]ServerEndpoint, 0, len(r.replicas))
+
+	for _, replica := range r.replicas {
+		if replica.Addr != primary.Addr {
+			replicas = append(replicas, replica)
+		}
+	}
+
+	r.mutex.RUnlock()
+
+	r.update(primary, replicas)
+}
+
+func (r *SentinelRegistry) update(primary ServerEndpoint, replicas []ServerEndpoint) {
+	endpoints := make(ServerList, 0, 1+len(replicas))
+	endpoints = append(endpoints, primary)
+	endpoints = append(endpoints, replicas...)
+
+	r.mutex.Lock()
+	old := r.primary
+	r.primary = primary
+	r.replicas = replicas
+	r.ring = newShardRing(endpoints)
+	r.err = nil
+	r.mutex.Unlock()
+
+	if len(old.Addr) != 0 && old.Addr != primary.Addr {
+		r.tr.FlushConnections(old.Addr)
+
+		if r.OnFailover != nil {
+			r.OnFailover(old, primary)
+		}
+	}
+}
+
+func (r *SentinelRegistry) endpoint(addr string, role ServerRole) ServerEndpoint {
+	return ServerEndpoint{
+		Name:  r.MasterName,
+		Addr:  addr,
+		Role:  role,
+		Group: r.MasterName,
+	}
+}
+
+func (r *SentinelRegistry) client(sentinel string) *Client {
+	return &Client{Addr: sentinel, Transport: r.tr}
+}
+
+func (r *SentinelRegistry) refreshInterval() time.Duration {
+	if interval := r.RefreshInterval; interval != 0 {
+		return interval
+	}
+
+	return 30 * time.Second
+}
+
+func (r *SentinelRegistry) timeout() time.Duration {
+	if timeout := r.Timeout; timeout != 0 {
+		return timeout
+	}
+
+	return 5 * time.Second
+}
+
+func isHealthySentinelReplica(flags string) bool {
+	for _, flag := range strings.Split(flags, ",") {
+		switch flag {
+		case "s_down", "o_down", "disconnected":
+			return false
+		}
+	}
+	return true
+}
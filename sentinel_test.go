@@ -0,0 +1,237 @@
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+// fakeSentinel is a redis.Handler which implements the subset of the Sentinel
+// protocol used by redis.SentinelRegistry.
+type fakeSentinel struct {
+	mutex       sync.Mutex
+	master      string
+	primary     string
+	replicas    []string
+	subscribers []*bufio.ReadWriter
+	subscribed  chan struct{}
+}
+
+func (s *fakeSentinel) ServeRedis(res redis.ResponseWriter, req *redis.Request) {
+	var args []string
+	req.Cmds[0].ParseArgs(&args)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch req.Cmds[0].Cmd {
+	case "SENTINEL":
+		if len(args) != 2 || args[1] != s.master {
+			res.Write(nil)
+			return
+		}
+
+		switch args[0] {
+		case "get-master-addr-by-name":
+			host, port, _ := net.SplitHostPort(s.primary)
+			res.Write([]string{host, port})
+
+		case "replicas":
+			replicas := make([][]string, 0, len(s.replicas))
+
+			for _, replica := range s.replicas {
+				host, port, _ := net.SplitHostPort(replica)
+				replicas = append(replicas, []string{"name", replica, "ip", host, "port", port, "flags", "slave"})
+			}
+
+			res.Write(replicas)
+		}
+
+	case "SUBSCRIBE":
+		_, rw, err := res.(redis.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+
+		fmt.Fprintf(rw, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[0]), args[0])
+		rw.Flush()
+
+		s.subscribers = append(s.subscribers, rw)
+		s.subscribed <- struct{}{}
+	}
+}
+
+// failover makes addr the primary and publishes the +switch-master event.
+func (s *fakeSentinel) failover(addr string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	oldHost, oldPort, _ := net.SplitHostPort(s.primary)
+	newHost, newPort, _ := net.SplitHostPort(addr)
+
+	replicas := []string{s.primary}
+	for _, replica := range s.replicas {
+		if replica != addr {
+			replicas = append(replicas, replica)
+		}
+	}
+
+	s.primary, s.replicas = addr, replicas
+
+	msg := fmt.Sprintf("%s %s %s %s %s", s.master, oldHost, oldPort, newHost, newPort)
+
+	for _, rw := range s.subscribers {
+		fmt.Fprintf(rw, "*3\r\n$7\r\nmessage\r\n$14\r\n+switch-master\r\n$%d\r\n%s\r\n", len(msg), msg)
+		rw.Flush()
+	}
+}
+
+func TestSentinelRegistry(t *testing.T) {
+	it := assert.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	ping := redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		res.Write("PONG")
+	})
+
+	primary, primaryAddr := redistest.FakeServer(ping)
+	defer primary.Close()
+
+	replica, replicaAddr := redistest.FakeServer(ping)
+	defer replica.Close()
+
+	sentinel := &fakeSentinel{
+		master:     "mymaster",
+		primary:    primaryAddr,
+		replicas:   []string{replicaAddr},
+		subscribed: make(chan struct{}, 1),
+	}
+
+	sentinelServer, sentinelAddr := redistest.FakeServer(sentinel)
+	defer sentinelServer.Close()
+
+	transport := &redis.Transport{}
+	defer transport.CloseIdleConnections()
+
+	failovers := make(chan [2]string, 1)
+
+	registry := &redis.SentinelRegistry{
+		Sentinels:  []string{"127.0.0.1:1", sentinelAddr}, // the first sentinel is down
+		MasterName: "mymaster",
+		Transport:  transport,
+		OnFailover: func(from redis.ServerEndpoint, to redis.ServerEndpoint) {
+			failovers <- [2]string{from.Addr, to.Addr}
+		},
+	}
+	defer registry.Close()
+
+	ring, err := registry.LookupServers(ctx)
+	if !it.Nil(err) {
+		return
+	}
+
+	it.Equal(redis.ServerEndpoint{Name: "mymaster", Addr: primaryAddr, Role: redis.PrimaryRole, Group: "mymaster"}, ring.LookupServer("key"))
+	it.Equal([]redis.ServerEndpoint{
+		{Name: "mymaster", Addr: replicaAddr, Role: redis.ReplicaRole, Group: "mymaster"},
+	}, ring.(redis.ReplicaRing).LookupReplicas("key"))
+
+	// opens a connection to the primary that must be flushed on failover
+	client := &redis.Client{Addr: primaryAddr, Transport: transport}
+	it.Nil(client.Exec(ctx, "PING"))
+	it.Equal(1, transport.Stats()[primaryAddr].Idle)
+
+	select {
+	case <-sentinel.subscribed:
+	case <-ctx.Done():
+		t.Fatal("the registry never subscribed to the sentinel")
+	}
+
+	sentinel.failover(replicaAddr)
+
+	select {
+	case failover := <-failovers:
+		it.Equal([2]string{primaryAddr, replicaAddr}, failover)
+	case <-ctx.Done():
+		t.Fatal("the registry never observed the failover")
+	}
+
+	ring, err = registry.LookupServers(ctx)
+	if it.Nil(err) {
+		it.Equal(replicaAddr, ring.LookupServer("key").Addr)
+	}
+
+	it.Equal(0, transport.Stats()[primaryAddr].OpenConnections)
+}
+
+func TestSentinelRegistryTimeout(t *testing.T) {
+	it := assert.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	sentinel := &fakeSentinel{
+		master:     "mymaster",
+		primary:    "127.0.0.1:6379",
+		subscribed: make(chan struct{}, 10),
+	}
+
+	sentinelServer, sentinelAddr := redistest.FakeServer(sentinel)
+	defer sentinelServer.Close()
+
+	done := make(chan struct{})
+
+	// The first sentinel accepts connections but never replies.
+	hang := redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		<-done
+	})
+
+	hangServer, hangAddr := redistest.FakeServer(hang)
+	defer hangServer.Close()
+	defer close(done)
+
+	registry := &redis.SentinelRegistry{
+		Sentinels:  []string{hangAddr, sentinelAddr},
+		MasterName: "mymaster",
+		Transport:  &redis.Transport{},
+		Timeout:    100 * time.Millisecond,
+	}
+	defer registry.Close()
+
+	ring, err := registry.LookupServers(ctx)
+	if it.Nil(err) {
+		it.Equal("127.0.0.1:6379", ring.LookupServer("key").Addr)
+	}
+}
+
+func TestSentinelRegistryUnknownMaster(t *testing.T) {
+	it := assert.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	sentinel := &fakeSentinel{master: "mymaster", subscribed: make(chan struct{}, 10)}
+
+	sentinelServer, sentinelAddr := redistest.FakeServer(sentinel)
+	defer sentinelServer.Close()
+
+	registry := &redis.SentinelRegistry{
+		Sentinels:  []string{sentinelAddr},
+		MasterName: "unknown",
+		Transport:  &redis.Transport{},
+	}
+	defer registry.Close()
+
+	_, err := registry.LookupServers(ctx)
+	it.NotNil(err)
+}
@@ -7,7 +7,9 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dolab/objconv"
@@ -60,6 +62,45 @@ type Hijacker interface {
 	Hijack() (net.Conn, *bufio.ReadWriter, error)
 }
 
+// contextKey is the type of the keys of the values that servers set on the
+// contexts of requests.
+type contextKey struct {
+	name string
+}
+
+func (k *contextKey) String() string { return "redis context value " + k.name }
+
+var (
+	// ServerContextKey is a context key. It can be used in handlers with
+	// Request.Context.Value to access the server that started the handler. The
+	// associated value is of type *Server.
+	ServerContextKey = &contextKey{"redis-server"}
+
+	// LocalAddrContextKey is a context key. It can be used in handlers with
+	// Request.Context.Value to access the local address that the connection
+	// arrived on. The associated value is of type net.Addr.
+	LocalAddrContextKey = &contextKey{"local-addr"}
+
+	// UserContextKey is a context key. It can be used in handlers with
+	// Request.Context.Value to access the name of the user that the connection
+	// authenticated as, it is only set on the requests of authenticated
+	// connections. The associated value is of type string.
+	UserContextKey = &contextKey{"user"}
+)
+
+const (
+	// DefaultMaxRequestSize is the default maximum size of requests.
+	DefaultMaxRequestSize = 1 << 30
+
+	// DefaultMaxBulkLen is the default maximum length of the arguments of
+	// commands.
+	DefaultMaxBulkLen = 512 << 20
+
+	// DefaultMaxMultiBulkLen is the default maximum number of arguments of
+	// commands.
+	DefaultMaxMultiBulkLen = 1 << 20
+)
+
 // A Server defines parameters for running a Redis server.
 type Server struct {
 	// The address to listen on, ":6379" if empty.
@@ -75,6 +116,15 @@ type Server struct {
 	EnableRetry    bool
 	EnablePipeline bool
 
+	// EnableBuiltins makes the server answer INFO, CLIENT, COMMAND, CONFIG,
+	// HELLO, SLOWLOG, LATENCY and MONITOR itself instead of passing them to the
+	// handler, see HandleInfo to add sections to the reply of INFO. PING is
+	// always answered by the server.
+	//
+	// The built-in commands are answered before the handler is invoked, they
+	// bypass handlers like CommandPolicy or ReverseProxy's Namespace.
+	EnableBuiltins bool
+
 	// ReadTimeout is the maximum duration for reading the entire request,
 	// including the reading the argument list.
 	ReadTimeout time.Duration
@@ -88,6 +138,81 @@ type Server struct {
 	// zero, there is no timeout.
 	IdleTimeout time.Duration
 
+	// CommandTimeouts overrides the maximum duration of requests made of the
+	// given commands, the keys are command names in upper case. A duration of
+	// zero means the requests never time out.
+	//
+	// By default the context of a request expires after ReadTimeout, except for
+	// blocking commands (BLPOP, XREAD, WAIT, ...) which have no deadline and are
+	// expected to honor the timeout passed as argument. The context of requests
+	// made of blocking commands or of commands listed here is also canceled when
+	// the client disconnects.
+	CommandTimeouts map[string]time.Duration
+
+	// Authenticate, if not nil, is called to check the credentials that
+	// clients pass to AUTH, which is then answered by the server itself, and
+	// clients must authenticate before sending other commands. The user is
+	// "default" when clients pass only a password. Returning a *resp.Error
+	// sends it to the client, other errors are reported as invalid credentials.
+	Authenticate func(user string, password string) error
+
+	// MaxConns, if not zero, is the maximum number of connections served at
+	// the same time, and MaxConnsPerIP the maximum number of connections from
+	// the same IP address. Connections exceeding the limits are answered with
+	// an error and closed.
+	MaxConns      int
+	MaxConnsPerIP int
+
+	// AcceptRate, if not zero, is the maximum number of connections accepted
+	// per second, AcceptBurst is the number of connections that can be
+	// accepted at once and defaults to max(1, AcceptRate). Connections are
+	// left in the backlog of listeners until they can be accepted.
+	AcceptRate  float64
+	AcceptBurst int
+
+	// MaxRequestSize is the maximum size in bytes of requests, including all
+	// the commands of transactions. MaxBulkLen is the maximum length of the
+	// arguments of commands, and MaxMultiBulkLen the maximum number of
+	// arguments of commands. Clients exceeding the limits are answered with a
+	// protocol error and disconnected. If zero, DefaultMaxRequestSize,
+	// DefaultMaxBulkLen and DefaultMaxMultiBulkLen are used.
+	MaxRequestSize  int
+	MaxBulkLen      int
+	MaxMultiBulkLen int
+
+	// MaxQueuedCommands, if not zero, is the maximum number of commands of
+	// transactions. Commands exceeding the limit are answered with an error,
+	// and the transaction is discarded when EXEC is received.
+	MaxQueuedCommands int
+
+	// SlowLogThreshold, if not zero, is the duration above which requests are
+	// recorded in the slow log of the server, which keeps the last
+	// SlowLogMaxLen requests, or DefaultSlowLogMaxLen if zero. See SlowLog.
+	SlowLogThreshold time.Duration
+	SlowLogMaxLen    int
+
+	// LatencyThreshold, if not zero, is the duration above which the latency
+	// of requests and of the events reported with RecordLatency is recorded
+	// by the latency monitor of the server.
+	LatencyThreshold time.Duration
+
+	// Observer, if not nil, receives the commands served by the server.
+	Observer CommandObserver
+
+	// MonitorBufferSize is the number of commands buffered for each client of
+	// MONITOR, DefaultMonitorBufferSize if zero. Clients which don't read the
+	// commands fast enough are disconnected.
+	MonitorBufferSize int
+
+	// PubSub, if not nil, is the broker of the Pub/Sub messages of the
+	// server, which then answers the Pub/Sub commands itself.
+	PubSub *PubSub
+
+	// NotifyKeyspaceEvents selects the keyspace notifications published by
+	// NotifyKeyspaceEvent, none are published if zero. Like in redis, it must
+	// include NotifyKeyspace or NotifyKeyevent, and the classes of events.
+	NotifyKeyspaceEvents NotifyFlags
+
 	// ErrorLog specifies an optional logger for errors accepting connections
 	// and unexpected behavior from handlers. If nil, logging goes to os.Stderr
 	// via the log package's standard logger.
@@ -98,6 +223,19 @@ type Server struct {
 	serveOnce   sync.Once
 	listeners   map[net.Listener]struct{}
 	connections map[*Conn]struct{}
+	addrs       map[string]int
+	lastID      uint64
+	pause       *clientPause
+	infos       []infoSection
+	stats       serverStats
+	startedAt   time.Time
+	runID       string
+	config      atomic.Value // serverConfig
+	slowlog     slowLog
+	latency     latencyMonitor
+	monitors    map[*connFeed]struct{}
+	nmonitors   int32
+	tracking    trackingTable
 	context     context.Context
 	shutdown    context.CancelFunc
 }
@@ -207,20 +345,28 @@ func (s *Server) Serve(l net.Listener) error {
 
 	s.trackListener(l)
 
-	config := serverConfig{
-		idleTimeout:  s.IdleTimeout,
-		readTimeout:  s.ReadTimeout,
-		writeTimeout: s.WriteTimeout,
-		retryable:    s.EnableRetry,
-	}
-
-	if config.idleTimeout == 0 {
-		config.idleTimeout = config.readTimeout
-	}
+	s.mutex.Lock()
+	config := s.makeConfig()
+	s.config.Store(config)
+	s.mutex.Unlock()
 
-	attempt := 0
+	var (
+		attempt = 0
+		accepts = RateLimitRule{Rate: s.AcceptRate, Burst: s.AcceptBurst}
+		bucket  = rateLimitBucket{tokens: float64(accepts.burst()), last: time.Now()}
+	)
 
 	for {
+		if accepts.Rate > 0 {
+			if wait := bucket.take(accepts.Rate, accepts.burst(), time.Now()); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-s.context.Done():
+					return ErrServerClosed
+				}
+			}
+		}
+
 		conn, err := l.Accept()
 
 		if err != nil {
@@ -249,7 +395,18 @@ func (s *Server) Serve(l net.Listener) error {
 		}
 
 		attempt = 0
+		config = s.loadConfig(config)
 		c := NewServerConn(conn, s)
+		c.limits = config.limits
+
+		err = s.admitConnection(c)
+		s.recordConnection(err != nil)
+
+		if err != nil {
+			go rejectConnection(conn, err)
+			continue
+		}
+
 		c.setState(http.StateNew)
 		go s.serveConnection(s.context, c, config)
 	}
@@ -257,10 +414,17 @@ func (s *Server) Serve(l net.Listener) error {
 
 func (s *Server) serveConnection(ctx context.Context, c *Conn, config serverConfig) {
 	ctx, cancel := context.WithCancel(ctx)
+	ctx = context.WithValue(ctx, ServerContextKey, s)
+	ctx = context.WithValue(ctx, LocalAddrContextKey, c.LocalAddr())
+	ctx = context.WithValue(ctx, connContextKey, c)
 	defer func() {
 		cancel()
-		c.Close()
-		c.setState(http.StateClosed)
+
+		// Hijacked connections are owned by the handler that took them over.
+		if state, _ := c.getState(); state != http.StateHijacked {
+			c.Close()
+			c.setState(http.StateClosed)
+		}
 	}()
 
 	var (
@@ -277,6 +441,11 @@ func (s *Server) serveConnection(ctx context.Context, c *Conn, config serverConf
 			return
 		}
 
+		// Changes made with CONFIG SET apply from the next request.
+		config = s.loadConfig(config)
+		c.limits = config.limits
+		c.argv.reset(config.slowLogThreshold > 0)
+
 		if c.waitReadyRead(config.idleTimeout) != nil {
 			return
 		}
@@ -289,14 +458,50 @@ func (s *Server) serveConnection(ctx context.Context, c *Conn, config serverConf
 		cmds = append(cmds, Command{})
 
 		if !cmdReader.Read(&cmds[0]) {
+			// Clients exceeding the limits of requests are told why they are
+			// disconnected.
+			if err := cmdReader.limitErr(); err != nil {
+				s.writeError(c, err, config)
+			}
+
 			s.log(cmdReader.Close())
 			return
 		}
 
+		// Subscribers are served in Pub/Sub mode until they unsubscribe from
+		// all their channels and patterns.
+		if s.PubSub != nil && isSubscribeCommand(cmds[0].Cmd) && (s.Authenticate == nil || len(c.user) != 0) {
+			var args []string
+
+			err := cmds[0].ParseArgs(&args)
+			if cerr := cmdReader.Close(); err == nil {
+				err = cerr
+			}
+
+			if err != nil {
+				s.log(err)
+				return
+			}
+
+			c.beginRequest([]string{cmds[0].Cmd}, time.Now())
+
+			if !s.serveSubscriber(ctx, c, cmds[0].Cmd, args, config) {
+				return
+			}
+
+			c.setState(http.StateIdle)
+			continue
+		}
+
+		multi := false
+
 		// for transaction
 		if cmds[0].Cmd == "MULTI" {
+			aborted := false
+
 			// Transactions have to be loaded in memory because the server has to
 			// interleave responses between each command it receives.
+		queue:
 			for {
 				lastIndex := len(cmds)
 				if lastIndex > 0 {
@@ -316,6 +521,22 @@ func (s *Server) serveConnection(ctx context.Context, c *Conn, config serverConf
 					cmds = cmds[:lastIndex]
 					break
 				}
+
+				// Commands exceeding the maximum are not queued, the transaction
+				// is aborted when EXEC is received.
+				for config.maxQueuedCommands > 0 && lastIndex > config.maxQueuedCommands && cmd.Cmd != "EXEC" && cmd.Cmd != "DISCARD" {
+					cmd.Args.Close()
+					aborted = true
+
+					if err := s.writeError(c, errorf("ERR max number of queued commands reached"), config); err != nil {
+						return
+					}
+
+					if !cmdReader.Read(cmd) {
+						cmds = cmds[:lastIndex]
+						break queue
+					}
+				}
 			}
 
 			lastIndex := len(cmds) - 1
@@ -330,14 +551,50 @@ func (s *Server) serveConnection(ctx context.Context, c *Conn, config serverConf
 				continue // discarded transactions are not passed to the handler
 			}
 
+			if aborted && cmds[lastIndex].Cmd == "EXEC" {
+				cmds[lastIndex].Args.Close()
+
+				if err := s.writeError(c, errorf("EXECABORT Transaction discarded because of previous errors."), config); err != nil {
+					return
+				}
+
+				for _, cmd := range cmds[1:lastIndex] {
+					cmd.Args.Close()
+				}
+
+				if err := cmdReader.Close(); err != nil {
+					s.log(err)
+					return
+				}
+				c.setState(http.StateIdle)
+				continue
+			}
+
 			cmds = cmds[1:lastIndex]
+			multi = true
 		}
 
-		if err := s.serveCommands(c, remoteAddr, cmds, config); err != nil {
+		if err := s.serveCommands(ctx, c, remoteAddr, cmds, multi, config); err != nil {
 			s.log(err)
 			return
 		}
 
+		// Clients which killed their own connection are disconnected after
+		// the response.
+		if c.killed() {
+			cmdReader.Close()
+			return
+		}
+
+		if c.monitoring() {
+			if err := cmdReader.Close(); err != nil {
+				s.log(err)
+				return
+			}
+			s.serveMonitor(ctx, c, config)
+			return
+		}
+
 		if err := cmdReader.Close(); err != nil {
 			s.log(err)
 			return
@@ -346,7 +603,7 @@ func (s *Server) serveConnection(ctx context.Context, c *Conn, config serverConf
 	}
 }
 
-func (s *Server) serveCommands(c *Conn, addr string, cmds []Command, config serverConfig) (err error) {
+func (s *Server) serveCommands(ctx context.Context, c *Conn, addr string, cmds []Command, multi bool, config serverConfig) (err error) {
 	var (
 		names      = make([]string, len(cmds))
 		remoteAddr = metrics.TrimPort(addr)
@@ -357,16 +614,55 @@ func (s *Server) serveCommands(c *Conn, addr string, cmds []Command, config serv
 		names[i] = cmd.Cmd
 	}
 
+	c.beginRequest(names, issuedAt)
+
+	var argv [][]string
+	if s.observed() {
+		argv = observeArgs(cmds)
+		s.feedMonitors(c, issuedAt, cmds, argv)
+	}
+
+	if s.tracked() {
+		s.trackReads(c, cmds)
+	}
+
 	// inc request and commands of processing
 	gometrics.IncRequest(remoteAddr, localAddr)
 	gometrics.IncCommands(remoteAddr, localAddr, names)
 
-	ctx, cancel := context.WithTimeout(context.Background(), config.readTimeout)
-
 	req := &Request{
-		Addr:    addr,
-		Cmds:    cmds,
-		Context: ctx,
+		Addr:  addr,
+		Cmds:  cmds,
+		multi: multi,
+	}
+
+	timeout, longPoll := config.requestTimeout(req)
+
+	var cancel context.CancelFunc
+	if timeout == 0 {
+		req.Context, cancel = context.WithCancel(ctx)
+	} else {
+		req.Context, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	if len(c.user) != 0 {
+		req.Context = context.WithValue(req.Context, UserContextKey, c.user)
+	}
+
+	var timing *requestTiming
+	if config.slowLogThreshold > 0 {
+		timing = &requestTiming{}
+		req.Context = context.WithValue(req.Context, requestTimingContextKey, timing)
+	}
+
+	var stopWatch func()
+	if longPoll {
+		// The arguments are loaded in memory so the connection can be watched
+		// for the client going away while the handler is blocked.
+		for i := range cmds {
+			cmds[i].loadByteArgs()
+		}
+		stopWatch = c.watchClose(cancel)
 	}
 
 	res := &responseWriter{
@@ -376,10 +672,15 @@ func (s *Server) serveCommands(c *Conn, addr string, cmds []Command, config serv
 
 	err = s.serveRequest(res, req)
 
+	if stopWatch != nil {
+		stopWatch()
+		c.setReadTimeout(config.readTimeout)
+	}
+
 	// is this a pipeline?
 	reqErr := req.Close()
 	if s.EnablePipeline && err == nil && reqErr == nil {
-		pipeErr := s.servePipeline(c, addr, cmds, config)
+		pipeErr := s.servePipeline(ctx, c, addr, cmds, config)
 		if pipeErr != ErrNotPipeline {
 			err = pipeErr
 		}
@@ -388,6 +689,24 @@ func (s *Server) serveCommands(c *Conn, addr string, cmds []Command, config serv
 	// cancel context
 	cancel()
 
+	c.endRequest(time.Now())
+
+	elapsed := time.Since(issuedAt)
+	s.recordCommands(names, elapsed)
+	s.recordSlowRequest(c, names, issuedAt, elapsed, timing, config)
+
+	if argv != nil {
+		cmdErr := err
+		if cmdErr == nil {
+			cmdErr = res.err
+		}
+		s.observeCommands(c, addr, issuedAt, names, argv, elapsed, cmdErr)
+	}
+
+	if config.latencyThreshold > 0 && elapsed >= config.latencyThreshold {
+		s.latency.add(latencyEventOf(names), elapsed, time.Now())
+	}
+
 	// for request duration
 	gometrics.ObserveRequest(remoteAddr, localAddr, issuedAt)
 
@@ -400,7 +719,7 @@ func (s *Server) serveCommands(c *Conn, addr string, cmds []Command, config serv
 	return
 }
 
-func (s *Server) servePipeline(c *Conn, addr string, cmds []Command, config serverConfig) (err error) {
+func (s *Server) servePipeline(ctx context.Context, c *Conn, addr string, cmds []Command, config serverConfig) (err error) {
 	var (
 		pipeCmds []Command
 	)
@@ -422,7 +741,7 @@ func (s *Server) servePipeline(c *Conn, addr string, cmds []Command, config serv
 		// TODO: This is for temporary solution and it should refactor to pipeline way!
 		c.setTimeout(config.readTimeout)
 
-		err = s.serveCommands(c, addr, pipeCmds, config)
+		err = s.serveCommands(ctx, c, addr, pipeCmds, false, config)
 	}
 
 	return
@@ -446,13 +765,22 @@ func (s *Server) serveRequest(res *responseWriter, req *Request) (err error) {
 	}
 
 	for _, cmd := range req.Cmds {
-		switch cmd.Cmd {
-		case "PING":
-			msg := "PONG"
-			cmd.ParseArgs(&msg)
-			addPreparedResponse(i, msg)
+		switch {
+		case s.Authenticate != nil && cmd.Cmd == "AUTH":
+			addPreparedResponse(i, s.authenticate(res.conn, cmd))
+
+		case s.Authenticate != nil && len(res.conn.user) == 0 && !(s.EnableBuiltins && cmd.Cmd == "HELLO"):
+			if cmd.Args != nil {
+				cmd.Args.Close()
+			}
+			addPreparedResponse(i, errorf("NOAUTH Authentication required."))
 
 		default:
+			if builtin := s.builtin(cmd.Cmd); builtin != nil {
+				addPreparedResponse(i, builtin(res.conn, cmd))
+				continue
+			}
+
 			req.Cmds[i] = cmd
 			i++
 		}
@@ -465,6 +793,7 @@ func (s *Server) serveRequest(res *responseWriter, req *Request) (err error) {
 	}
 
 	if req.Cmds = req.Cmds[:i]; len(req.Cmds) != 0 {
+		s.waitPause(req.Context, req.Cmds)
 		err = s.serveRedis(w, req)
 	}
 
@@ -479,6 +808,46 @@ func (s *Server) serveRequest(res *responseWriter, req *Request) (err error) {
 	return
 }
 
+// authenticate answers the AUTH command cmd received on the connection c.
+func (s *Server) authenticate(c *Conn, cmd Command) interface{} {
+	var args []string
+
+	if err := cmd.ParseArgs(&args); err != nil {
+		return err
+	}
+
+	var user, password string
+
+	switch len(args) {
+	case 1:
+		user, password = "default", args[0]
+	case 2:
+		user, password = args[0], args[1]
+	default:
+		return errorf("ERR wrong number of arguments for 'auth' command")
+	}
+
+	if err := s.login(c, user, password); err != nil {
+		return err
+	}
+
+	return "OK"
+}
+
+// login authenticates the connection c as user, or returns the error to answer
+// the client with if the credentials are invalid.
+func (s *Server) login(c *Conn, user string, password string) error {
+	if err := s.Authenticate(user, password); err != nil {
+		if e, ok := err.(*resp.Error); ok {
+			return e
+		}
+		return errorf("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+
+	c.setUser(user)
+	return nil
+}
+
 func (s *Server) serveRedis(res ResponseWriter, req *Request) (err error) {
 	defer func() {
 		if v := recover(); v != nil {
@@ -490,6 +859,20 @@ func (s *Server) serveRedis(res ResponseWriter, req *Request) (err error) {
 	return
 }
 
+// writeError writes err to c, outside of the response to a request.
+func (s *Server) writeError(c *Conn, err error, config serverConfig) error {
+	res := &responseWriter{
+		conn:    c,
+		timeout: config.writeTimeout,
+	}
+
+	if err := res.Write(err); err != nil {
+		return err
+	}
+
+	return res.Flush()
+}
+
 func (s *Server) log(err error) {
 	if err == ErrHijacked || err == ErrNotPipeline {
 		return
@@ -510,6 +893,10 @@ func (s *Server) trackListener(l net.Listener) {
 		s.context, s.shutdown = context.WithCancel(context.Background())
 	}
 
+	if s.startedAt.IsZero() {
+		s.startedAt, s.runID = time.Now(), newRunID()
+	}
+
 	s.listeners[l] = struct{}{}
 	s.mutex.Unlock()
 }
@@ -520,24 +907,94 @@ func (s *Server) untrackListener(l net.Listener) {
 	s.mutex.Unlock()
 }
 
+// admitConnection tracks c if it doesn't exceed the limits of connections, or
+// returns the error to answer it with.
+func (s *Server) admitConnection(c *Conn) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.MaxConns > 0 && len(s.connections) >= s.MaxConns {
+		return errorf("ERR max number of clients reached")
+	}
+
+	if ip := connectionIP(c); s.MaxConnsPerIP > 0 && len(ip) != 0 && s.addrs[ip] >= s.MaxConnsPerIP {
+		return errorf("ERR max number of clients per IP address reached")
+	}
+
+	s.addConnection(c)
+	return nil
+}
+
 func (s *Server) trackConnection(c *Conn) {
 	s.mutex.Lock()
+	s.addConnection(c)
+	s.mutex.Unlock()
+}
 
+// addConnection tracks c, the server's mutex must be held.
+func (s *Server) addConnection(c *Conn) {
 	if s.connections == nil {
 		s.connections = map[*Conn]struct{}{}
+		s.addrs = map[string]int{}
+	}
+
+	if _, ok := s.connections[c]; ok {
+		return
 	}
 
 	s.connections[c] = struct{}{}
 
-	s.mutex.Unlock()
+	if ip := connectionIP(c); len(ip) != 0 {
+		s.addrs[ip]++
+	}
+
+	s.lastID++
+	now := time.Now()
+
+	c.client.mutex.Lock()
+	c.client.id = s.lastID
+	c.client.createdAt = now
+	c.client.lastAt = now
+	c.client.mutex.Unlock()
 }
 
 func (s *Server) untrackConnection(c *Conn) {
 	s.mutex.Lock()
 
-	delete(s.connections, c)
+	if _, ok := s.connections[c]; ok {
+		delete(s.connections, c)
+
+		if ip := connectionIP(c); len(ip) != 0 {
+			if s.addrs[ip]--; s.addrs[ip] == 0 {
+				delete(s.addrs, ip)
+			}
+		}
+	}
 
 	s.mutex.Unlock()
+
+	if s.tracked() {
+		id := c.clientID()
+		s.tracking.remove(id)
+		s.redirectBroken(id)
+	}
+}
+
+// connectionIP returns the IP address of the client of c, or an empty string
+// if c is not a TCP connection.
+func connectionIP(c *Conn) string {
+	if addr, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// rejectConnection answers conn with err and closes it.
+func rejectConnection(conn net.Conn, err error) {
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	resp.NewEncoder(conn).Encode(err)
 }
 
 func (s *Server) numberOfActors() int {
@@ -583,10 +1040,112 @@ type temporaryError interface {
 }
 
 type serverConfig struct {
-	idleTimeout  time.Duration
-	readTimeout  time.Duration
-	writeTimeout time.Duration
-	retryable    bool
+	idleTimeout     time.Duration
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	commandTimeouts map[string]time.Duration
+	retryable       bool
+	limits          requestLimits
+
+	maxQueuedCommands int
+	slowLogThreshold  time.Duration
+	slowLogMaxLen     int
+	latencyThreshold  time.Duration
+	notifyFlags       NotifyFlags
+}
+
+// makeConfig returns the configuration of connections from the fields of the
+// server, the server's mutex must be held.
+func (s *Server) makeConfig() serverConfig {
+	config := serverConfig{
+		idleTimeout:     s.IdleTimeout,
+		readTimeout:     s.ReadTimeout,
+		writeTimeout:    s.WriteTimeout,
+		commandTimeouts: s.CommandTimeouts,
+		retryable:       s.EnableRetry,
+		limits: requestLimits{
+			maxRequestSize:  s.MaxRequestSize,
+			maxBulkLen:      s.MaxBulkLen,
+			maxMultiBulkLen: s.MaxMultiBulkLen,
+		},
+		maxQueuedCommands: s.MaxQueuedCommands,
+		slowLogThreshold:  s.SlowLogThreshold,
+		slowLogMaxLen:     s.SlowLogMaxLen,
+		latencyThreshold:  s.LatencyThreshold,
+		notifyFlags:       s.NotifyKeyspaceEvents,
+	}
+
+	if config.idleTimeout == 0 {
+		config.idleTimeout = config.readTimeout
+	}
+
+	if config.limits.maxRequestSize == 0 {
+		config.limits.maxRequestSize = DefaultMaxRequestSize
+	}
+
+	if config.limits.maxBulkLen == 0 {
+		config.limits.maxBulkLen = DefaultMaxBulkLen
+	}
+
+	if config.limits.maxMultiBulkLen == 0 {
+		config.limits.maxMultiBulkLen = DefaultMaxMultiBulkLen
+	}
+
+	if config.slowLogMaxLen <= 0 {
+		config.slowLogMaxLen = DefaultSlowLogMaxLen
+	}
+
+	return config
+}
+
+// loadConfig returns the current configuration of connections, which may have
+// been changed by CONFIG SET, or config if none was stored.
+func (s *Server) loadConfig(config serverConfig) serverConfig {
+	if v, ok := s.config.Load().(serverConfig); ok {
+		return v
+	}
+	return config
+}
+
+// currentConfig returns the current configuration of connections, which is
+// made from the fields of the server if it isn't serving yet.
+func (s *Server) currentConfig() serverConfig {
+	if v, ok := s.config.Load().(serverConfig); ok {
+		return v
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.makeConfig()
+}
+
+// requestTimeout returns the timeout of the context passed to the handler of
+// req, and whether the request is a long poll which must be canceled when the
+// client disconnects.
+func (config serverConfig) requestTimeout(req *Request) (timeout time.Duration, longPoll bool) {
+	timeout = config.readTimeout
+
+	if req.IsBlocking() {
+		timeout, longPoll = 0, true
+	}
+
+	override := false
+
+	for _, cmd := range req.Cmds {
+		t, ok := config.commandTimeouts[strings.ToUpper(cmd.Cmd)]
+		if !ok {
+			continue
+		}
+
+		// The longest timeout of the request's commands wins, zero meaning
+		// no timeout at all.
+		if !override || (timeout != 0 && (t == 0 || t > timeout)) {
+			timeout = t
+		}
+		override, longPoll = true, true
+	}
+
+	return
 }
 
 func backoff(attempt int, minDelay time.Duration, maxDelay time.Duration) time.Duration {
@@ -630,6 +1189,9 @@ type responseWriter struct {
 	enc     objconv.Encoder
 	stream  objconv.StreamEncoder
 	timeout time.Duration
+
+	// the first error written to the response
+	err error
 }
 
 func (res *responseWriter) WriteStream(n int) error {
@@ -672,6 +1234,10 @@ func (res *responseWriter) Write(val interface{}) error {
 	}
 	res.remain--
 
+	if err, ok := val.(error); ok && res.err == nil {
+		res.err = err
+	}
+
 	if res.wtype == oneshot {
 		return res.enc.Encode(val)
 	}
@@ -694,7 +1260,7 @@ func (res *responseWriter) Flush() error {
 		return ErrWriteCalledNotEnoughTimes
 	}
 
-	return res.conn.wbuffer.Flush()
+	return res.conn.endReply()
 }
 
 func (res *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
@@ -706,17 +1272,19 @@ func (res *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 		Reader: &res.conn.rbuffer,
 		Writer: &res.conn.wbuffer,
 	}
-	res.conn = nil
 	res.conn.setState(http.StateHijacked)
+	res.conn = nil
 	return nc, rw, nil
 }
 
 // TODO: figure out here how to wait for the previous response to flush to
 // support pipeline.
 func (res *responseWriter) waitReadyWrite() {
-	if res.timeout != 0 {
-		res.conn.setWriteTimeout(res.timeout)
-	}
+	res.conn.beginReply()
+
+	// The deadline is always reset, the one set when the request was read may
+	// have expired while the handler was blocked.
+	res.conn.setWriteTimeout(res.timeout)
 }
 
 type preparedResponseWriter struct {
@@ -735,7 +1303,7 @@ func (res *preparedResponseWriter) WriteStream(n int) error {
 }
 
 func (res *preparedResponseWriter) Write(v interface{}) error {
-	if len(res.responses) != 0 && res.responses[0].index == res.index {
+	for len(res.responses) != 0 && res.responses[0].index == res.index {
 		if err := res.base.Write(res.responses[0].value); err != nil {
 			return err
 		}
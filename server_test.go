@@ -13,6 +13,7 @@ import (
 
 	"github.com/dolab/objconv/resp"
 	goredis "github.com/go-redis/redis"
+	"github.com/golib/assert"
 	fuzz "github.com/google/gofuzz"
 	"github.com/google/uuid"
 
@@ -65,6 +66,34 @@ func TestServer(t *testing.T) {
 			scenario: "redis protocol errors written to the response writer are made visible by the client",
 			function: testServerWriteErrorToResponseWriter,
 		},
+		{
+			scenario: "connections exceeding MaxConns are answered with an error and closed",
+			function: testServerMaxConns,
+		},
+		{
+			scenario: "connections exceeding MaxConnsPerIP are answered with an error and closed",
+			function: testServerMaxConnsPerIP,
+		},
+		{
+			scenario: "connections are accepted at the rate of AcceptRate",
+			function: testServerAcceptRate,
+		},
+		{
+			scenario: "commands exceeding MaxMultiBulkLen are rejected before being read",
+			function: testServerMaxMultiBulkLen,
+		},
+		{
+			scenario: "arguments exceeding MaxBulkLen are rejected",
+			function: testServerMaxBulkLen,
+		},
+		{
+			scenario: "requests exceeding MaxRequestSize are rejected",
+			function: testServerMaxRequestSize,
+		},
+		{
+			scenario: "transactions exceeding MaxQueuedCommands are discarded",
+			function: testServerMaxQueuedCommands,
+		},
 	}
 
 	for _, test := range tests {
@@ -445,6 +474,231 @@ func testServerWriteErrorToResponseWriter(t *testing.T, ctx context.Context) {
 	}
 }
 
+// startServer serves srv on a random port of the loopback interface, returning
+// the address it listens on. The handler defaults to echoHandler.
+func startServer(t *testing.T, srv *redis.Server) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if srv.Handler == nil {
+		srv.Handler = echoHandler
+	}
+	go srv.Serve(l)
+
+	return l.Addr().String()
+}
+
+// readReply reads a raw reply line from conn.
+func readReply(t *testing.T, conn net.Conn) string {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	b := make([]byte, 512)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Error(err)
+	}
+
+	return string(b[:n])
+}
+
+func testServerMaxConns(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv := &redis.Server{MaxConns: 1}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var name string
+	it.Nil(conn.query(&name, "GET", "key"))
+
+	other, err := net.Dial("tcp", addr)
+	if !it.Nil(err) {
+		return
+	}
+	defer other.Close()
+
+	it.Equal("-ERR max number of clients reached\r\n", readReply(t, other))
+
+	// closing the first connection makes room for a new one
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	conn = dialClientConn(t, addr)
+	it.Nil(conn.query(&name, "GET", "key"))
+	it.Equal("GET", name)
+}
+
+func testServerMaxConnsPerIP(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv := &redis.Server{MaxConnsPerIP: 2}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	var name string
+
+	for i := 0; i != 2; i++ {
+		conn := dialClientConn(t, addr)
+		defer conn.Close()
+
+		it.Nil(conn.query(&name, "GET", "key"))
+	}
+
+	other, err := net.Dial("tcp", addr)
+	if !it.Nil(err) {
+		return
+	}
+	defer other.Close()
+
+	it.Equal("-ERR max number of clients per IP address reached\r\n", readReply(t, other))
+}
+
+func testServerAcceptRate(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv := &redis.Server{AcceptRate: 10, AcceptBurst: 1}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	start := time.Now()
+
+	for i := 0; i != 4; i++ {
+		conn := dialClientConn(t, addr)
+		defer conn.Close()
+
+		var name string
+		it.Nil(conn.query(&name, "GET", "key"))
+	}
+
+	// the first connection is accepted at once, the next ones every 100ms
+	it.True(time.Since(start) >= 250*time.Millisecond, "connections were not delayed")
+}
+
+func testServerMaxMultiBulkLen(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv := &redis.Server{MaxMultiBulkLen: 3}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if !it.Nil(err) {
+		return
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("*1000000000\r\n$3\r\nSET\r\n"))
+
+	it.Equal("-ERR Protocol error: invalid multibulk length\r\n", readReply(t, conn))
+}
+
+func testServerMaxBulkLen(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv := &redis.Server{
+		Handler: redis.HandlerFunc(func(w redis.ResponseWriter, r *redis.Request) {
+			var key, value string
+
+			if err := redis.ParseArgs(r.Cmds[0].Args, &key, &value); err != nil {
+				w.Write(err)
+				return
+			}
+
+			w.Write("OK")
+		}),
+		MaxBulkLen: 8,
+	}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	cli := &redis.Client{Addr: addr}
+
+	it.Nil(cli.Exec(ctx, "SET", "key", "12345678"))
+
+	err := cli.Exec(ctx, "SET", "key", "123456789")
+	if it.NotNil(err) {
+		it.Equal("ERR Protocol error: invalid bulk length", err.Error())
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if !it.Nil(err) {
+		return
+	}
+	defer conn.Close()
+
+	// the length is rejected without waiting for the content
+	conn.Write([]byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$1000000000\r\n"))
+
+	it.Equal("-ERR Protocol error: invalid bulk length\r\n", readReply(t, conn))
+}
+
+func testServerMaxRequestSize(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv := &redis.Server{MaxRequestSize: 64}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if !it.Nil(err) {
+		return
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("*1\r\n$1000\r\n" + strings.Repeat("A", 1000)))
+
+	it.Equal("-ERR Protocol error: request is too large\r\n", readReply(t, conn))
+}
+
+func testServerMaxQueuedCommands(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv := &redis.Server{MaxQueuedCommands: 1}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	it.Nil(conn.WriteCommands(
+		redis.Command{Cmd: "MULTI"},
+		redis.Command{Cmd: "SET", Args: redis.List("key", "value")},
+		redis.Command{Cmd: "SET", Args: redis.List("key", "value")},
+		redis.Command{Cmd: "EXEC"},
+	))
+
+	var status string
+
+	// MULTI and the first SET are queued
+	it.Nil(redis.ParseArgs(conn.ReadArgs(), &status))
+	it.Nil(redis.ParseArgs(conn.ReadArgs(), &status))
+
+	err := redis.ParseArgs(conn.ReadArgs(), &status)
+	if it.NotNil(err) {
+		it.Equal("ERR max number of queued commands reached", err.Error())
+	}
+
+	// EXEC is acknowledged, then discarded
+	it.Nil(redis.ParseArgs(conn.ReadArgs(), &status))
+
+	err = redis.ParseArgs(conn.ReadArgs(), &status)
+	if it.NotNil(err) {
+		it.Equal("EXECABORT Transaction discarded because of previous errors.", err.Error())
+	}
+
+	// the connection remains usable
+	var name string
+	it.Nil(conn.query(&name, "GET", "key"))
+	it.Equal("GET", name)
+}
+
 type testAddr struct {
 	network string
 	address string
@@ -0,0 +1,357 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/dolab/objconv"
+	"github.com/dolab/objconv/resp"
+)
+
+// Shadow describes a set of servers that a ReverseProxy mirrors a sample of the
+// requests it serves to, for example to validate a new version of redis or a
+// new deployment with production traffic.
+//
+// Mirrored requests are sent in the background once their arguments have been
+// buffered, the proxy never waits for their responses. Their responses are
+// compared to the responses of the primary servers, and counted by command and
+// result in the shadow_requests_total metric:
+//
+//   - match, the responses were equal
+//   - mismatch, the responses were different
+//   - error, the shadow request failed
+//   - skipped, the primary request failed, or the request has non-deterministic
+//     commands (like SPOP or RANDOMKEY) so its responses are not compared
+//   - dropped, the request was not mirrored because MaxInFlight requests were
+//     already being mirrored
+//
+// Only requests with keys are mirrored, the shadow servers are looked up by
+// hashing the first key of requests on the rings of Registry.
+//
+// Shadows are safe for concurrent use by multiple goroutines.
+type Shadow struct {
+	// Registry exposes the shadow servers.
+	Registry ServerRegistry
+
+	// Transport is used to send mirrored requests, if nil DefaultTransport is
+	// used.
+	Transport RoundTripper
+
+	// SampleRate is the fraction of the requests which are mirrored, between 0
+	// and 1. Zero means all requests.
+	SampleRate float64
+
+	// Timeout is the amount of time that mirrored requests are given to
+	// complete. Zero means 1s.
+	Timeout time.Duration
+
+	// MaxInFlight is the maximum number of requests being mirrored at the same
+	// time, requests are not mirrored while it is reached. Zero means 100.
+	MaxInFlight int
+
+	// OnMismatch, if not nil, is called with the responses of mirrored requests
+	// which were different from the responses of the primary servers. cmd is
+	// the command of the request, or MULTI for transactions.
+	OnMismatch func(cmd string, primary []interface{}, shadow []interface{})
+
+	// ErrorLog specifies an optional logger for errors of mirrored requests. If
+	// nil, errors are not logged.
+	ErrorLog Logger
+
+	inFlight   int64
+	mirrored   int64
+	dropped    int64
+	matched    int64
+	mismatched int64
+	failed     int64
+	skipped    int64
+}
+
+// ShadowStats reports the counters of a Shadow.
+type ShadowStats struct {
+	// Mirrored is the number of requests sent to the shadow servers, Dropped
+	// the number of sampled requests which were not.
+	Mirrored int64
+	Dropped  int64
+
+	// Matched, Mismatched, Failed and Skipped count the results of the
+	// mirrored requests which completed.
+	Matched    int64
+	Mismatched int64
+	Failed     int64
+	Skipped    int64
+}
+
+// Stats returns the counters of the shadow.
+func (s *Shadow) Stats() ShadowStats {
+	return ShadowStats{
+		Mirrored:   atomic.LoadInt64(&s.mirrored),
+		Dropped:    atomic.LoadInt64(&s.dropped),
+		Matched:    atomic.LoadInt64(&s.matched),
+		Mismatched: atomic.LoadInt64(&s.mismatched),
+		Failed:     atomic.LoadInt64(&s.failed),
+		Skipped:    atomic.LoadInt64(&s.skipped),
+	}
+}
+
+// mirror starts mirroring req if it is sampled, returning nil otherwise. The
+// arguments of req are buffered so they can be read by both the primary and
+// the mirrored requests. The returned value must be finished when the primary
+// response was written.
+func (s *Shadow) mirror(req *Request, keys []string) *shadowRequest {
+	if s == nil || len(keys) == 0 || !s.sample() {
+		return nil
+	}
+
+	// Requests are labeled by their first command, which is MULTI for
+	// transactions, to bound the number of metric series.
+	name := req.Cmds[0].Cmd
+
+	if atomic.AddInt64(&s.inFlight, 1) > int64(s.maxInFlight()) {
+		atomic.AddInt64(&s.inFlight, -1)
+		atomic.AddInt64(&s.dropped, 1)
+		gometrics.IncShadowRequests(name, "dropped")
+		return nil
+	}
+
+	cmds := make([]Command, len(req.Cmds))
+	random := false
+
+	// The arguments are consumed by the primary request, they are buffered so
+	// they can be sent to the shadow as well.
+	for i := range req.Cmds {
+		cmd := &req.Cmds[i]
+		cmds[i].Cmd = cmd.Cmd
+
+		if info := LookupCommand(cmd.Cmd); info != nil && info.HasFlag("random") {
+			random = true
+		}
+
+		if cmd.Args == nil {
+			continue
+		}
+
+		var (
+			list []interface{}
+			val  interface{}
+		)
+
+		for cmd.Args.Next(&val) {
+			list = append(list, copyValue(val))
+			val = nil
+		}
+
+		if err := cmd.Args.Close(); err != nil {
+			cmd.Args = newArgsError(err)
+			atomic.AddInt64(&s.inFlight, -1)
+			return nil // the primary request fails with the same error
+		}
+
+		cmd.Args = newValueArgs(list)
+		cmds[i].Args = newValueArgs(list)
+	}
+
+	m := &shadowRequest{
+		name:    name,
+		random:  random,
+		primary: make(chan shadowReply, 1),
+	}
+
+	atomic.AddInt64(&s.mirrored, 1)
+	go s.run(m, &Request{Cmds: cmds}, keys[0])
+	return m
+}
+
+func (s *Shadow) run(m *shadowRequest, req *Request, key string) {
+	defer atomic.AddInt64(&s.inFlight, -1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
+	defer cancel()
+
+	values, err := s.roundTrip(ctx, req, key)
+
+	var primary shadowReply
+	select {
+	case primary = <-m.primary:
+	case <-ctx.Done():
+	}
+
+	var result string
+
+	switch {
+	case err != nil:
+		result = "error"
+		atomic.AddInt64(&s.failed, 1)
+
+		if s.ErrorLog != nil {
+			s.ErrorLog.Print(err)
+		}
+
+	case !primary.ok || m.random:
+		result = "skipped"
+		atomic.AddInt64(&s.skipped, 1)
+
+	case reflect.DeepEqual(primary.values, values):
+		result = "match"
+		atomic.AddInt64(&s.matched, 1)
+
+	default:
+		result = "mismatch"
+		atomic.AddInt64(&s.mismatched, 1)
+
+		if s.OnMismatch != nil {
+			s.OnMismatch(m.name, primary.values, values)
+		}
+	}
+
+	gometrics.IncShadowRequests(m.name, result)
+}
+
+func (s *Shadow) roundTrip(ctx context.Context, req *Request, key string) ([]interface{}, error) {
+	ring, err := s.Registry.LookupServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Addr = ring.LookupServer(key).Addr
+	req.Context = ctx
+
+	res, err := s.transport().RoundTrip(req)
+	switch err.(type) {
+	case nil:
+	case *resp.Error:
+		return []interface{}{err}, nil
+	default:
+		return nil, err
+	}
+
+	var values []interface{}
+
+	if res.Args != nil {
+		var v interface{}
+		for res.Args.Next(&v) {
+			values = append(values, copyValue(v))
+			v = nil
+		}
+
+		err = res.Args.Close()
+	} else {
+		for a := res.TxArgs.Next(); a != nil; a = res.TxArgs.Next() {
+			var (
+				list = []interface{}{}
+				v    interface{}
+			)
+
+			for a.Next(&v) {
+				list = append(list, copyValue(v))
+				v = nil
+			}
+
+			if e, ok := a.Close().(*resp.Error); ok {
+				list = append(list, e)
+			}
+
+			values = append(values, list)
+		}
+
+		err = res.TxArgs.Close()
+	}
+
+	if e, ok := err.(*resp.Error); ok {
+		values, err = append(values, e), nil
+	}
+
+	return values, err
+}
+
+func (s *Shadow) sample() bool {
+	rate := s.SampleRate
+	return rate == 0 || rate >= 1 || rand.Float64() < rate
+}
+
+func (s *Shadow) transport() RoundTripper {
+	if transport := s.Transport; transport != nil {
+		return transport
+	}
+	return DefaultTransport
+}
+
+func (s *Shadow) timeout() time.Duration {
+	if timeout := s.Timeout; timeout != 0 {
+		return timeout
+	}
+	return time.Second
+}
+
+func (s *Shadow) maxInFlight() int {
+	if max := s.MaxInFlight; max > 0 {
+		return max
+	}
+	return 100
+}
+
+// shadowRequest is a request being mirrored, it records the response of the
+// primary request so it can be compared to the response of the shadow.
+type shadowRequest struct {
+	name    string
+	random  bool
+	values  []interface{}
+	failed  bool
+	primary chan shadowReply
+}
+
+type shadowReply struct {
+	values []interface{}
+	ok     bool
+}
+
+// record appends v to the response of the primary request.
+func (m *shadowRequest) record(v interface{}) {
+	if m != nil {
+		m.values = append(m.values, copyValue(v))
+	}
+}
+
+// fail marks the primary request as failed, its response is not compared.
+func (m *shadowRequest) fail() {
+	if m != nil {
+		m.failed = true
+	}
+}
+
+// finish hands the response of the primary request over to the shadow, it
+// never blocks.
+func (m *shadowRequest) finish() {
+	if m != nil {
+		m.primary <- shadowReply{values: m.values, ok: !m.failed}
+	}
+}
+
+// copyValue returns a deep copy of v, values read from responses may share the
+// buffers of connections.
+func copyValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		return append([]byte(nil), x...)
+	case []interface{}:
+		c := make([]interface{}, len(x))
+		for i := range x {
+			c[i] = copyValue(x[i])
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// newValueArgs returns Args reading the values of list.
+func newValueArgs(list []interface{}) Args {
+	return &argsList{
+		dec: objconv.StreamDecoder{
+			Parser: objconv.NewValueParser(list),
+		},
+	}
+}
@@ -0,0 +1,202 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+type shadowTest struct {
+	primary *fakeStore
+	shadow  *fakeStore
+	client  *redis.Client
+	proxy   *redis.ReverseProxy
+}
+
+func TestShadow(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, *shadowTest)
+	}{
+		{
+			scenario: "equal responses of the primary and shadow servers are counted as matches",
+			function: testShadowMatch,
+		},
+		{
+			scenario: "different responses of the primary and shadow servers are counted as mismatches",
+			function: testShadowMismatch,
+		},
+		{
+			scenario: "writes are mirrored to the shadow servers",
+			function: testShadowWrites,
+		},
+		{
+			scenario: "requests which are not sampled are not mirrored",
+			function: testShadowSampleRate,
+		},
+		{
+			scenario: "failures of the shadow servers don't affect the responses of the proxy",
+			function: testShadowFailures,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			primary, shadow := newFakeStore(), newFakeStore()
+
+			primarySrv, primaryAddr := redistest.FakeServer(primary)
+			defer primarySrv.Close()
+
+			shadowSrv, shadowAddr := redistest.FakeServer(shadow)
+			defer shadowSrv.Close()
+
+			transport := &redis.Transport{}
+			defer transport.CloseIdleConnections()
+
+			test := &shadowTest{
+				primary: primary,
+				shadow:  shadow,
+				proxy: &redis.ReverseProxy{
+					Transport: transport,
+					Registry:  redis.ServerList{{Addr: primaryAddr}},
+					Shadow: &redis.Shadow{
+						Registry:  redis.ServerList{{Addr: shadowAddr}},
+						Transport: transport,
+					},
+				},
+			}
+
+			proxy, proxyAddr := redistest.FakeServer(test.proxy)
+			defer proxy.Close()
+
+			test.client = &redis.Client{Addr: proxyAddr, Transport: transport}
+
+			testFunc(t, ctx, test)
+		})
+	}
+}
+
+func (test *shadowTest) get(ctx context.Context, key string) (string, error) {
+	var value string
+	err := redis.ParseArgs(test.client.Query(ctx, "GET", key), &value)
+	return value, err
+}
+
+// waitForShadowStats waits until the mirrored requests completed.
+func waitForShadowStats(t *testing.T, ctx context.Context, shadow *redis.Shadow) redis.ShadowStats {
+	for {
+		stats := shadow.Stats()
+
+		if stats.Mirrored != 0 && stats.Matched+stats.Mismatched+stats.Failed+stats.Skipped == stats.Mirrored {
+			return stats
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("the mirrored requests never completed: %+v", stats)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func testShadowMatch(t *testing.T, ctx context.Context, test *shadowTest) {
+	it := assert.New(t)
+
+	test.primary.set("key", "value")
+	test.shadow.set("key", "value")
+
+	value, err := test.get(ctx, "key")
+	it.Nil(err)
+	it.Equal("value", value)
+
+	stats := waitForShadowStats(t, ctx, test.proxy.Shadow)
+	it.Equal(int64(1), stats.Mirrored)
+	it.Equal(int64(1), stats.Matched)
+	it.Equal(int64(0), stats.Mismatched)
+}
+
+func testShadowMismatch(t *testing.T, ctx context.Context, test *shadowTest) {
+	it := assert.New(t)
+
+	mismatches := make(chan []interface{}, 2)
+	test.proxy.Shadow.OnMismatch = func(cmd string, primary []interface{}, shadow []interface{}) {
+		it.Equal("GET", cmd)
+		mismatches <- primary
+		mismatches <- shadow
+	}
+
+	test.primary.set("key", "value")
+	test.shadow.set("key", "other")
+
+	value, err := test.get(ctx, "key")
+	it.Nil(err)
+	it.Equal("value", value)
+
+	stats := waitForShadowStats(t, ctx, test.proxy.Shadow)
+	it.Equal(int64(1), stats.Mismatched)
+	it.Equal(int64(0), stats.Matched)
+
+	primary, shadow := <-mismatches, <-mismatches
+	it.Equal(1, len(primary))
+	it.Equal(1, len(shadow))
+	it.NotEqual(primary, shadow)
+}
+
+func testShadowWrites(t *testing.T, ctx context.Context, test *shadowTest) {
+	it := assert.New(t)
+
+	var status string
+	it.Nil(redis.ParseArgs(test.client.Query(ctx, "SET", "key", "value"), &status))
+	it.Equal("OK", status)
+
+	stats := waitForShadowStats(t, ctx, test.proxy.Shadow)
+	it.Equal(int64(1), stats.Matched)
+
+	value, ok := test.primary.get("key")
+	it.True(ok)
+	it.Equal("value", value)
+
+	value, ok = test.shadow.get("key")
+	it.True(ok)
+	it.Equal("value", value)
+}
+
+func testShadowSampleRate(t *testing.T, ctx context.Context, test *shadowTest) {
+	it := assert.New(t)
+
+	test.proxy.Shadow.SampleRate = 1e-9
+	test.primary.set("key", "value")
+
+	for i := 0; i != 10; i++ {
+		value, err := test.get(ctx, "key")
+		it.Nil(err)
+		it.Equal("value", value)
+	}
+
+	it.Equal(redis.ShadowStats{}, test.proxy.Shadow.Stats())
+}
+
+func testShadowFailures(t *testing.T, ctx context.Context, test *shadowTest) {
+	it := assert.New(t)
+
+	test.proxy.Shadow.Registry = redis.ServerList{{Addr: "127.0.0.1:1"}}
+	test.primary.set("key", "value")
+
+	value, err := test.get(ctx, "key")
+	it.Nil(err)
+	it.Equal("value", value)
+
+	stats := waitForShadowStats(t, ctx, test.proxy.Shadow)
+	it.Equal(int64(1), stats.Failed)
+}
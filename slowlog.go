@@ -0,0 +1,465 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultSlowLogMaxLen is the default number of requests kept in the slow
+	// log of servers.
+	DefaultSlowLogMaxLen = 128
+
+	// slowLogMaxArgs and slowLogMaxArgLen truncate the arguments recorded in
+	// the slow log, like redis does.
+	slowLogMaxArgs   = 32
+	slowLogMaxArgLen = 128
+
+	// latencyMaxSamples is the number of samples kept by the latency monitor
+	// for each event.
+	latencyMaxSamples = 160
+)
+
+// SlowLogEntry is a request recorded in the slow log of a server.
+type SlowLogEntry struct {
+	// ID is the unique identifier of the entry, it increases with each
+	// request recorded by the server.
+	ID int64
+
+	// Time is the time at which the request was received, and Duration the
+	// time it took to serve it.
+	Time     time.Time
+	Duration time.Duration
+
+	// Upstream is the part of Duration spent waiting for upstream servers, as
+	// reported by handlers like ReverseProxy.
+	Upstream time.Duration
+
+	// Args are the name and the arguments of the first command of the request,
+	// truncated to 32 arguments of 128 bytes.
+	Args []string
+
+	// Addr is the address of the client, and Name the name it set with
+	// CLIENT SETNAME.
+	Addr string
+	Name string
+}
+
+// slowLog is a ring buffer of the slow requests of a server.
+type slowLog struct {
+	mutex   sync.Mutex
+	lastID  int64
+	entries []SlowLogEntry
+	next    int
+}
+
+// add records e, keeping at most maxLen entries.
+func (l *slowLog) add(e SlowLogEntry, maxLen int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.lastID++
+	e.ID = l.lastID
+
+	if len(l.entries) > maxLen || (l.next != 0 && len(l.entries) < maxLen) {
+		// The length of the slow log was changed, the newest entries are
+		// kept in order.
+		l.entries, l.next = l.list(maxLen), 0
+		reverseSlowLog(l.entries)
+	}
+
+	if len(l.entries) < maxLen {
+		l.entries = append(l.entries, e)
+		return
+	}
+
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % maxLen
+}
+
+// list returns at most n entries, newest first, the mutex must be held.
+func (l *slowLog) list(n int) []SlowLogEntry {
+	if n < 0 || n > len(l.entries) {
+		n = len(l.entries)
+	}
+
+	list := make([]SlowLogEntry, n)
+
+	for i := range list {
+		list[i] = l.entries[(l.next+len(l.entries)-1-i)%len(l.entries)]
+	}
+
+	return list
+}
+
+func (l *slowLog) get(n int) []SlowLogEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.list(n)
+}
+
+func (l *slowLog) len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.entries)
+}
+
+func (l *slowLog) reset() {
+	l.mutex.Lock()
+	l.entries, l.next = nil, 0
+	l.mutex.Unlock()
+}
+
+func reverseSlowLog(entries []SlowLogEntry) {
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+}
+
+// SlowLog returns the requests recorded in the slow log of the server, newest
+// first.
+func (s *Server) SlowLog() []SlowLogEntry {
+	return s.slowlog.get(-1)
+}
+
+// recordSlowRequest records the request made of the commands names in the slow
+// log if it took longer than the threshold of config.
+func (s *Server) recordSlowRequest(c *Conn, names []string, issuedAt time.Time, d time.Duration, timing *requestTiming, config serverConfig) {
+	if config.slowLogThreshold <= 0 || d < config.slowLogThreshold {
+		return
+	}
+
+	// The credentials passed to AUTH and HELLO are never recorded.
+	for _, name := range names {
+		if name = strings.ToUpper(name); name == "AUTH" || name == "HELLO" {
+			return
+		}
+	}
+
+	info := c.info()
+
+	s.slowlog.add(SlowLogEntry{
+		Time:     issuedAt,
+		Duration: d,
+		Upstream: timing.upstreamTime(),
+		Args:     c.argv.list(names),
+		Addr:     info.Addr,
+		Name:     info.Name,
+	}, config.slowLogMaxLen)
+}
+
+// slowLogArgs records the arguments of the first command of the request read
+// from a connection, in the truncated form reported by the slow log.
+type slowLogArgs struct {
+	enabled bool
+	cmds    int
+	args    []string
+	more    int
+}
+
+func (a *slowLogArgs) reset(enabled bool) {
+	a.enabled, a.cmds, a.args, a.more = enabled, 0, a.args[:0], 0
+}
+
+// command is called when the command name is read, it returns true if its
+// arguments must be recorded. MULTI and EXEC are not recorded so transactions
+// are reported by their first command.
+func (a *slowLogArgs) command(name string) bool {
+	if !a.enabled || name == "MULTI" || name == "EXEC" || name == "DISCARD" {
+		return false
+	}
+
+	if a.cmds++; a.cmds != 1 {
+		return false
+	}
+
+	a.args = append(a.args, name)
+	return true
+}
+
+func (a *slowLogArgs) add(arg []byte) {
+	if len(a.args) >= slowLogMaxArgs-1 {
+		a.more++
+		return
+	}
+
+	if len(arg) > slowLogMaxArgLen {
+		a.args = append(a.args, fmt.Sprintf("%s... (%d more bytes)", arg[:slowLogMaxArgLen], len(arg)-slowLogMaxArgLen))
+		return
+	}
+
+	a.args = append(a.args, string(arg))
+}
+
+// list returns the recorded arguments, or names if no arguments were
+// recorded.
+func (a *slowLogArgs) list(names []string) []string {
+	if len(a.args) == 0 {
+		return append([]string(nil), names...)
+	}
+
+	args := append([]string(nil), a.args...)
+
+	if a.more != 0 {
+		args = append(args, fmt.Sprintf("... (%d more arguments)", a.more))
+	}
+
+	if a.cmds > 1 {
+		args = append(args, fmt.Sprintf("... (%d more commands)", a.cmds-1))
+	}
+
+	return args
+}
+
+// requestTiming is set on the contexts of requests to let handlers report the
+// time spent waiting for upstream servers.
+type requestTiming struct {
+	upstream int64
+}
+
+var requestTimingContextKey = &contextKey{"request-timing"}
+
+func (t *requestTiming) upstreamTime() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&t.upstream))
+}
+
+// recordUpstreamTime reports that the request of ctx waited d for an upstream
+// server, to the slow log and the latency monitor of the server serving it.
+func recordUpstreamTime(ctx context.Context, d time.Duration) {
+	if ctx == nil {
+		return
+	}
+
+	if t, _ := ctx.Value(requestTimingContextKey).(*requestTiming); t != nil {
+		atomic.AddInt64(&t.upstream, int64(d))
+	}
+
+	if s, _ := ctx.Value(ServerContextKey).(*Server); s != nil {
+		s.RecordLatency("upstream", d)
+	}
+}
+
+// latencySample is the highest latency of an event within a second.
+type latencySample struct {
+	time    int64
+	latency time.Duration
+}
+
+type latencyEvent struct {
+	samples []latencySample
+	next    int
+	max     time.Duration
+}
+
+func (e *latencyEvent) latest() latencySample {
+	return e.samples[(e.next+len(e.samples)-1)%len(e.samples)]
+}
+
+// latencyMonitor records the latency spikes of the events of a server.
+type latencyMonitor struct {
+	mutex  sync.Mutex
+	events map[string]*latencyEvent
+}
+
+func (m *latencyMonitor) add(event string, d time.Duration, now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.events == nil {
+		m.events = make(map[string]*latencyEvent)
+	}
+
+	e := m.events[event]
+	if e == nil {
+		e = &latencyEvent{}
+		m.events[event] = e
+	}
+
+	if d > e.max {
+		e.max = d
+	}
+
+	sample := latencySample{time: now.Unix(), latency: d}
+
+	switch {
+	case len(e.samples) != 0 && e.latest().time == sample.time:
+		// One sample is kept per second, the highest.
+		last := &e.samples[(e.next+len(e.samples)-1)%len(e.samples)]
+		if d > last.latency {
+			last.latency = d
+		}
+	case len(e.samples) < latencyMaxSamples:
+		e.samples = append(e.samples, sample)
+	default:
+		e.samples[e.next] = sample
+		e.next = (e.next + 1) % latencyMaxSamples
+	}
+}
+
+// RecordLatency records that the event took d, if d is above the latency
+// threshold of the server. Handlers can report their own events, which are
+// exposed by LATENCY LATEST and LATENCY HISTORY.
+func (s *Server) RecordLatency(event string, d time.Duration) {
+	config := s.currentConfig()
+
+	if config.latencyThreshold <= 0 || d < config.latencyThreshold {
+		return
+	}
+
+	s.latency.add(event, d, time.Now())
+}
+
+// latencyEventOf returns the event recorded for a request made of the commands
+// names, "fast-command" if all its commands are fast.
+func latencyEventOf(names []string) string {
+	for _, name := range names {
+		if info := LookupCommand(name); info == nil || !info.HasFlag("fast") {
+			return "command"
+		}
+	}
+	return "fast-command"
+}
+
+// slowlogCommand answers SLOWLOG GET [count], SLOWLOG LEN and SLOWLOG RESET.
+func (s *Server) slowlogCommand(c *Conn, cmd Command) interface{} {
+	var args []string
+
+	if err := cmd.ParseArgs(&args); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errorf("ERR wrong number of arguments for 'slowlog' command")
+	}
+
+	sub, args := strings.ToUpper(args[0]), args[1:]
+
+	switch {
+	case sub == "GET" && len(args) <= 1:
+		count := 10
+
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < -1 {
+				return errorf("ERR count should be greater than or equal to -1")
+			}
+			count = n
+		}
+
+		entries := s.slowlog.get(count)
+		list := make([]interface{}, len(entries))
+
+		for i, e := range entries {
+			argv := make([]interface{}, len(e.Args))
+			for j, arg := range e.Args {
+				argv[j] = arg
+			}
+
+			list[i] = []interface{}{
+				e.ID,
+				e.Time.Unix(),
+				int64(e.Duration / time.Microsecond),
+				argv,
+				e.Addr,
+				e.Name,
+			}
+		}
+
+		return list
+
+	case sub == "LEN" && len(args) == 0:
+		return int64(s.slowlog.len())
+
+	case sub == "RESET" && len(args) == 0:
+		s.slowlog.reset()
+		return "OK"
+	}
+
+	return errorf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try SLOWLOG HELP.", strings.ToLower(sub))
+}
+
+// latencyCommand answers LATENCY LATEST, LATENCY HISTORY event and LATENCY
+// RESET [event ...].
+func (s *Server) latencyCommand(c *Conn, cmd Command) interface{} {
+	var args []string
+
+	if err := cmd.ParseArgs(&args); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return errorf("ERR wrong number of arguments for 'latency' command")
+	}
+
+	sub, args := strings.ToUpper(args[0]), args[1:]
+
+	m := &s.latency
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch {
+	case sub == "LATEST" && len(args) == 0:
+		names := make([]string, 0, len(m.events))
+		for name := range m.events {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		list := make([]interface{}, len(names))
+
+		for i, name := range names {
+			e := m.events[name]
+			latest := e.latest()
+			list[i] = []interface{}{
+				name,
+				latest.time,
+				int64(latest.latency / time.Millisecond),
+				int64(e.max / time.Millisecond),
+			}
+		}
+
+		return list
+
+	case sub == "HISTORY" && len(args) == 1:
+		e := m.events[args[0]]
+		if e == nil {
+			return []interface{}{}
+		}
+
+		list := make([]interface{}, len(e.samples))
+
+		for i := range e.samples {
+			sample := e.samples[(e.next+i)%len(e.samples)]
+			list[i] = []interface{}{sample.time, int64(sample.latency / time.Millisecond)}
+		}
+
+		return list
+
+	case sub == "RESET":
+		n := 0
+
+		if len(args) == 0 {
+			n, m.events = len(m.events), nil
+		}
+
+		for _, name := range args {
+			if _, ok := m.events[name]; ok {
+				delete(m.events, name)
+				n++
+			}
+		}
+
+		return int64(n)
+	}
+
+	return errorf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try LATENCY HELP.", strings.ToLower(sub))
+}
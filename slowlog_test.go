@@ -0,0 +1,257 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+// slowHandler sleeps for 100ms before answering requests of the key "slow".
+var slowHandler = redis.HandlerFunc(func(w redis.ResponseWriter, r *redis.Request) {
+	var key string
+	r.Cmds[0].ParseArgs(&key)
+
+	if key == "slow" {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	w.Write(r.Cmds[0].Cmd)
+})
+
+func TestServerSlowLog(t *testing.T) {
+	tests := []struct {
+		scenario string
+		server   *redis.Server
+		function func(*testing.T, context.Context, *redis.Server, *clientConn)
+	}{
+		{
+			scenario: "requests slower than the threshold are recorded",
+			server:   &redis.Server{SlowLogThreshold: 50 * time.Millisecond},
+			function: testServerSlowLogGet,
+		},
+		{
+			scenario: "the arguments of requests are truncated",
+			server:   &redis.Server{SlowLogThreshold: time.Nanosecond},
+			function: testServerSlowLogTruncate,
+		},
+		{
+			scenario: "the slow log keeps the newest requests",
+			server:   &redis.Server{SlowLogThreshold: time.Nanosecond, SlowLogMaxLen: 2},
+			function: testServerSlowLogMaxLen,
+		},
+		{
+			scenario: "the slow log is configured with CONFIG SET",
+			server:   &redis.Server{},
+			function: testServerSlowLogConfig,
+		},
+		{
+			scenario: "LATENCY reports the latency spikes of requests",
+			server:   &redis.Server{LatencyThreshold: 50 * time.Millisecond},
+			function: testServerSlowLogLatency,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc, srv := test.function, test.server
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			srv.Handler = slowHandler
+			srv.EnableBuiltins = true
+
+			addr := startServer(t, srv)
+			defer srv.Close()
+
+			conn := dialClientConn(t, addr)
+			defer conn.Close()
+
+			testFunc(t, ctx, srv, conn)
+		})
+	}
+}
+
+func testServerSlowLogGet(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	var status, name string
+	it.Nil(conn.query(&status, "CLIENT", "SETNAME", "worker"))
+	it.Nil(conn.query(&name, "GET", "fast"))
+	it.Nil(conn.query(&name, "GET", "slow"))
+
+	var n int
+	it.Nil(conn.query(&n, "SLOWLOG", "LEN"))
+	it.Equal(1, n)
+
+	var entry []interface{}
+	it.Nil(conn.query(&entry, "SLOWLOG", "GET"))
+
+	if it.Equal(6, len(entry)) {
+		it.Equal("1", fmt.Sprint(entry[0]))
+		it.Equal([]interface{}{"GET", "slow"}, entry[3])
+		it.Equal(conn.LocalAddr().String(), fmt.Sprint(entry[4]))
+		it.Equal("worker", fmt.Sprint(entry[5]))
+	}
+
+	entries := srv.SlowLog()
+	if it.Equal(1, len(entries)) {
+		it.True(entries[0].Duration >= 100*time.Millisecond)
+		it.Equal(time.Duration(0), entries[0].Upstream)
+	}
+}
+
+func testServerSlowLogTruncate(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	args := []interface{}{"key", strings.Repeat("v", 200)}
+	for i := 0; i != 40; i++ {
+		args = append(args, i)
+	}
+
+	var name string
+	it.Nil(conn.query(&name, "RPUSH", args...))
+
+	entries := srv.SlowLog()
+	if !it.Equal(1, len(entries)) {
+		return
+	}
+
+	argv := entries[0].Args
+	if it.Equal(32, len(argv)) {
+		it.Equal("RPUSH", argv[0])
+		it.Equal("key", argv[1])
+		it.Equal(strings.Repeat("v", 128)+"... (72 more bytes)", argv[2])
+		it.Equal("... (12 more arguments)", argv[31])
+	}
+}
+
+func testServerSlowLogMaxLen(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+	for _, key := range []string{"a", "b", "c"} {
+		it.Nil(conn.query(&name, "GET", key))
+	}
+
+	entries := srv.SlowLog()
+	if it.Equal(2, len(entries)) {
+		it.Equal(int64(3), entries[0].ID)
+		it.Equal([]string{"GET", "c"}, entries[0].Args)
+		it.Equal(int64(2), entries[1].ID)
+		it.Equal([]string{"GET", "b"}, entries[1].Args)
+	}
+
+	var status string
+	it.Nil(conn.query(&status, "SLOWLOG", "RESET"))
+
+	// the request of SLOWLOG RESET is recorded after the reset
+	var n int
+	it.Nil(conn.query(&n, "SLOWLOG", "LEN"))
+	it.Equal(1, n)
+}
+
+func testServerSlowLogConfig(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	var config map[string]string
+	it.Nil(conn.query(&config, "CONFIG", "GET", "slowlog-*"))
+	it.Equal(map[string]string{
+		"slowlog-log-slower-than": "-1",
+		"slowlog-max-len":         "128",
+	}, config)
+
+	var status, name string
+	it.Nil(conn.query(&name, "GET", "slow"))
+	it.Equal(0, len(srv.SlowLog()), "the slow log is disabled")
+
+	it.Nil(conn.query(&status, "CONFIG", "SET", "slowlog-log-slower-than", "50000"))
+	it.Nil(conn.query(&name, "GET", "fast"))
+	it.Nil(conn.query(&name, "GET", "slow"))
+
+	if entries := srv.SlowLog(); it.Equal(1, len(entries)) {
+		it.Equal([]string{"GET", "slow"}, entries[0].Args)
+	}
+}
+
+func testServerSlowLogLatency(t *testing.T, ctx context.Context, srv *redis.Server, conn *clientConn) {
+	it := assert.New(t)
+
+	var name string
+	it.Nil(conn.query(&name, "GET", "fast"))
+	it.Nil(conn.query(&name, "GET", "slow"))
+	it.Nil(conn.query(&name, "SUNION", "slow", "other"))
+
+	var latest []interface{}
+	it.Nil(conn.query(&latest, "LATENCY", "LATEST"))
+
+	// GET is a fast command, SUNION is not.
+	if it.Equal(4, len(latest)) {
+		it.Equal("command", fmt.Sprint(latest[0]))
+		it.NotEqual("0", fmt.Sprint(latest[2]))
+	}
+
+	var sample []interface{}
+	it.Nil(conn.query(&sample, "LATENCY", "HISTORY", "fast-command"))
+	it.Equal(2, len(sample))
+
+	var n int
+	it.Nil(conn.query(&n, "LATENCY", "RESET", "command", "unknown"))
+	it.Equal(1, n)
+
+	srv.RecordLatency("custom", time.Millisecond)
+	srv.RecordLatency("custom", time.Second)
+
+	it.Nil(conn.query(&latest, "LATENCY", "LATEST"))
+
+	if it.Equal(4, len(latest)) {
+		it.Equal("custom", fmt.Sprint(latest[0]))
+		it.Equal("1000", fmt.Sprint(latest[3]))
+	}
+}
+
+func TestReverseProxySlowLog(t *testing.T) {
+	it := assert.New(t)
+
+	upstream, upstreamAddr := redistest.FakeServer(slowHandler)
+	defer upstream.Close()
+
+	transport := &redis.Transport{}
+	defer transport.CloseIdleConnections()
+
+	srv := &redis.Server{
+		Handler: &redis.ReverseProxy{
+			Transport: transport,
+			Registry:  redis.ServerList{{Addr: upstreamAddr}},
+		},
+		SlowLogThreshold: 50 * time.Millisecond,
+		LatencyThreshold: 50 * time.Millisecond,
+		EnableBuiltins:   true,
+	}
+	addr := startServer(t, srv)
+	defer srv.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var name string
+	it.Nil(conn.query(&name, "GET", "slow"))
+
+	entries := srv.SlowLog()
+	if it.Equal(1, len(entries)) {
+		it.True(entries[0].Upstream >= 100*time.Millisecond)
+		it.True(entries[0].Duration >= entries[0].Upstream)
+	}
+
+	var history []interface{}
+	it.Nil(conn.query(&history, "LATENCY", "HISTORY", "upstream"))
+	it.Equal(2, len(history))
+}
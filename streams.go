@@ -0,0 +1,618 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dolab/objconv/resp"
+)
+
+// XMessage is an entry of a redis stream.
+type XMessage struct {
+	_      struct{} `redis:",array"`
+	ID     string
+	Values map[string]string
+}
+
+// XStream is the list of entries read from a redis stream.
+type XStream struct {
+	_        struct{} `redis:",array"`
+	Stream   string
+	Messages []XMessage
+}
+
+// XPendingEntry describes an entry of the pending entries list of a consumer
+// group.
+type XPendingEntry struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	RetryCount int64
+}
+
+// BlockForever is the value of the Block fields of XReadArgs and
+// XReadGroupArgs which makes the commands wait without timeout for entries to
+// be available, like BLOCK 0.
+const BlockForever time.Duration = -1
+
+// XReadArgs carries the arguments of a XREAD command.
+type XReadArgs struct {
+	// Streams is the list of streams to read from, and IDs the list of IDs
+	// after which entries are read in each stream. When IDs is empty, only
+	// entries added after the command was issued are returned.
+	Streams []string
+	IDs     []string
+
+	// Count limits the number of entries returned per stream, zero means no
+	// limit.
+	Count int64
+
+	// Block is the amount of time that the command waits for entries to be
+	// available, zero means the command does not block and BlockForever that
+	// it waits until entries are available.
+	Block time.Duration
+}
+
+// XReadGroupArgs carries the arguments of a XREADGROUP command.
+type XReadGroupArgs struct {
+	// Group and Consumer identify the consumer reading the streams.
+	Group    string
+	Consumer string
+
+	// Streams is the list of streams to read from, and IDs the list of IDs
+	// after which entries are read in each stream. When IDs is empty, only
+	// entries never delivered to other consumers of the group are returned.
+	Streams []string
+	IDs     []string
+
+	// Count limits the number of entries returned per stream, zero means no
+	// limit.
+	Count int64
+
+	// Block is the amount of time that the command waits for entries to be
+	// available, zero means the command does not block and BlockForever that
+	// it waits until entries are available.
+	Block time.Duration
+
+	// NoAck, when set, acknowledges entries as soon as they are delivered.
+	NoAck bool
+}
+
+// XAutoClaimArgs carries the arguments of a XAUTOCLAIM command.
+type XAutoClaimArgs struct {
+	Stream   string
+	Group    string
+	Consumer string
+
+	// MinIdle is the minimum time that entries must have been pending for to
+	// be claimed.
+	MinIdle time.Duration
+
+	// Start is the ID from which the pending entries list is scanned, "0-0"
+	// is used when empty.
+	Start string
+
+	// Count limits the number of entries claimed, zero means the server
+	// default.
+	Count int64
+}
+
+// XPendingExtArgs carries the arguments of the extended form of a XPENDING
+// command.
+type XPendingExtArgs struct {
+	Stream string
+	Group  string
+
+	// Idle filters out the entries that have been pending for less than this
+	// duration, zero means no filter.
+	Idle time.Duration
+
+	// Start and End bound the range of IDs returned, "-" and "+" are used when
+	// they are empty.
+	Start string
+	End   string
+
+	// Count limits the number of entries returned.
+	Count int64
+
+	// Consumer, if not empty, only returns the entries pending for this
+	// consumer.
+	Consumer string
+}
+
+// XAdd issues a XADD command, appending an entry made of values to the stream.
+// The values may be a list of field/value pairs, or structs and maps. When id
+// is empty the server generates the ID of the entry, which is returned.
+func (c *Client) XAdd(ctx context.Context, stream string, id string, values ...interface{}) (string, error) {
+	if len(id) == 0 {
+		id = "*"
+	}
+
+	args := make([]interface{}, 0, 2+len(values))
+	args = append(args, stream, id)
+	args = append(args, values...)
+
+	return replyString(c.Query(ctx, "XADD", args...))
+}
+
+// XRange issues a XRANGE command, returning the entries of the stream with IDs
+// between start and end.
+func (c *Client) XRange(ctx context.Context, stream string, start string, end string) ([]XMessage, error) {
+	return replyXMessages(c.Query(ctx, "XRANGE", stream, start, end))
+}
+
+// XRangeN is like XRange but returns at most count entries.
+func (c *Client) XRangeN(ctx context.Context, stream string, start string, end string, count int64) ([]XMessage, error) {
+	return replyXMessages(c.Query(ctx, "XRANGE", stream, start, end, "COUNT", count))
+}
+
+// XRevRange issues a XREVRANGE command, returning the entries of the stream
+// with IDs between end and start in reverse order.
+func (c *Client) XRevRange(ctx context.Context, stream string, end string, start string) ([]XMessage, error) {
+	return replyXMessages(c.Query(ctx, "XREVRANGE", stream, end, start))
+}
+
+// XRead issues a XREAD command, returning the entries read from each stream.
+//
+// When the command blocks, the client timeout is extended by the block
+// duration. ErrNil is returned if no entries were available before the block
+// duration elapsed.
+func (c *Client) XRead(ctx context.Context, a XReadArgs) ([]XStream, error) {
+	args := make([]interface{}, 0, 5+2*len(a.Streams))
+
+	if a.Count > 0 {
+		args = append(args, "COUNT", a.Count)
+	}
+
+	block, blocking := blockDuration(a.Block)
+	if blocking {
+		args = append(args, "BLOCK", int64(block/time.Millisecond))
+	}
+
+	args, err := appendStreams(args, a.Streams, a.IDs, "$")
+	if err != nil {
+		return nil, err
+	}
+
+	if blocking {
+		return replyXStreams(c.queryBlocking(ctx, block, "XREAD", args...))
+	}
+
+	return replyXStreams(c.Query(ctx, "XREAD", args...))
+}
+
+// XReadGroup issues a XREADGROUP command, returning the entries read from each
+// stream.
+//
+// When the command blocks, the client timeout is extended by the block
+// duration. ErrNil is returned if no entries were available before the block
+// duration elapsed.
+func (c *Client) XReadGroup(ctx context.Context, a XReadGroupArgs) ([]XStream, error) {
+	args := make([]interface{}, 0, 9+2*len(a.Streams))
+	args = append(args, "GROUP", a.Group, a.Consumer)
+
+	if a.Count > 0 {
+		args = append(args, "COUNT", a.Count)
+	}
+
+	block, blocking := blockDuration(a.Block)
+	if blocking {
+		args = append(args, "BLOCK", int64(block/time.Millisecond))
+	}
+
+	if a.NoAck {
+		args = append(args, "NOACK")
+	}
+
+	args, err := appendStreams(args, a.Streams, a.IDs, ">")
+	if err != nil {
+		return nil, err
+	}
+
+	if blocking {
+		return replyXStreams(c.queryBlocking(ctx, block, "XREADGROUP", args...))
+	}
+
+	return replyXStreams(c.Query(ctx, "XREADGROUP", args...))
+}
+
+// blockDuration returns the duration of the BLOCK argument of reads with
+// block, zero when they block forever, and whether the reads block.
+func blockDuration(block time.Duration) (time.Duration, bool) {
+	switch {
+	case block == BlockForever:
+		return 0, true
+	case block > 0:
+		return block, true
+	default:
+		return 0, false
+	}
+}
+
+// XGroupCreate issues a XGROUP CREATE command, creating a consumer group which
+// starts reading the stream after id. When mkstream is true the stream is
+// created if it doesn't exist.
+func (c *Client) XGroupCreate(ctx context.Context, stream string, group string, id string, mkstream bool) error {
+	if mkstream {
+		return c.Exec(ctx, "XGROUP", "CREATE", stream, group, id, "MKSTREAM")
+	}
+
+	return c.Exec(ctx, "XGROUP", "CREATE", stream, group, id)
+}
+
+// XGroupDestroy issues a XGROUP DESTROY command, removing a consumer group.
+func (c *Client) XGroupDestroy(ctx context.Context, stream string, group string) (int64, error) {
+	return replyInt64(c.Query(ctx, "XGROUP", "DESTROY", stream, group))
+}
+
+// XAutoClaim issues a XAUTOCLAIM command, transferring the ownership of the
+// pending entries idle for longer than a.MinIdle to a.Consumer. It returns the
+// ID to pass as start of the next call, which is "0-0" once the whole pending
+// entries list was scanned.
+func (c *Client) XAutoClaim(ctx context.Context, a XAutoClaimArgs) (string, []XMessage, error) {
+	start := a.Start
+	if len(start) == 0 {
+		start = "0-0"
+	}
+
+	args := make([]interface{}, 0, 7)
+	args = append(args, a.Stream, a.Group, a.Consumer, int64(a.MinIdle/time.Millisecond), start)
+
+	if a.Count > 0 {
+		args = append(args, "COUNT", a.Count)
+	}
+
+	var reply struct {
+		_        struct{} `redis:",array"`
+		Next     string
+		Messages []XMessage
+		Deleted  []string
+	}
+
+	if err := ParseArgs(c.Query(ctx, "XAUTOCLAIM", args...), &reply); err != nil {
+		return "", nil, err
+	}
+
+	return reply.Next, reply.Messages, nil
+}
+
+// XPendingExt issues the extended form of a XPENDING command, returning the
+// entries of the pending entries list of a consumer group.
+func (c *Client) XPendingExt(ctx context.Context, a XPendingExtArgs) ([]XPendingEntry, error) {
+	start, end := a.Start, a.End
+	if len(start) == 0 {
+		start = "-"
+	}
+	if len(end) == 0 {
+		end = "+"
+	}
+
+	args := make([]interface{}, 0, 8)
+	args = append(args, a.Stream, a.Group)
+
+	if a.Idle > 0 {
+		args = append(args, "IDLE", int64(a.Idle/time.Millisecond))
+	}
+
+	args = append(args, start, end, a.Count)
+
+	if len(a.Consumer) != 0 {
+		args = append(args, a.Consumer)
+	}
+
+	var reply []struct {
+		_          struct{} `redis:",array"`
+		ID         string
+		Consumer   string
+		Idle       int64
+		RetryCount int64
+	}
+
+	if err := ParseArgs(c.Query(ctx, "XPENDING", args...), &reply); err != nil {
+		return nil, err
+	}
+
+	entries := make([]XPendingEntry, len(reply))
+
+	for i, r := range reply {
+		entries[i] = XPendingEntry{
+			ID:         r.ID,
+			Consumer:   r.Consumer,
+			Idle:       time.Duration(r.Idle) * time.Millisecond,
+			RetryCount: r.RetryCount,
+		}
+	}
+
+	return entries, nil
+}
+
+func appendStreams(args []interface{}, streams []string, ids []string, defaultID string) ([]interface{}, error) {
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("redis: no streams to read from")
+	}
+
+	if len(ids) != 0 && len(ids) != len(streams) {
+		return nil, fmt.Errorf("redis: mismatching number of streams and IDs: %d != %d", len(streams), len(ids))
+	}
+
+	args = append(args, "STREAMS")
+
+	for _, stream := range streams {
+		args = append(args, stream)
+	}
+
+	for i := range streams {
+		if len(ids) == 0 {
+			args = append(args, defaultID)
+		} else {
+			args = append(args, ids[i])
+		}
+	}
+
+	return args, nil
+}
+
+func replyXMessages(args Args) (msgs []XMessage, err error) {
+	err = ParseArgs(args, &msgs)
+	return
+}
+
+func replyXStreams(args Args) (streams []XStream, err error) {
+	if err = ParseArgs(args, &streams); err == nil && streams == nil {
+		err = ErrNil
+	}
+	return
+}
+
+// A Consumer reads the entries of a redis stream as a member of a consumer
+// group.
+//
+// Entries are passed to a handler and acknowledged when it succeeds. Entries
+// that the handler failed to process stay pending, and are claimed again by
+// one of the consumers of the group once they have been idle for MinIdle.
+// Entries delivered more than MaxDeliveries times are considered dead letters,
+// they are copied to DeadLetterStream and removed from the group.
+//
+// Blocking reads are made on connections which aren't shared with the regular
+// requests of the client's transport, and are not interrupted by the client
+// timeout.
+type Consumer struct {
+	// Client is the client used to issue the commands, DefaultClient is used
+	// when nil.
+	Client *Client
+
+	// Stream, Group and Name identify the consumer. The group is created if it
+	// doesn't exist.
+	Stream string
+	Group  string
+	Name   string
+
+	// Count is the maximum number of entries read at once, defaults to 10.
+	Count int64
+
+	// Block is the amount of time that each read waits for entries to be
+	// available, defaults to 5 seconds. BlockForever makes the reads wait
+	// until entries are available or ctx is canceled.
+	Block time.Duration
+
+	// MinIdle is the amount of time after which pending entries are claimed by
+	// the consumer. Zero disables claiming pending entries.
+	MinIdle time.Duration
+
+	// MaxDeliveries is the number of deliveries after which pending entries
+	// are considered dead letters. Zero means no limit.
+	MaxDeliveries int64
+
+	// DeadLetterStream, if not empty, is the stream to which dead letters are
+	// added. The entries are copied with the additional fields _stream, _group,
+	// _id, _consumer and _deliveries.
+	DeadLetterStream string
+
+	// ErrorLog specifies an optional logger for the errors returned by the
+	// handler, the entries then stay pending. If nil, errors are not logged.
+	ErrorLog Logger
+
+	deadLetters int64
+	claimStart  string
+}
+
+// Run reads the entries of the stream and passes them to handler until ctx
+// is canceled, in which case the context error is returned. Any other error
+// occurring while reading or acknowledging entries stops the consumer and is
+// returned.
+//
+// The consumer first processes the entries that were delivered to it but
+// never acknowledged, for example because a previous run was interrupted.
+func (c *Consumer) Run(ctx context.Context, handler func(context.Context, XMessage) error) error {
+	client := c.client()
+
+	if err := client.XGroupCreate(ctx, c.Stream, c.Group, "0", true); err != nil && !isBusyGroup(err) {
+		return err
+	}
+
+	var (
+		id        = "0" // start with the history of pending entries
+		lastClaim time.Time
+	)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if c.MinIdle > 0 && time.Since(lastClaim) >= c.MinIdle {
+			lastClaim = time.Now()
+
+			if err := c.claim(ctx, client, handler); err != nil {
+				return c.stop(ctx, err)
+			}
+		}
+
+		streams, err := client.XReadGroup(ctx, XReadGroupArgs{
+			Group:    c.Group,
+			Consumer: c.Name,
+			Streams:  []string{c.Stream},
+			IDs:      []string{id},
+			Count:    c.count(),
+			Block:    c.block(),
+		})
+		switch err {
+		case nil:
+		case ErrNil:
+			continue
+		default:
+			return c.stop(ctx, err)
+		}
+
+		n := 0
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				if err := c.handle(ctx, client, handler, msg); err != nil {
+					return c.stop(ctx, err)
+				}
+
+				if id != ">" {
+					id = msg.ID
+				}
+				n++
+			}
+		}
+
+		if n == 0 && id != ">" {
+			id = ">" // done with the history, read new entries
+		}
+	}
+}
+
+// DeadLetters returns the number of dead letters removed from the group by
+// the consumer.
+func (c *Consumer) DeadLetters() int64 {
+	return atomic.LoadInt64(&c.deadLetters)
+}
+
+func (c *Consumer) handle(ctx context.Context, client *Client, handler func(context.Context, XMessage) error, msg XMessage) error {
+	// Entries deleted from the stream while pending have no values, there is
+	// nothing left to process.
+	if msg.Values != nil {
+		if err := handler(ctx, msg); err != nil {
+			if c.ErrorLog != nil {
+				c.ErrorLog.Print(fmt.Sprintf("redis: consumer %s of group %s failed to handle entry %s of stream %s: %s", c.Name, c.Group, msg.ID, c.Stream, err))
+			}
+			return nil // stays pending, claimed again later
+		}
+	}
+
+	_, err := client.XAck(ctx, c.Stream, c.Group, msg.ID)
+	return err
+}
+
+func (c *Consumer) claim(ctx context.Context, client *Client, handler func(context.Context, XMessage) error) error {
+	if c.MaxDeliveries > 0 {
+		pending, err := client.XPendingExt(ctx, XPendingExtArgs{
+			Stream: c.Stream,
+			Group:  c.Group,
+			Idle:   c.MinIdle,
+			Count:  c.count(),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, p := range pending {
+			if p.RetryCount >= c.MaxDeliveries {
+				if err := c.deadLetter(ctx, client, p); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	next, msgs, err := client.XAutoClaim(ctx, XAutoClaimArgs{
+		Stream:   c.Stream,
+		Group:    c.Group,
+		Consumer: c.Name,
+		MinIdle:  c.MinIdle,
+		Start:    c.claimStart,
+		Count:    c.count(),
+	})
+	if err != nil {
+		return err
+	}
+	c.claimStart = next
+
+	for _, msg := range msgs {
+		if err := c.handle(ctx, client, handler, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, client *Client, p XPendingEntry) error {
+	if len(c.DeadLetterStream) != 0 {
+		msgs, err := client.XRangeN(ctx, c.Stream, p.ID, p.ID, 1)
+		if err != nil {
+			return err
+		}
+
+		var values map[string]string
+		if len(msgs) != 0 {
+			values = msgs[0].Values
+		}
+
+		if _, err := client.XAdd(ctx, c.DeadLetterStream, "", values,
+			"_stream", c.Stream,
+			"_group", c.Group,
+			"_id", p.ID,
+			"_consumer", p.Consumer,
+			"_deliveries", strconv.FormatInt(p.RetryCount, 10),
+		); err != nil {
+			return err
+		}
+	}
+
+	if _, err := client.XAck(ctx, c.Stream, c.Group, p.ID); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&c.deadLetters, 1)
+	return nil
+}
+
+func (c *Consumer) stop(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func (c *Consumer) client() *Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return DefaultClient
+}
+
+func (c *Consumer) count() int64 {
+	if c.Count > 0 {
+		return c.Count
+	}
+	return 10
+}
+
+func (c *Consumer) block() time.Duration {
+	if c.Block > 0 || c.Block == BlockForever {
+		return c.Block
+	}
+	return 5 * time.Second
+}
+
+func isBusyGroup(err error) bool {
+	e, ok := err.(*resp.Error)
+	return ok && e.Type() == "BUSYGROUP"
+}
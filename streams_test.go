@@ -0,0 +1,347 @@
+package redis_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
+)
+
+// fakeStream is a minimal in-memory implementation of a redis stream with a
+// single consumer group, it serves the commands issued by redis.Consumer.
+type fakeStream struct {
+	mutex      sync.Mutex
+	entries    []redis.XMessage
+	next       int
+	pending    map[string]int64
+	acked      []string
+	deadLetter []map[string]string
+}
+
+func (s *fakeStream) ServeRedis(res redis.ResponseWriter, req *redis.Request) {
+	var args []string
+	req.Cmds[0].ParseArgs(&args)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch req.Cmds[0].Cmd {
+	case "XGROUP":
+		res.Write("OK")
+
+	case "XREADGROUP":
+		id := args[len(args)-1]
+		stream := args[len(args)-2]
+
+		if id != ">" {
+			res.Write([]interface{}{[]interface{}{stream, []interface{}{}}})
+			return
+		}
+
+		if s.next == len(s.entries) {
+			res.Write(nil)
+			return
+		}
+
+		msg := s.entries[s.next]
+		s.next++
+		s.pending[msg.ID]++
+		res.Write([]interface{}{[]interface{}{stream, []interface{}{s.reply(msg)}}})
+
+	case "XACK":
+		for _, id := range args[2:] {
+			delete(s.pending, id)
+			s.acked = append(s.acked, id)
+		}
+		res.Write(len(args) - 2)
+
+	case "XPENDING":
+		list := []interface{}{}
+		for _, msg := range s.entries {
+			if n, ok := s.pending[msg.ID]; ok {
+				list = append(list, []interface{}{msg.ID, "c1", 100, n})
+			}
+		}
+		res.Write(list)
+
+	case "XAUTOCLAIM":
+		list := []interface{}{}
+		for _, msg := range s.entries {
+			if _, ok := s.pending[msg.ID]; ok {
+				s.pending[msg.ID]++
+				list = append(list, s.reply(msg))
+			}
+		}
+		res.Write([]interface{}{"0-0", list, []interface{}{}})
+
+	case "XRANGE":
+		for _, msg := range s.entries {
+			if msg.ID == args[1] {
+				res.Write([]interface{}{s.reply(msg)})
+				return
+			}
+		}
+		res.Write([]interface{}{})
+
+	case "XADD":
+		values := map[string]string{}
+		for i := 2; i < len(args); i += 2 {
+			values[args[i]] = args[i+1]
+		}
+		s.deadLetter = append(s.deadLetter, values)
+		res.Write("1-0")
+
+	default:
+		res.Write(errors.New("ERR unknown command " + req.Cmds[0].Cmd))
+	}
+}
+
+func (s *fakeStream) reply(msg redis.XMessage) []interface{} {
+	values := []interface{}{}
+	for k, v := range msg.Values {
+		values = append(values, k, v)
+	}
+	return []interface{}{msg.ID, values}
+}
+
+func TestStreamsXAddAndXRange(t *testing.T) {
+	it := assert.New(t)
+
+	var cmds [][]string
+
+	srv, addr := redistest.FakeServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var args []string
+		req.Cmds[0].ParseArgs(&args)
+		cmds = append(cmds, append([]string{req.Cmds[0].Cmd}, args...))
+
+		switch req.Cmds[0].Cmd {
+		case "XADD":
+			res.Write("1-0")
+
+		case "XRANGE", "XREVRANGE":
+			res.Write([]interface{}{
+				[]interface{}{"1-0", []interface{}{"a", "1"}},
+				[]interface{}{"2-0", []interface{}{"b", "2"}},
+			})
+
+		case "XREAD":
+			res.Write([]interface{}{
+				[]interface{}{"s1", []interface{}{[]interface{}{"1-0", []interface{}{"a", "1"}}}},
+			})
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr, Timeout: time.Second}
+	ctx := context.Background()
+
+	id, err := client.XAdd(ctx, "s1", "", map[string]string{"a": "1"})
+	if it.Nil(err) {
+		it.Equal("1-0", id)
+	}
+
+	msgs, err := client.XRange(ctx, "s1", "-", "+")
+	if it.Nil(err) {
+		it.Equal([]redis.XMessage{
+			{ID: "1-0", Values: map[string]string{"a": "1"}},
+			{ID: "2-0", Values: map[string]string{"b": "2"}},
+		}, msgs)
+	}
+
+	streams, err := client.XRead(ctx, redis.XReadArgs{Streams: []string{"s1"}, IDs: []string{"0"}, Count: 10})
+	if it.Nil(err) {
+		it.Equal([]redis.XStream{
+			{Stream: "s1", Messages: []redis.XMessage{{ID: "1-0", Values: map[string]string{"a": "1"}}}},
+		}, streams)
+	}
+
+	_, err = client.XRead(ctx, redis.XReadArgs{Streams: []string{"s1", "s2"}, IDs: []string{"0"}})
+	it.NotNil(err)
+
+	it.Equal([][]string{
+		{"XADD", "s1", "*", "a", "1"},
+		{"XRANGE", "s1", "-", "+"},
+		{"XREAD", "COUNT", "10", "STREAMS", "s1", "0"},
+	}, cmds)
+}
+
+func TestStreamsBlockingRead(t *testing.T) {
+	srv, addr := redistest.FakeServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		var args []string
+		req.Cmds[0].ParseArgs(&args)
+
+		switch req.Cmds[0].Cmd {
+		case "XREAD":
+			ms, _ := strconv.Atoi(args[1])
+			if ms == 0 {
+				ms = 100 // longer than the client timeout
+			}
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			res.Write(nil)
+
+		default:
+			res.Write("OK")
+		}
+	}))
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr, Timeout: 50 * time.Millisecond}
+
+	t.Run("the client timeout is extended by the block duration", func(t *testing.T) {
+		it := assert.New(t)
+
+		_, err := client.XRead(context.Background(), redis.XReadArgs{
+			Streams: []string{"s1"},
+			Block:   200 * time.Millisecond,
+		})
+		it.Equal(redis.ErrNil, err)
+	})
+
+	t.Run("BlockForever sends BLOCK 0 and disables the client timeout", func(t *testing.T) {
+		it := assert.New(t)
+
+		_, err := client.XRead(context.Background(), redis.XReadArgs{
+			Streams: []string{"s1"},
+			Block:   redis.BlockForever,
+		})
+		it.Equal(redis.ErrNil, err)
+	})
+
+	t.Run("the context cancels blocking reads", func(t *testing.T) {
+		it := assert.New(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+
+		_, err := client.XRead(ctx, redis.XReadArgs{
+			Streams: []string{"s1"},
+			Block:   time.Second,
+		})
+		it.NotNil(err)
+		it.True(time.Since(start) < 500*time.Millisecond)
+	})
+
+	t.Run("regular requests are not queued behind blocking reads", func(t *testing.T) {
+		it := assert.New(t)
+
+		done := make(chan struct{})
+		go func() {
+			client.XRead(context.Background(), redis.XReadArgs{
+				Streams: []string{"s1"},
+				Block:   300 * time.Millisecond,
+			})
+			close(done)
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		it.Nil(client.Exec(context.Background(), "SET", "a", "1"))
+
+		<-done
+	})
+}
+
+func TestStreamsConsumer(t *testing.T) {
+	it := assert.New(t)
+
+	stream := &fakeStream{
+		entries: []redis.XMessage{
+			{ID: "1-0", Values: map[string]string{"n": "1"}},
+			{ID: "2-0", Values: map[string]string{"n": "2"}},
+			{ID: "3-0", Values: map[string]string{"n": "3"}},
+		},
+		pending: map[string]int64{},
+	}
+
+	srv, addr := redistest.FakeServer(stream)
+	defer srv.Close()
+
+	tr := &redis.Transport{}
+	defer tr.CloseIdleConnections()
+
+	var errlog bytes.Buffer
+
+	consumer := &redis.Consumer{
+		Client:           &redis.Client{Addr: addr, Transport: tr, Timeout: time.Second},
+		ErrorLog:         log.New(&errlog, "", 0),
+		Stream:           "s1",
+		Group:            "g1",
+		Name:             "c1",
+		Block:            10 * time.Millisecond,
+		MinIdle:          10 * time.Millisecond,
+		MaxDeliveries:    3,
+		DeadLetterStream: "s1:dead",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mutex   sync.Mutex
+		handled []string
+	)
+
+	errch := make(chan error, 1)
+	go func() {
+		errch <- consumer.Run(ctx, func(ctx context.Context, msg redis.XMessage) error {
+			mutex.Lock()
+			handled = append(handled, msg.ID)
+			mutex.Unlock()
+
+			if msg.ID == "2-0" {
+				return errors.New("cannot process entry")
+			}
+			return nil
+		})
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for consumer.DeadLetters() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	it.Equal(context.Canceled, <-errch)
+
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	it.Equal(int64(1), consumer.DeadLetters())
+	it.Equal([]string{"1-0", "3-0", "2-0"}, stream.acked)
+	it.Empty(stream.pending)
+
+	if it.Len(stream.deadLetter, 1) {
+		it.Equal(map[string]string{
+			"n":           "2",
+			"_stream":     "s1",
+			"_group":      "g1",
+			"_id":         "2-0",
+			"_consumer":   "c1",
+			"_deliveries": "3",
+		}, stream.deadLetter[0])
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	it.Equal([]string{"1-0", "2-0", "3-0", "2-0", "2-0"}, handled)
+
+	it.Equal(strings.Repeat("redis: consumer c1 of group g1 failed to handle entry 2-0 of stream s1: cannot process entry\n", 3), errlog.String())
+}
@@ -74,11 +74,65 @@ func (sub *SubConn) WriteCommand(command string, channels ...string) (err error)
 }
 
 // ReadMessage reads the stream of PUB/SUB messages from the connection and
-// returns the channel and payload of the first message it received.
+// returns the channel and payload of the first message it received, including
+// the messages received on the patterns that the connection subscribed to.
 //
 // The program is expected to call ReadMessage in a loop to consume messages
 // from the PUB/SUB channels that the connection was subscribed to.
 func (sub *SubConn) ReadMessage() (channel string, message []byte, err error) {
+	for {
+		var payload interface{}
+
+		if channel, payload, err = sub.readMessage(); err != nil {
+			return
+		}
+
+		if message, _ = payload.([]byte); message != nil {
+			return
+		}
+	}
+}
+
+// ReadInvalidation reads the next invalidation message of client-side caching
+// from the connection, which must be subscribed to __redis__:invalidate. The
+// messages of other channels are skipped. It returns the list of invalidated
+// keys, which is nil when all keys are invalidated.
+func (sub *SubConn) ReadInvalidation() (keys []string, err error) {
+	for {
+		var (
+			channel string
+			payload interface{}
+		)
+
+		if channel, payload, err = sub.readMessage(); err != nil {
+			return
+		}
+
+		if channel != invalidateChannel {
+			continue
+		}
+
+		if payload == nil {
+			return nil, nil
+		}
+
+		list, _ := payload.([]interface{})
+		keys = make([]string, 0, len(list))
+
+		for _, key := range list {
+			if b, ok := key.([]byte); ok {
+				keys = append(keys, string(b))
+			}
+		}
+
+		return keys, nil
+	}
+}
+
+// readMessage is like ReadMessage but returns the payload of messages as they
+// were decoded, the invalidation messages of client-side caching carry arrays
+// of keys.
+func (sub *SubConn) readMessage() (channel string, payload interface{}, err error) {
 	defer sub.rmtx.Unlock()
 	sub.rmtx.Lock()
 
@@ -90,25 +144,60 @@ func (sub *SubConn) ReadMessage() (channel string, message []byte, err error) {
 			return
 		}
 
+		// Messages received on patterns are prefixed with the pattern.
+		if len(args) == 4 {
+			if kind, _ := args[0].([]byte); string(kind) == "pmessage" {
+				args = []interface{}{[]byte("message"), args[2], args[3]}
+			}
+		}
+
 		if len(args) != 3 {
 			continue
 		}
 
 		arg0, _ := args[0].([]byte)
 		arg1, _ := args[1].([]byte)
-		arg2, _ := args[2].([]byte)
 
-		if arg0 == nil || arg1 == nil || arg2 == nil {
+		if arg0 == nil || arg1 == nil {
 			continue
 		}
 
 		if string(arg0) == "message" {
-			channel, message = string(arg1), arg2
+			channel, payload = string(arg1), args[2]
 			return
 		}
 	}
 }
 
+// do sends a command to the connection and returns its reply, it is used to
+// set up connections before they switch to PUB/SUB mode.
+func (sub *SubConn) do(args ...interface{}) (reply interface{}, err error) {
+	cmd := make([][]byte, len(args))
+	for i, arg := range args {
+		cmd[i] = []byte(fmt.Sprint(arg))
+	}
+
+	sub.wmtx.Lock()
+	if err = sub.enc.Encode(cmd); err == nil {
+		err = sub.wbuf.Flush()
+	}
+	sub.wmtx.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	sub.rmtx.Lock()
+	err = sub.dec.Decode(&reply)
+	sub.rmtx.Unlock()
+
+	if e, ok := reply.(error); ok && err == nil {
+		err = e
+	}
+
+	return
+}
+
 // Close closes the connection, writing commands or reading messages from the
 // connection after Close was called will return errors.
 func (sub *SubConn) Close() error {
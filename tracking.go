@@ -0,0 +1,579 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connContextKey is the context key of the connection serving a request.
+var connContextKey = &contextKey{"conn"}
+
+// trackingTable records the keys read by the clients of a server which
+// enabled CLIENT TRACKING, so the server can send them invalidation messages
+// when handlers report that the keys changed.
+type trackingTable struct {
+	mutex    sync.Mutex
+	clients  map[uint64]*trackingClient
+	keys     map[string]map[*trackingClient]struct{}
+	nclients int32
+}
+
+// trackingClient is the tracking state of a client, guarded by the mutex of
+// the table.
+type trackingClient struct {
+	id       uint64
+	redirect uint64
+	bcast    bool
+	prefixes []string
+	optin    bool
+	optout   bool
+	noloop   bool
+	keys     map[string]struct{}
+
+	// conn is the connection of the client if it speaks RESP3, the
+	// invalidation messages are pushed to it when there is no redirect.
+	conn *Conn
+
+	// caching is set by CLIENT CACHING for the next request of the client.
+	caching    bool
+	hasCaching bool
+}
+
+// tracked returns true if the server has clients with tracking enabled.
+func (s *Server) tracked() bool {
+	return atomic.LoadInt32(&s.tracking.nclients) != 0
+}
+
+// clientTracking answers CLIENT TRACKING on|off [REDIRECT id] [PREFIX prefix
+// ...] [BCAST] [OPTIN] [OPTOUT] [NOLOOP].
+//
+// The invalidation messages are delivered to the connection with the REDIRECT
+// id, which must be subscribed to the __redis__:invalidate channel of the
+// PubSub broker of the server. Clients which switched to RESP3 with HELLO 3 may
+// omit REDIRECT to receive them as push messages on their own connection, they
+// are sent a tracking-redir-broken push message when their redirect client
+// disconnects.
+func (s *Server) clientTracking(c *Conn, args []string) interface{} {
+	if len(args) == 0 {
+		return errorf("ERR wrong number of arguments for 'client|tracking' command")
+	}
+
+	var on bool
+
+	switch strings.ToUpper(args[0]) {
+	case "ON":
+		on = true
+	case "OFF":
+	default:
+		return errorf("ERR syntax error")
+	}
+
+	id := c.clientID()
+	client := &trackingClient{id: id}
+
+	if c.resp3 {
+		client.conn = c
+	}
+
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REDIRECT":
+			if i++; i == len(args) {
+				return errorf("ERR syntax error")
+			}
+
+			redirect, err := strconv.ParseUint(args[i], 10, 64)
+			if err != nil {
+				return errorf("ERR value is not an integer or out of range")
+			}
+
+			client.redirect = redirect
+
+		case "PREFIX":
+			if i++; i == len(args) {
+				return errorf("ERR syntax error")
+			}
+			client.prefixes = append(client.prefixes, args[i])
+
+		case "BCAST":
+			client.bcast = true
+
+		case "OPTIN":
+			client.optin = true
+
+		case "OPTOUT":
+			client.optout = true
+
+		case "NOLOOP":
+			client.noloop = true
+
+		default:
+			return errorf("ERR syntax error")
+		}
+	}
+
+	if !on {
+		s.tracking.remove(id)
+		return "OK"
+	}
+
+	switch {
+	case client.redirect == 0 && client.conn == nil:
+		return errorf("ERR client tracking without REDIRECT requires RESP3, switch protocols with HELLO 3")
+
+	case client.redirect != 0 && s.PubSub == nil:
+		return errorf("ERR client tracking with REDIRECT requires the server to have a Pub/Sub broker")
+
+	case client.redirect != 0 && client.redirect != id && !s.hasClient(client.redirect):
+		return errorf("ERR The client ID you want redirect to does not exist")
+
+	case len(client.prefixes) != 0 && !client.bcast:
+		return errorf("ERR PREFIX option requires BCAST mode to be enabled")
+
+	case client.bcast && (client.optin || client.optout):
+		return errorf("ERR OPTIN and OPTOUT are not compatible with BCAST")
+
+	case client.optin && client.optout:
+		return errorf("ERR You can't use both OPTIN and OPTOUT")
+	}
+
+	if err := s.tracking.enable(client); err != nil {
+		return err
+	}
+
+	return "OK"
+}
+
+// clientCaching answers CLIENT CACHING yes|no.
+func (s *Server) clientCaching(c *Conn, arg string) interface{} {
+	var caching bool
+
+	switch strings.ToUpper(arg) {
+	case "YES":
+		caching = true
+	case "NO":
+	default:
+		return errorf("ERR syntax error")
+	}
+
+	t := &s.tracking
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	client := t.clients[c.clientID()]
+
+	switch {
+	case client == nil || !(client.optin || client.optout):
+		return errorf("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+	case caching && !client.optin:
+		return errorf("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+	case !caching && !client.optout:
+		return errorf("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+	}
+
+	client.caching, client.hasCaching = caching, true
+	return "OK"
+}
+
+// clientGetRedir answers CLIENT GETREDIR, it returns the client that the
+// invalidation messages of c are redirected to, or -1 if tracking is off.
+func (s *Server) clientGetRedir(c *Conn) interface{} {
+	t := &s.tracking
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if client := t.clients[c.clientID()]; client != nil {
+		return int64(client.redirect)
+	}
+
+	return int64(-1)
+}
+
+// redirectBroken sends the tracking-redir-broken push message to the RESP3
+// clients which redirected their invalidation messages to the client with id,
+// which disconnected.
+func (s *Server) redirectBroken(id uint64) {
+	t := &s.tracking
+	t.mutex.Lock()
+
+	var conns []*Conn
+
+	for _, client := range t.clients {
+		if client.redirect == id && client.conn != nil {
+			conns = append(conns, client.conn)
+		}
+	}
+
+	t.mutex.Unlock()
+
+	if len(conns) == 0 {
+		return
+	}
+
+	b := make([]byte, 0, 64)
+	b = append(b, ">2\r\n"...)
+	b = appendBulkString(b, "tracking-redir-broken")
+	b = append(b, ':')
+	b = strconv.AppendUint(b, id, 10)
+	b = append(b, '\r', '\n')
+
+	timeout := s.writeTimeout()
+
+	for _, c := range conns {
+		c.push(b, timeout)
+	}
+}
+
+func (s *Server) hasClient(id uint64) bool {
+	for _, c := range s.clientConns() {
+		if c.clientID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// enable sets the tracking state of a client, the keys tracked by the client
+// are kept when it was already enabled.
+func (t *trackingTable) enable(client *trackingClient) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	prev := t.clients[client.id]
+
+	if prev != nil {
+		if prev.bcast != client.bcast {
+			return errorf("ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode.")
+		}
+		client.prefixes = append(prev.prefixes, client.prefixes...)
+	}
+
+	if client.bcast && len(client.prefixes) == 0 {
+		client.prefixes = []string{""}
+	}
+
+	for i, p1 := range client.prefixes {
+		for _, p2 := range client.prefixes[i+1:] {
+			if p1 != p2 && (strings.HasPrefix(p1, p2) || strings.HasPrefix(p2, p1)) {
+				return errorf("ERR Prefix '%s' overlaps with another provided prefix '%s'. Prefixes for a single client must not overlap.", p1, p2)
+			}
+		}
+	}
+
+	if t.clients == nil {
+		t.clients = make(map[uint64]*trackingClient)
+		t.keys = make(map[string]map[*trackingClient]struct{})
+	}
+
+	if prev != nil {
+		// The keys tracked by the previous state are moved to the new one.
+		client.keys = prev.keys
+		for key := range client.keys {
+			delete(t.keys[key], prev)
+			t.keys[key][client] = struct{}{}
+		}
+	} else {
+		atomic.AddInt32(&t.nclients, 1)
+	}
+
+	t.clients[client.id] = client
+	return nil
+}
+
+// remove disables the tracking of the client with id.
+func (t *trackingTable) remove(id uint64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	client := t.clients[id]
+	if client == nil {
+		return
+	}
+
+	for key := range client.keys {
+		t.untrack(key, client)
+	}
+
+	delete(t.clients, id)
+	atomic.AddInt32(&t.nclients, -1)
+}
+
+func (t *trackingTable) untrack(key string, client *trackingClient) {
+	if clients := t.keys[key]; clients != nil {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(t.keys, key)
+		}
+	}
+}
+
+// trackReads records the keys read by cmds for the client of c, if it enabled
+// tracking. It is called before the commands are served, so the changes made
+// to the keys after they were read always cause invalidation messages.
+func (s *Server) trackReads(c *Conn, cmds []Command) {
+	t := &s.tracking
+	id := c.clientID()
+
+	t.mutex.Lock()
+	client := t.clients[id]
+
+	track := false
+	if client != nil && !client.bcast {
+		switch {
+		case client.optin:
+			track = client.hasCaching && client.caching
+		case client.optout:
+			track = !client.hasCaching || client.caching
+		default:
+			track = true
+		}
+
+		// CLIENT CACHING only applies to the next request.
+		client.hasCaching = false
+	}
+
+	t.mutex.Unlock()
+
+	if !track {
+		return
+	}
+
+	var keys []string
+
+	for i := range cmds {
+		info := LookupCommand(cmds[i].Cmd)
+		if info == nil || !info.HasFlag("readonly") {
+			continue
+		}
+
+		cmds[i].loadByteArgs()
+
+		args, _ := cmds[i].Args.(*byteArgs)
+		if args == nil {
+			continue
+		}
+
+		// The commands with the wrong number of arguments are rejected by
+		// the handler, they don't read keys.
+		if n := len(args.args) + 1; (info.Arity > 0 && n != info.Arity) || n < -info.Arity {
+			continue
+		}
+
+		for _, j := range info.KeyIndexes(len(args.args)) {
+			keys = append(keys, string(args.args[j]))
+		}
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Tracking may have been disabled or changed while the arguments were
+	// loaded.
+	if client = t.clients[id]; client == nil || client.bcast {
+		return
+	}
+
+	if client.keys == nil {
+		client.keys = make(map[string]struct{})
+	}
+
+	for _, key := range keys {
+		clients := t.keys[key]
+		if clients == nil {
+			clients = make(map[*trackingClient]struct{})
+			t.keys[key] = clients
+		}
+		clients[client] = struct{}{}
+		client.keys[key] = struct{}{}
+	}
+}
+
+// InvalidateKeys sends invalidation messages for keys to the clients of the
+// server which are tracking them. Handlers call it after modifying keys, with
+// the package function InvalidateKeys, so the clients which enabled NOLOOP
+// don't receive the invalidations of their own writes; the method is meant to
+// report changes which are not made by clients, like keys expiring.
+//
+// In the default mode of tracking, the clients stop tracking the keys until
+// they read them again.
+func (s *Server) InvalidateKeys(keys ...string) {
+	s.invalidateKeys(nil, keys)
+}
+
+// InvalidateKeys sends invalidation messages for keys modified by the request
+// of ctx, see Server.InvalidateKeys. It does nothing if ctx is not the context
+// of a request.
+func InvalidateKeys(ctx context.Context, keys ...string) {
+	if s, _ := ctx.Value(ServerContextKey).(*Server); s != nil {
+		c, _ := ctx.Value(connContextKey).(*Conn)
+		s.invalidateKeys(c, keys)
+	}
+}
+
+// InvalidateAll sends the message invalidating all keys to the clients of the
+// server which enabled tracking, handlers call it when they flush the keys of
+// the server, and all the keys tracked by the clients are forgotten.
+func (s *Server) InvalidateAll() {
+	if !s.tracked() {
+		return
+	}
+
+	t := &s.tracking
+	t.mutex.Lock()
+
+	targets := make(map[invalidationTarget]struct{}, len(t.clients))
+
+	for _, client := range t.clients {
+		targets[client.target()] = struct{}{}
+		client.keys = nil
+	}
+
+	t.keys = make(map[string]map[*trackingClient]struct{})
+	t.mutex.Unlock()
+
+	for target := range targets {
+		s.sendInvalidation(target, nil)
+	}
+}
+
+func (s *Server) invalidateKeys(writer *Conn, keys []string) {
+	if !s.tracked() || len(keys) == 0 {
+		return
+	}
+
+	var writerID uint64
+	if writer != nil {
+		writerID = writer.clientID()
+	}
+
+	t := &s.tracking
+	t.mutex.Lock()
+
+	var (
+		targets []invalidationTarget
+		invalid = make(map[invalidationTarget][]string)
+		seen    = make(map[invalidationTarget]map[string]struct{})
+	)
+
+	notify := func(client *trackingClient, key string) {
+		if client.noloop && client.id == writerID {
+			return
+		}
+
+		target := client.target()
+
+		sent := seen[target]
+		if sent == nil {
+			sent = make(map[string]struct{})
+			seen[target] = sent
+			targets = append(targets, target)
+		}
+
+		if _, ok := sent[key]; !ok {
+			sent[key] = struct{}{}
+			invalid[target] = append(invalid[target], key)
+		}
+	}
+
+	for _, key := range keys {
+		for client := range t.keys[key] {
+			delete(client.keys, key)
+			notify(client, key)
+		}
+		delete(t.keys, key)
+
+		for _, client := range t.clients {
+			if client.bcast && hasAnyPrefix(key, client.prefixes) {
+				notify(client, key)
+			}
+		}
+	}
+
+	t.mutex.Unlock()
+
+	for _, target := range targets {
+		s.sendInvalidation(target, invalid[target])
+	}
+}
+
+// invalidationTarget is where the invalidation messages of a tracking client
+// are delivered, either pushed to conn or sent to the subscriber of
+// __redis__:invalidate on the connection of the client with the redirect id.
+type invalidationTarget struct {
+	redirect uint64
+	conn     *Conn
+}
+
+func (client *trackingClient) target() invalidationTarget {
+	if client.redirect == 0 {
+		return invalidationTarget{conn: client.conn}
+	}
+	return invalidationTarget{redirect: client.redirect}
+}
+
+// sendInvalidation sends the invalidation message of keys to target.
+func (s *Server) sendInvalidation(target invalidationTarget, keys []string) {
+	switch {
+	case target.conn != nil:
+		target.conn.push(formatInvalidationPush(keys), s.writeTimeout())
+	case s.PubSub != nil:
+		s.PubSub.sendTo(target.redirect, invalidateChannel, formatInvalidation(keys))
+	}
+}
+
+func (s *Server) writeTimeout() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.WriteTimeout
+}
+
+// formatInvalidation returns the invalidation message of keys, in the format
+// of the messages published on __redis__:invalidate in RESP2. A nil list of
+// keys invalidates all keys.
+func formatInvalidation(keys []string) []byte {
+	b := make([]byte, 0, 64)
+	b = append(b, "*3\r\n"...)
+	b = appendBulkString(b, "message")
+	b = appendBulkString(b, invalidateChannel)
+
+	if keys == nil {
+		return append(b, "$-1\r\n"...)
+	}
+
+	return appendInvalidatedKeys(b, keys)
+}
+
+// formatInvalidationPush returns the invalidation message of keys in the
+// format of the push messages of RESP3. A nil list of keys invalidates all
+// keys.
+func formatInvalidationPush(keys []string) []byte {
+	b := make([]byte, 0, 64)
+	b = append(b, ">2\r\n"...)
+	b = appendBulkString(b, "invalidate")
+
+	if keys == nil {
+		return append(b, "_\r\n"...)
+	}
+
+	return appendInvalidatedKeys(b, keys)
+}
+
+func appendInvalidatedKeys(b []byte, keys []string) []byte {
+	b = append(b, '*')
+	b = strconv.AppendInt(b, int64(len(keys)), 10)
+	b = append(b, '\r', '\n')
+
+	for _, key := range keys {
+		b = appendBulkString(b, key)
+	}
+
+	return b
+}
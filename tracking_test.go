@@ -0,0 +1,437 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golib/assert"
+
+	"github.com/dolab/objconv/resp"
+	redis "github.com/dolab/redis-go"
+)
+
+func TestServerTracking(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context, *redis.Server, string)
+	}{
+		{
+			scenario: "the keys read by a client are invalidated once when they change",
+			function: testServerTrackingDefault,
+		},
+		{
+			scenario: "clients in BCAST mode receive the invalidations of the keys matching their prefixes",
+			function: testServerTrackingBroadcast,
+		},
+		{
+			scenario: "clients in OPTIN and OPTOUT mode select the reads tracked with CLIENT CACHING",
+			function: testServerTrackingOptIn,
+		},
+		{
+			scenario: "clients in NOLOOP mode don't receive the invalidations of their own writes",
+			function: testServerTrackingNoLoop,
+		},
+		{
+			scenario: "clients in RESP3 receive the invalidations as push messages",
+			function: testServerTrackingPush,
+		},
+		{
+			scenario: "clients in RESP3 are told when their redirect client disconnects",
+			function: testServerTrackingRedirectBroken,
+		},
+		{
+			scenario: "the reads with the wrong number of arguments are not tracked",
+			function: testServerTrackingArity,
+		},
+		{
+			scenario: "invalid CLIENT TRACKING options are rejected",
+			function: testServerTrackingErrors,
+		},
+		{
+			scenario: "the CachingClient is invalidated by the server",
+			function: testServerTrackingCachingClient,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			srv := &redis.Server{
+				Handler:        &keyValueHandler{values: map[string]string{}},
+				PubSub:         &redis.PubSub{},
+				EnableBuiltins: true,
+			}
+			addr := startServer(t, srv)
+			defer srv.Close()
+
+			testFunc(t, ctx, srv, addr)
+		})
+	}
+}
+
+func testServerTrackingDefault(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	inv, id := dialInvalidations(t, srv, addr)
+	defer inv.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var (
+		status string
+		value  interface{}
+	)
+	it.Nil(conn.query(&status, "CLIENT", "TRACKING", "on", "REDIRECT", id))
+	it.Nil(conn.query(&value, "GET", "a"))
+	it.Nil(conn.query(&value, "MGET", "b", "c"))
+
+	var redirect int64
+	it.Nil(conn.query(&redirect, "CLIENT", "GETREDIR"))
+	it.Equal(id, redirect)
+
+	it.Nil(conn.query(&status, "SET", "c", "1"))
+	it.Equal([]string{"c"}, readInvalidation(t, inv))
+
+	// The key isn't tracked anymore until it is read again.
+	it.Nil(conn.query(&status, "SET", "c", "2"))
+	it.Nil(conn.query(&status, "SET", "a", "1"))
+	it.Equal([]string{"a"}, readInvalidation(t, inv))
+
+	srv.InvalidateAll()
+	it.Nil(readInvalidation(t, inv))
+
+	it.Nil(conn.query(&status, "CLIENT", "TRACKING", "off"))
+	it.Nil(conn.query(&redirect, "CLIENT", "GETREDIR"))
+	it.Equal(int64(-1), redirect)
+}
+
+func testServerTrackingBroadcast(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	inv, id := dialInvalidations(t, srv, addr)
+	defer inv.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var status string
+	it.Nil(conn.query(&status, "CLIENT", "TRACKING", "on", "REDIRECT", id, "BCAST", "PREFIX", "user:", "PREFIX", "session:"))
+
+	// The keys are invalidated without being read.
+	it.Nil(conn.query(&status, "SET", "other", "1"))
+	it.Nil(conn.query(&status, "SET", "user:1", "1"))
+	it.Equal([]string{"user:1"}, readInvalidation(t, inv))
+
+	it.Nil(conn.query(&status, "SET", "session:1", "1"))
+	it.Equal([]string{"session:1"}, readInvalidation(t, inv))
+
+	err := conn.query(&status, "CLIENT", "TRACKING", "on", "REDIRECT", id)
+	if it.NotNil(err) {
+		it.Contains(err.Error(), "You can't switch BCAST mode")
+	}
+}
+
+func testServerTrackingOptIn(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	inv, id := dialInvalidations(t, srv, addr)
+	defer inv.Close()
+
+	optin := dialClientConn(t, addr)
+	defer optin.Close()
+
+	optout := dialClientConn(t, addr)
+	defer optout.Close()
+
+	var (
+		status string
+		value  interface{}
+	)
+	it.Nil(optin.query(&status, "CLIENT", "TRACKING", "on", "REDIRECT", id, "OPTIN"))
+	it.Nil(optin.query(&value, "GET", "a"))
+	it.Nil(optin.query(&status, "CLIENT", "CACHING", "yes"))
+	it.Nil(optin.query(&value, "GET", "b"))
+
+	it.Nil(optout.query(&status, "CLIENT", "TRACKING", "on", "REDIRECT", id, "OPTOUT"))
+	it.Nil(optout.query(&value, "GET", "c"))
+	it.Nil(optout.query(&status, "CLIENT", "CACHING", "no"))
+	it.Nil(optout.query(&value, "GET", "d"))
+
+	err := optin.query(&status, "CLIENT", "CACHING", "no")
+	if it.NotNil(err) {
+		it.Equal("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.", err.Error())
+	}
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		it.Nil(optin.query(&status, "SET", key, "1"))
+	}
+
+	it.Equal([]string{"b"}, readInvalidation(t, inv))
+	it.Equal([]string{"c"}, readInvalidation(t, inv))
+}
+
+func testServerTrackingNoLoop(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	inv, id := dialInvalidations(t, srv, addr)
+	defer inv.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	other := dialClientConn(t, addr)
+	defer other.Close()
+
+	var (
+		status string
+		value  interface{}
+	)
+	it.Nil(conn.query(&status, "CLIENT", "TRACKING", "on", "REDIRECT", id, "NOLOOP"))
+	it.Nil(conn.query(&value, "MGET", "a", "b"))
+
+	it.Nil(conn.query(&status, "SET", "a", "1"))
+	it.Nil(other.query(&status, "SET", "b", "1"))
+	it.Equal([]string{"b"}, readInvalidation(t, inv))
+}
+
+func testServerTrackingPush(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	other := dialClientConn(t, addr)
+	defer other.Close()
+
+	var hello map[string]interface{}
+	it.Nil(conn.query(&hello, "HELLO", "3"))
+	it.Equal("3", fmt.Sprint(hello["proto"]))
+
+	var (
+		status string
+		value  interface{}
+	)
+	it.Nil(conn.query(&status, "CLIENT", "TRACKING", "on"))
+	it.Nil(conn.query(&value, "MGET", "a", "b"))
+
+	var redirect int64
+	it.Nil(conn.query(&redirect, "CLIENT", "GETREDIR"))
+	it.Equal(int64(0), redirect)
+
+	it.Nil(other.query(&status, "SET", "b", "1"))
+	msg := ">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\nb\r\n"
+	it.Equal(msg, readPush(t, conn, msg))
+
+	srv.InvalidateAll()
+	msg = ">2\r\n$10\r\ninvalidate\r\n_\r\n"
+	it.Equal(msg, readPush(t, conn, msg))
+
+	// The connection keeps serving requests between the push messages.
+	it.Nil(conn.query(&status, "PING"))
+	it.Equal("PONG", status)
+}
+
+func testServerTrackingRedirectBroken(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	inv, id := dialInvalidations(t, srv, addr)
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var (
+		hello  map[string]interface{}
+		status string
+	)
+	it.Nil(conn.query(&hello, "HELLO", "3"))
+	it.Nil(conn.query(&status, "CLIENT", "TRACKING", "on", "REDIRECT", id))
+
+	inv.Close()
+
+	msg := fmt.Sprintf(">2\r\n$21\r\ntracking-redir-broken\r\n:%d\r\n", id)
+	it.Equal(msg, readPush(t, conn, msg))
+}
+
+func testServerTrackingArity(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var id int64
+	it.Nil(conn.query(&id, "CLIENT", "ID"))
+
+	var status string
+	it.Nil(conn.query(&status, "CLIENT", "TRACKING", "on", "REDIRECT", id))
+
+	for _, cmd := range []string{"OBJECT", "BLPOP", "XINFO"} {
+		it.NotNil(conn.query(&status, cmd), cmd)
+	}
+
+	it.Nil(conn.query(&status, "PING"))
+	it.Equal("PONG", status)
+}
+
+func testServerTrackingErrors(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	tests := []struct {
+		args []interface{}
+		err  string
+	}{
+		{
+			args: []interface{}{"TRACKING", "on"},
+			err:  "ERR client tracking without REDIRECT requires RESP3, switch protocols with HELLO 3",
+		},
+		{
+			args: []interface{}{"TRACKING", "on", "REDIRECT", 1000},
+			err:  "ERR The client ID you want redirect to does not exist",
+		},
+		{
+			args: []interface{}{"TRACKING", "on", "REDIRECT", 1, "PREFIX", "a"},
+			err:  "ERR PREFIX option requires BCAST mode to be enabled",
+		},
+		{
+			args: []interface{}{"TRACKING", "on", "REDIRECT", 1, "OPTIN", "OPTOUT"},
+			err:  "ERR You can't use both OPTIN and OPTOUT",
+		},
+		{
+			args: []interface{}{"TRACKING", "on", "REDIRECT", 1, "BCAST", "PREFIX", "a", "PREFIX", "ab"},
+			err:  "ERR Prefix 'a' overlaps with another provided prefix 'ab'. Prefixes for a single client must not overlap.",
+		},
+		{
+			args: []interface{}{"CACHING", "yes"},
+			err:  "ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled",
+		},
+	}
+
+	for _, test := range tests {
+		var status string
+		err := conn.query(&status, "CLIENT", test.args...)
+		if it.NotNil(err, test.args) {
+			it.Equal(test.err, err.Error())
+		}
+	}
+}
+
+func testServerTrackingCachingClient(t *testing.T, ctx context.Context, srv *redis.Server, addr string) {
+	it := assert.New(t)
+
+	client := &redis.CachingClient{Addr: addr, Transport: &redis.Transport{}}
+	defer client.Close()
+
+	conn := dialClientConn(t, addr)
+	defer conn.Close()
+
+	var status string
+	it.Nil(conn.query(&status, "SET", "key", "A"))
+
+	for i := 0; i != 2; i++ {
+		value, err := redis.String(client.Query(ctx, "GET", "key"))
+		it.Nil(err)
+		it.Equal("A", value)
+	}
+
+	it.Nil(conn.query(&status, "SET", "key", "B"))
+	waitCacheStats(t, client, func(stats redis.CacheStats) bool { return stats.Invalidations == 1 })
+
+	value, err := redis.String(client.Query(ctx, "GET", "key"))
+	it.Nil(err)
+	it.Equal("B", value)
+
+	stats := client.Stats()
+	it.Equal(int64(1), stats.Hits)
+	it.Equal(int64(2), stats.Misses)
+}
+
+// dialInvalidations opens a connection subscribed to __redis__:invalidate, it
+// returns the connection and its client ID.
+func dialInvalidations(t *testing.T, srv *redis.Server, addr string) (*redis.SubConn, int64) {
+	sub := dialSubConn(t, srv, addr, "SUBSCRIBE", "__redis__:invalidate")
+
+	for _, info := range srv.Connections() {
+		if info.Subscriptions == 1 {
+			return sub, int64(info.ID)
+		}
+	}
+
+	t.Fatal("the subscriber was not found")
+	return nil, 0
+}
+
+// readInvalidation reads the next invalidation message from sub, it returns
+// nil when all the keys are invalidated.
+func readInvalidation(t *testing.T, sub *redis.SubConn) []string {
+	sub.SetDeadline(time.Now().Add(2 * time.Second))
+
+	keys, err := sub.ReadInvalidation()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keys
+}
+
+// readPush reads a push message of the length of msg from conn.
+func readPush(t *testing.T, conn *clientConn, msg string) string {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	b := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+// keyValueHandler serves GET, MGET and SET on a map of values, SET reports the
+// keys it modifies with InvalidateKeys.
+type keyValueHandler struct {
+	mutex  sync.Mutex
+	values map[string]string
+}
+
+func (h *keyValueHandler) ServeRedis(w redis.ResponseWriter, r *redis.Request) {
+	var args []string
+	r.Cmds[0].ParseArgs(&args)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	switch r.Cmds[0].Cmd {
+	case "GET", "MGET":
+		values := make([]interface{}, len(args))
+		for i, key := range args {
+			if value, ok := h.values[key]; ok {
+				values[i] = value
+			}
+		}
+
+		if r.Cmds[0].Cmd == "GET" {
+			w.Write(values[0])
+		} else {
+			w.Write(values)
+		}
+
+	case "SET":
+		h.values[args[0]] = args[1]
+		redis.InvalidateKeys(r.Context, args[0])
+		w.Write("OK")
+
+	default:
+		w.Write(resp.NewError("ERR unknown command"))
+	}
+}
@@ -62,6 +62,12 @@ type RoundTripper interface {
 // many open connections when accessing many hosts. This behavior can be managed
 // using Transport's CloseIdleConnections method and ConnsPerHost field.
 //
+// Requests made of blocking commands (BLPOP, XREAD, XREADGROUP, ...) use
+// dedicated connections, which prevents long blocking reads from holding on
+// the connections that serve regular requests. They are limited by
+// MaxBlockingConnsPerHost instead of MaxConnsPerHost, so blocked readers never
+// make the regular requests wait.
+//
 // Transports should be reused instead of created as needed. Transports are safe
 // for concurrent use by multiple goroutines.
 //
@@ -80,6 +86,30 @@ type Transport struct {
 	// (keep-alive) connections to keep per-host. Zero means no limit.
 	MaxIdleConnsPerHost int
 
+	// MaxConnsPerHost, if non-zero, limits the total number of connections to
+	// each host, in use and idle. Requests made when the limit is reached wait
+	// in line for a connection to be released, or for their context to be done.
+	MaxConnsPerHost int
+
+	// MaxBlockingConnsPerHost, if non-zero, limits the number of connections
+	// to each host used for blocking commands, which don't count toward
+	// MaxConnsPerHost. Blocking requests made when the limit is reached wait
+	// in line like the regular ones. Zero means no limit.
+	MaxBlockingConnsPerHost int
+
+	// MinIdleConns is the number of idle connections that the transport tries
+	// to keep open to each host it has connected to. Zero means that no
+	// connections are dialed in advance.
+	MinIdleConns int
+
+	// MaxConnLifetime, if non-zero, is the maximum amount of time that a
+	// connection may be reused for.
+	MaxConnLifetime time.Duration
+
+	// IdleTimeout, if non-zero, is the maximum amount of time that a connection
+	// may remain idle before being closed.
+	IdleTimeout time.Duration
+
 	// PingInterval is the amount of time between pings that the transport sends
 	// to the hosts it connects to.
 	PingInterval time.Duration
@@ -100,6 +130,14 @@ func (t *Transport) CloseIdleConnections() {
 	t.pool.closeIdleConnections()
 }
 
+// FlushConnections closes the idle connections to addr, and the connections to
+// addr that are in use once they are released. It is typically called when the
+// server at addr changed roles, for example after a failover.
+func (t *Transport) FlushConnections(addr string) {
+	t.once.Do(t.init)
+	t.pool.flushConnections(addr)
+}
+
 // Subscribe uses the transport's configuration to open a connection to a redis
 // server that subscribes to the given channels.
 func (t *Transport) Subscribe(ctx context.Context, network string, address string, channels ...string) (*SubConn, error) {
@@ -169,23 +207,11 @@ func (t *Transport) RoundTrip(req *Request) (*Response, error) {
 		ctx = context.Background()
 	}
 
-	conn := t.pool.getConn(req.Addr)
-	if conn == nil {
-		network, address := splitNetworkAddress(req.Addr)
-
-		c, err := t.dialContext(ctx, network, address)
-		if err != nil {
-			if ctxErr := ctx.Err(); ctxErr != nil {
-				err = &net.OpError{
-					Op:  "dial",
-					Net: fmt.Sprintf("redis(%s, %s)", network, address),
-					Err: ctxErr,
-				}
-			}
+	pool := t.pool
 
-			return nil, err
-		}
-		conn = NewClientConn(c)
+	conn, err := pool.getConn(ctx, req.Addr, req.IsBlocking())
+	if err != nil {
+		return nil, err
 	}
 
 	var (
@@ -195,12 +221,9 @@ func (t *Transport) RoundTrip(req *Request) (*Response, error) {
 	)
 
 	go t.writeRequest(conn, req, errch)
-	go t.readResponse(conn, req, resch)
+	go t.readResponse(conn, req, pool, resch)
 
-	var (
-		res *Response
-		err error
-	)
+	var res *Response
 
 	select {
 	case res = <-resch:
@@ -214,7 +237,7 @@ func (t *Transport) RoundTrip(req *Request) (*Response, error) {
 		raddr = conn.RemoteAddr()
 	)
 	if err != nil {
-		conn.Close()
+		pool.discardConn(req.Addr, conn)
 
 		err = &net.OpError{Op: "request", Net: "redis", Source: laddr, Addr: raddr, Err: err}
 
@@ -236,19 +259,19 @@ func (t *Transport) writeRequest(conn *Conn, req *Request, errch chan<- error) {
 	}
 }
 
-func (t *Transport) readResponse(conn *Conn, req *Request, resch chan<- *Response) {
+func (t *Transport) readResponse(conn *Conn, req *Request, pool *connPool, resch chan<- *Response) {
 	var res *Response
 
 	if req.IsTransaction() {
-		res = t.readTransactionResponse(conn, req)
+		res = t.readTransactionResponse(conn, req, pool)
 	} else {
-		res = t.readSimpleResponse(conn, req)
+		res = t.readSimpleResponse(conn, req, pool)
 	}
 
 	resch <- res
 }
 
-func (t *Transport) readTransactionResponse(conn *Conn, req *Request) *Response {
+func (t *Transport) readTransactionResponse(conn *Conn, req *Request, pool *connPool) *Response {
 	args := conn.ReadTxArgs(len(req.Cmds) - 2)
 
 	return &Response{
@@ -256,7 +279,7 @@ func (t *Transport) readTransactionResponse(conn *Conn, req *Request) *Response
 			connPoolPutter: connPoolPutter{
 				host: req.Addr,
 				conn: conn,
-				pool: t.pool,
+				pool: pool,
 			},
 			TxArgs: args,
 		},
@@ -264,7 +287,7 @@ func (t *Transport) readTransactionResponse(conn *Conn, req *Request) *Response
 	}
 }
 
-func (t *Transport) readSimpleResponse(conn *Conn, req *Request) *Response {
+func (t *Transport) readSimpleResponse(conn *Conn, req *Request, pool *connPool) *Response {
 	args := conn.ReadArgs()
 
 	return &Response{
@@ -272,7 +295,7 @@ func (t *Transport) readSimpleResponse(conn *Conn, req *Request) *Response {
 			connPoolPutter: connPoolPutter{
 				host: req.Addr,
 				conn: conn,
-				pool: t.pool,
+				pool: pool,
 			},
 			Args: args,
 		},
@@ -285,6 +308,13 @@ func (t *Transport) init() {
 	pool := &connPool{
 		maxIdleConns:        t.MaxIdleConns,
 		maxIdleConnsPerHost: t.MaxIdleConnsPerHost,
+		maxConnsPerHost:     t.MaxConnsPerHost,
+		maxBlockingPerHost:  t.MaxBlockingConnsPerHost,
+		minIdleConns:        t.MinIdleConns,
+		maxConnLifetime:     t.MaxConnLifetime,
+		idleTimeout:         t.IdleTimeout,
+		dialTimeout:         t.pingTimeout(),
+		dial:                t.dial,
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -304,11 +334,54 @@ func (t *Transport) init() {
 		}
 	}(t.pingInterval(), t.pingTimeout())
 
+	if interval := t.evictInterval(); interval != 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+
+				pool.evictIdleConnections()
+			}
+		}()
+	}
+
 	runtime.SetFinalizer(pool, func(*connPool) { cancel() })
 
 	t.pool = pool
 }
 
+// Stats returns statistics about the connections of the transport, indexed by
+// host address.
+func (t *Transport) Stats() map[string]ConnStats {
+	t.once.Do(t.init)
+	return t.pool.stats()
+}
+
+func (t *Transport) dial(ctx context.Context, addr string) (*Conn, error) {
+	network, address := splitNetworkAddress(addr)
+
+	c, err := t.dialContext(ctx, network, address)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = &net.OpError{
+				Op:  "dial",
+				Net: fmt.Sprintf("redis(%s, %s)", network, address),
+				Err: ctxErr,
+			}
+		}
+
+		return nil, err
+	}
+
+	return NewClientConn(c), nil
+}
+
 func (t *Transport) dialContext(ctx context.Context, network string, address string) (net.Conn, error) {
 	dialContext := t.DialContext
 	if dialContext == nil {
@@ -333,6 +406,28 @@ func (t *Transport) pingInterval() time.Duration {
 	return 30 * time.Second
 }
 
+// evictInterval returns the interval at which the transport looks for idle
+// connections to evict or to dial, zero means that it doesn't need to.
+func (t *Transport) evictInterval() time.Duration {
+	var interval time.Duration
+
+	if t.MinIdleConns != 0 {
+		interval = t.pingInterval()
+	}
+
+	for _, timeout := range []time.Duration{t.MaxConnLifetime, t.IdleTimeout} {
+		if timeout /= 2; timeout != 0 && (interval == 0 || timeout < interval) {
+			interval = timeout
+		}
+	}
+
+	if interval != 0 && interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+
+	return interval
+}
+
 type connPoolPutter struct {
 	host string
 	conn *Conn
@@ -344,7 +439,7 @@ func (c *connPoolPutter) close(err error) error {
 	if err != nil {
 		if _, stable := err.(*resp.Error); !stable {
 			c.once.Do(func() {
-				c.conn.Close()
+				c.pool.discardConn(c.host, c.conn)
 			})
 		}
 	}
@@ -8,7 +8,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golib/assert"
+
 	redis "github.com/dolab/redis-go"
+	"github.com/dolab/redis-go/redistest"
 )
 
 func TestTransport(t *testing.T) {
@@ -151,3 +154,295 @@ func testTransportCancelRoundTrip(t *testing.T) {
 		t.Errorf("bad root cause of the error: %#v", e.Err)
 	}
 }
+
+func TestTransportConnectionLimits(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T, context.Context)
+	}{
+		{
+			scenario: "requests wait for connections when the limit per host is reached",
+			function: testTransportMaxConnsPerHost,
+		},
+		{
+			scenario: "requests waiting for connections time out with their context",
+			function: testTransportMaxConnsPerHostTimeout,
+		},
+		{
+			scenario: "blocked readers don't make regular requests wait",
+			function: testTransportMaxConnsPerHostBlocking,
+		},
+		{
+			scenario: "connections which expired while in use are not handed to waiters",
+			function: testTransportMaxConnsPerHostExpired,
+		},
+		{
+			scenario: "connections are closed when they reach their maximum lifetime",
+			function: testTransportMaxConnLifetime,
+		},
+		{
+			scenario: "idle connections are closed after the idle timeout",
+			function: testTransportIdleTimeout,
+		},
+		{
+			scenario: "idle connections are dialed in advance",
+			function: testTransportMinIdleConns,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			testFunc(t, ctx)
+		})
+	}
+}
+
+// newSlowServer starts a server which responds to SLOW and BLPOP requests once
+// a value is sent to the returned channel, and to other requests immediately.
+func newSlowServer() (*redis.Server, string, chan struct{}) {
+	release := make(chan struct{})
+
+	srv, addr := redistest.FakeServer(redis.HandlerFunc(func(res redis.ResponseWriter, req *redis.Request) {
+		if cmd := req.Cmds[0].Cmd; cmd == "SLOW" || cmd == "BLPOP" {
+			select {
+			case <-release:
+			case <-req.Context.Done():
+			}
+		}
+		res.Write("OK")
+	}))
+
+	return srv, addr, release
+}
+
+func testTransportMaxConnsPerHost(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, release := newSlowServer()
+	defer srv.Close()
+
+	tr := &redis.Transport{MaxConnsPerHost: 1}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr}
+
+	done := make(chan error, 2)
+	for i := 0; i != 2; i++ {
+		go func() { done <- client.Exec(ctx, "SLOW") }()
+	}
+
+	// waits for one request to be in flight and the other one to be waiting
+	for tr.Stats()[addr].WaitCount == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	stats := tr.Stats()[addr]
+	it.Equal(1, stats.MaxOpenConnections)
+	it.Equal(1, stats.OpenConnections)
+	it.Equal(1, stats.InUse)
+	it.EqualValues(1, stats.Dials)
+
+	release <- struct{}{}
+	release <- struct{}{}
+	it.Nil(<-done)
+	it.Nil(<-done)
+
+	stats = tr.Stats()[addr]
+	it.Equal(1, stats.OpenConnections)
+	it.Equal(1, stats.Idle)
+	it.Equal(0, stats.InUse)
+	it.EqualValues(1, stats.Dials)
+	it.EqualValues(1, stats.WaitCount)
+	it.True(stats.WaitDuration > 0)
+}
+
+func testTransportMaxConnsPerHostTimeout(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, release := newSlowServer()
+	defer srv.Close()
+
+	tr := &redis.Transport{MaxConnsPerHost: 1}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr}
+
+	done := make(chan error, 1)
+	go func() { done <- client.Exec(ctx, "SLOW") }()
+
+	for tr.Stats()[addr].InUse == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	it.Equal(context.DeadlineExceeded, client.Exec(timeout, "PING"))
+
+	stats := tr.Stats()[addr]
+	it.EqualValues(1, stats.WaitCount)
+	it.EqualValues(1, stats.Timeouts)
+
+	release <- struct{}{}
+	it.Nil(<-done)
+
+	// the connection is still usable after the waiter gave up
+	it.Nil(client.Exec(ctx, "PING"))
+	it.EqualValues(1, tr.Stats()[addr].Dials)
+}
+
+func testTransportMaxConnsPerHostBlocking(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, release := newSlowServer()
+	defer srv.Close()
+
+	tr := &redis.Transport{MaxConnsPerHost: 1, MaxBlockingConnsPerHost: 2}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr}
+
+	done := make(chan error, 3)
+	for i := 0; i != 3; i++ {
+		go func() { done <- client.Exec(ctx, "BLPOP", "list", 0) }()
+	}
+
+	// waits for two readers to be blocked and the third one to be waiting
+	for tr.Stats()[addr].WaitCount == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	stats := tr.Stats()[addr]
+	it.Equal(2, stats.MaxBlockingConnections)
+	it.Equal(2, stats.BlockingConnections)
+	it.Equal(2, stats.InUse)
+
+	// the blocked readers don't take the slot of the regular requests
+	it.Nil(client.Exec(ctx, "GET", "key"))
+
+	stats = tr.Stats()[addr]
+	it.Equal(3, stats.OpenConnections)
+	it.Equal(1, stats.Idle)
+	it.EqualValues(1, stats.WaitCount)
+
+	for i := 0; i != 3; i++ {
+		release <- struct{}{}
+	}
+	for i := 0; i != 3; i++ {
+		it.Nil(<-done)
+	}
+
+	stats = tr.Stats()[addr]
+	it.Equal(3, stats.OpenConnections)
+	it.Equal(2, stats.BlockingConnections)
+	it.EqualValues(3, stats.Dials)
+}
+
+func testTransportMaxConnsPerHostExpired(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, release := newSlowServer()
+	defer srv.Close()
+
+	tr := &redis.Transport{MaxConnsPerHost: 1, MaxConnLifetime: 20 * time.Millisecond}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr}
+
+	done := make(chan error, 2)
+	for i := 0; i != 2; i++ {
+		go func() { done <- client.Exec(ctx, "SLOW") }()
+	}
+
+	for tr.Stats()[addr].WaitCount == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	release <- struct{}{}
+	release <- struct{}{}
+	it.Nil(<-done)
+	it.Nil(<-done)
+
+	stats := tr.Stats()[addr]
+	it.EqualValues(2, stats.Dials)
+	it.EqualValues(1, stats.MaxLifetimeClosed)
+	it.Equal(1, stats.OpenConnections)
+}
+
+func testTransportMaxConnLifetime(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, _ := newSlowServer()
+	defer srv.Close()
+
+	tr := &redis.Transport{MaxConnLifetime: 20 * time.Millisecond}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr}
+
+	it.Nil(client.Exec(ctx, "PING"))
+	time.Sleep(50 * time.Millisecond)
+	it.Nil(client.Exec(ctx, "PING"))
+
+	stats := tr.Stats()[addr]
+	it.EqualValues(2, stats.Dials)
+	it.EqualValues(1, stats.MaxLifetimeClosed)
+	it.Equal(1, stats.OpenConnections)
+}
+
+func testTransportIdleTimeout(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, _ := newSlowServer()
+	defer srv.Close()
+
+	tr := &redis.Transport{IdleTimeout: 10 * time.Millisecond}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr}
+
+	it.Nil(client.Exec(ctx, "PING"))
+
+	// the connection is evicted in the background
+	for tr.Stats()[addr].OpenConnections != 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("the idle connection was never closed")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	it.EqualValues(1, tr.Stats()[addr].MaxIdleTimeClosed)
+}
+
+func testTransportMinIdleConns(t *testing.T, ctx context.Context) {
+	it := assert.New(t)
+
+	srv, addr, _ := newSlowServer()
+	defer srv.Close()
+
+	tr := &redis.Transport{MinIdleConns: 3}
+	defer tr.CloseIdleConnections()
+
+	client := &redis.Client{Addr: addr, Transport: tr}
+
+	it.Nil(client.Exec(ctx, "PING"))
+
+	for tr.Stats()[addr].Idle != 4 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("the idle connections were never dialed")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	it.EqualValues(4, tr.Stats()[addr].Dials)
+}